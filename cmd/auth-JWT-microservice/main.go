@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	_ "github.com/ShlykovPavel/auth-JWT-microservice/docs"
 	"github.com/ShlykovPavel/auth-JWT-microservice/internal/app"
@@ -25,7 +26,16 @@ const (
 // @in header
 // @name Authorization
 // @description Add "Bearer" before token
+//
+// Запуск:
+//
+//	auth-JWT-microservice                     - применить миграции и запустить сервер
+//	auth-JWT-microservice --migrate-only      - только применить миграции (init контейнер)
+//	auth-JWT-microservice migrate status      - команды миграций: up, down [N], status, force VERSION
 func main() {
+	migrateOnly := flag.Bool("migrate-only", false, "применить миграции и завершиться, не запуская сервер")
+	flag.Parse()
+
 	cfg, err := config.LoadConfig("secret_config.yaml")
 	if err != nil {
 		log.Fatal(err)
@@ -35,6 +45,18 @@ func main() {
 	logger.Info("Starting application")
 	logger.Debug("Debug messages enabled")
 
+	if *migrateOnly || flag.Arg(0) == "migrate" {
+		var args []string
+		if flag.Arg(0) == "migrate" {
+			args = flag.Args()[1:]
+		}
+		if err = app.Migrate(logger, cfg, args); err != nil {
+			logger.Error("Migration failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	application := app.NewApp(logger, cfg)
 	application.Run()
 }
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/breached_passwords"
+	"log/slog"
+	"os"
+)
+
+// Собирает bloom фильтр из сырого файла "Pwned Passwords" (строки "SHA1:COUNT").
+//
+// Пример:
+//
+//	go run ./cmd/build-breach-filter -input pwned-passwords-sha1-ordered-by-hash-v8.txt -output breached.bloom -min-count 10
+func main() {
+	input := flag.String("input", "", "путь к сырому файлу Pwned Passwords (SHA1:COUNT)")
+	output := flag.String("output", "breached.bloom", "путь к файлу фильтра")
+	minCount := flag.Uint("min-count", 1, "минимальное количество появлений пароля в утечках")
+	falsePositiveRate := flag.Float64("fp-rate", 0.001, "допустимая вероятность ложного срабатывания")
+	expected := flag.Uint64("expected", 0, "ожидаемое количество хешей. 0 - посчитать по входному файлу")
+	flag.Parse()
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	if *input == "" {
+		logger.Error("Flag -input is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// Размер фильтра зависит от количества элементов, поэтому при необходимости проходим файл дважды
+	if *expected == 0 {
+		file, err := os.Open(*input)
+		if err != nil {
+			logger.Error("Failed to open input file", "error", err)
+			os.Exit(1)
+		}
+		*expected, err = breached_passwords.CountEntries(file, uint32(*minCount))
+		file.Close()
+		if err != nil {
+			logger.Error("Failed to count entries", "error", err)
+			os.Exit(1)
+		}
+		logger.Info("Counted entries", slog.Uint64("entries", *expected))
+	}
+
+	file, err := os.Open(*input)
+	if err != nil {
+		logger.Error("Failed to open input file", "error", err)
+		os.Exit(1)
+	}
+	defer file.Close()
+
+	filter, err := breached_passwords.BuildBloomFilter(file, *expected, *falsePositiveRate, uint32(*minCount))
+	if err != nil {
+		logger.Error("Failed to build bloom filter", "error", err)
+		os.Exit(1)
+	}
+
+	out, err := os.Create(*output)
+	if err != nil {
+		logger.Error("Failed to create output file", "error", err)
+		os.Exit(1)
+	}
+	defer out.Close()
+	size, err := filter.WriteTo(out)
+	if err != nil {
+		logger.Error("Failed to write bloom filter", "error", err)
+		os.Exit(1)
+	}
+	logger.Info("Bloom filter built",
+		slog.String("output", *output),
+		slog.Uint64("items", filter.Items),
+		slog.Int64("bytes", size))
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/config"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/services"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/tenant"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/server/users/bulk"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/bulk_users_db"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// Массовый импорт и выгрузка пользователей без HTTP, напрямую в БД сервиса. Настройки БД берутся как у сервиса:
+// config.yaml, файл с секретами и переменные окружения.
+//
+// Примеры:
+//
+//	go run ./cmd/bulk-users import -format csv -password-mode reset -dry-run -input users.csv
+//	go run ./cmd/bulk-users import -format jsonl -password-mode hashed -org 3 < users.jsonl
+//	go run ./cmd/bulk-users export -format jsonl -output users.jsonl
+//
+// Отчёт импорта печатается в stdout в JSON. Код выхода 1, если хотя бы одна строка не загружена
+func main() {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	command, args := os.Args[1], os.Args[2:]
+	if command != "import" && command != "export" {
+		usage()
+		os.Exit(2)
+	}
+
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	configPath := flags.String("config", "secret_config.yaml", "файл с секретами, как у сервиса")
+	format := flags.String("format", "csv", "формат файла: csv или jsonl")
+	orgID := flags.Int64("org", tenant.DefaultOrgID, "id организации")
+	input := flags.String("input", "", "файл для импорта. Пусто - stdin")
+	output := flags.String("output", "", "файл выгрузки. Пусто - stdout")
+	passwordMode := flags.String("password-mode", "", "импорт: hashed (хеши из password_hash) или reset (пароль задаётся после первого входа)")
+	dryRun := flags.Bool("dry-run", false, "импорт: только проверить файл, ничего не записывая")
+	passwordHashes := flags.Bool("password-hashes", false, "выгрузка: выгрузить хеши паролей")
+	_ = flags.Parse(args)
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		logger.Error("Failed to load config", "error", err)
+		os.Exit(1)
+	}
+	if err = cfg.ValidateDb(); err != nil {
+		logger.Error("Invalid database config", "error", err)
+		os.Exit(1)
+	}
+	pool, err := database.CreatePool(context.Background(), &database.DbConfig{
+		DbName:              cfg.DbName,
+		DbUser:              cfg.DbUser,
+		DbPassword:          cfg.DbPassword,
+		DbHost:              cfg.DbHost,
+		DbPort:              cfg.DbPort,
+		DbMaxConnections:    cfg.DbMaxConnections,
+		DbMinConnections:    cfg.DbMinConnections,
+		DbMaxConnLifetime:   cfg.DbMaxConnLifetime,
+		DbMaxConnIdleTime:   cfg.DbMaxConnIdleTime,
+		DbHealthCheckPeriod: cfg.DbHealthCheckPeriod,
+	}, logger)
+	if err != nil {
+		logger.Error("Failed to create database pool", "error", err)
+		os.Exit(1)
+	}
+	defer pool.Close()
+
+	bulkService := services.NewBulkUsersService(bulk_users_db.NewBulkUsersRepository(pool, logger), cfg.BulkUsers.ImportBatchSize, logger)
+	ctx := tenant.WithOrgID(context.Background(), *orgID)
+
+	switch command {
+	case "import":
+		in := io.Reader(os.Stdin)
+		if *input != "" {
+			file, err := os.Open(*input)
+			if err != nil {
+				logger.Error("Failed to open input file", "error", err)
+				os.Exit(1)
+			}
+			defer file.Close()
+			in = file
+		}
+		report, err := bulkService.Import(ctx, in, services.ImportOptions{Format: *format, PasswordMode: *passwordMode, DryRun: *dryRun, GrantRoles: true})
+		printReport(report)
+		if err != nil {
+			logger.Error("Import failed", "error", err, slog.Int("imported", report.Imported))
+			os.Exit(1)
+		}
+		if report.Failed > 0 {
+			os.Exit(1)
+		}
+	case "export":
+		out := io.Writer(os.Stdout)
+		if *output != "" {
+			file, err := os.Create(*output)
+			if err != nil {
+				logger.Error("Failed to create output file", "error", err)
+				os.Exit(1)
+			}
+			defer file.Close()
+			out = file
+		}
+		count, err := bulkService.Export(ctx, out, *format, *passwordHashes)
+		if err != nil {
+			logger.Error("Export failed", "error", err, slog.Int("exported", count))
+			os.Exit(1)
+		}
+		logger.Info("Users exported", slog.Int("count", count))
+	}
+}
+
+func printReport(report services.ImportReport) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(bulk.ToImportReportResponse(report))
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: bulk-users import|export [flags]")
+	fmt.Fprintln(os.Stderr, "run 'bulk-users import -h' to list flags")
+}
@@ -2,16 +2,53 @@ package app
 
 import (
 	"context"
+	"fmt"
 	"github.com/ShlykovPavel/auth-JWT-microservice/internal/config"
 	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/middlewares"
 	validators "github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/validator"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/breached_passwords"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/mailer"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/message_sender"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/password_hasher"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/password_policy"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/permissions"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/policy"
 	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/services"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/user_metadata"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/server/audit"
+	authzHandlers "github.com/ShlykovPavel/auth-JWT-microservice/internal/server/authz"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/server/groups"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/server/invitations"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/server/orgs"
 	"github.com/ShlykovPavel/auth-JWT-microservice/internal/server/users/auth"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/server/users/bulk"
 	users "github.com/ShlykovPavel/auth-JWT-microservice/internal/server/users/create"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/server/users/directory"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/server/users/email"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/server/users/impersonation"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/server/users/lockout"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/server/users/password"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/server/users/phone"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/server/users/privacy"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/server/users/profile"
 	"github.com/ShlykovPavel/auth-JWT-microservice/internal/server/users/roles"
 	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/audit_db"
 	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/auth_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/bulk_users_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/groups_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/invitations_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/login_attempts_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/magic_links_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/orgs_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/otp_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/policy_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/privacy_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/roles_db"
 	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/memory"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/sqlite"
+	sqlitemigration "github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/sqlite/migration"
 	"github.com/ShlykovPavel/auth-JWT-microservice/metrics"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -32,25 +69,58 @@ type App struct {
 	cfg        *config.Config
 }
 
+// newSqliteApp Приложение на файле SQLite. Миграции SQLite применяются при каждом запуске:
+// экземпляр сервиса один, ждать init контейнер не нужно
+func newSqliteApp(logger *slog.Logger, cfg *config.Config) *App {
+	if err := checkCoreOnly(cfg); err != nil {
+		logger.Error("Unsupported sqlite storage config", "error", err)
+		os.Exit(1)
+	}
+	db, err := sqlite.Open(context.Background(), cfg.SqlitePath, logger)
+	if err != nil {
+		logger.Error("Failed to open sqlite database", "error", err)
+		os.Exit(1)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.DbMigrationTimeout)
+	defer cancel()
+	if err = sqlite.Migrate(ctx, db, sqlitemigration.FS, logger); err != nil {
+		logger.Error("Failed to apply sqlite migrations", "error", err)
+		os.Exit(1)
+	}
+	return newCoreApp(logger, cfg, sqlite.NewUserRepository(db, logger), sqlite.NewTokensRepository(db, logger),
+		sqlite.NewLoginAttemptsRepository(db, logger))
+}
+
 // NewApp создаёт экземпляр приложения, инициализируя все зависимости:
 // - Подключение к БД (пул соединений).
 // - Репозитории для работы с данными.
 // - Настройку роутера и HTTP-сервера.
 func NewApp(logger *slog.Logger, cfg *config.Config) *App {
-
-	dbConfig := database.DbConfig{
-		DbName:              cfg.DbName,
-		DbUser:              cfg.DbUser,
-		DbPassword:          cfg.DbPassword,
-		DbHost:              cfg.DbHost,
-		DbPort:              cfg.DbPort,
-		DbMaxConnections:    cfg.DbMaxConnections,
-		DbMinConnections:    cfg.DbMinConnections,
-		DbMaxConnLifetime:   cfg.DbMaxConnLifetime,
-		DbMaxConnIdleTime:   cfg.DbMaxConnIdleTime,
-		DbHealthCheckPeriod: cfg.DbHealthCheckPeriod,
+	switch cfg.Storage {
+	case storagePostgres:
+	case storageMemory:
+		if err := checkCoreOnly(cfg); err != nil {
+			logger.Error("Unsupported memory storage config", "error", err)
+			os.Exit(1)
+		}
+		logger.Warn("Using in-memory storage: data is lost on restart",
+			slog.Any("unsupported_features", coreUnsupportedFeatures))
+		store := memory.NewStore()
+		return newCoreApp(logger, cfg, memory.NewUserRepository(store), memory.NewTokensRepository(store),
+			memory.NewLoginAttemptsRepository(store))
+	case storageSqlite:
+		return newSqliteApp(logger, cfg)
+	default:
+		logger.Error("Unknown storage", slog.String("storage", cfg.Storage))
+		os.Exit(1)
+	}
+	if err := cfg.ValidateDb(); err != nil {
+		logger.Error("Invalid database config", "error", err)
+		os.Exit(1)
 	}
 
+	dbConfig := newDbConfig(cfg)
+
 	metricses := metrics.InitMetrics()
 
 	poll, err := database.CreatePool(context.Background(), &dbConfig, logger)
@@ -58,6 +128,13 @@ func NewApp(logger *slog.Logger, cfg *config.Config) *App {
 		logger.Error("Failed to create database pool", "error", err)
 		os.Exit(1)
 	}
+	// Схема обновляется до того, как сервис начнёт принимать запросы
+	if cfg.DbMigrateOnStart {
+		if err = migrateUp(poll, cfg, logger); err != nil {
+			logger.Error("Failed to apply database migrations", "error", err)
+			os.Exit(1)
+		}
+	}
 
 	database.MonitorPool(context.Background(), poll, metricses)
 	metricsMiddleware := middlewares.PrometheusMiddleware(metricses)
@@ -66,40 +143,210 @@ func NewApp(logger *slog.Logger, cfg *config.Config) *App {
 		logger.Error("Failed to initialize validator", "error", err)
 	}
 
+	passwordHasher := initPasswordHasher(cfg, logger)
+
 	// Инициализируем объекты репозиториев
 	userRepository := users_db.NewUsersDB(poll, logger)
 	tokensRepository := auth_db.NewTokensRepositoryImpl(poll, logger)
+	rolesRepository := roles_db.NewRolesRepository(poll, logger)
+	orgsRepository := orgs_db.NewOrgsRepository(poll, logger)
+	groupsRepository := groups_db.NewGroupsRepository(poll, logger)
+	mailSender := newMailer(cfg, logger)
+
+	loginAttemptsRepository := login_attempts_db.NewLoginAttemptsRepository(poll, logger)
+	// Ограничение неудачных попыток входа
+	loginThrottler := newLoginThrottler(cfg, loginAttemptsRepository, metricses, logger)
+	// Статусы аккаунтов: блокировка проверяется при входе, обновлении токенов и в AuthMiddleware
+	accountStatusService := services.NewAccountStatusService(userRepository, cfg.AccountStatusCacheTTL, logger)
+	// Дополнительные атрибуты пользователей: схема для проверки и атрибуты, попадающие в access токен
+	metadataValidator, metadataClaims := newMetadata(cfg, logger)
 	// Инициализация сервиса авторизации
-	authService := services.NewAuthService(userRepository, tokensRepository, logger, cfg.JWTSecretKey, cfg.JWTDuration)
+	authService := services.NewAuthService(userRepository, tokensRepository, logger, cfg.JWTSecretKey, cfg.JWTDuration, loginThrottler, metadataClaims)
+	magicLinkService := services.NewMagicLinkService(userRepository, magic_links_db.NewMagicLinksRepository(poll, logger), authService, mailSender, services.MagicLinkConfig{
+		TTL:            cfg.MagicLink.TTL,
+		URL:            cfg.MagicLink.URL,
+		MaxPerWindow:   cfg.MagicLink.MaxPerWindow,
+		ThrottleWindow: cfg.MagicLink.ThrottleWindow,
+	}, logger)
+	// Вход по одноразовому коду из SMS
+	messageSender, err := message_sender.NewMessageSender(cfg.OTP.SenderBackend, logger)
+	if err != nil {
+		logger.Error("Failed to create message sender", "error", err)
+		os.Exit(1)
+	}
+	otpService := services.NewOTPService(userRepository, otp_db.NewOTPRepository(poll, logger), authService, messageSender, cfg.JWTSecretKey, services.OTPConfig{
+		TTL:            cfg.OTP.TTL,
+		MaxAttempts:    cfg.OTP.MaxAttempts,
+		ResendCooldown: cfg.OTP.ResendCooldown,
+	}, logger)
+	// Правила доступа на атрибутах: из БД (с ручками управления) или из YAML файла
+	policyRepository := policy_db.NewPolicyRepository(poll, logger)
+	policyEngine, err := newPolicyEngine(cfg, policyRepository, logger)
+	if err != nil {
+		logger.Error("Failed to load access policies", "error", err)
+		os.Exit(1)
+	}
+	go policyEngine.RunReloader(context.Background(), cfg.Policy.ReloadInterval)
+	authzService := services.NewAuthzService(policyEngine, userRepository)
+	// Политика паролей для регистрации и смены пароля
+	passwordPolicy := newPasswordPolicy(cfg, passwordHasher, logger)
+	// Приглашения администраторами: единственный способ регистрации при выключенной публичной регистрации
+	invitationsRepository := invitations_db.NewInvitationsRepository(poll, logger)
+	invitationService := services.NewInvitationService(userRepository, invitationsRepository, authService, mailSender, passwordPolicy, services.InvitationConfig{
+		TTL: cfg.Invitation.TTL,
+		URL: cfg.Invitation.URL,
+	}, logger)
 
-	router := chi.NewRouter()
-	router.Use(middleware.RequestID)
-	router.Use(middleware.Logger)
-	router.Use(middleware.Recoverer)
-	router.Use(middleware.URLFormat)
-	router.Use(middleware.Heartbeat("/health"))
-	router.Use(metricsMiddleware)
+	// Смена email с подтверждением нового адреса и отменой со старого
+	emailChangeService := newEmailChangeService(cfg, userRepository, mailSender, loginThrottler, logger)
 
+	// Вход администраторов под пользователями, каждая выдача токена пишется в журнал
+	auditRepository := audit_db.NewAuditRepository(poll, logger)
+	impersonationService := services.NewImpersonationService(userRepository, auditRepository, cfg.JWTSecretKey, cfg.ImpersonationTTL, metadataClaims, logger)
+
+	// Запросы на выгрузку и удаление персональных данных. Удаление по истечении срока выполняет фоновая задача
+	privacyService := services.NewPrivacyService(userRepository, privacy_db.NewPrivacyRepository(poll, logger), auditRepository, accountStatusService, mailSender, services.ErasureConfig{
+		GracePeriod:   cfg.Erasure.GracePeriod,
+		CheckInterval: cfg.Erasure.CheckInterval,
+	}, logger)
+	go privacyService.RunEraser(context.Background())
+	// Массовый импорт и выгрузка пользователей, тот же сервис использует cmd/bulk-users
+	bulkUsersService := services.NewBulkUsersService(bulk_users_db.NewBulkUsersRepository(poll, logger), cfg.BulkUsers.ImportBatchSize, logger)
+
+	router := newRouter(cfg, metricsMiddleware)
 	router.Route("/api/v1", func(apiRouter chi.Router) {
-		apiRouter.Get("/swagger/*", httpSwagger.Handler(
-			httpSwagger.URL("/api/v1/swagger/doc.json"),
-		))
+		routeServiceEndpoints(apiRouter)
 
-		apiRouter.Handle("/metrics", promhttp.Handler())
+		apiRouter.Group(func(r chi.Router) {
+			r.Use(middlewares.AuthMiddleware(cfg.JWTSecretKey, logger, accountStatusService))
+			// Административные ручки: доступ по правам из токена, данные только организации из токена
+			usersRead := middlewares.RequirePermission(logger, permissions.UsersRead)
+			usersWrite := middlewares.RequirePermission(logger, permissions.UsersWrite)
+			rolesRead := middlewares.RequirePermission(logger, permissions.RolesRead)
+			rolesWrite := middlewares.RequirePermission(logger, permissions.RolesWrite)
+			// Общее для всех организаций меняется только из организации по умолчанию
+			defaultOrg := middlewares.RequireDefaultOrg(logger)
+			notImpersonated := middlewares.DenyImpersonation(logger)
 
+			r.With(rolesWrite).Patch("/users/{id}", roles.SetAdminRole(logger, userRepository))
+			r.With(usersRead).Get("/admin/users", directory.ListUsersHandler(logger, userRepository, cfg.ServerTimeout))
+			r.With(usersWrite).Post("/admin/users/import", bulk.ImportUsersHandler(logger, bulkUsersService, cfg.BulkUsers.Timeout, cfg.BulkUsers.ImportMaxBytes))
+			r.With(usersRead).Get("/admin/users/export", bulk.ExportUsersHandler(logger, bulkUsersService, cfg.BulkUsers.Timeout))
+			r.With(usersRead).Get("/admin/users/{id}", directory.GetUserHandler(logger, userRepository, cfg.ServerTimeout))
+			r.With(rolesRead).Get("/admin/roles", roles.ListRolesHandler(logger, rolesRepository, cfg.ServerTimeout))
+			r.With(rolesWrite).Post("/admin/roles", roles.CreateRoleHandler(logger, rolesRepository, cfg.ServerTimeout))
+			r.With(rolesRead).Get("/admin/permissions", roles.ListPermissionsHandler(logger, rolesRepository, cfg.ServerTimeout))
+			r.With(rolesWrite).Post("/admin/roles/{role}/permissions", roles.GrantPermissionHandler(logger, rolesRepository, cfg.ServerTimeout))
+			r.With(rolesWrite).Delete("/admin/roles/{role}/permissions/{permission}", roles.RevokePermissionHandler(logger, rolesRepository, cfg.ServerTimeout))
+			r.With(rolesWrite).Post("/admin/users/{id}/roles", roles.GrantRoleHandler(logger, rolesRepository, cfg.ServerTimeout))
+			r.With(rolesWrite).Delete("/admin/users/{id}/roles/{role}", roles.RevokeRoleHandler(logger, rolesRepository, cfg.ServerTimeout))
+			r.With(rolesRead).Get("/admin/users/{id}/permissions", roles.EffectivePermissionsHandler(logger, rolesRepository, cfg.ServerTimeout))
+			r.With(rolesRead).Get("/admin/groups", groups.ListGroupsHandler(logger, groupsRepository, cfg.ServerTimeout))
+			r.With(rolesWrite).Post("/admin/groups", groups.CreateGroupHandler(logger, groupsRepository, cfg.ServerTimeout))
+			r.With(rolesRead).Get("/admin/groups/{id}", groups.GetGroupHandler(logger, groupsRepository, cfg.ServerTimeout))
+			r.With(rolesWrite).Patch("/admin/groups/{id}", groups.UpdateGroupHandler(logger, groupsRepository, cfg.ServerTimeout))
+			r.With(rolesWrite).Delete("/admin/groups/{id}", groups.DeleteGroupHandler(logger, groupsRepository, cfg.ServerTimeout))
+			r.With(rolesRead).Get("/admin/groups/{id}/members", groups.ListMembersHandler(logger, groupsRepository, cfg.ServerTimeout))
+			r.With(rolesWrite).Post("/admin/groups/{id}/members", groups.AddMemberHandler(logger, groupsRepository, cfg.ServerTimeout))
+			r.With(rolesWrite).Delete("/admin/groups/{id}/members/{user_id}", groups.RemoveMemberHandler(logger, groupsRepository, cfg.ServerTimeout))
+			r.With(rolesWrite).Post("/admin/groups/{id}/roles", groups.GrantRoleHandler(logger, groupsRepository, cfg.ServerTimeout))
+			r.With(rolesWrite).Delete("/admin/groups/{id}/roles/{role}", groups.RevokeRoleHandler(logger, groupsRepository, cfg.ServerTimeout))
+			r.With(rolesWrite).Post("/admin/groups/{id}/permissions", groups.GrantPermissionHandler(logger, groupsRepository, cfg.ServerTimeout))
+			r.With(rolesWrite).Delete("/admin/groups/{id}/permissions/{permission}", groups.RevokePermissionHandler(logger, groupsRepository, cfg.ServerTimeout))
+			r.With(defaultOrg, usersWrite).Put("/admin/users/{id}/metadata", directory.SetMetadataHandler(logger, userRepository, metadataValidator, cfg.ServerTimeout))
+			r.With(defaultOrg, usersWrite).Post("/admin/users/{id}/suspend", directory.SuspendUserHandler(logger, accountStatusService, cfg.ServerTimeout))
+			r.With(defaultOrg, usersWrite).Post("/admin/users/{id}/deactivate", directory.DeactivateUserHandler(logger, accountStatusService, cfg.ServerTimeout))
+			r.With(defaultOrg, usersWrite).Post("/admin/users/{id}/reactivate", directory.ReactivateUserHandler(logger, accountStatusService, cfg.ServerTimeout))
+			r.With(notImpersonated, middlewares.RequirePermission(logger, permissions.UsersImpersonate)).Post("/admin/users/{id}/impersonate", impersonation.ImpersonateHandler(logger, impersonationService, cfg.ServerTimeout))
+			r.With(defaultOrg, usersWrite).Post("/admin/users/{id}/erase", privacy.EraseUserHandler(logger, privacyService, cfg.ServerTimeout))
+			r.With(defaultOrg, usersWrite).Delete("/admin/users/{id}/erasure", privacy.AdminCancelErasureHandler(logger, privacyService, cfg.ServerTimeout))
+			r.With(usersRead).Get("/admin/audit", audit.ListEventsHandler(logger, auditRepository, cfg.ServerTimeout))
+			r.With(usersWrite).Post("/admin/users/{id}/unlock", lockout.UnlockUserHandler(logger, userRepository, loginThrottler, cfg.ServerTimeout))
+			r.With(usersWrite).Delete("/admin/members/{id}", orgs.RemoveMemberHandler(logger, orgsRepository, cfg.ServerTimeout))
+			r.With(usersRead).Get("/admin/invitations", invitations.ListInvitationsHandler(logger, invitationsRepository, cfg.ServerTimeout))
+			r.With(usersWrite).Post("/admin/invitations", invitations.CreateInvitationHandler(logger, invitationService, cfg.ServerTimeout))
+			r.With(usersWrite).Delete("/admin/invitations/{id}", invitations.RevokeInvitationHandler(logger, invitationsRepository, cfg.ServerTimeout))
+			r.With(defaultOrg, middlewares.RequirePermission(logger, permissions.OrgsWrite)).Post("/admin/orgs", orgs.CreateOrganizationHandler(logger, orgsRepository, cfg.ServerTimeout))
+			r.With(rolesRead).Get("/admin/policies", authzHandlers.ListPoliciesHandler(policyEngine))
+			if cfg.Policy.Source == policySourceDB {
+				policiesWrite := middlewares.RequirePermission(logger, permissions.PoliciesWrite)
+				r.With(defaultOrg, policiesWrite).Put("/admin/policies/{id}", authzHandlers.UpsertPolicyHandler(logger, policyRepository, policyEngine, cfg.ServerTimeout))
+				r.With(defaultOrg, policiesWrite).Delete("/admin/policies/{id}", authzHandlers.DeletePolicyHandler(logger, policyRepository, policyEngine, cfg.ServerTimeout))
+			}
+		})
 		apiRouter.Group(func(r chi.Router) {
-			r.Use(middlewares.AuthMiddleware(cfg.JWTSecretKey, logger))
-			r.Use(middlewares.AuthAdminMiddleware(cfg.JWTSecretKey, logger))
-			r.Patch("/users/{id}", roles.SetAdminRole(logger, userRepository))
+			r.Use(middlewares.AuthMiddleware(cfg.JWTSecretKey, logger, accountStatusService))
+			// Под чужим именем нельзя менять пароль, email, телефон (второй фактор), удалять аккаунт и получать новые токены
+			notImpersonated := middlewares.DenyImpersonation(logger)
+			r.With(notImpersonated).Put("/user/password", password.ChangePasswordHandler(logger, userRepository, cfg.ServerTimeout, passwordPolicy, loginThrottler))
+			r.With(notImpersonated).Post("/user/email", email.ChangeEmailHandler(logger, cfg.ServerTimeout, emailChangeService))
+			r.With(notImpersonated).Post("/user/phone", phone.SetPhoneHandler(logger, cfg.ServerTimeout, otpService))
+			r.With(notImpersonated).Post("/user/phone/verify", phone.VerifyPhoneHandler(logger, cfg.ServerTimeout, otpService))
+			r.Get("/me", profile.GetMeHandler(logger, userRepository, cfg.ServerTimeout))
+			r.Patch("/me", profile.UpdateMeHandler(logger, userRepository, metadataValidator, cfg.ServerTimeout))
+			r.With(notImpersonated).Delete("/me", profile.DeleteMeHandler(logger, userRepository, cfg.ServerTimeout))
+			r.With(notImpersonated).Get("/me/export", privacy.ExportMeHandler(logger, privacyService, cfg.ServerTimeout))
+			r.With(notImpersonated).Post("/me/erasure", privacy.RequestErasureHandler(logger, privacyService, cfg.ServerTimeout))
+			r.With(notImpersonated).Delete("/me/erasure", privacy.CancelErasureHandler(logger, privacyService, cfg.ServerTimeout))
+			r.Get("/orgs", orgs.ListMyOrganizationsHandler(logger, orgsRepository, cfg.ServerTimeout))
+			r.With(notImpersonated).Post("/orgs/switch", orgs.SwitchOrganizationHandler(logger, authService, cfg.ServerTimeout))
+			r.With(notImpersonated).Post("/invitations/join", invitations.JoinInvitationHandler(logger, cfg.ServerTimeout, invitationService))
+			r.With(middlewares.RequirePermission(logger, permissions.AuthzCheck)).Post("/authz/check", authzHandlers.CheckHandler(logger, authzService, cfg.ServerTimeout))
 		})
-		apiRouter.Post("/user/register", users.CreateUser(logger, userRepository, cfg.ServerTimeout))
+		apiRouter.Post("/user/register", users.CreateUser(logger, userRepository, cfg.ServerTimeout, passwordPolicy, users.RegistrationOptions{
+			EnumerationSafe: cfg.RegistrationEnumerationSafe,
+			Disabled:        !cfg.PublicRegistration,
+			Mailer:          mailSender,
+		}))
+		apiRouter.Post("/user/email/confirm", email.ConfirmEmailChangeHandler(logger, cfg.ServerTimeout, emailChangeService))
+		apiRouter.Post("/user/email/cancel", email.CancelEmailChangeHandler(logger, cfg.ServerTimeout, emailChangeService))
+		apiRouter.Post("/invitations/accept", invitations.AcceptInvitationHandler(logger, cfg.ServerTimeout, invitationService))
 		apiRouter.Post("/login", auth.AuthenticationHandler(logger, cfg.ServerTimeout, authService))
+		apiRouter.Post("/login/magic-link", auth.MagicLinkRequestHandler(logger, cfg.ServerTimeout, magicLinkService))
+		apiRouter.Post("/login/magic-link/consume", auth.MagicLinkConsumeHandler(logger, cfg.ServerTimeout, magicLinkService))
+		apiRouter.Post("/login/otp", auth.OTPRequestHandler(logger, cfg.ServerTimeout, otpService))
+		apiRouter.Post("/login/otp/verify", auth.OTPVerifyHandler(logger, cfg.ServerTimeout, otpService))
 		apiRouter.Post("/refresh", auth.RefreshTokenHandler(logger, cfg.ServerTimeout, authService))
 		apiRouter.Post("/logout", auth.LogoutHandler(logger, cfg.ServerTimeout, authService))
 
 	})
 
-	// Run server
+	return newHTTPApp(logger, cfg, router)
+}
+
+// Хранилища пользователей и refresh токенов
+const (
+	storagePostgres = "postgres"
+	storageSqlite   = "sqlite" // Файл БД для развёртывания на одном узле
+	storageMemory   = "memory" // Без БД, для тестов и локальной разработки
+)
+
+// newRouter Роутер с общими для всех хранилищ middleware
+func newRouter(cfg *config.Config, metricsMiddleware func(http.Handler) http.Handler) *chi.Mux {
+	router := chi.NewRouter()
+	router.Use(middleware.RequestID)
+	if cfg.TrustProxyHeaders {
+		router.Use(middleware.RealIP)
+	}
+	router.Use(middleware.Logger)
+	router.Use(middleware.Recoverer)
+	router.Use(middleware.URLFormat)
+	router.Use(middleware.Heartbeat("/health"))
+	router.Use(metricsMiddleware)
+	return router
+}
+
+// routeServiceEndpoints Документация API и метрики
+func routeServiceEndpoints(apiRouter chi.Router) {
+	apiRouter.Get("/swagger/*", httpSwagger.Handler(
+		httpSwagger.URL("/api/v1/swagger/doc.json"),
+	))
+
+	apiRouter.Handle("/metrics", promhttp.Handler())
+}
+
+// newHTTPApp Приложение с HTTP сервером на роутере router
+func newHTTPApp(logger *slog.Logger, cfg *config.Config, router http.Handler) *App {
 	srv := &http.Server{
 		Addr:              cfg.Address,
 		Handler:           router,
@@ -109,6 +356,153 @@ func NewApp(logger *slog.Logger, cfg *config.Config) *App {
 	return &App{cfg: cfg, logger: logger, HTTPServer: srv}
 }
 
+// initPasswordHasher создаёт хешер паролей из конфига и делает его хешером по умолчанию
+func initPasswordHasher(cfg *config.Config, logger *slog.Logger) *password_hasher.MultiHasher {
+	passwordHasher, err := password_hasher.NewHasher(cfg.PasswordHashing.Algorithm, cfg.PasswordHashing.BcryptCost, password_hasher.Argon2idParams{
+		Memory:      cfg.PasswordHashing.Argon2Memory,
+		Time:        cfg.PasswordHashing.Argon2Time,
+		Parallelism: cfg.PasswordHashing.Argon2Parallelism,
+	}, password_hasher.Argon2idLimits{
+		MaxMemory:      cfg.PasswordHashing.Argon2MaxMemory,
+		MaxTime:        cfg.PasswordHashing.Argon2MaxTime,
+		MaxParallelism: cfg.PasswordHashing.Argon2MaxParallelism,
+	})
+	if err != nil {
+		logger.Error("Failed to create password hasher", "error", err)
+		os.Exit(1)
+	}
+	if err = password_hasher.InitHasher(passwordHasher); err != nil {
+		logger.Error("Failed to initialize password hasher", "error", err)
+	}
+	return passwordHasher
+}
+
+// newPasswordPolicy Политика паролей для регистрации и смены пароля
+func newPasswordPolicy(cfg *config.Config, passwordHasher *password_hasher.MultiHasher, logger *slog.Logger) *password_policy.Policy {
+	breachChecker, err := newBreachChecker(cfg, logger)
+	if err != nil {
+		logger.Error("Failed to load breached passwords dataset", "error", err)
+		os.Exit(1)
+	}
+	return password_policy.NewPolicy(password_policy.Policy{
+		MinLength:        cfg.PasswordPolicy.MinLength,
+		MaxBytes:         passwordHasher.MaxPasswordBytes(),
+		RequireUppercase: cfg.PasswordPolicy.RequireUppercase,
+		RequireLowercase: cfg.PasswordPolicy.RequireLowercase,
+		RequireDigit:     cfg.PasswordPolicy.RequireDigit,
+		RequireSpecial:   cfg.PasswordPolicy.RequireSpecial,
+		ForbidPersonal:   cfg.PasswordPolicy.ForbidPersonal,
+		MinStrength:      cfg.PasswordPolicy.MinStrength,
+		HistorySize:      cfg.PasswordPolicy.HistorySize,
+		BreachChecker:    breachChecker,
+	})
+}
+
+func newMailer(cfg *config.Config, logger *slog.Logger) mailer.Mailer {
+	mailSender, err := mailer.NewMailer(mailer.Config{
+		Backend:      cfg.Mailer.Backend,
+		SMTPHost:     cfg.Mailer.SMTPHost,
+		SMTPPort:     cfg.Mailer.SMTPPort,
+		SMTPUser:     cfg.Mailer.SMTPUser,
+		SMTPPassword: cfg.Mailer.SMTPPassword,
+		From:         cfg.Mailer.From,
+	}, logger)
+	if err != nil {
+		logger.Error("Failed to create mailer", "error", err)
+		os.Exit(1)
+	}
+	return mailSender
+}
+
+// newLoginThrottler Ограничение неудачных попыток входа по настройкам LoginThrottling
+func newLoginThrottler(cfg *config.Config, repo login_attempts_db.LoginAttemptsRepository, metricses *metrics.Metrics, logger *slog.Logger) *services.LoginThrottler {
+	return services.NewLoginThrottler(repo, metricses, services.LoginThrottlerConfig{
+		DelayAfter:      cfg.LoginThrottling.DelayAfter,
+		BaseDelay:       cfg.LoginThrottling.BaseDelay,
+		LockoutAfter:    cfg.LoginThrottling.LockoutAfter,
+		LockoutDuration: cfg.LoginThrottling.LockoutDuration,
+		MaxLockout:      cfg.LoginThrottling.MaxLockout,
+		IPLockoutAfter:  cfg.LoginThrottling.IPLockoutAfter,
+		FailureWindow:   cfg.LoginThrottling.FailureWindow,
+	}, logger)
+}
+
+// newMetadata Схема для проверки дополнительных атрибутов пользователей и атрибуты, попадающие в access токен
+func newMetadata(cfg *config.Config, logger *slog.Logger) (*user_metadata.Validator, user_metadata.ClaimsMapping) {
+	metadataValidator, err := user_metadata.LoadValidator(cfg.Metadata.SchemaFile, cfg.Metadata.MaxBytes)
+	if err != nil {
+		logger.Error("Failed to load metadata schema", "error", err)
+		os.Exit(1)
+	}
+	metadataClaims, err := user_metadata.ParseClaimsMapping(cfg.Metadata.Claims)
+	if err != nil {
+		logger.Error("Failed to parse metadata claims", "error", err)
+		os.Exit(1)
+	}
+	return metadataValidator, metadataClaims
+}
+
+// newEmailChangeService Смена email с подтверждением нового адреса и отменой со старого
+func newEmailChangeService(cfg *config.Config, userRepository users_db.UserRepository, mailSender mailer.Mailer, loginThrottler *services.LoginThrottler, logger *slog.Logger) *services.EmailChangeService {
+	return services.NewEmailChangeService(userRepository, mailSender, loginThrottler, services.EmailChangeConfig{
+		TTL:        cfg.EmailChange.TTL,
+		CancelTTL:  cfg.EmailChange.CancelTTL,
+		ConfirmURL: cfg.EmailChange.ConfirmURL,
+		CancelURL:  cfg.EmailChange.CancelURL,
+	}, logger)
+}
+
+// newBreachChecker загружает локальный набор утекших паролей, если он указан в конфиге.
+// Возвращает nil, если проверка по утечкам выключена
+func newBreachChecker(cfg *config.Config, logger *slog.Logger) (breached_passwords.Checker, error) {
+	policyCfg := cfg.PasswordPolicy
+	if policyCfg.BreachedPath == "" {
+		logger.Info("Breached passwords screening is disabled")
+		return nil, nil
+	}
+	checker, err := breached_passwords.NewChecker(policyCfg.BreachedFormat, policyCfg.BreachedPath, policyCfg.BreachedMinCount)
+	if err != nil {
+		return nil, err
+	}
+	// В bloom фильтре нет счётчиков, порог задаётся при сборке фильтра
+	if filter, ok := checker.(*breached_passwords.BloomFilter); ok && int(filter.MinCount) != policyCfg.BreachedMinCount {
+		logger.Warn("Bloom filter was built with a different minimum breach count, configured value is ignored",
+			slog.Int("filter_min_count", int(filter.MinCount)),
+			slog.Int("configured_min_count", policyCfg.BreachedMinCount))
+	}
+	logger.Info("Breached passwords screening is enabled", slog.String("format", policyCfg.BreachedFormat))
+	return checker, nil
+}
+
+// Источники правил доступа
+const (
+	policySourceDB   = "db"
+	policySourceFile = "file"
+)
+
+// newPolicyEngine создаёт движок правил доступа и загружает правила из источника, указанного в конфиге
+func newPolicyEngine(cfg *config.Config, policyRepository policy_db.PolicyRepository, logger *slog.Logger) (*policy.Engine, error) {
+	location, err := time.LoadLocation(cfg.Policy.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	var store policy.Store
+	switch cfg.Policy.Source {
+	case policySourceDB:
+		store = policyRepository
+	case policySourceFile:
+		store = policy.NewFileStore(cfg.Policy.File)
+	default:
+		return nil, fmt.Errorf("unknown policy source %q", cfg.Policy.Source)
+	}
+	engine := policy.NewEngine(store, location, logger)
+	if err = engine.Reload(context.Background()); err != nil {
+		return nil, err
+	}
+	logger.Info("Access policies loaded", slog.String("source", cfg.Policy.Source), slog.Int("rules", len(engine.Rules())))
+	return engine, nil
+}
+
 // Run запускает HTTP-сервер и ожидает сигналов для graceful shutdown.
 // Это позволяет добавить в будущем другие подсистемы (например, gRPC), вызывая их Run в горутинах.
 func (a *App) Run() {
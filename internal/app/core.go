@@ -0,0 +1,115 @@
+package app
+
+import (
+	"fmt"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/config"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/middlewares"
+	validators "github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/validator"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/permissions"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/services"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/server/users/auth"
+	users "github.com/ShlykovPavel/auth-JWT-microservice/internal/server/users/create"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/server/users/directory"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/server/users/email"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/server/users/lockout"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/server/users/password"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/server/users/profile"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/server/users/roles"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/auth_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/login_attempts_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/metrics"
+	"github.com/go-chi/chi/v5"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// coreUnsupportedFeatures Возможности, которых нет у хранилищ memory и sqlite: им нужны таблицы, которые есть только в Postgres
+var coreUnsupportedFeatures = []string{
+	"roles and permissions", "groups", "organizations", "invitations", "magic link login", "otp login", "phone verification",
+	"authorization policies and checks", "audit log", "impersonation", "personal data export and erasure", "bulk users import and export",
+}
+
+// checkCoreOnly Сервис на memory и sqlite запускается без coreUnsupportedFeatures только с явного согласия (STORAGE_CORE_ONLY),
+// что б конфиг, рассчитанный на Postgres, не запустился молча без ролей и организаций.
+// Без открытой регистрации пользователей не добавить совсем: приглашений в этих хранилищах нет
+func checkCoreOnly(cfg *config.Config) error {
+	if !cfg.CoreOnly {
+		return fmt.Errorf("%s storage does not support: %s; set STORAGE_CORE_ONLY=true to start without them or use postgres storage",
+			cfg.Storage, strings.Join(coreUnsupportedFeatures, ", "))
+	}
+	if !cfg.PublicRegistration {
+		return fmt.Errorf("%s storage does not support invitations, so PUBLIC_REGISTRATION=false leaves no way to add users", cfg.Storage)
+	}
+	return nil
+}
+
+// newCoreApp Приложение на хранилище, где есть только пользователи, refresh токены и счётчики неудачных попыток входа (memory и sqlite).
+// Работают регистрация, вход с ограничением неудачных попыток, обновление токенов, профиль, смена пароля и email,
+// справочник пользователей и разблокировка для администраторов. Ручки coreUnsupportedFeatures не регистрируются.
+// При пустом хранилище создаётся первый администратор из BOOTSTRAP_ADMIN_*, без них сервис не запускается
+func newCoreApp(logger *slog.Logger, cfg *config.Config, userRepository users_db.UserRepository, tokensRepository auth_db.TokensRepository,
+	loginAttemptsRepository login_attempts_db.LoginAttemptsRepository) *App {
+	metricses := metrics.InitMetrics()
+	metricsMiddleware := middlewares.PrometheusMiddleware(metricses)
+
+	if err := validators.InitValidator(); err != nil {
+		logger.Error("Failed to initialize validator", "error", err)
+	}
+	passwordHasher := initPasswordHasher(cfg, logger)
+	passwordPolicy := newPasswordPolicy(cfg, passwordHasher, logger)
+	mailSender := newMailer(cfg, logger)
+	metadataValidator, metadataClaims := newMetadata(cfg, logger)
+
+	if err := roles.CheckAdminInDB(userRepository, cfg.BootstrapAdmin.Email, cfg.BootstrapAdmin.Password, passwordPolicy, logger); err != nil {
+		logger.Error("Failed to create first admin", "error", err)
+		os.Exit(1)
+	}
+
+	loginThrottler := newLoginThrottler(cfg, loginAttemptsRepository, metricses, logger)
+	accountStatusService := services.NewAccountStatusService(userRepository, cfg.AccountStatusCacheTTL, logger)
+	authService := services.NewAuthService(userRepository, tokensRepository, logger, cfg.JWTSecretKey, cfg.JWTDuration, loginThrottler, metadataClaims)
+	emailChangeService := newEmailChangeService(cfg, userRepository, mailSender, loginThrottler, logger)
+
+	router := newRouter(cfg, metricsMiddleware)
+	router.Route("/api/v1", func(apiRouter chi.Router) {
+		routeServiceEndpoints(apiRouter)
+
+		apiRouter.Group(func(r chi.Router) {
+			r.Use(middlewares.AuthMiddleware(cfg.JWTSecretKey, logger, accountStatusService))
+			usersRead := middlewares.RequirePermission(logger, permissions.UsersRead)
+			usersWrite := middlewares.RequirePermission(logger, permissions.UsersWrite)
+			rolesWrite := middlewares.RequirePermission(logger, permissions.RolesWrite)
+			defaultOrg := middlewares.RequireDefaultOrg(logger)
+			notImpersonated := middlewares.DenyImpersonation(logger)
+
+			r.With(rolesWrite).Patch("/users/{id}", roles.SetAdminRole(logger, userRepository))
+			r.With(usersRead).Get("/admin/users", directory.ListUsersHandler(logger, userRepository, cfg.ServerTimeout))
+			r.With(usersRead).Get("/admin/users/{id}", directory.GetUserHandler(logger, userRepository, cfg.ServerTimeout))
+			r.With(defaultOrg, usersWrite).Put("/admin/users/{id}/metadata", directory.SetMetadataHandler(logger, userRepository, metadataValidator, cfg.ServerTimeout))
+			r.With(defaultOrg, usersWrite).Post("/admin/users/{id}/suspend", directory.SuspendUserHandler(logger, accountStatusService, cfg.ServerTimeout))
+			r.With(defaultOrg, usersWrite).Post("/admin/users/{id}/deactivate", directory.DeactivateUserHandler(logger, accountStatusService, cfg.ServerTimeout))
+			r.With(defaultOrg, usersWrite).Post("/admin/users/{id}/reactivate", directory.ReactivateUserHandler(logger, accountStatusService, cfg.ServerTimeout))
+			r.With(usersWrite).Post("/admin/users/{id}/unlock", lockout.UnlockUserHandler(logger, userRepository, loginThrottler, cfg.ServerTimeout))
+
+			r.With(notImpersonated).Put("/user/password", password.ChangePasswordHandler(logger, userRepository, cfg.ServerTimeout, passwordPolicy, loginThrottler))
+			r.With(notImpersonated).Post("/user/email", email.ChangeEmailHandler(logger, cfg.ServerTimeout, emailChangeService))
+			r.Get("/me", profile.GetMeHandler(logger, userRepository, cfg.ServerTimeout))
+			r.Patch("/me", profile.UpdateMeHandler(logger, userRepository, metadataValidator, cfg.ServerTimeout))
+			r.With(notImpersonated).Delete("/me", profile.DeleteMeHandler(logger, userRepository, cfg.ServerTimeout))
+		})
+		apiRouter.Post("/user/register", users.CreateUser(logger, userRepository, cfg.ServerTimeout, passwordPolicy, users.RegistrationOptions{
+			EnumerationSafe: cfg.RegistrationEnumerationSafe,
+			Disabled:        !cfg.PublicRegistration,
+			Mailer:          mailSender,
+		}))
+		apiRouter.Post("/user/email/confirm", email.ConfirmEmailChangeHandler(logger, cfg.ServerTimeout, emailChangeService))
+		apiRouter.Post("/user/email/cancel", email.CancelEmailChangeHandler(logger, cfg.ServerTimeout, emailChangeService))
+		apiRouter.Post("/login", auth.AuthenticationHandler(logger, cfg.ServerTimeout, authService))
+		apiRouter.Post("/refresh", auth.RefreshTokenHandler(logger, cfg.ServerTimeout, authService))
+		apiRouter.Post("/logout", auth.LogoutHandler(logger, cfg.ServerTimeout, authService))
+	})
+
+	return newHTTPApp(logger, cfg, router)
+}
@@ -0,0 +1,105 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/config"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/migration"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/migrator"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
+	"strconv"
+)
+
+var ErrUnknownMigrateCommand = errors.New("unknown migrate command, expected up, down [N], status or force VERSION")
+
+// newDbConfig Настройки пула соединений из конфига сервиса
+func newDbConfig(cfg *config.Config) database.DbConfig {
+	return database.DbConfig{
+		DbName:              cfg.DbName,
+		DbUser:              cfg.DbUser,
+		DbPassword:          cfg.DbPassword,
+		DbHost:              cfg.DbHost,
+		DbPort:              cfg.DbPort,
+		DbMaxConnections:    cfg.DbMaxConnections,
+		DbMinConnections:    cfg.DbMinConnections,
+		DbMaxConnLifetime:   cfg.DbMaxConnLifetime,
+		DbMaxConnIdleTime:   cfg.DbMaxConnIdleTime,
+		DbHealthCheckPeriod: cfg.DbHealthCheckPeriod,
+	}
+}
+
+// migrateUp Применяет встроенные миграции при запуске сервиса
+func migrateUp(pool *pgxpool.Pool, cfg *config.Config, logger *slog.Logger) error {
+	m, err := migrator.New(pool, migration.FS, logger)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.DbMigrationTimeout)
+	defer cancel()
+	return m.Up(ctx)
+}
+
+// Migrate Выполняет команду миграций без запуска HTTP сервера:
+//   - up (или пустая команда) - применить все миграции. Так работает --migrate-only для init контейнера
+//   - down [N] - откатить N последних миграций, по умолчанию одну
+//   - status - напечатать версию схемы и неприменённые миграции
+//   - force VERSION - записать версию без выполнения миграций и снять пометку dirty (0 - миграций нет)
+func Migrate(logger *slog.Logger, cfg *config.Config, args []string) error {
+	command := "up"
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+
+	if cfg.Storage != storagePostgres {
+		return fmt.Errorf("migrate commands are only for postgres storage, configured storage is %q", cfg.Storage)
+	}
+	if err := cfg.ValidateDb(); err != nil {
+		return err
+	}
+	dbConfig := newDbConfig(cfg)
+	pool, err := database.CreatePool(context.Background(), &dbConfig, logger)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+	m, err := migrator.New(pool, migration.FS, logger)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.DbMigrationTimeout)
+	defer cancel()
+
+	switch {
+	case command == "up" && len(args) == 0:
+		return m.Up(ctx)
+	case command == "down" && len(args) <= 1:
+		steps := 1
+		if len(args) == 1 {
+			if steps, err = strconv.Atoi(args[0]); err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of migrations to roll back: %s", args[0])
+			}
+		}
+		return m.Down(ctx, steps)
+	case command == "status" && len(args) == 0:
+		status, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("version: %d\ndirty: %t\nlatest: %d\n", status.Version, status.Dirty, status.Latest)
+		for _, pending := range status.Pending {
+			fmt.Printf("pending: %s\n", pending)
+		}
+		return nil
+	case command == "force" && len(args) == 1:
+		version, err := strconv.ParseUint(args[0], 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid version: %s", args[0])
+		}
+		return m.Force(ctx, uint(version))
+	default:
+		return ErrUnknownMigrateCommand
+	}
+}
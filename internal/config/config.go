@@ -1,6 +1,7 @@
 package config
 
 import (
+	"errors"
 	"github.com/ilyakaznacheev/cleanenv"
 	"log"
 	"time"
@@ -8,21 +9,87 @@ import (
 
 // Config представляет конфигурацию приложения
 type Config struct {
-	Env                 string        `yaml:"ENV" env:"ENV" env-default:"production"`
-	Address             string        `yaml:"address" env:"ADDRESS" env-default:"localhost:8080"`
-	DbHost              string        `yaml:"db_host" env:"DB_HOST" env-required:"true" `
-	DbPort              string        `yaml:"db_port" env:"DB_PORT" env-required:"true"`
-	DbName              string        `yaml:"db_name" env:"DB_NAME" env-required:"true"`
-	DbUser              string        `yaml:"db_user" env:"DB_USER" env-required:"true"`
-	DbPassword          string        `yaml:"db_password" env:"DB_PASSWORD" env-required:"true"`
+	Env     string `yaml:"ENV" env:"ENV" env-default:"production"`
+	Address string `yaml:"address" env:"ADDRESS" env-default:"localhost:8080"`
+	// Storage Где хранятся пользователи и токены: postgres, sqlite (файл БД для одного узла)
+	// или memory (без БД, данные теряются при перезапуске). Полный набор ручек только у postgres:
+	// memory и sqlite обслуживают пользователей, вход и токены, без ролей, групп, организаций, приглашений,
+	// входа по ссылке и коду, политик, журнала, impersonation, персональных данных и импорта (см. README).
+	// memory и sqlite запускаются только с CoreOnly
+	Storage string `yaml:"storage" env:"STORAGE" env-default:"postgres"`
+	// SqlitePath Путь к файлу БД для storage: sqlite. Файл создаётся, если его нет
+	SqlitePath string `yaml:"sqlite_path" env:"SQLITE_PATH" env-default:"auth.db"`
+	// CoreOnly Согласие запустить storage: memory или sqlite без возможностей, которых у них нет.
+	// Без него сервис на этих хранилищах не запускается и перечисляет эти возможности в ошибке
+	CoreOnly bool `yaml:"core_only" env:"STORAGE_CORE_ONLY" env-default:"false"`
+	// BootstrapAdmin Первый администратор для storage: memory и sqlite
+	BootstrapAdmin BootstrapAdminConfig `yaml:"bootstrap_admin"`
+	// Параметры подключения к Postgres. Обязательны для storage: postgres
+	DbHost              string        `yaml:"db_host" env:"DB_HOST"`
+	DbPort              string        `yaml:"db_port" env:"DB_PORT"`
+	DbName              string        `yaml:"db_name" env:"DB_NAME"`
+	DbUser              string        `yaml:"db_user" env:"DB_USER"`
+	DbPassword          string        `yaml:"db_password" env:"DB_PASSWORD"`
 	DbMaxConnections    int32         `yaml:"db_max_connections" env:"DB_MAX_CONNECTIONS"`
 	DbMinConnections    int32         `yaml:"db_min_connections" env:"DB_MIN_CONNECTIONS"`
 	DbMaxConnLifetime   time.Duration `yaml:"db_max_conn_lifetime" env:"DB_MAX_CONN_LIFETIME"`
 	DbMaxConnIdleTime   time.Duration `yaml:"db_max_conn_idle_time" env:"DB_MAX_CONN_IDLE_TIME"`
 	DbHealthCheckPeriod time.Duration `yaml:"db_health_check_period" env:"DB_HEALTH_CHECK_PERIOD"`
-	JWTSecretKey        string        `yaml:"jwt_secret_key" env:"JWT_SECRET_KEY" env-required:"true"`
-	JWTDuration         time.Duration `yaml:"jwt_duration"  env:"JWT_DURATION" env-default:"5m"`
-	ServerTimeout       time.Duration `yaml:"server_timeout" env:"SERVER_TIMEOUT" env-default:"10s"`
+	// DbMigrateOnStart Применять встроенные миграции при запуске. Выключают, если их применяет init контейнер с --migrate-only
+	DbMigrateOnStart bool `yaml:"db_migrate_on_start" env:"DB_MIGRATE_ON_START" env-default:"true"`
+	// DbMigrationTimeout Сколько можно ждать блокировку миграций и применять их
+	DbMigrationTimeout time.Duration `yaml:"db_migration_timeout" env:"DB_MIGRATION_TIMEOUT" env-default:"5m"`
+	JWTSecretKey       string        `yaml:"jwt_secret_key" env:"JWT_SECRET_KEY" env-required:"true"`
+	JWTDuration        time.Duration `yaml:"jwt_duration"  env:"JWT_DURATION" env-default:"5m"`
+	ServerTimeout      time.Duration `yaml:"server_timeout" env:"SERVER_TIMEOUT" env-default:"10s"`
+	// AccountStatusCacheTTL Сколько AuthMiddleware помнит статус аккаунта. Столько access токены заблокированного
+	// пользователя ещё принимаются другими экземплярами сервиса
+	AccountStatusCacheTTL time.Duration `yaml:"account_status_cache_ttl" env:"ACCOUNT_STATUS_CACHE_TTL" env-default:"30s"`
+	// ImpersonationTTL Время жизни токена, выданного администратору от имени пользователя
+	ImpersonationTTL time.Duration `yaml:"impersonation_ttl" env:"IMPERSONATION_TTL" env-default:"15m"`
+
+	PasswordPolicy  PasswordPolicyConfig  `yaml:"password_policy"`
+	PasswordHashing PasswordHashingConfig `yaml:"password_hashing"`
+	LoginThrottling LoginThrottlingConfig `yaml:"login_throttling"`
+	Mailer          MailerConfig          `yaml:"mailer"`
+	MagicLink       MagicLinkConfig       `yaml:"magic_link"`
+	OTP             OTPConfig             `yaml:"otp"`
+	Policy          PolicyConfig          `yaml:"policy"`
+	Invitation      InvitationConfig      `yaml:"invitation"`
+	EmailChange     EmailChangeConfig     `yaml:"email_change"`
+	Erasure         ErasureConfig         `yaml:"erasure"`
+	BulkUsers       BulkUsersConfig       `yaml:"bulk_users"`
+	Metadata        MetadataConfig        `yaml:"metadata"`
+
+	// TrustProxyHeaders Брать IP клиента из X-Forwarded-For/X-Real-IP. Включать только за доверенным прокси
+	TrustProxyHeaders bool `yaml:"trust_proxy_headers" env:"TRUST_PROXY_HEADERS" env-default:"false"`
+	// RegistrationEnumerationSafe Регистрация всегда отвечает одинаково, а владелец занятого email получает письмо
+	RegistrationEnumerationSafe bool `yaml:"registration_enumeration_safe" env:"REGISTRATION_ENUMERATION_SAFE" env-default:"false"`
+	// PublicRegistration Открытая регистрация через /user/register. Если выключена, пользователи появляются только по приглашениям
+	PublicRegistration bool `yaml:"public_registration" env:"PUBLIC_REGISTRATION" env-default:"true"`
+}
+
+// BootstrapAdminConfig Первый администратор, который создаётся, пока в хранилище нет ни одного.
+// Без него memory и sqlite на пустом хранилище не запускаются. После создания администратора не используется
+type BootstrapAdminConfig struct {
+	Email    string `yaml:"email" env:"BOOTSTRAP_ADMIN_EMAIL"`
+	Password string `yaml:"password" env:"BOOTSTRAP_ADMIN_PASSWORD"`
+}
+
+// PasswordPolicyConfig Настройки политики паролей
+type PasswordPolicyConfig struct {
+	MinLength        int  `yaml:"min_length" env:"PASSWORD_MIN_LENGTH" env-default:"8"`
+	RequireUppercase bool `yaml:"require_uppercase" env:"PASSWORD_REQUIRE_UPPERCASE" env-default:"false"`
+	RequireLowercase bool `yaml:"require_lowercase" env:"PASSWORD_REQUIRE_LOWERCASE" env-default:"false"`
+	RequireDigit     bool `yaml:"require_digit" env:"PASSWORD_REQUIRE_DIGIT" env-default:"false"`
+	RequireSpecial   bool `yaml:"require_special" env:"PASSWORD_REQUIRE_SPECIAL" env-default:"false"`
+	ForbidPersonal   bool `yaml:"forbid_personal_info" env:"PASSWORD_FORBID_PERSONAL_INFO" env-default:"true"`
+	MinStrength      int  `yaml:"min_strength" env:"PASSWORD_MIN_STRENGTH" env-default:"2"`
+	HistorySize      int  `yaml:"history_size" env:"PASSWORD_HISTORY_SIZE" env-default:"5"`
+
+	BreachedPath     string `yaml:"breached_path" env:"PASSWORD_BREACHED_PATH"`
+	BreachedFormat   string `yaml:"breached_format" env:"PASSWORD_BREACHED_FORMAT" env-default:"bloom"`
+	BreachedMinCount int    `yaml:"breached_min_count" env:"PASSWORD_BREACHED_MIN_COUNT" env-default:"1"`
 }
 
 // LoadConfig загружает конфигурацию из файла и переменных окружения
@@ -46,3 +113,107 @@ func LoadConfig(filePath string) (*Config, error) {
 	}
 	return &cfg, nil
 }
+
+// ValidateDb Проверяет, что заданы параметры подключения к Postgres. Они обязательны, только если он используется
+func (c *Config) ValidateDb() error {
+	if c.DbHost == "" || c.DbPort == "" || c.DbName == "" || c.DbUser == "" || c.DbPassword == "" {
+		return errors.New("DB_HOST, DB_PORT, DB_NAME, DB_USER and DB_PASSWORD are required")
+	}
+	return nil
+}
+
+// PasswordHashingConfig Настройки хеширования паролей.
+// Хеши других алгоритмов и с другими параметрами перехешируются при успешном логине
+type PasswordHashingConfig struct {
+	Algorithm         string `yaml:"algorithm" env:"PASSWORD_HASH_ALGORITHM" env-default:"bcrypt"`
+	BcryptCost        int    `yaml:"bcrypt_cost" env:"PASSWORD_BCRYPT_COST" env-default:"10"`
+	Argon2Memory      uint32 `yaml:"argon2_memory" env:"PASSWORD_ARGON2_MEMORY" env-default:"19456"`
+	Argon2Time        uint32 `yaml:"argon2_time" env:"PASSWORD_ARGON2_TIME" env-default:"2"`
+	Argon2Parallelism uint8  `yaml:"argon2_parallelism" env:"PASSWORD_ARGON2_PARALLELISM" env-default:"1"`
+	// Пределы параметров argon2id хешей, которые сервис согласен проверять (импорт, хеши в БД)
+	Argon2MaxMemory      uint32 `yaml:"argon2_max_memory" env:"PASSWORD_ARGON2_MAX_MEMORY" env-default:"262144"`
+	Argon2MaxTime        uint32 `yaml:"argon2_max_time" env:"PASSWORD_ARGON2_MAX_TIME" env-default:"10"`
+	Argon2MaxParallelism uint8  `yaml:"argon2_max_parallelism" env:"PASSWORD_ARGON2_MAX_PARALLELISM" env-default:"16"`
+}
+
+// LoginThrottlingConfig Задержки и блокировки после неудачных попыток входа
+type LoginThrottlingConfig struct {
+	DelayAfter      int           `yaml:"delay_after" env:"LOGIN_DELAY_AFTER" env-default:"3"`
+	BaseDelay       time.Duration `yaml:"base_delay" env:"LOGIN_BASE_DELAY" env-default:"1s"`
+	LockoutAfter    int           `yaml:"lockout_after" env:"LOGIN_LOCKOUT_AFTER" env-default:"10"`
+	LockoutDuration time.Duration `yaml:"lockout_duration" env:"LOGIN_LOCKOUT_DURATION" env-default:"15m"`
+	MaxLockout      time.Duration `yaml:"max_lockout" env:"LOGIN_MAX_LOCKOUT" env-default:"24h"`
+	IPLockoutAfter  int           `yaml:"ip_lockout_after" env:"LOGIN_IP_LOCKOUT_AFTER" env-default:"50"`
+	FailureWindow   time.Duration `yaml:"failure_window" env:"LOGIN_FAILURE_WINDOW" env-default:"1h"`
+}
+
+// MailerConfig Настройки отправки писем
+type MailerConfig struct {
+	Backend      string `yaml:"backend" env:"MAILER_BACKEND" env-default:"log"`
+	SMTPHost     string `yaml:"smtp_host" env:"SMTP_HOST"`
+	SMTPPort     string `yaml:"smtp_port" env:"SMTP_PORT" env-default:"587"`
+	SMTPUser     string `yaml:"smtp_user" env:"SMTP_USER"`
+	SMTPPassword string `yaml:"smtp_password" env:"SMTP_PASSWORD"`
+	From         string `yaml:"from" env:"MAILER_FROM" env-default:"no-reply@localhost"`
+}
+
+// MagicLinkConfig Настройки входа по ссылке из письма
+type MagicLinkConfig struct {
+	TTL            time.Duration `yaml:"ttl" env:"MAGIC_LINK_TTL" env-default:"15m"`
+	URL            string        `yaml:"url" env:"MAGIC_LINK_URL" env-default:"http://localhost:3000/login/magic-link"`
+	MaxPerWindow   int           `yaml:"max_per_window" env:"MAGIC_LINK_MAX_PER_WINDOW" env-default:"3"`
+	ThrottleWindow time.Duration `yaml:"throttle_window" env:"MAGIC_LINK_THROTTLE_WINDOW" env-default:"15m"`
+}
+
+// OTPConfig Настройки входа по одноразовому коду на телефон
+type OTPConfig struct {
+	SenderBackend  string        `yaml:"sender_backend" env:"MESSAGE_SENDER_BACKEND" env-default:"log"`
+	TTL            time.Duration `yaml:"ttl" env:"OTP_TTL" env-default:"5m"`
+	MaxAttempts    int           `yaml:"max_attempts" env:"OTP_MAX_ATTEMPTS" env-default:"5"`
+	ResendCooldown time.Duration `yaml:"resend_cooldown" env:"OTP_RESEND_COOLDOWN" env-default:"60s"`
+}
+
+// PolicyConfig Настройки правил доступа на атрибутах
+type PolicyConfig struct {
+	Source         string        `yaml:"source" env:"POLICY_SOURCE" env-default:"db"`
+	File           string        `yaml:"file" env:"POLICY_FILE" env-default:"policies.yaml"`
+	ReloadInterval time.Duration `yaml:"reload_interval" env:"POLICY_RELOAD_INTERVAL" env-default:"1m"`
+	Timezone       string        `yaml:"timezone" env:"POLICY_TIMEZONE" env-default:"UTC"`
+}
+
+// InvitationConfig Настройки приглашений пользователей
+type InvitationConfig struct {
+	TTL time.Duration `yaml:"ttl" env:"INVITATION_TTL" env-default:"72h"`
+	URL string        `yaml:"url" env:"INVITATION_URL" env-default:"http://localhost:3000/invitations/accept"`
+}
+
+// EmailChangeConfig Настройки смены email
+type EmailChangeConfig struct {
+	TTL        time.Duration `yaml:"ttl" env:"EMAIL_CHANGE_TTL" env-default:"24h"`
+	CancelTTL  time.Duration `yaml:"cancel_ttl" env:"EMAIL_CHANGE_CANCEL_TTL" env-default:"168h"`
+	ConfirmURL string        `yaml:"confirm_url" env:"EMAIL_CHANGE_CONFIRM_URL" env-default:"http://localhost:3000/email/confirm"`
+	CancelURL  string        `yaml:"cancel_url" env:"EMAIL_CHANGE_CANCEL_URL" env-default:"http://localhost:3000/email/cancel"`
+}
+
+// ErasureConfig Настройки удаления персональных данных по запросу пользователя
+type ErasureConfig struct {
+	GracePeriod   time.Duration `yaml:"grace_period" env:"ERASURE_GRACE_PERIOD" env-default:"720h"`
+	CheckInterval time.Duration `yaml:"check_interval" env:"ERASURE_CHECK_INTERVAL" env-default:"1h"`
+}
+
+// BulkUsersConfig Настройки массового импорта и выгрузки пользователей
+type BulkUsersConfig struct {
+	// Timeout Сколько может идти один импорт или выгрузка. Заменяет SERVER_TIMEOUT для этих ручек
+	Timeout         time.Duration `yaml:"timeout" env:"BULK_USERS_TIMEOUT" env-default:"10m"`
+	ImportBatchSize int           `yaml:"import_batch_size" env:"BULK_IMPORT_BATCH_SIZE" env-default:"1000"`
+	ImportMaxBytes  int64         `yaml:"import_max_bytes" env:"BULK_IMPORT_MAX_BYTES" env-default:"104857600"`
+}
+
+// MetadataConfig Настройки дополнительных атрибутов пользователя
+type MetadataConfig struct {
+	// SchemaFile JSON схема документа {"user": {...}, "admin": {...}}. Пусто - проверяется только размер секций
+	SchemaFile string `yaml:"schema_file" env:"METADATA_SCHEMA_FILE"`
+	// Claims Атрибуты в access токене: "claim=section.attribute,..."
+	Claims   string `yaml:"claims" env:"METADATA_CLAIMS"`
+	MaxBytes int    `yaml:"max_bytes" env:"METADATA_MAX_BYTES" env-default:"16384"`
+}
@@ -0,0 +1,104 @@
+package middlewares
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/tenant"
+	"github.com/golang-jwt/jwt/v5"
+	"strconv"
+)
+
+var ErrNoClaimsInContext = errors.New("token claims not found in context")
+
+// ClaimsFromContext достаёт claims токена, которые AuthMiddleware положил в контекст запроса
+func ClaimsFromContext(ctx context.Context) (jwt.MapClaims, error) {
+	claims, ok := ctx.Value("tokenClaims").(jwt.MapClaims)
+	if !ok {
+		return nil, ErrNoClaimsInContext
+	}
+	return claims, nil
+}
+
+// UserIDFromContext достаёт id пользователя из claim sub
+func UserIDFromContext(ctx context.Context) (int64, error) {
+	claims, err := ClaimsFromContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return UserIDFromClaims(claims)
+}
+
+// UserIDFromClaims достаёт id пользователя из claim sub.
+// После парсинга JWT числа приходят как float64, поэтому поддерживаем несколько представлений
+func UserIDFromClaims(claims jwt.MapClaims) (int64, error) {
+	switch sub := claims["sub"].(type) {
+	case float64:
+		return int64(sub), nil
+	case json.Number:
+		return sub.Int64()
+	case string:
+		return strconv.ParseInt(sub, 10, 64)
+	default:
+		return 0, fmt.Errorf("invalid sub claim: %v", claims["sub"])
+	}
+}
+
+// ActorIDFromClaims Администратор из claim act, если токен выдан ему от имени пользователя
+func ActorIDFromClaims(claims jwt.MapClaims) (int64, bool) {
+	act, ok := claims["act"].(map[string]interface{})
+	if !ok {
+		return 0, false
+	}
+	actorID, err := UserIDFromClaims(act)
+	if err != nil {
+		return 0, false
+	}
+	return actorID, true
+}
+
+// OrgIDFromClaims достаёт организацию из claim org_id. Токены, выпущенные до появления организаций,
+// относятся к организации по умолчанию: тогда все пользователи состояли в ней
+func OrgIDFromClaims(claims jwt.MapClaims) int64 {
+	switch orgID := claims["org_id"].(type) {
+	case float64:
+		return int64(orgID)
+	case json.Number:
+		if id, err := orgID.Int64(); err == nil {
+			return id
+		}
+	}
+	return tenant.DefaultOrgID
+}
+
+// RolesFromClaims достаёт роли из claim roles. Для токенов, выпущенных до появления нескольких ролей,
+// используется строковый claim user_role
+func RolesFromClaims(claims jwt.MapClaims) []string {
+	var roles []string
+	if list, ok := claims["roles"].([]interface{}); ok {
+		for _, item := range list {
+			if role, ok := item.(string); ok {
+				roles = append(roles, role)
+			}
+		}
+	}
+	if role, ok := claims["user_role"].(string); ok && role != "" && !containsString(roles, role) {
+		roles = append(roles, role)
+	}
+	return roles
+}
+
+// HasRole Есть ли роль среди ролей токена
+func HasRole(claims jwt.MapClaims, role string) bool {
+	return containsString(RolesFromClaims(claims), role)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+package middlewares
+
+import (
+	resp "github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/response"
+	"log/slog"
+	"net/http"
+)
+
+// DenyImpersonation не пускает токены, выданные администратору от имени пользователя (с claim act).
+// Ставится на чувствительные ручки: смена пароля и телефона, удаление аккаунта, выпуск новых токенов
+func DenyImpersonation(log *slog.Logger) func(next http.Handler) http.Handler {
+	const op = "internal/lib/api/middlewares/impersonation.go/DenyImpersonation"
+	log = log.With(slog.String("op", op))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, err := ClaimsFromContext(r.Context())
+			if err != nil {
+				log.Error("Failed to retrieve claims from context")
+				resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("Unauthorized"))
+				return
+			}
+			if actorID, ok := ActorIDFromClaims(claims); ok {
+				log.Warn("Impersonated token used on sensitive endpoint", slog.Int64("actor_id", actorID), slog.String("path", r.URL.Path))
+				resp.RenderResponse(w, r, http.StatusForbidden, resp.Error("Not available while impersonating a user"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
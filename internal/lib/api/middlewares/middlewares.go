@@ -5,19 +5,28 @@ import (
 	"fmt"
 	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/authorization"
 	resp "github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/tenant"
 	"github.com/go-chi/render"
-	"github.com/golang-jwt/jwt/v5"
 	"log/slog"
 	"net/http"
 	"strings"
 )
 
+// AccountStatusChecker Проверка, что аккаунт владельца токена активен. Access токен живёт до истечения срока,
+// поэтому заблокированного пользователя отсекаем по статусу. Реализации стоит кешировать ответ, что б не ходить в БД на каждый запрос
+type AccountStatusChecker interface {
+	AccountActive(ctx context.Context, userID int64) (bool, error)
+}
+
 // AuthMiddleware проверяет токен авторизации при выполнении запроса
 //
 // # При успехе передаёт обработку следующему хендлеру
 //
+// Запрос привязывается к организации из claim org_id: репозитории дальше видят только её данные.
+// Если передан statusChecker, токены заблокированных и отключённых аккаунтов отклоняются
+//
 // При ошибке возвращает статус код 401 и ошибку
-func AuthMiddleware(secretKey string, log *slog.Logger) func(next http.Handler) http.Handler {
+func AuthMiddleware(secretKey string, log *slog.Logger, statusChecker AccountStatusChecker) func(next http.Handler) http.Handler {
 	const op = "internal/lib/api/middlewares/middlewares.go/AuthMiddleware"
 	log = log.With(slog.String("op", op))
 	return func(next http.Handler) http.Handler {
@@ -41,7 +50,30 @@ func AuthMiddleware(secretKey string, log *slog.Logger) func(next http.Handler)
 				return
 			}
 			log.Debug("Authorization token is valid", slog.Any("claims", claims))
+			if statusChecker != nil {
+				userID, err := UserIDFromClaims(claims)
+				if err != nil {
+					renderUnauthorized(w, r, log, fmt.Sprintf("Authorization token is invalid: %v", err))
+					return
+				}
+				active, err := statusChecker.AccountActive(r.Context(), userID)
+				if err != nil {
+					log.Error("Error while checking account status", "err", err)
+					resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("Internal server error"))
+					return
+				}
+				if !active {
+					renderUnauthorized(w, r, log, "Account is not active")
+					return
+				}
+			}
+			if actorID, ok := ActorIDFromClaims(claims); ok {
+				// Каждый запрос под чужим именем попадает в лог вместе с администратором
+				log.Info("Impersonated request", slog.Int64("actor_id", actorID), slog.Any("sub", claims["sub"]),
+					slog.String("method", r.Method), slog.String("path", r.URL.Path))
+			}
 			ctx := context.WithValue(r.Context(), "tokenClaims", claims)
+			ctx = tenant.WithOrgID(ctx, OrgIDFromClaims(claims))
 
 			next.ServeHTTP(w, r.WithContext(ctx))
 
@@ -55,38 +87,3 @@ func renderUnauthorized(w http.ResponseWriter, r *http.Request, log *slog.Logger
 	render.Status(r, http.StatusUnauthorized)
 	render.JSON(w, r, resp.Error(msg))
 }
-
-func AuthAdminMiddleware(secretKey string, log *slog.Logger) func(next http.Handler) http.Handler {
-	const op = "internal/lib/api/middlewares/middlewares.go/AuthAdminMiddleware"
-	log = log.With(slog.String("op", op))
-
-	return func(next http.Handler) http.Handler {
-		// Используем AuthMiddleware для проверки авторизации
-		return AuthMiddleware(secretKey, log)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Извлекаем claims из контекста
-			claims, ok := r.Context().Value("tokenClaims").(jwt.MapClaims)
-			if !ok {
-				log.Error("Failed to retrieve claims from context")
-				render.Status(r, http.StatusInternalServerError)
-				render.JSON(w, r, resp.Error("Internal server error"))
-				return
-			}
-
-			value, ok := claims["user_role"].(string)
-			if !ok {
-				log.Error("Failed to retrieve user role from context", "user_role", claims["user_role"])
-				resp.RenderResponse(w, r, http.StatusForbidden, resp.Error("Forbidden"))
-				return
-			}
-			// Проверяем, является ли пользователь администратором
-			if value == "admin" {
-				log.Debug("User is authorized and has admin privileges")
-				next.ServeHTTP(w, r)
-			} else {
-				log.Debug("User is NOT authorized and has admin privileges")
-				resp.RenderResponse(w, r, http.StatusForbidden,
-					resp.Error("Forbidden"))
-			}
-		}))
-	}
-}
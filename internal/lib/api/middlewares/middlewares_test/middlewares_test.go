@@ -1,13 +1,18 @@
 package middlewares_test
 
 import (
+	"context"
 	"encoding/json"
 	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/middlewares"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/jwt_tokens"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/tenant"
+	"github.com/golang-jwt/jwt/v5"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestAuthMiddleware(t *testing.T) {
@@ -47,7 +52,7 @@ func TestAuthMiddleware(t *testing.T) {
 				w.Write([]byte("{Status: OK}"))
 			})
 			//Регистрируем обработчик middleware
-			middleware := middlewares.AuthMiddleware(test.secretKey, log)
+			middleware := middlewares.AuthMiddleware(test.secretKey, log, nil)
 			handler := middleware(next)
 
 			//	Метод для вызова нашего созданного запроса и ответа
@@ -90,3 +95,138 @@ func TestAuthMiddleware(t *testing.T) {
 		})
 	}
 }
+
+func TestRequirePermission(t *testing.T) {
+	log := slog.Default()
+	tests := []struct {
+		TestName           string
+		Claims             jwt.MapClaims
+		Middleware         func(next http.Handler) http.Handler
+		expectedStatusCode int
+	}{
+		{"any-of: one permission present", jwt.MapClaims{"permissions": []interface{}{"users:read"}},
+			middlewares.RequirePermission(log, "users:write", "users:read"), http.StatusOK},
+		{"any-of: none present", jwt.MapClaims{"permissions": []interface{}{"roles:read"}},
+			middlewares.RequirePermission(log, "users:write", "users:read"), http.StatusForbidden},
+		{"all-of: all present", jwt.MapClaims{"permissions": []interface{}{"users:read", "users:write"}},
+			middlewares.RequireAllPermissions(log, "users:write", "users:read"), http.StatusOK},
+		{"all-of: one missing", jwt.MapClaims{"permissions": []interface{}{"users:read"}},
+			middlewares.RequireAllPermissions(log, "users:write", "users:read"), http.StatusForbidden},
+		{"scope claim only", jwt.MapClaims{"scope": "roles:read users:read"},
+			middlewares.RequirePermission(log, "users:read"), http.StatusOK},
+		{"no permission claims", jwt.MapClaims{"user_role": "admin"},
+			middlewares.RequirePermission(log, "users:read"), http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.TestName, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/url", nil)
+			request = request.WithContext(context.WithValue(request.Context(), "tokenClaims", test.Claims))
+			responseRecorder := httptest.NewRecorder()
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			test.Middleware(next).ServeHTTP(responseRecorder, request)
+
+			if responseRecorder.Code != test.expectedStatusCode {
+				t.Errorf("expected status %d, got %d", test.expectedStatusCode, responseRecorder.Code)
+			}
+		})
+	}
+}
+
+func TestAuthMiddlewareTenant(t *testing.T) {
+	const secretKey = "256bitsvalid256bitsvalid256bitsvalid"
+	log := slog.Default()
+
+	orgToken, err := jwt_tokens.CreateAccessToken(1, 7, secretKey, []string{"user"}, nil, time.Minute, log)
+	if err != nil {
+		t.Fatalf("failed to create token: %v", err)
+	}
+	legacyToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": 1,
+		"exp": time.Now().Add(time.Minute).Unix(),
+	}).SignedString([]byte(secretKey))
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+
+	tests := []struct {
+		TestName             string
+		Token                string
+		ExpectedOrgID        int64
+		DefaultOrgStatusCode int
+	}{
+		{"org_id claim", orgToken, 7, http.StatusForbidden},
+		{"token without org_id belongs to default organization", legacyToken, tenant.DefaultOrgID, http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.TestName, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/url", nil)
+			request.Header.Set("Authorization", "Bearer "+test.Token)
+			var orgID int64
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				orgID, _ = tenant.OrgIDFromContext(r.Context())
+				w.WriteHeader(http.StatusOK)
+			})
+
+			auth := middlewares.AuthMiddleware(secretKey, log, nil)
+			auth(next).ServeHTTP(httptest.NewRecorder(), request)
+			if orgID != test.ExpectedOrgID {
+				t.Errorf("expected org %d in context, got %d", test.ExpectedOrgID, orgID)
+			}
+
+			responseRecorder := httptest.NewRecorder()
+			auth(middlewares.RequireDefaultOrg(log)(next)).ServeHTTP(responseRecorder, request)
+			if responseRecorder.Code != test.DefaultOrgStatusCode {
+				t.Errorf("expected status %d from RequireDefaultOrg, got %d", test.DefaultOrgStatusCode, responseRecorder.Code)
+			}
+		})
+	}
+}
+
+func TestDenyImpersonation(t *testing.T) {
+	const secretKey = "256bitsvalid256bitsvalid256bitsvalid"
+	log := slog.Default()
+	ownToken, err := jwt_tokens.CreateAccessToken(5, 1, secretKey, []string{"user"}, nil, time.Minute, log)
+	if err != nil {
+		t.Fatalf("failed to create token: %v", err)
+	}
+	impersonatedToken, err := jwt_tokens.CreateImpersonationToken(5, 1, 9, secretKey, []string{"user"}, nil, nil, time.Minute, log)
+	if err != nil {
+		t.Fatalf("failed to create token: %v", err)
+	}
+
+	tests := []struct {
+		TestName           string
+		Token              string
+		ExpectedActorID    int64
+		ExpectedStatusCode int
+	}{
+		{"own token", ownToken, 0, http.StatusOK},
+		{"impersonated token", impersonatedToken, 9, http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.TestName, func(t *testing.T) {
+			claims, err := jwt_tokens.VerifyToken(test.Token, secretKey)
+			if err != nil {
+				t.Fatalf("failed to verify token: %v", err)
+			}
+			actorID, _ := middlewares.ActorIDFromClaims(claims)
+			if actorID != test.ExpectedActorID {
+				t.Errorf("expected actor %d, got %d", test.ExpectedActorID, actorID)
+			}
+
+			request := httptest.NewRequest(http.MethodPut, "/user/password", nil)
+			request.Header.Set("Authorization", "Bearer "+test.Token)
+			responseRecorder := httptest.NewRecorder()
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			middlewares.AuthMiddleware(secretKey, log, nil)(middlewares.DenyImpersonation(log)(next)).ServeHTTP(responseRecorder, request)
+			if responseRecorder.Code != test.ExpectedStatusCode {
+				t.Errorf("expected status %d, got %d", test.ExpectedStatusCode, responseRecorder.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package middlewares
+
+import (
+	resp "github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/response"
+	"github.com/golang-jwt/jwt/v5"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// PermissionsFromClaims достаёт права из claim permissions, а если его нет - из scope (строка через пробел)
+func PermissionsFromClaims(claims jwt.MapClaims) []string {
+	if list, ok := claims["permissions"].([]interface{}); ok {
+		perms := make([]string, 0, len(list))
+		for _, item := range list {
+			if perm, ok := item.(string); ok {
+				perms = append(perms, perm)
+			}
+		}
+		return perms
+	}
+	if scope, ok := claims["scope"].(string); ok {
+		return strings.Fields(scope)
+	}
+	return nil
+}
+
+// RequirePermission пропускает запрос, если в токене есть хотя бы одно из перечисленных прав.
+// Ставится после AuthMiddleware: claims берутся из контекста
+func RequirePermission(log *slog.Logger, perms ...string) func(next http.Handler) http.Handler {
+	return requirePermissions(log, false, perms)
+}
+
+// RequireAllPermissions пропускает запрос, только если в токене есть все перечисленные права
+func RequireAllPermissions(log *slog.Logger, perms ...string) func(next http.Handler) http.Handler {
+	return requirePermissions(log, true, perms)
+}
+
+func requirePermissions(log *slog.Logger, all bool, perms []string) func(next http.Handler) http.Handler {
+	const op = "internal/lib/api/middlewares/permissions.go/RequirePermission"
+	log = log.With(slog.String("op", op), slog.Any("required", perms), slog.Bool("all", all))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, err := ClaimsFromContext(r.Context())
+			if err != nil {
+				log.Error("Failed to retrieve claims from context")
+				resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("Unauthorized"))
+				return
+			}
+			granted := PermissionsFromClaims(claims)
+			if !permissionsSatisfied(granted, perms, all) {
+				log.Debug("Permission denied", slog.Any("granted", granted))
+				resp.RenderResponse(w, r, http.StatusForbidden, resp.Error("Forbidden"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func permissionsSatisfied(granted []string, required []string, all bool) bool {
+	for _, perm := range required {
+		has := containsString(granted, perm)
+		if all && !has {
+			return false
+		}
+		if !all && has {
+			return true
+		}
+	}
+	return all
+}
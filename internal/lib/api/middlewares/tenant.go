@@ -0,0 +1,27 @@
+package middlewares
+
+import (
+	resp "github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/tenant"
+	"log/slog"
+	"net/http"
+)
+
+// RequireDefaultOrg пропускает только запросы в рамках организации по умолчанию.
+// Для ручек, которые меняют общее для всех организаций: создание организаций, правила доступа
+func RequireDefaultOrg(log *slog.Logger) func(next http.Handler) http.Handler {
+	const op = "internal/lib/api/middlewares/tenant.go/RequireDefaultOrg"
+	log = log.With(slog.String("op", op))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			orgID, ok := tenant.OrgIDFromContext(r.Context())
+			if !ok || orgID != tenant.DefaultOrgID {
+				log.Debug("Request is not in the default organization", slog.Int64("org_id", orgID))
+				resp.RenderResponse(w, r, http.StatusForbidden, resp.Error("Available only in the default organization"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
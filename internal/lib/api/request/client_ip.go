@@ -0,0 +1,16 @@
+package request
+
+import (
+	"net"
+	"net/http"
+)
+
+// ClientIP возвращает IP клиента из RemoteAddr.
+// Если сервис стоит за прокси, RemoteAddr заполняется из заголовков middleware.RealIP (настройка trust_proxy_headers)
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -3,17 +3,28 @@ package validators
 import (
 	"errors"
 	"github.com/go-playground/validator"
+	"regexp"
 )
 
 // validate Переменная хранящая в себе экземпляр валидатора.
 // она нужна что б не инициализировать экземпляр валидатора каждый раз когда нам нужно что-то провалидировать
 var validate *validator.Validate
 
+// usernamePattern Имя пользователя: 3-32 латинских буквы, цифры, точки, дефисы и подчёркивания, начинается с буквы или цифры.
+// Без @, поэтому имя нельзя спутать с email
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{2,31}$`)
+
 func InitValidator() error {
 	if validate != nil {
 		return errors.New("validator already initialized")
 	}
 	validate = validator.New()
+	// Пустая строка - имя не задано, обязательность проверяется отдельными тегами
+	if err := validate.RegisterValidation("username", func(fl validator.FieldLevel) bool {
+		return fl.Field().String() == "" || ValidUsername(fl.Field().String())
+	}); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -21,3 +32,8 @@ func InitValidator() error {
 func GetValidator() *validator.Validate {
 	return validate
 }
+
+// ValidUsername Подходит ли строка как имя пользователя
+func ValidUsername(username string) bool {
+	return usernamePattern.MatchString(username)
+}
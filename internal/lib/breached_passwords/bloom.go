@@ -0,0 +1,180 @@
+package breached_passwords
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+var bloomMagic = [4]byte{'P', 'W', 'B', 'F'}
+
+const bloomVersion uint32 = 1
+
+var ErrInvalidBloomFile = errors.New("invalid breached passwords bloom filter file")
+
+// BloomFilter Bloom фильтр по SHA-1 хешам утекших паролей.
+// Счётчики появлений в фильтре не хранятся: при сборке в него попадают только хеши с количеством не меньше MinCount
+type BloomFilter struct {
+	bits     []uint64
+	m        uint64 // Размер фильтра в битах
+	k        uint32 // Количество хеш-функций
+	MinCount uint32
+	Items    uint64
+}
+
+// NewBloomFilter создаёт пустой фильтр под expectedItems элементов с заданной вероятностью ложного срабатывания
+func NewBloomFilter(expectedItems uint64, falsePositiveRate float64, minCount uint32) *BloomFilter {
+	if expectedItems == 0 {
+		expectedItems = 1
+	}
+	if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		falsePositiveRate = 0.001
+	}
+	m := uint64(math.Ceil(-float64(expectedItems) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	m = (m + 63) / 64 * 64
+	k := uint32(math.Round(float64(m) / float64(expectedItems) * math.Ln2))
+	if k == 0 {
+		k = 1
+	}
+	return &BloomFilter{
+		bits:     make([]uint64, m/64),
+		m:        m,
+		k:        k,
+		MinCount: minCount,
+	}
+}
+
+// AddHash добавляет SHA-1 хеш в hex представлении
+func (b *BloomFilter) AddHash(hexHash string) error {
+	h1, h2, err := splitHash(hexHash)
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < b.k; i++ {
+		pos := (h1 + uint64(i)*h2) % b.m
+		b.bits[pos/64] |= 1 << (pos % 64)
+	}
+	b.Items++
+	return nil
+}
+
+// ContainsHash проверяет SHA-1 хеш. Возможны ложные срабатывания, ложных пропусков нет
+func (b *BloomFilter) ContainsHash(hexHash string) (bool, error) {
+	h1, h2, err := splitHash(hexHash)
+	if err != nil {
+		return false, err
+	}
+	for i := uint32(0); i < b.k; i++ {
+		pos := (h1 + uint64(i)*h2) % b.m
+		if b.bits[pos/64]&(1<<(pos%64)) == 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (b *BloomFilter) IsBreached(password string) (bool, error) {
+	return b.ContainsHash(PasswordHash(password))
+}
+
+// splitHash Сам SHA-1 равномерно распределён, поэтому позиции берём из его байт (double hashing)
+func splitHash(hexHash string) (uint64, uint64, error) {
+	raw, err := hex.DecodeString(hexHash)
+	if err != nil || len(raw) < 16 {
+		return 0, 0, fmt.Errorf("invalid sha1 hash %q", hexHash)
+	}
+	h1 := binary.BigEndian.Uint64(raw[:8])
+	h2 := binary.BigEndian.Uint64(raw[8:16]) | 1
+	return h1, h2, nil
+}
+
+// WriteTo сохраняет фильтр в бинарном формате
+func (b *BloomFilter) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	header := []any{bloomMagic, bloomVersion, b.m, b.k, b.MinCount, b.Items}
+	for _, field := range header {
+		if err := binary.Write(bw, binary.LittleEndian, field); err != nil {
+			return 0, err
+		}
+	}
+	if err := binary.Write(bw, binary.LittleEndian, b.bits); err != nil {
+		return 0, err
+	}
+	if err := bw.Flush(); err != nil {
+		return 0, err
+	}
+	return int64(4+4+8+4+4+8) + int64(len(b.bits))*8, nil
+}
+
+// ReadBloomFilter читает фильтр, сохранённый WriteTo
+func ReadBloomFilter(r io.Reader) (*BloomFilter, error) {
+	br := bufio.NewReader(r)
+	var magic [4]byte
+	var version uint32
+	b := &BloomFilter{}
+	for _, field := range []any{&magic, &version, &b.m, &b.k, &b.MinCount, &b.Items} {
+		if err := binary.Read(br, binary.LittleEndian, field); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidBloomFile, err)
+		}
+	}
+	if magic != bloomMagic || version != bloomVersion || b.m == 0 || b.m%64 != 0 || b.k == 0 {
+		return nil, ErrInvalidBloomFile
+	}
+	b.bits = make([]uint64, b.m/64)
+	if err := binary.Read(br, binary.LittleEndian, b.bits); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBloomFile, err)
+	}
+	return b, nil
+}
+
+// LoadBloomFilter читает фильтр из файла
+func LoadBloomFilter(path string) (*BloomFilter, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bloom filter: %w", err)
+	}
+	defer file.Close()
+	return ReadBloomFilter(file)
+}
+
+// BuildBloomFilter собирает фильтр из сырого файла "Pwned Passwords" (строки "SHA1:COUNT").
+// В фильтр попадают только хеши, встречавшиеся в утечках не меньше minCount раз
+func BuildBloomFilter(r io.Reader, expectedItems uint64, falsePositiveRate float64, minCount uint32) (*BloomFilter, error) {
+	filter := NewBloomFilter(expectedItems, falsePositiveRate, minCount)
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		hash, count, ok := ParseLine(scanner.Text())
+		if !ok {
+			continue
+		}
+		if count < int(minCount) {
+			continue
+		}
+		if err := filter.AddHash(hash); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// CountEntries считает строки набора, подходящие под minCount. Нужен для расчёта размера фильтра
+func CountEntries(r io.Reader, minCount uint32) (uint64, error) {
+	scanner := bufio.NewScanner(r)
+	var count uint64
+	for scanner.Scan() {
+		if _, c, ok := ParseLine(scanner.Text()); ok && c >= int(minCount) {
+			count++
+		}
+	}
+	return count, scanner.Err()
+}
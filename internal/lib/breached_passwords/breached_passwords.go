@@ -0,0 +1,110 @@
+package breached_passwords
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Форматы локального набора утекших паролей
+const (
+	FormatPrefixDir = "prefix_dir" // Каталог с файлами по 5-символьному префиксу SHA-1, как отдаёт range API "Pwned Passwords"
+	FormatBloom     = "bloom"      // Bloom фильтр, собранный командой build-breach-filter
+	prefixLength    = 5
+)
+
+var ErrUnknownFormat = errors.New("unknown breached passwords dataset format")
+
+// Checker Проверяет, встречался ли пароль в известных утечках
+type Checker interface {
+	IsBreached(password string) (bool, error)
+}
+
+// NewChecker создаёт проверку по локальному набору данных в зависимости от формата.
+// minCount - минимальное количество появлений пароля в утечках, начиная с которого пароль считается скомпрометированным
+func NewChecker(format string, path string, minCount int) (Checker, error) {
+	switch format {
+	case FormatPrefixDir:
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open breached passwords dataset: %w", err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("breached passwords dataset %s is not a directory", path)
+		}
+		return &PrefixDirChecker{dir: path, minCount: minCount}, nil
+	case FormatBloom:
+		filter, err := LoadBloomFilter(path)
+		if err != nil {
+			return nil, err
+		}
+		return filter, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+	}
+}
+
+// PasswordHash Возвращает SHA-1 пароля в верхнем регистре, как в наборах "Pwned Passwords"
+func PasswordHash(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// PrefixDirChecker Проверка по каталогу k-anonymity: файл с именем префикса хеша содержит строки "SUFFIX:COUNT"
+type PrefixDirChecker struct {
+	dir      string
+	minCount int
+}
+
+func (c *PrefixDirChecker) IsBreached(password string) (bool, error) {
+	hash := PasswordHash(password)
+	prefix, suffix := hash[:prefixLength], hash[prefixLength:]
+
+	file, err := c.openPrefixFile(prefix)
+	if errors.Is(err, os.ErrNotExist) {
+		// Нет файла - нет ни одного хеша с таким префиксом
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lineSuffix, count, ok := ParseLine(scanner.Text())
+		if !ok || lineSuffix != suffix {
+			continue
+		}
+		return count >= c.minCount, nil
+	}
+	return false, scanner.Err()
+}
+
+// openPrefixFile Файлы могут быть сохранены как "ABCDE" или "ABCDE.txt"
+func (c *PrefixDirChecker) openPrefixFile(prefix string) (*os.File, error) {
+	file, err := os.Open(filepath.Join(c.dir, prefix))
+	if errors.Is(err, os.ErrNotExist) {
+		return os.Open(filepath.Join(c.dir, prefix+".txt"))
+	}
+	return file, err
+}
+
+// ParseLine Разбирает строку вида "HASH:COUNT". Хеш приводится к верхнему регистру
+func ParseLine(line string) (string, int, bool) {
+	hash, countStr, found := strings.Cut(strings.TrimSpace(line), ":")
+	if !found || hash == "" {
+		return "", 0, false
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(countStr))
+	if err != nil {
+		return "", 0, false
+	}
+	return strings.ToUpper(hash), count, true
+}
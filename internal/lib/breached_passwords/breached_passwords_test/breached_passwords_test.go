@@ -0,0 +1,83 @@
+package breached_passwords_test
+
+import (
+	"bytes"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/breached_passwords"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// rawDataset Сырой набор в формате "Pwned Passwords": password - 100 раз, 123456 - 3 раза
+func rawDataset() string {
+	return breached_passwords.PasswordHash("password") + ":100\n" +
+		breached_passwords.PasswordHash("123456") + ":3\n"
+}
+
+func TestBloomFilter(t *testing.T) {
+	filter, err := breached_passwords.BuildBloomFilter(strings.NewReader(rawDataset()), 2, 0.001, 10)
+	if err != nil {
+		t.Fatal("BuildBloomFilter is failed. Error: ", err)
+	}
+
+	var buf bytes.Buffer
+	if _, err = filter.WriteTo(&buf); err != nil {
+		t.Fatal("WriteTo is failed. Error: ", err)
+	}
+	loaded, err := breached_passwords.ReadBloomFilter(&buf)
+	if err != nil {
+		t.Fatal("ReadBloomFilter is failed. Error: ", err)
+	}
+	if loaded.MinCount != 10 || loaded.Items != 1 {
+		t.Errorf("unexpected filter header: min_count=%d items=%d", loaded.MinCount, loaded.Items)
+	}
+
+	tests := []struct {
+		TestName string
+		Password string
+		Breached bool
+	}{
+		{TestName: "Breached more than min count", Password: "password", Breached: true},
+		{TestName: "Breached less than min count", Password: "123456", Breached: false},
+		{TestName: "Not breached", Password: "Vq7#lp2Rz!mW", Breached: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.TestName, func(t *testing.T) {
+			breached, err := loaded.IsBreached(tt.Password)
+			if err != nil {
+				t.Fatal("IsBreached is failed. Error: ", err)
+			}
+			if breached != tt.Breached {
+				t.Errorf("expected breached=%v, got %v", tt.Breached, breached)
+			}
+		})
+	}
+}
+
+func TestPrefixDirChecker(t *testing.T) {
+	dir := t.TempDir()
+	hash := breached_passwords.PasswordHash("password")
+	if err := os.WriteFile(filepath.Join(dir, hash[:5]+".txt"), []byte(hash[5:]+":100\r\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	checker, err := breached_passwords.NewChecker(breached_passwords.FormatPrefixDir, dir, 50)
+	if err != nil {
+		t.Fatal("NewChecker is failed. Error: ", err)
+	}
+	if breached, err := checker.IsBreached("password"); err != nil || !breached {
+		t.Errorf("expected password to be breached, got %v, error: %v", breached, err)
+	}
+	if breached, err := checker.IsBreached("Vq7#lp2Rz!mW"); err != nil || breached {
+		t.Errorf("expected password not to be breached, got %v, error: %v", breached, err)
+	}
+
+	strict, err := breached_passwords.NewChecker(breached_passwords.FormatPrefixDir, dir, 1000)
+	if err != nil {
+		t.Fatal("NewChecker is failed. Error: ", err)
+	}
+	if breached, _ := strict.IsBreached("password"); breached {
+		t.Error("expected password below min count not to be breached")
+	}
+}
@@ -0,0 +1,243 @@
+package bulk_users
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Форматы файлов импорта и выгрузки
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+// rolesSeparator Разделитель ролей в колонке roles CSV файла
+const rolesSeparator = ";"
+
+// maxLineBytes Максимальная длина строки JSON Lines файла
+const maxLineBytes = 1 << 20
+
+var ErrUnknownFormat = errors.New("unknown file format, expected csv or jsonl")
+var ErrMissingEmailColumn = errors.New("CSV header must contain email column")
+
+// csvColumns Колонки CSV файла выгрузки. При импорте порядок не важен, неизвестные колонки пропускаются,
+// а id, status и created_at не читаются: выгрузку можно загрузить обратно без правок
+var csvColumns = []string{"id", "email", "first_name", "last_name", "password_hash", "roles", "status", "created_at"}
+
+// Record Пользователь в файле импорта или выгрузки
+type Record struct {
+	Line         int        `json:"-"` // Номер строки в файле, для отчёта об ошибках
+	ID           int64      `json:"id,omitempty"`
+	Email        string     `json:"email"`
+	FirstName    string     `json:"first_name"`
+	LastName     string     `json:"last_name"`
+	PasswordHash string     `json:"password_hash,omitempty"` // bcrypt или argon2id хеш в PHC формате
+	Roles        []string   `json:"roles"`
+	Status       string     `json:"status,omitempty"`
+	CreatedAt    *time.Time `json:"created_at,omitempty"`
+}
+
+// RowError Ошибка в строке файла. Чтение можно продолжать со следующей строки
+type RowError struct {
+	Line int
+	Err  error
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// Reader Читает пользователей по одному, не загружая файл в память.
+// Next возвращает io.EOF в конце файла, *RowError - если строка испорчена, но следующие читать можно.
+// Любая другая ошибка означает, что файл дальше не читается
+type Reader interface {
+	Next() (Record, error)
+}
+
+// Writer Пишет пользователей по одному. Flush дописывает буфер в нижележащий io.Writer
+type Writer interface {
+	Write(record Record) error
+	Flush() error
+}
+
+// ValidFormat Поддерживается ли формат
+func ValidFormat(format string) bool {
+	return format == FormatCSV || format == FormatJSONL
+}
+
+// NewReader Создаёт чтение файла в формате format. CSV файл должен начинаться со строки заголовков
+func NewReader(format string, r io.Reader) (Reader, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVReader(r)
+	case FormatJSONL:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxLineBytes)
+		return &jsonlReader{scanner: scanner}, nil
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+// NewWriter Создаёт запись файла в формате format. В CSV сразу пишется строка заголовков
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(csvColumns); err != nil {
+			return nil, err
+		}
+		return &csvWriter{writer: writer}, nil
+	case FormatJSONL:
+		buffered := bufio.NewWriter(w)
+		return &jsonlWriter{buffered: buffered, encoder: json.NewEncoder(buffered)}, nil
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+// ContentType MIME тип файла выгрузки
+func ContentType(format string) string {
+	if format == FormatCSV {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/x-ndjson"
+}
+
+type csvReader struct {
+	reader  *csv.Reader
+	columns map[string]int
+}
+
+func newCSVReader(r io.Reader) (*csvReader, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, ErrMissingEmailColumn
+	}
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		// Excel добавляет BOM в начало файла
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		columns[name] = i
+	}
+	if _, ok := columns["email"]; !ok {
+		return nil, ErrMissingEmailColumn
+	}
+	return &csvReader{reader: reader, columns: columns}, nil
+}
+
+func (c *csvReader) Next() (Record, error) {
+	fields, err := c.reader.Read()
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return Record{}, &RowError{Line: parseErr.StartLine, Err: parseErr.Err}
+	}
+	if err != nil {
+		return Record{}, err
+	}
+	line, _ := c.reader.FieldPos(0)
+	column := func(name string) string {
+		if i, ok := c.columns[name]; ok && i < len(fields) {
+			return strings.TrimSpace(fields[i])
+		}
+		return ""
+	}
+	record := Record{
+		Line:         line,
+		Email:        column("email"),
+		FirstName:    column("first_name"),
+		LastName:     column("last_name"),
+		PasswordHash: column("password_hash"),
+	}
+	for _, role := range strings.Split(column("roles"), rolesSeparator) {
+		if role = strings.TrimSpace(role); role != "" {
+			record.Roles = append(record.Roles, role)
+		}
+	}
+	return record, nil
+}
+
+type jsonlReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func (j *jsonlReader) Next() (Record, error) {
+	for j.scanner.Scan() {
+		j.line++
+		text := strings.TrimSpace(j.scanner.Text())
+		if text == "" {
+			continue
+		}
+		var record Record
+		if err := json.Unmarshal([]byte(text), &record); err != nil {
+			return Record{}, &RowError{Line: j.line, Err: fmt.Errorf("invalid JSON: %w", err)}
+		}
+		record.Line = j.line
+		record.Email = strings.TrimSpace(record.Email)
+		return record, nil
+	}
+	if err := j.scanner.Err(); err != nil {
+		return Record{}, err
+	}
+	return Record{}, io.EOF
+}
+
+type csvWriter struct {
+	writer *csv.Writer
+}
+
+func (c *csvWriter) Write(record Record) error {
+	createdAt := ""
+	if record.CreatedAt != nil {
+		createdAt = record.CreatedAt.UTC().Format(time.RFC3339)
+	}
+	return c.writer.Write([]string{
+		strconv.FormatInt(record.ID, 10),
+		record.Email,
+		record.FirstName,
+		record.LastName,
+		record.PasswordHash,
+		strings.Join(record.Roles, rolesSeparator),
+		record.Status,
+		createdAt,
+	})
+}
+
+func (c *csvWriter) Flush() error {
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+type jsonlWriter struct {
+	buffered *bufio.Writer
+	encoder  *json.Encoder
+}
+
+func (j *jsonlWriter) Write(record Record) error {
+	if record.Roles == nil {
+		record.Roles = []string{}
+	}
+	return j.encoder.Encode(record)
+}
+
+func (j *jsonlWriter) Flush() error {
+	return j.buffered.Flush()
+}
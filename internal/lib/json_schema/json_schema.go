@@ -0,0 +1,397 @@
+package json_schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/mail"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Поддерживается подмножество JSON Schema (draft 2020-12), которого хватает для проверки плоских атрибутов.
+// Остальные ключевые слова при загрузке схемы дают ошибку, что б не казалось, будто они проверяются
+var supportedKeywords = map[string]bool{
+	"type": true, "properties": true, "required": true, "additionalProperties": true, "maxProperties": true,
+	"items": true, "minItems": true, "maxItems": true, "uniqueItems": true,
+	"enum": true, "const": true,
+	"minLength": true, "maxLength": true, "pattern": true, "format": true,
+	"minimum": true, "maximum": true, "exclusiveMinimum": true, "exclusiveMaximum": true,
+	// Аннотации ни на что не влияют
+	"$schema": true, "$id": true, "$comment": true, "title": true, "description": true, "default": true, "examples": true,
+}
+
+var supportedFormats = map[string]func(string) bool{
+	"email": func(value string) bool {
+		address, err := mail.ParseAddress(value)
+		return err == nil && address.Address == value
+	},
+	"date": func(value string) bool {
+		_, err := time.Parse(time.DateOnly, value)
+		return err == nil
+	},
+	"date-time": func(value string) bool {
+		_, err := time.Parse(time.RFC3339, value)
+		return err == nil
+	},
+}
+
+var ErrInvalidSchema = errors.New("invalid JSON schema")
+
+// Schema Скомпилированная схема
+type Schema struct {
+	types                []string
+	properties           map[string]*Schema
+	required             []string
+	additionalProperties *Schema // nil - любые
+	noAdditional         bool    // additionalProperties: false
+	maxProperties        *int
+	items                *Schema
+	minItems, maxItems   *int
+	uniqueItems          bool
+	enum                 []interface{}
+	constValue           *interface{}
+	minLength, maxLength *int
+	pattern              *regexp.Regexp
+	format               string
+	minimum, maximum     *float64
+	exclusiveMinimum     *float64
+	exclusiveMaximum     *float64
+}
+
+// rawSchema Схема в том виде, в каком она записана в файле
+type rawSchema struct {
+	Type                 json.RawMessage            `json:"type"`
+	Properties           map[string]json.RawMessage `json:"properties"`
+	Required             []string                   `json:"required"`
+	AdditionalProperties json.RawMessage            `json:"additionalProperties"`
+	MaxProperties        *int                       `json:"maxProperties"`
+	Items                json.RawMessage            `json:"items"`
+	MinItems             *int                       `json:"minItems"`
+	MaxItems             *int                       `json:"maxItems"`
+	UniqueItems          bool                       `json:"uniqueItems"`
+	Enum                 []interface{}              `json:"enum"`
+	Const                json.RawMessage            `json:"const"`
+	MinLength            *int                       `json:"minLength"`
+	MaxLength            *int                       `json:"maxLength"`
+	Pattern              *string                    `json:"pattern"`
+	Format               string                     `json:"format"`
+	Minimum              *float64                   `json:"minimum"`
+	Maximum              *float64                   `json:"maximum"`
+	ExclusiveMinimum     *float64                   `json:"exclusiveMinimum"`
+	ExclusiveMaximum     *float64                   `json:"exclusiveMaximum"`
+}
+
+// LoadFile Загружает схему из JSON файла
+func LoadFile(path string) (*Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Compile(data)
+}
+
+// Compile Разбирает схему. true и false - схемы "всё подходит" и "ничего не подходит"
+func Compile(data []byte) (*Schema, error) {
+	return compile(data, "")
+}
+
+func compile(data []byte, path string) (*Schema, error) {
+	data = bytes.TrimSpace(data)
+	switch string(data) {
+	case "true":
+		return &Schema{}, nil
+	case "false":
+		return &Schema{types: []string{}}, nil
+	}
+
+	var keywords map[string]json.RawMessage
+	if err := json.Unmarshal(data, &keywords); err != nil {
+		return nil, schemaError(path, "schema must be an object or boolean")
+	}
+	for keyword := range keywords {
+		if !supportedKeywords[keyword] {
+			return nil, schemaError(path, fmt.Sprintf("unsupported keyword %q", keyword))
+		}
+	}
+	var raw rawSchema
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, schemaError(path, err.Error())
+	}
+
+	schema := &Schema{
+		required:         raw.Required,
+		maxProperties:    raw.MaxProperties,
+		minItems:         raw.MinItems,
+		maxItems:         raw.MaxItems,
+		uniqueItems:      raw.UniqueItems,
+		enum:             raw.Enum,
+		minLength:        raw.MinLength,
+		maxLength:        raw.MaxLength,
+		format:           raw.Format,
+		minimum:          raw.Minimum,
+		maximum:          raw.Maximum,
+		exclusiveMinimum: raw.ExclusiveMinimum,
+		exclusiveMaximum: raw.ExclusiveMaximum,
+	}
+	if len(raw.Type) > 0 {
+		types, err := parseTypes(raw.Type)
+		if err != nil {
+			return nil, schemaError(path, err.Error())
+		}
+		schema.types = types
+	}
+	if raw.Format != "" && supportedFormats[raw.Format] == nil {
+		return nil, schemaError(path, fmt.Sprintf("unsupported format %q", raw.Format))
+	}
+	if raw.Pattern != nil {
+		pattern, err := regexp.Compile(*raw.Pattern)
+		if err != nil {
+			return nil, schemaError(path, "invalid pattern: "+err.Error())
+		}
+		schema.pattern = pattern
+	}
+	if len(raw.Const) > 0 {
+		var value interface{}
+		if err := json.Unmarshal(raw.Const, &value); err != nil {
+			return nil, schemaError(path, "invalid const")
+		}
+		schema.constValue = &value
+	}
+	if len(raw.Properties) > 0 {
+		schema.properties = make(map[string]*Schema, len(raw.Properties))
+		for name, property := range raw.Properties {
+			compiled, err := compile(property, path+"/properties/"+name)
+			if err != nil {
+				return nil, err
+			}
+			schema.properties[name] = compiled
+		}
+	}
+	if len(raw.AdditionalProperties) > 0 {
+		if string(bytes.TrimSpace(raw.AdditionalProperties)) == "false" {
+			schema.noAdditional = true
+		} else {
+			compiled, err := compile(raw.AdditionalProperties, path+"/additionalProperties")
+			if err != nil {
+				return nil, err
+			}
+			schema.additionalProperties = compiled
+		}
+	}
+	if len(raw.Items) > 0 {
+		compiled, err := compile(raw.Items, path+"/items")
+		if err != nil {
+			return nil, err
+		}
+		schema.items = compiled
+	}
+	return schema, nil
+}
+
+func parseTypes(raw json.RawMessage) ([]string, error) {
+	var types []string
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil {
+		types = []string{single}
+	} else if err = json.Unmarshal(raw, &types); err != nil {
+		return nil, errors.New("type must be a string or an array of strings")
+	}
+	for _, t := range types {
+		switch t {
+		case "null", "boolean", "object", "array", "number", "integer", "string":
+		default:
+			return nil, fmt.Errorf("unknown type %q", t)
+		}
+	}
+	return types, nil
+}
+
+func schemaError(path string, msg string) error {
+	if path == "" {
+		path = "/"
+	}
+	return fmt.Errorf("%w: %s: %s", ErrInvalidSchema, path, msg)
+}
+
+// Property Схема свойства name. nil, если схема его не описывает
+func (s *Schema) Property(name string) *Schema {
+	if s == nil {
+		return nil
+	}
+	return s.properties[name]
+}
+
+// ValidationError Все нарушения схемы. Каждое - JSON Pointer на значение и описание
+type ValidationError struct {
+	Violations []string
+}
+
+func (e *ValidationError) Error() string {
+	return "value does not match schema: " + strings.Join(e.Violations, "; ")
+}
+
+// Validate Проверяет значение, разобранное encoding/json (map[string]interface{}, []interface{}, float64 и т.д.)
+func (s *Schema) Validate(value interface{}) error {
+	var violations []string
+	s.validate(value, "", &violations)
+	if len(violations) > 0 {
+		return &ValidationError{Violations: violations}
+	}
+	return nil
+}
+
+func (s *Schema) validate(value interface{}, path string, violations *[]string) {
+	fail := func(format string, args ...interface{}) {
+		pointer := path
+		if pointer == "" {
+			pointer = "/"
+		}
+		*violations = append(*violations, pointer+": "+fmt.Sprintf(format, args...))
+	}
+
+	if s.types != nil && !matchesType(value, s.types) {
+		if len(s.types) == 0 {
+			fail("no value is allowed")
+		} else {
+			fail("must be %s", strings.Join(s.types, " or "))
+		}
+		return
+	}
+	if s.constValue != nil && !reflect.DeepEqual(value, *s.constValue) {
+		fail("must be %v", *s.constValue)
+	}
+	if s.enum != nil && !containsValue(s.enum, value) {
+		fail("must be one of %v", s.enum)
+	}
+
+	switch typed := value.(type) {
+	case string:
+		length := utf8.RuneCountInString(typed)
+		if s.minLength != nil && length < *s.minLength {
+			fail("must be at least %d characters", *s.minLength)
+		}
+		if s.maxLength != nil && length > *s.maxLength {
+			fail("must be at most %d characters", *s.maxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(typed) {
+			fail("must match %s", s.pattern.String())
+		}
+		if s.format != "" && !supportedFormats[s.format](typed) {
+			fail("must be a valid %s", s.format)
+		}
+	case float64:
+		if s.minimum != nil && typed < *s.minimum {
+			fail("must be >= %v", *s.minimum)
+		}
+		if s.maximum != nil && typed > *s.maximum {
+			fail("must be <= %v", *s.maximum)
+		}
+		if s.exclusiveMinimum != nil && typed <= *s.exclusiveMinimum {
+			fail("must be > %v", *s.exclusiveMinimum)
+		}
+		if s.exclusiveMaximum != nil && typed >= *s.exclusiveMaximum {
+			fail("must be < %v", *s.exclusiveMaximum)
+		}
+	case []interface{}:
+		if s.minItems != nil && len(typed) < *s.minItems {
+			fail("must contain at least %d items", *s.minItems)
+		}
+		if s.maxItems != nil && len(typed) > *s.maxItems {
+			fail("must contain at most %d items", *s.maxItems)
+		}
+		if s.uniqueItems {
+			for i := range typed {
+				if containsValue(typed[:i], typed[i]) {
+					fail("items must be unique")
+					break
+				}
+			}
+		}
+		if s.items != nil {
+			for i, item := range typed {
+				s.items.validate(item, fmt.Sprintf("%s/%d", path, i), violations)
+			}
+		}
+	case map[string]interface{}:
+		if s.maxProperties != nil && len(typed) > *s.maxProperties {
+			fail("must have at most %d properties", *s.maxProperties)
+		}
+		for _, name := range s.required {
+			if _, ok := typed[name]; !ok {
+				fail("property %q is required", name)
+			}
+		}
+		// Сортируем, что б порядок ошибок не зависел от порядка обхода map
+		names := make([]string, 0, len(typed))
+		for name := range typed {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			propertyPath := path + "/" + escapePointer(name)
+			if property, ok := s.properties[name]; ok {
+				property.validate(typed[name], propertyPath, violations)
+				continue
+			}
+			if s.noAdditional {
+				*violations = append(*violations, propertyPath+": property is not allowed")
+			} else if s.additionalProperties != nil {
+				s.additionalProperties.validate(typed[name], propertyPath, violations)
+			}
+		}
+	}
+}
+
+func matchesType(value interface{}, types []string) bool {
+	for _, t := range types {
+		switch typed := value.(type) {
+		case nil:
+			if t == "null" {
+				return true
+			}
+		case bool:
+			if t == "boolean" {
+				return true
+			}
+		case string:
+			if t == "string" {
+				return true
+			}
+		case float64:
+			if t == "number" || (t == "integer" && typed == math.Trunc(typed)) {
+				return true
+			}
+		case []interface{}:
+			if t == "array" {
+				return true
+			}
+		case map[string]interface{}:
+			if t == "object" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func containsValue(values []interface{}, value interface{}) bool {
+	for _, candidate := range values {
+		if reflect.DeepEqual(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// escapePointer Экранирует имя свойства для JSON Pointer (RFC 6901)
+func escapePointer(name string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(name)
+}
@@ -2,38 +2,102 @@ package jwt_tokens
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/golang-jwt/jwt/v5"
 	"log/slog"
 	"strconv"
+	"strings"
 	"time"
 )
 
-func CreateAccessToken(userID int64, secretKey string, userRole string, duration time.Duration, log *slog.Logger) (string, error) {
+// LegacyRole Значение старого claim user_role для клиентов, которые ещё не читают roles
+func LegacyRole(roles []string) string {
+	for _, role := range roles {
+		if role == "admin" {
+			return "admin"
+		}
+	}
+	return "user"
+}
+
+// CreateAccessToken Создаёт access токен. Роли кладутся массивом в claim roles и, для обратной совместимости, одной строкой в user_role.
+// Права кладутся массивом в permissions и строкой через пробел в scope (как в OAuth 2.0).
+// Роли и права относятся к организации orgID, она кладётся в claim org_id
+func CreateAccessToken(userID int64, orgID int64, secretKey string, roles []string, permissions []string, duration time.Duration, log *slog.Logger) (string, error) {
 	const op = "internal/lib/jwt_tokens/jwt_token.go/CreateAccessToken"
 	log = log.With(
 		slog.String("op", op),
 		slog.String("user_id", strconv.FormatInt(userID, 10)))
 
+	return signAccessToken(accessClaims(userID, orgID, roles, permissions, duration), secretKey, log)
+}
+
+// CreateAccessTokenWithClaims То же, что CreateAccessToken, плюс дополнительные claims (атрибуты пользователя).
+// Claims, которые выставляет сервис, дополнительными не перезаписываются
+func CreateAccessTokenWithClaims(userID int64, orgID int64, secretKey string, roles []string, permissions []string, extraClaims map[string]interface{}, duration time.Duration, log *slog.Logger) (string, error) {
+	const op = "internal/lib/jwt_tokens/jwt_token.go/CreateAccessTokenWithClaims"
+	log = log.With(
+		slog.String("op", op),
+		slog.String("user_id", strconv.FormatInt(userID, 10)))
+
+	claims := accessClaims(userID, orgID, roles, permissions, duration)
+	addExtraClaims(claims, extraClaims)
+	return signAccessToken(claims, secretKey, log)
+}
+
+// CreateImpersonationToken Создаёт access токен пользователя userID для администратора actorID.
+// Администратор кладётся в claim act (RFC 8693): по нему ручки понимают, что токен выдан не самому пользователю.
+// Refresh токен к нему не выдаётся
+func CreateImpersonationToken(userID int64, orgID int64, actorID int64, secretKey string, roles []string, permissions []string, extraClaims map[string]interface{}, duration time.Duration, log *slog.Logger) (string, error) {
+	const op = "internal/lib/jwt_tokens/jwt_token.go/CreateImpersonationToken"
+	log = log.With(
+		slog.String("op", op),
+		slog.String("user_id", strconv.FormatInt(userID, 10)),
+		slog.Int64("actor_id", actorID))
+
+	claims := accessClaims(userID, orgID, roles, permissions, duration)
+	claims["act"] = map[string]interface{}{"sub": actorID}
+	addExtraClaims(claims, extraClaims)
+	return signAccessToken(claims, secretKey, log)
+}
+
+func accessClaims(userID int64, orgID int64, roles []string, permissions []string, duration time.Duration) jwt.MapClaims {
+	// Создаем claims
+	return jwt.MapClaims{
+		"roles":       roles,
+		"user_role":   LegacyRole(roles),
+		"permissions": permissions,
+		"scope":       strings.Join(permissions, " "),
+		"sub":         userID,                          // Идентификатор пользователя
+		"org_id":      orgID,                           // Организация, в которую выполнен вход
+		"iat":         time.Now().Unix(),               // Время выпуска токена
+		"exp":         time.Now().Add(duration).Unix(), // Время истечения (1 час)
+	}
+}
+
+func addExtraClaims(claims jwt.MapClaims, extraClaims map[string]interface{}) {
+	for name, value := range extraClaims {
+		if _, exists := claims[name]; !exists {
+			claims[name] = value
+		}
+	}
+}
+
+func signAccessToken(claims jwt.MapClaims, secretKey string, log *slog.Logger) (string, error) {
 	if len([]byte(secretKey)) < 32 {
 		log.Error("secret key too short")
 		return "", errors.New("secret key too short")
 	}
-	// Создаем claims
-	claims := jwt.MapClaims{
-		"user_role": userRole,
-		"sub":       userID,                          // Идентификатор пользователя
-		"iat":       time.Now().Unix(),               // Время выпуска токена
-		"exp":       time.Now().Add(duration).Unix(), // Время истечения (1 час)
-	}
 	// Создаем токен с алгоритмом HS256
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	// Подписываем токен секретным ключом
 	tokenString, err := token.SignedString([]byte(secretKey))
 	if err != nil {
-		log.Error("token generate failed", op, err)
+		log.Error("token generate failed", "err", err)
 		return "", err
 	}
 	return tokenString, nil
@@ -76,3 +140,10 @@ func CreateRefreshToken(log *slog.Logger) (string, error) {
 	// Кодируем в base64 и обрезаем до нужной длины
 	return base64.URLEncoding.EncodeToString(byteArray)[:32], nil
 }
+
+// HashOpaqueToken Возвращает SHA-256 от одноразового токена (ссылки для входа, коды).
+// В БД храним только хеш, что б утечка таблицы не давала готовых токенов
+func HashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,23 @@
+package mailer
+
+import (
+	"context"
+	"log/slog"
+)
+
+// LogMailer Не отправляет письма, а пишет их в лог. Для локальной разработки и тестовых стендов
+type LogMailer struct {
+	log *slog.Logger
+}
+
+func NewLogMailer(log *slog.Logger) *LogMailer {
+	return &LogMailer{log: log.With(slog.String("op", "internal/lib/mailer/LogMailer"))}
+}
+
+func (m *LogMailer) Send(_ context.Context, msg Message) error {
+	m.log.Info("Email message",
+		slog.String("to", msg.To),
+		slog.String("subject", msg.Subject),
+		slog.String("body", msg.Body))
+	return nil
+}
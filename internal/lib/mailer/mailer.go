@@ -0,0 +1,50 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// Доступные способы отправки писем
+const (
+	BackendLog  = "log"
+	BackendSMTP = "smtp"
+)
+
+var ErrUnknownBackend = errors.New("unknown mailer backend")
+
+// Message Письмо пользователю
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer Отправка писем пользователям
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Config Настройки отправки писем
+type Config struct {
+	Backend      string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUser     string
+	SMTPPassword string
+	From         string
+}
+
+// NewMailer создаёт отправщик писем по названию бэкенда
+func NewMailer(cfg Config, log *slog.Logger) (Mailer, error) {
+	switch cfg.Backend {
+	case BackendLog, "":
+		return NewLogMailer(log), nil
+	case BackendSMTP:
+		return NewSMTPMailer(cfg), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownBackend, cfg.Backend)
+	}
+}
@@ -0,0 +1,20 @@
+package message_sender
+
+import (
+	"context"
+	"log/slog"
+)
+
+// LogSender Пишет сообщения в лог вместо отправки. Для локальной разработки
+type LogSender struct {
+	log *slog.Logger
+}
+
+func NewLogSender(log *slog.Logger) *LogSender {
+	return &LogSender{log: log.With(slog.String("op", "internal/lib/message_sender/LogSender"))}
+}
+
+func (s *LogSender) Send(_ context.Context, phone string, text string) error {
+	s.log.Info("Phone message", slog.String("phone", phone), slog.String("text", text))
+	return nil
+}
@@ -0,0 +1,48 @@
+package message_sender
+
+import (
+	"context"
+	"sync"
+)
+
+// Message Отправленное сообщение
+type Message struct {
+	Phone string
+	Text  string
+}
+
+// MemorySender Складывает сообщения в память. Для тестов: можно достать код, который "ушёл" пользователю
+type MemorySender struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemorySender() *MemorySender {
+	return &MemorySender{}
+}
+
+func (s *MemorySender) Send(_ context.Context, phone string, text string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, Message{Phone: phone, Text: text})
+	return nil
+}
+
+// Messages Копия всех отправленных сообщений
+func (s *MemorySender) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Last Последнее сообщение на номер. false - сообщений не было
+func (s *MemorySender) Last(phone string) (Message, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.messages) - 1; i >= 0; i-- {
+		if s.messages[i].Phone == phone {
+			return s.messages[i], true
+		}
+	}
+	return Message{}, false
+}
@@ -0,0 +1,34 @@
+package message_sender
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// Доступные способы отправки сообщений
+const (
+	BackendLog    = "log"
+	BackendMemory = "memory"
+)
+
+var ErrUnknownBackend = errors.New("unknown message sender backend")
+
+// MessageSender Отправка коротких сообщений на телефон (SMS, мессенджеры).
+// Конкретный провайдер подключается отдельной реализацией
+type MessageSender interface {
+	Send(ctx context.Context, phone string, text string) error
+}
+
+// NewMessageSender создаёт отправщик по названию бэкенда
+func NewMessageSender(backend string, log *slog.Logger) (MessageSender, error) {
+	switch backend {
+	case BackendLog, "":
+		return NewLogSender(log), nil
+	case BackendMemory:
+		return NewMemorySender(), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownBackend, backend)
+	}
+}
@@ -0,0 +1,161 @@
+package password_hasher
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"strings"
+)
+
+// Значения по умолчанию - рекомендация OWASP для argon2id
+const (
+	defaultArgonMemory      = 19 * 1024 // KiB
+	defaultArgonTime        = 2
+	defaultArgonParallelism = 1
+	argonSaltLength         = 16
+	argonKeyLength          = 32
+	// argonMaxPasswordBytes argon2 не обрезает пароль, ограничение нужно только что б не хешировать мегабайты
+	argonMaxPasswordBytes = 1024
+	// Пределы параметров чужих хешей по умолчанию: хеш из импорта или из БД не должен занять всю память сервиса
+	defaultArgonMaxMemory      = 256 * 1024 // KiB
+	defaultArgonMaxTime        = 10
+	defaultArgonMaxParallelism = 16
+	// Длины соли и ключа, которые принимаются при разборе хеша (соль по спецификации argon2 - от 8 байт)
+	argonMinSaltLength = 8
+	argonMaxSaltLength = 64
+	argonMinKeyLength  = 16
+	argonMaxKeyLength  = 64
+)
+
+// Argon2idParams Параметры argon2id
+type Argon2idParams struct {
+	Memory      uint32 // Память в KiB
+	Time        uint32 // Количество итераций
+	Parallelism uint8  // Количество потоков
+}
+
+// Argon2idLimits Максимальные параметры хеша, который можно проверить. Хеши с большими параметрами
+// (импортированные или записанные в БД в обход сервиса) отклоняются как ErrInvalidHash, а не вычисляются
+type Argon2idLimits struct {
+	MaxMemory      uint32 // KiB
+	MaxTime        uint32
+	MaxParallelism uint8
+}
+
+// Argon2idHasher argon2id с хешами в PHC формате: $argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>
+type Argon2idHasher struct {
+	params Argon2idParams
+	limits Argon2idLimits
+}
+
+// NewArgon2idHasher создаёт argon2id хешер. Незаданные параметры и пределы заменяются значениями по умолчанию,
+// а пределы не бывают меньше собственных параметров, иначе хешер не смог бы проверить свои же хеши
+func NewArgon2idHasher(params Argon2idParams, limits Argon2idLimits) *Argon2idHasher {
+	if params.Memory == 0 {
+		params.Memory = defaultArgonMemory
+	}
+	if params.Time == 0 {
+		params.Time = defaultArgonTime
+	}
+	if params.Parallelism == 0 {
+		params.Parallelism = defaultArgonParallelism
+	}
+	if limits.MaxMemory == 0 {
+		limits.MaxMemory = defaultArgonMaxMemory
+	}
+	if limits.MaxTime == 0 {
+		limits.MaxTime = defaultArgonMaxTime
+	}
+	if limits.MaxParallelism == 0 {
+		limits.MaxParallelism = defaultArgonMaxParallelism
+	}
+	limits.MaxMemory = max(limits.MaxMemory, params.Memory)
+	limits.MaxTime = max(limits.MaxTime, params.Time)
+	limits.MaxParallelism = max(limits.MaxParallelism, params.Parallelism)
+	return &Argon2idHasher{params: params, limits: limits}
+}
+
+func (a *Argon2idHasher) Algorithm() string {
+	return AlgorithmArgon2id
+}
+
+func (a *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, argonSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, a.params.Time, a.params.Memory, a.params.Parallelism, argonKeyLength)
+	return encodeArgon2id(a.params, salt, key), nil
+}
+
+func (a *Argon2idHasher) Compare(hash string, password string) (bool, error) {
+	params, salt, key, err := decodeArgon2id(hash, a.limits)
+	if err != nil {
+		return false, err
+	}
+	otherKey := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Parallelism, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, otherKey) == 1, nil
+}
+
+func (a *Argon2idHasher) NeedsRehash(hash string) bool {
+	params, salt, key, err := decodeArgon2id(hash, a.limits)
+	if err != nil {
+		return true
+	}
+	return params != a.params || len(salt) != argonSaltLength || len(key) != argonKeyLength
+}
+
+func (a *Argon2idHasher) Supports(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+func (a *Argon2idHasher) Validate(hash string) error {
+	_, _, _, err := decodeArgon2id(hash, a.limits)
+	return err
+}
+
+func (a *Argon2idHasher) MaxPasswordBytes() int {
+	return argonMaxPasswordBytes
+}
+
+func encodeArgon2id(params Argon2idParams, salt []byte, key []byte) string {
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, params.Memory, params.Time, params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key))
+}
+
+// decodeArgon2id Разбирает хеш и проверяет параметры: argon2.IDKey паникует при p=0 и выделяет m KiB памяти,
+// поэтому параметры вне limits не доходят до вычисления
+func decodeArgon2id(hash string, limits Argon2idLimits) (Argon2idParams, []byte, []byte, error) {
+	var params Argon2idParams
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, hash
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != AlgorithmArgon2id {
+		return params, nil, nil, ErrInvalidHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("%w: unsupported argon2 version", ErrInvalidHash)
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Parallelism); err != nil {
+		return params, nil, nil, fmt.Errorf("%w: %v", ErrInvalidHash, err)
+	}
+	// argon2 требует не меньше 8 KiB памяти на поток
+	if params.Parallelism < 1 || params.Parallelism > limits.MaxParallelism ||
+		params.Time < 1 || params.Time > limits.MaxTime ||
+		params.Memory < 8*uint32(params.Parallelism) || params.Memory > limits.MaxMemory {
+		return params, nil, nil, fmt.Errorf("%w: argon2 parameters out of range", ErrInvalidHash)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil || len(salt) < argonMinSaltLength || len(salt) > argonMaxSaltLength {
+		return params, nil, nil, fmt.Errorf("%w: invalid salt", ErrInvalidHash)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) < argonMinKeyLength || len(key) > argonMaxKeyLength {
+		return params, nil, nil, fmt.Errorf("%w: invalid key", ErrInvalidHash)
+	}
+	return params, salt, key, nil
+}
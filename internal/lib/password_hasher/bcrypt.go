@@ -0,0 +1,75 @@
+package password_hasher
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+)
+
+// bcryptHashLength Длина хеша bcrypt: префикс с версией и стоимостью, 22 символа соли и 31 символ ключа
+const bcryptHashLength = 60
+
+// BcryptHasher bcrypt с настраиваемой стоимостью. Хеши в формате $2a$/$2b$/$2y$
+type BcryptHasher struct {
+	cost int
+}
+
+// NewBcryptHasher создаёт bcrypt хешер. Стоимость вне допустимого диапазона заменяется на bcrypt.DefaultCost
+func NewBcryptHasher(cost int) *BcryptHasher {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		cost = bcrypt.DefaultCost
+	}
+	return &BcryptHasher{cost: cost}
+}
+
+func (b *BcryptHasher) Algorithm() string {
+	return AlgorithmBcrypt
+}
+
+func (b *BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), b.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (b *BcryptHasher) Compare(hash string, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (b *BcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return true
+	}
+	return cost != b.cost
+}
+
+func (b *BcryptHasher) Supports(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+// Validate Проверяет длину хеша и стоимость. Хеш со стоимостью вне допустимой bcrypt.Cost не разберёт
+func (b *BcryptHasher) Validate(hash string) error {
+	if !b.Supports(hash) || len(hash) != bcryptHashLength {
+		return ErrInvalidHash
+	}
+	if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidHash, err)
+	}
+	return nil
+}
+
+// MaxPasswordBytes bcrypt молча обрезает пароль после 72 байт
+func (b *BcryptHasher) MaxPasswordBytes() int {
+	return 72
+}
@@ -0,0 +1,150 @@
+package password_hasher
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Поддерживаемые алгоритмы хеширования
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+)
+
+var (
+	ErrUnknownAlgorithm = errors.New("unknown password hashing algorithm")
+	ErrInvalidHash      = errors.New("invalid password hash format")
+)
+
+// Hasher Алгоритм хеширования паролей
+type Hasher interface {
+	// Algorithm Название алгоритма
+	Algorithm() string
+	// Hash хеширует пароль со случайной солью
+	Hash(password string) (string, error)
+	// Compare проверяет пароль. false без ошибки - пароль не совпал
+	Compare(hash string, password string) (bool, error)
+	// NeedsRehash true, если хеш сделан этим алгоритмом, но с устаревшими параметрами
+	NeedsRehash(hash string) bool
+	// Supports true, если хеш сделан этим алгоритмом
+	Supports(hash string) bool
+	// Validate Полностью разбирает хеш и проверяет его параметры. Нужен для хешей, пришедших извне (импорт)
+	Validate(hash string) error
+	// MaxPasswordBytes Максимальная длина пароля, которую алгоритм учитывает целиком
+	MaxPasswordBytes() int
+}
+
+// MultiHasher Хеширует основным алгоритмом, а проверяет любым из известных.
+// Позволяет постепенно перевести пользователей на новый алгоритм без сброса паролей
+type MultiHasher struct {
+	primary Hasher
+	legacy  []Hasher
+}
+
+func NewMultiHasher(primary Hasher, legacy ...Hasher) *MultiHasher {
+	return &MultiHasher{primary: primary, legacy: legacy}
+}
+
+func (m *MultiHasher) Algorithm() string {
+	return m.primary.Algorithm()
+}
+
+func (m *MultiHasher) Hash(password string) (string, error) {
+	return m.primary.Hash(password)
+}
+
+func (m *MultiHasher) Compare(hash string, password string) (bool, error) {
+	hasher, err := m.hasherFor(hash)
+	if err != nil {
+		return false, err
+	}
+	return hasher.Compare(hash, password)
+}
+
+// NeedsRehash true, если хеш сделан не основным алгоритмом или с устаревшими параметрами
+func (m *MultiHasher) NeedsRehash(hash string) bool {
+	if !m.primary.Supports(hash) {
+		return true
+	}
+	return m.primary.NeedsRehash(hash)
+}
+
+func (m *MultiHasher) Supports(hash string) bool {
+	_, err := m.hasherFor(hash)
+	return err == nil
+}
+
+func (m *MultiHasher) Validate(hash string) error {
+	hasher, err := m.hasherFor(hash)
+	if err != nil {
+		return err
+	}
+	return hasher.Validate(hash)
+}
+
+func (m *MultiHasher) MaxPasswordBytes() int {
+	return m.primary.MaxPasswordBytes()
+}
+
+func (m *MultiHasher) hasherFor(hash string) (Hasher, error) {
+	if m.primary.Supports(hash) {
+		return m.primary, nil
+	}
+	for _, h := range m.legacy {
+		if h.Supports(hash) {
+			return h, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownAlgorithm, hashPrefix(hash))
+}
+
+// hashPrefix Возвращает идентификатор алгоритма из PHC строки, не раскрывая сам хеш
+func hashPrefix(hash string) string {
+	parts := strings.SplitN(hash, "$", 3)
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+// hasher Экземпляр, которым пользуется всё приложение. Инициализируется один раз при старте, как и валидатор
+var (
+	hasher     Hasher
+	hasherOnce sync.Once
+)
+
+// InitHasher задаёт алгоритм хеширования для всего приложения
+func InitHasher(h Hasher) error {
+	if hasher != nil {
+		return errors.New("password hasher already initialized")
+	}
+	hasher = h
+	return nil
+}
+
+// GetHasher возвращает алгоритм хеширования приложения.
+// Если InitHasher не вызывался (например в тестах и утилитах), используется bcrypt с настройками по умолчанию
+func GetHasher() Hasher {
+	hasherOnce.Do(func() {
+		if hasher == nil {
+			hasher = NewMultiHasher(NewBcryptHasher(0), NewArgon2idHasher(Argon2idParams{}, Argon2idLimits{}))
+		}
+	})
+	return hasher
+}
+
+// NewHasher создаёт хешер по названию основного алгоритма. Остальные алгоритмы подключаются для проверки старых хешей
+func NewHasher(algorithm string, bcryptCost int, argonParams Argon2idParams, argonLimits Argon2idLimits) (*MultiHasher, error) {
+	bcryptHasher := NewBcryptHasher(bcryptCost)
+	argonHasher := NewArgon2idHasher(argonParams, argonLimits)
+	switch algorithm {
+	case AlgorithmArgon2id:
+		return NewMultiHasher(argonHasher, bcryptHasher), nil
+	case AlgorithmBcrypt:
+		return NewMultiHasher(bcryptHasher, argonHasher), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownAlgorithm, algorithm)
+	}
+}
@@ -0,0 +1,127 @@
+package password_hasher_test
+
+import (
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/password_hasher"
+	"strings"
+	"testing"
+)
+
+// Минимальные параметры, что б тесты не тратили по 19 МБ памяти на каждый хеш
+var testArgonParams = password_hasher.Argon2idParams{Memory: 1024, Time: 1, Parallelism: 1}
+
+func TestHashAndCompare(t *testing.T) {
+	tests := []struct {
+		TestName        string
+		Hasher          password_hasher.Hasher
+		Prefix          string
+		Password        string
+		ComparePassword string
+		Match           bool
+	}{
+		{TestName: "argon2id valid password", Hasher: password_hasher.NewArgon2idHasher(testArgonParams, password_hasher.Argon2idLimits{}), Prefix: "$argon2id$v=19$m=1024,t=1,p=1$", Password: "password", ComparePassword: "password", Match: true},
+		{TestName: "argon2id wrong password", Hasher: password_hasher.NewArgon2idHasher(testArgonParams, password_hasher.Argon2idLimits{}), Prefix: "$argon2id$", Password: "password", ComparePassword: "wrong", Match: false},
+		{TestName: "bcrypt valid password", Hasher: password_hasher.NewBcryptHasher(4), Prefix: "$2a$04$", Password: "password", ComparePassword: "password", Match: true},
+		{TestName: "bcrypt wrong password", Hasher: password_hasher.NewBcryptHasher(4), Prefix: "$2a$04$", Password: "password", ComparePassword: "wrong", Match: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.TestName, func(t *testing.T) {
+			hash, err := tt.Hasher.Hash(tt.Password)
+			if err != nil {
+				t.Fatal("Hash is failed. Error: ", err)
+			}
+			if !strings.HasPrefix(hash, tt.Prefix) {
+				t.Errorf("expected hash with prefix %q, got %q", tt.Prefix, hash)
+			}
+			match, err := tt.Hasher.Compare(hash, tt.ComparePassword)
+			if err != nil {
+				t.Fatal("Compare is failed. Error: ", err)
+			}
+			if match != tt.Match {
+				t.Errorf("expected match=%v, got %v", tt.Match, match)
+			}
+		})
+	}
+}
+
+func TestMultiHasherNeedsRehash(t *testing.T) {
+	bcryptHasher := password_hasher.NewBcryptHasher(4)
+	argonHasher := password_hasher.NewArgon2idHasher(testArgonParams, password_hasher.Argon2idLimits{})
+	multi := password_hasher.NewMultiHasher(argonHasher, bcryptHasher)
+
+	bcryptHash, err := bcryptHasher.Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Старый bcrypt хеш проверяется, но требует перехеширования
+	if ok, err := multi.Compare(bcryptHash, "password"); err != nil || !ok {
+		t.Errorf("expected legacy bcrypt hash to match, got %v, error: %v", ok, err)
+	}
+	if !multi.NeedsRehash(bcryptHash) {
+		t.Error("expected bcrypt hash to need rehash when primary is argon2id")
+	}
+
+	argonHash, err := multi.Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if multi.NeedsRehash(argonHash) {
+		t.Error("hash with current parameters must not need rehash")
+	}
+
+	// Параметры поменялись - хеш надо обновить
+	stronger := password_hasher.NewMultiHasher(password_hasher.NewArgon2idHasher(password_hasher.Argon2idParams{Memory: 2048, Time: 1, Parallelism: 1}, password_hasher.Argon2idLimits{}))
+	if !stronger.NeedsRehash(argonHash) {
+		t.Error("expected argon2id hash with outdated parameters to need rehash")
+	}
+	if ok, err := stronger.Compare(argonHash, "password"); err != nil || !ok {
+		t.Errorf("expected hash with outdated parameters to match, got %v, error: %v", ok, err)
+	}
+
+	if _, err = multi.Compare("$unknown$hash", "password"); err == nil {
+		t.Error("expected error for unknown algorithm")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	multi := password_hasher.NewMultiHasher(password_hasher.NewBcryptHasher(4),
+		password_hasher.NewArgon2idHasher(testArgonParams, password_hasher.Argon2idLimits{MaxMemory: 65536, MaxTime: 4, MaxParallelism: 4}))
+	bcryptHash, err := multi.Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const salt, key = "c2FsdHNhbHRzYWx0c2FsdA", "a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5"
+	tests := []struct {
+		TestName string
+		Hash     string
+		Valid    bool
+	}{
+		{TestName: "bcrypt", Hash: bcryptHash, Valid: true},
+		{TestName: "argon2id", Hash: "$argon2id$v=19$m=1024,t=1,p=1$" + salt + "$" + key, Valid: true},
+		{TestName: "argon2id zero parallelism", Hash: "$argon2id$v=19$m=1024,t=1,p=0$" + salt + "$" + key},
+		{TestName: "argon2id memory above limit", Hash: "$argon2id$v=19$m=4194304,t=1,p=1$" + salt + "$" + key},
+		{TestName: "argon2id time above limit", Hash: "$argon2id$v=19$m=1024,t=100,p=1$" + salt + "$" + key},
+		{TestName: "argon2id old version", Hash: "$argon2id$v=16$m=1024,t=1,p=1$" + salt + "$" + key},
+		{TestName: "argon2id short salt", Hash: "$argon2id$v=19$m=1024,t=1,p=1$c2FsdA$" + key},
+		{TestName: "argon2id short key", Hash: "$argon2id$v=19$m=1024,t=1,p=1$" + salt + "$a2V5"},
+		{TestName: "bcrypt truncated", Hash: "$2a$04$abc"},
+		{TestName: "bcrypt cost out of range", Hash: "$2a$99$" + strings.Repeat("a", 53)},
+		{TestName: "unknown algorithm", Hash: "plaintext"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.TestName, func(t *testing.T) {
+			err := multi.Validate(tt.Hash)
+			if tt.Valid && err != nil {
+				t.Errorf("expected valid hash, got %v", err)
+			}
+			if !tt.Valid && err == nil {
+				t.Error("expected invalid hash")
+			}
+			// Недопустимый хеш не вычисляется, а возвращает ошибку
+			if !tt.Valid {
+				if _, err = multi.Compare(tt.Hash, "password"); err == nil {
+					t.Error("expected compare error for invalid hash")
+				}
+			}
+		})
+	}
+}
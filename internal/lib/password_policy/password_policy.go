@@ -0,0 +1,206 @@
+package password_policy
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/breached_passwords"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Названия правил политики паролей. Возвращаются клиенту в поле rule, что б фронт мог подсветить конкретное нарушение
+const (
+	RuleMinLength     = "min_length"
+	RuleMaxBytes      = "max_bytes"
+	RuleUppercase     = "uppercase"
+	RuleLowercase     = "lowercase"
+	RuleDigit         = "digit"
+	RuleSpecial       = "special"
+	RulePersonalInfo  = "personal_info"
+	RuleStrength      = "strength"
+	RuleHistory       = "history"
+	RuleBreached      = "breached"
+	BcryptMaxBytes    = 72 // bcrypt молча обрезает всё что длиннее 72 байт. Используется, если ограничение хешера не задано
+	defaultMinLength  = 8
+	minPersonalLength = 3 // Слишком короткие части email/имени не проверяем, иначе "Ян" запретит половину паролей
+)
+
+// Policy Настройки политики паролей
+type Policy struct {
+	MinLength        int
+	MaxBytes         int
+	RequireUppercase bool
+	RequireLowercase bool
+	RequireDigit     bool
+	RequireSpecial   bool
+	ForbidPersonal   bool
+	MinStrength      int // Минимальная оценка сложности от 0 до 4 (как в zxcvbn)
+	HistorySize      int // Сколько предыдущих хешей пароля нельзя использовать повторно
+	// BreachChecker Проверка по локальному набору утекших паролей. nil - проверка выключена
+	BreachChecker breached_passwords.Checker
+}
+
+// PersonalInfo Данные пользователя, которые не должны встречаться в пароле
+type PersonalInfo struct {
+	Email     string
+	FirstName string
+	LastName  string
+}
+
+// Violation Нарушение одного правила политики
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ViolationError Ошибка со списком всех нарушенных правил
+type ViolationError struct {
+	Violations []Violation
+}
+
+var ErrPasswordPolicy = errors.New("password does not satisfy password policy")
+
+func (e *ViolationError) Error() string {
+	rules := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		rules = append(rules, v.Rule)
+	}
+	return fmt.Sprintf("%s: %s", ErrPasswordPolicy.Error(), strings.Join(rules, ", "))
+}
+
+func (e *ViolationError) Unwrap() error {
+	return ErrPasswordPolicy
+}
+
+// NewPolicy создаёт политику, подставляя значения по умолчанию для незаданных ограничений
+func NewPolicy(p Policy) *Policy {
+	if p.MinLength <= 0 {
+		p.MinLength = defaultMinLength
+	}
+	if p.MaxBytes <= 0 {
+		p.MaxBytes = BcryptMaxBytes
+	}
+	if p.MinStrength < 0 {
+		p.MinStrength = 0
+	}
+	if p.MinStrength > 4 {
+		p.MinStrength = 4
+	}
+	return &p
+}
+
+// Validate проверяет пароль по всем правилам политики, кроме истории.
+// Возвращает *ViolationError со всеми найденными нарушениями, а не только с первым
+func (p *Policy) Validate(password string, info PersonalInfo) error {
+	var violations []Violation
+
+	if utf8.RuneCountInString(password) < p.MinLength {
+		violations = append(violations, Violation{RuleMinLength, fmt.Sprintf("password must be at least %d characters long", p.MinLength)})
+	}
+	if len(password) > p.MaxBytes {
+		violations = append(violations, Violation{RuleMaxBytes, fmt.Sprintf("password must not be longer than %d bytes", p.MaxBytes)})
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSpecial bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			hasSpecial = true
+		}
+	}
+	if p.RequireUppercase && !hasUpper {
+		violations = append(violations, Violation{RuleUppercase, "password must contain an uppercase letter"})
+	}
+	if p.RequireLowercase && !hasLower {
+		violations = append(violations, Violation{RuleLowercase, "password must contain a lowercase letter"})
+	}
+	if p.RequireDigit && !hasDigit {
+		violations = append(violations, Violation{RuleDigit, "password must contain a digit"})
+	}
+	if p.RequireSpecial && !hasSpecial {
+		violations = append(violations, Violation{RuleSpecial, "password must contain a special character"})
+	}
+
+	if p.ForbidPersonal && containsPersonalInfo(password, info) {
+		violations = append(violations, Violation{RulePersonalInfo, "password must not contain your email or name"})
+	}
+
+	if p.MinStrength > 0 {
+		if score := StrengthScore(password, personalTokens(info)...); score < p.MinStrength {
+			violations = append(violations, Violation{RuleStrength, fmt.Sprintf("password is too weak: score %d, required %d", score, p.MinStrength)})
+		}
+	}
+
+	if p.BreachChecker != nil {
+		breached, err := p.BreachChecker.IsBreached(password)
+		if err != nil {
+			return fmt.Errorf("failed to check password against breached passwords: %w", err)
+		}
+		if breached {
+			violations = append(violations, Violation{RuleBreached, "password has appeared in a known data breach"})
+		}
+	}
+
+	if len(violations) > 0 {
+		return &ViolationError{Violations: violations}
+	}
+	return nil
+}
+
+// CheckHistory проверяет что пароль не совпадает ни с одним из предыдущих хешей.
+// compare - функция сравнения хеша и пароля, что б политика не зависела от конкретного алгоритма хеширования
+func (p *Policy) CheckHistory(password string, previousHashes []string, compare func(hash, password string) bool) error {
+	if p.HistorySize <= 0 {
+		return nil
+	}
+	for i, hash := range previousHashes {
+		if i >= p.HistorySize {
+			break
+		}
+		if compare(hash, password) {
+			return &ViolationError{Violations: []Violation{{
+				RuleHistory, fmt.Sprintf("password must differ from the last %d passwords", p.HistorySize),
+			}}}
+		}
+	}
+	return nil
+}
+
+// personalTokens Разбивает email и имя на части, которые не должны встречаться в пароле
+func personalTokens(info PersonalInfo) []string {
+	var tokens []string
+	add := func(s string) {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if utf8.RuneCountInString(s) >= minPersonalLength {
+			tokens = append(tokens, s)
+		}
+	}
+	if local, _, found := strings.Cut(info.Email, "@"); found {
+		add(local)
+		for _, part := range strings.FieldsFunc(local, func(r rune) bool { return r == '.' || r == '_' || r == '-' || r == '+' }) {
+			add(part)
+		}
+	} else {
+		add(info.Email)
+	}
+	add(info.FirstName)
+	add(info.LastName)
+	return tokens
+}
+
+func containsPersonalInfo(password string, info PersonalInfo) bool {
+	lower := strings.ToLower(password)
+	for _, token := range personalTokens(info) {
+		if strings.Contains(lower, token) {
+			return true
+		}
+	}
+	return false
+}
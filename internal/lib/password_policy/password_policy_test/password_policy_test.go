@@ -0,0 +1,100 @@
+package password_policy_test
+
+import (
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/password_policy"
+	"strings"
+	"testing"
+)
+
+func TestPolicyValidate(t *testing.T) {
+	policy := password_policy.NewPolicy(password_policy.Policy{
+		MinLength:        8,
+		RequireUppercase: true,
+		RequireDigit:     true,
+		ForbidPersonal:   true,
+		MinStrength:      2,
+	})
+	info := password_policy.PersonalInfo{Email: "john.smith@corp.com", FirstName: "John", LastName: "Smith"}
+
+	tests := []struct {
+		TestName      string
+		Password      string
+		ExpectedRules []string
+		ErrorExpected bool
+	}{
+		{TestName: "Strong password", Password: "Vq7#lp2Rz!mW", ErrorExpected: false},
+		{TestName: "Too short", Password: "Ab1", ExpectedRules: []string{password_policy.RuleMinLength}, ErrorExpected: true},
+		{TestName: "No uppercase and digit", Password: "vqlpzrmwkxtn", ExpectedRules: []string{password_policy.RuleUppercase, password_policy.RuleDigit}, ErrorExpected: true},
+		{TestName: "Contains name", Password: "Smith-Vq7#lp2Rz", ExpectedRules: []string{password_policy.RulePersonalInfo}, ErrorExpected: true},
+		{TestName: "Common password", Password: "Password1", ExpectedRules: []string{password_policy.RuleStrength}, ErrorExpected: true},
+		{TestName: "Longer than bcrypt limit", Password: "Vq7#" + strings.Repeat("ж", 40), ExpectedRules: []string{password_policy.RuleMaxBytes}, ErrorExpected: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.TestName, func(t *testing.T) {
+			err := policy.Validate(tt.Password, info)
+			if !tt.ErrorExpected {
+				if err != nil {
+					t.Fatal("Validate is failed. Error: ", err)
+				}
+				return
+			}
+			if !errors.Is(err, password_policy.ErrPasswordPolicy) {
+				t.Fatal("Expected password policy error, got: ", err)
+			}
+			var violationErr *password_policy.ViolationError
+			if !errors.As(err, &violationErr) {
+				t.Fatal("Expected *ViolationError, got: ", err)
+			}
+			for _, rule := range tt.ExpectedRules {
+				found := false
+				for _, v := range violationErr.Violations {
+					if v.Rule == rule {
+						found = true
+					}
+				}
+				if !found {
+					t.Errorf("expected violation %q in %v", rule, violationErr.Violations)
+				}
+			}
+		})
+	}
+}
+
+func TestPolicyCheckHistory(t *testing.T) {
+	policy := password_policy.NewPolicy(password_policy.Policy{HistorySize: 2})
+	compare := func(hash, password string) bool { return hash == "hash:"+password }
+	history := []string{"hash:first", "hash:second", "hash:third"}
+
+	if err := policy.CheckHistory("first", history, compare); err == nil {
+		t.Error("Expected history violation for the latest password")
+	}
+	if err := policy.CheckHistory("third", history, compare); err != nil {
+		t.Error("Password older than history size must be allowed. Error: ", err)
+	}
+	if err := policy.CheckHistory("new", history, compare); err != nil {
+		t.Error("New password must be allowed. Error: ", err)
+	}
+}
+
+func TestStrengthScore(t *testing.T) {
+	tests := []struct {
+		TestName string
+		Password string
+		MinScore int
+		MaxScore int
+	}{
+		{TestName: "Dictionary password", Password: "password", MinScore: 0, MaxScore: 0},
+		{TestName: "Keyboard row", Password: "qwertyuiop", MinScore: 0, MaxScore: 1},
+		{TestName: "Repeated characters", Password: "aaaaaaaaaaaa", MinScore: 0, MaxScore: 1},
+		{TestName: "Random password", Password: "Vq7#lp2Rz!mW", MinScore: 4, MaxScore: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.TestName, func(t *testing.T) {
+			score := password_policy.StrengthScore(tt.Password)
+			if score < tt.MinScore || score > tt.MaxScore {
+				t.Errorf("expected score in [%d, %d], got %d", tt.MinScore, tt.MaxScore, score)
+			}
+		})
+	}
+}
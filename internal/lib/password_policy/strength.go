@@ -0,0 +1,151 @@
+package password_policy
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// commonPasswords Небольшой словарь самых популярных паролей и их основ.
+// Для полноценной проверки по утечкам есть отдельный механизм, здесь только то, что перебирают первым делом
+var commonPasswords = map[string]struct{}{
+	"password": {}, "passw0rd": {}, "qwerty": {}, "qwertyuiop": {}, "asdfgh": {}, "zxcvbn": {},
+	"letmein": {}, "welcome": {}, "admin": {}, "administrator": {}, "login": {}, "master": {},
+	"dragon": {}, "monkey": {}, "football": {}, "baseball": {}, "iloveyou": {}, "sunshine": {},
+	"princess": {}, "trustno1": {}, "superman": {}, "batman": {}, "shadow": {}, "michael": {},
+	"secret": {}, "changeme": {}, "default": {}, "abc": {}, "abcdef": {}, "qazwsx": {},
+	"starwars": {}, "whatever": {}, "freedom": {}, "hello": {}, "charlie": {}, "password1": {},
+	"123456": {}, "12345678": {}, "123456789": {}, "1234567890": {}, "111111": {}, "000000": {},
+}
+
+// keyboardRows Ряды клавиатуры для поиска "клавиатурных" последовательностей
+var keyboardRows = []string{"qwertyuiop", "asdfghjkl", "zxcvbnm", "1234567890", "йцукенгшщзхъ", "фывапролджэ", "ячсмитьбю"}
+
+// Пороги количества попыток подбора для оценок 1..4, как в zxcvbn
+var scoreThresholds = []float64{1e3, 1e6, 1e8, 1e10}
+
+// StrengthScore оценивает сложность пароля по шкале 0..4 в стиле zxcvbn.
+//
+// Оценка строится на приблизительном количестве попыток подбора:
+// словарные пароли, повторы символов, последовательности (abc, 123) и клавиатурные ряды (qwerty)
+// почти не добавляют энтропии. userInputs - строки пользователя (email, имя), которые считаются известными атакующему
+func StrengthScore(password string, userInputs ...string) int {
+	guesses := estimateGuesses(password, userInputs)
+	for i, threshold := range scoreThresholds {
+		if guesses < threshold {
+			return i
+		}
+	}
+	return len(scoreThresholds)
+}
+
+func estimateGuesses(password string, userInputs []string) float64 {
+	if password == "" {
+		return 1
+	}
+	lower := strings.ToLower(password)
+
+	// Пароль целиком из словаря (с точностью до цифр и символов в конце) подбирается почти мгновенно
+	base := strings.TrimRightFunc(lower, func(r rune) bool { return unicode.IsDigit(r) || unicode.IsPunct(r) || unicode.IsSymbol(r) })
+	if _, ok := commonPasswords[lower]; ok {
+		return 10
+	}
+	if _, ok := commonPasswords[base]; ok {
+		suffix := len([]rune(lower)) - len([]rune(base))
+		return 100 * math.Pow(10, float64(suffix))
+	}
+
+	// Убираем из пароля известные атакующему строки: они стоят как одно словарное слово
+	knownWords := 0
+	for _, input := range userInputs {
+		if input != "" && strings.Contains(lower, input) {
+			lower = strings.ReplaceAll(lower, input, "")
+			knownWords++
+		}
+	}
+	for word := range commonPasswords {
+		if len(word) >= 4 && strings.Contains(lower, word) {
+			lower = strings.ReplaceAll(lower, word, "")
+			knownWords++
+		}
+	}
+
+	runes := []rune(lower)
+	effective := 0.0
+	for i, r := range runes {
+		if i == 0 {
+			effective++
+			continue
+		}
+		prev := runes[i-1]
+		switch {
+		case r == prev:
+			// Повтор символа почти ничего не добавляет
+			effective += 0.1
+		case r-prev == 1 || prev-r == 1 || isKeyboardNeighbour(prev, r):
+			// Последовательности и соседние клавиши
+			effective += 0.25
+		default:
+			effective++
+		}
+	}
+
+	log10Guesses := effective * math.Log10(float64(cardinality(password)))
+	// Каждое словарное слово - примерно 10^4 вариантов
+	log10Guesses += float64(knownWords) * 4
+	if log10Guesses > 300 {
+		log10Guesses = 300
+	}
+	return math.Pow(10, log10Guesses)
+}
+
+// cardinality Размер алфавита, из которого составлен пароль
+func cardinality(password string) int {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		case r < unicode.MaxASCII:
+			symbol = true
+		default:
+			other = true
+		}
+	}
+	size := 0
+	if lower {
+		size += 26
+	}
+	if upper {
+		size += 26
+	}
+	if digit {
+		size += 10
+	}
+	if symbol {
+		size += 33
+	}
+	if other {
+		size += 100
+	}
+	if size == 0 {
+		size = 1
+	}
+	return size
+}
+
+func isKeyboardNeighbour(a, b rune) bool {
+	for _, row := range keyboardRows {
+		rowRunes := []rune(row)
+		for i := 0; i < len(rowRunes)-1; i++ {
+			if (rowRunes[i] == a && rowRunes[i+1] == b) || (rowRunes[i] == b && rowRunes[i+1] == a) {
+				return true
+			}
+		}
+	}
+	return false
+}
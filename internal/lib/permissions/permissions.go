@@ -0,0 +1,15 @@
+package permissions
+
+// Права, которые проверяются в коде. Какие роли ими обладают, хранится в таблице role_permissions
+const (
+	UsersRead      = "users:read"
+	UsersWrite     = "users:write"
+	RolesRead      = "roles:read"
+	RolesWrite     = "roles:write"
+	SessionsRevoke = "sessions:revoke"
+	AuthzCheck     = "authz:check"
+	PoliciesWrite  = "policies:write"
+	OrgsWrite      = "orgs:write"
+	// UsersImpersonate Вход под пользователем для поддержки
+	UsersImpersonate = "users:impersonate"
+)
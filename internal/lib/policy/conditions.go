@@ -0,0 +1,210 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Операторы условий
+const (
+	OpEq       = "eq"
+	OpNe       = "ne"
+	OpIn       = "in"     // Атрибут равен одному из значений списка
+	OpNotIn    = "not_in" // Атрибут не равен ни одному из значений списка
+	OpContains = "contains"
+	OpGt       = "gt"
+	OpGte      = "gte"
+	OpLt       = "lt"
+	OpLte      = "lte"
+	OpExists   = "exists"
+)
+
+// Condition Условие над атрибутом запроса.
+//
+// Attribute - путь через точку: subject.roles, resource.department, context.time.hour.
+// Сравнивается либо с Value, либо со значением другого атрибута ValueFrom (например subject.department)
+type Condition struct {
+	Attribute string      `yaml:"attribute" json:"attribute"`
+	Operator  string      `yaml:"operator" json:"operator"`
+	Value     interface{} `yaml:"value" json:"value,omitempty"`
+	ValueFrom string      `yaml:"value_from" json:"value_from,omitempty"`
+}
+
+// ConditionResult Результат проверки условия с фактическими значениями, для объяснения решения
+type ConditionResult struct {
+	Attribute string      `json:"attribute"`
+	Operator  string      `json:"operator"`
+	Actual    interface{} `json:"actual"`
+	Expected  interface{} `json:"expected,omitempty"`
+	Satisfied bool        `json:"satisfied"`
+}
+
+func (c Condition) validate() error {
+	if c.Attribute == "" {
+		return fmt.Errorf("condition attribute is required")
+	}
+	switch c.Operator {
+	case OpEq, OpNe, OpIn, OpNotIn, OpContains, OpGt, OpGte, OpLt, OpLte, OpExists:
+		return nil
+	default:
+		return fmt.Errorf("unknown operator %q", c.Operator)
+	}
+}
+
+func (c Condition) evaluate(attrs map[string]interface{}) ConditionResult {
+	actual, found := lookup(attrs, c.Attribute)
+	expected := c.Value
+	if c.ValueFrom != "" {
+		expected, _ = lookup(attrs, c.ValueFrom)
+	}
+	result := ConditionResult{Attribute: c.Attribute, Operator: c.Operator, Actual: actual, Expected: expected}
+
+	if c.Operator == OpExists {
+		result.Satisfied = found && actual != nil
+		return result
+	}
+	// Отсутствующий атрибут не удовлетворяет ни одному условию, в том числе ne и not_in:
+	// иначе правило срабатывало бы для запросов, в которых просто не передали атрибут
+	if !found || actual == nil || expected == nil {
+		return result
+	}
+
+	switch c.Operator {
+	case OpEq:
+		result.Satisfied = equal(actual, expected)
+	case OpNe:
+		result.Satisfied = !equal(actual, expected)
+	case OpIn:
+		result.Satisfied = containsValue(expected, actual)
+	case OpNotIn:
+		result.Satisfied = !containsValue(expected, actual)
+	case OpContains:
+		if s, ok := actual.(string); ok {
+			sub, ok := expected.(string)
+			result.Satisfied = ok && strings.Contains(s, sub)
+		} else {
+			result.Satisfied = containsValue(actual, expected)
+		}
+	case OpGt, OpGte, OpLt, OpLte:
+		result.Satisfied = compare(actual, expected, c.Operator)
+	}
+	return result
+}
+
+// lookup Достаёт значение по пути через точку из вложенных map
+func lookup(attrs map[string]interface{}, path string) (interface{}, bool) {
+	var current interface{} = attrs
+	for _, part := range strings.Split(path, ".") {
+		m, ok := toMap(current)
+		if !ok {
+			return nil, false
+		}
+		current, ok = m[part]
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func toMap(value interface{}) (map[string]interface{}, bool) {
+	switch m := value.(type) {
+	case map[string]interface{}:
+		return m, true
+	case map[string]string:
+		converted := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			converted[k] = v
+		}
+		return converted, true
+	default:
+		return nil, false
+	}
+}
+
+// equal Сравнивает значения, приводя числа к float64: из JSON, YAML и claims числа приходят разных типов
+func equal(a, b interface{}) bool {
+	if fa, ok := toFloat(a); ok {
+		if fb, ok := toFloat(b); ok {
+			return fa == fb
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func containsValue(list interface{}, value interface{}) bool {
+	v := reflect.ValueOf(list)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return false
+	}
+	for i := 0; i < v.Len(); i++ {
+		if equal(v.Index(i).Interface(), value) {
+			return true
+		}
+	}
+	return false
+}
+
+func compare(a, b interface{}, op string) bool {
+	fa, okA := toFloat(a)
+	fb, okB := toFloat(b)
+	var cmp int
+	switch {
+	case okA && okB:
+		cmp = compareFloat(fa, fb)
+	default:
+		// Строки сравниваются лексикографически: подходит для дат в формате RFC3339
+		sa, okA := a.(string)
+		sb, okB := b.(string)
+		if !okA || !okB {
+			return false
+		}
+		cmp = strings.Compare(sa, sb)
+	}
+	switch op {
+	case OpGt:
+		return cmp > 0
+	case OpGte:
+		return cmp >= 0
+	case OpLt:
+		return cmp < 0
+	default:
+		return cmp <= 0
+	}
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		// Числа в строках не приводим, иначе "007" стало бы равно 7
+		return 0, false
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,46 @@
+package policy
+
+import (
+	"context"
+	"gopkg.in/yaml.v3"
+	"os"
+)
+
+// FileStore Правила из YAML файла вида:
+//
+//	rules:
+//	  - id: team-leads-manage-own-department
+//	    effect: allow
+//	    actions: ["users:read", "users:write"]
+//	    resources: ["user"]
+//	    conditions:
+//	      - attribute: subject.roles
+//	        operator: contains
+//	        value: team_lead
+//	      - attribute: resource.department
+//	        operator: eq
+//	        value_from: subject.department
+type FileStore struct {
+	path string
+}
+
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+type fileRules struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// LoadRules Файл читается заново при каждом вызове, поэтому правки подхватываются без перезапуска
+func (s *FileStore) LoadRules(_ context.Context) ([]Rule, error) {
+	raw, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+	var parsed fileRules
+	if err = yaml.Unmarshal(raw, &parsed); err != nil {
+		return nil, err
+	}
+	return parsed.Rules, nil
+}
@@ -0,0 +1,252 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Эффекты правил
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+var ErrInvalidRule = errors.New("invalid policy rule")
+
+// Rule Декларативное правило доступа.
+//
+// Правило применяется, если действие и тип ресурса подходят под Actions и Resources и выполняются все Conditions.
+// Запрещающие правила важнее разрешающих, если не подошло ни одно правило - доступа нет
+type Rule struct {
+	ID          string      `yaml:"id" json:"id"`
+	Description string      `yaml:"description" json:"description,omitempty"`
+	Effect      string      `yaml:"effect" json:"effect"`
+	Actions     []string    `yaml:"actions" json:"actions"`     // "users:write", "users:*" или "*"
+	Resources   []string    `yaml:"resources" json:"resources"` // Типы ресурсов: "user" или "*"
+	Conditions  []Condition `yaml:"conditions" json:"conditions,omitempty"`
+}
+
+// Validate Проверяет правило при загрузке, что б ошибка в конфиге не превращалась в молчаливый отказ
+func (r Rule) Validate() error {
+	if r.ID == "" {
+		return fmt.Errorf("%w: id is required", ErrInvalidRule)
+	}
+	if r.Effect != EffectAllow && r.Effect != EffectDeny {
+		return fmt.Errorf("%w %s: effect must be %q or %q", ErrInvalidRule, r.ID, EffectAllow, EffectDeny)
+	}
+	if len(r.Actions) == 0 || len(r.Resources) == 0 {
+		return fmt.Errorf("%w %s: actions and resources are required", ErrInvalidRule, r.ID)
+	}
+	for _, condition := range r.Conditions {
+		if err := condition.validate(); err != nil {
+			return fmt.Errorf("%w %s: %v", ErrInvalidRule, r.ID, err)
+		}
+	}
+	return nil
+}
+
+// Resource Объект, к которому запрашивается доступ
+type Resource struct {
+	Type       string                 `json:"type"`
+	ID         string                 `json:"id,omitempty"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// Request Вопрос "может ли субъект выполнить действие над ресурсом"
+type Request struct {
+	Subject  map[string]interface{}
+	Action   string
+	Resource Resource
+	Context  map[string]interface{}
+}
+
+// RuleEvaluation Результат проверки одного правила, для объяснения решения
+type RuleEvaluation struct {
+	RuleID     string            `json:"rule_id"`
+	Effect     string            `json:"effect"`
+	Matched    bool              `json:"matched"`
+	Reason     string            `json:"reason"`
+	Conditions []ConditionResult `json:"conditions,omitempty"`
+}
+
+// Decision Решение движка политик
+type Decision struct {
+	Allowed     bool             `json:"allowed"`
+	Effect      string           `json:"effect"`
+	RuleID      string           `json:"rule_id,omitempty"` // Правило, которое определило решение. Пусто - не подошло ни одно
+	Evaluations []RuleEvaluation `json:"evaluations"`
+}
+
+// Store Источник правил: таблица в БД или YAML файл
+type Store interface {
+	LoadRules(ctx context.Context) ([]Rule, error)
+}
+
+// Engine Вычисляет решения по правилам из Store. Правила держатся в памяти и перечитываются методом Reload
+type Engine struct {
+	store    Store
+	location *time.Location
+	now      func() time.Time
+	log      *slog.Logger
+
+	mu    sync.RWMutex
+	rules []Rule
+}
+
+// NewEngine создаёт движок. location - часовой пояс для атрибутов context.time.*, nil - UTC
+func NewEngine(store Store, location *time.Location, log *slog.Logger) *Engine {
+	if location == nil {
+		location = time.UTC
+	}
+	return &Engine{
+		store:    store,
+		location: location,
+		now:      time.Now,
+		log:      log,
+	}
+}
+
+// SetClock Подменяет текущее время. Для тестов правил, завязанных на время
+func (e *Engine) SetClock(now func() time.Time) {
+	e.now = now
+}
+
+// Reload перечитывает правила. При ошибке остаются прежние правила
+func (e *Engine) Reload(ctx context.Context) error {
+	rules, err := e.store.LoadRules(ctx)
+	if err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		if err = rule.Validate(); err != nil {
+			return err
+		}
+	}
+	e.mu.Lock()
+	e.rules = rules
+	e.mu.Unlock()
+	return nil
+}
+
+// Rules Копия текущих правил
+func (e *Engine) Rules() []Rule {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return append([]Rule(nil), e.rules...)
+}
+
+// RunReloader перечитывает правила каждые interval, пока не отменён ctx
+func (e *Engine) RunReloader(ctx context.Context, interval time.Duration) {
+	const op = "internal/lib/policy/policy.go/RunReloader"
+	log := e.log.With(slog.String("op", op))
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := e.Reload(ctx); err != nil {
+				log.Error("Failed to reload policy rules", "err", err)
+			}
+		}
+	}
+}
+
+// Evaluate Вычисляет решение. Запрещающее правило побеждает разрешающее, без подходящих правил - отказ
+func (e *Engine) Evaluate(req Request) Decision {
+	e.mu.RLock()
+	rules := e.rules
+	e.mu.RUnlock()
+
+	attrs := e.attributes(req)
+	decision := Decision{Effect: EffectDeny, Evaluations: make([]RuleEvaluation, 0, len(rules))}
+	for _, rule := range rules {
+		evaluation := evaluateRule(rule, req, attrs)
+		decision.Evaluations = append(decision.Evaluations, evaluation)
+		if !evaluation.Matched {
+			continue
+		}
+		if rule.Effect == EffectDeny {
+			if decision.Allowed || decision.RuleID == "" {
+				decision.Allowed, decision.Effect, decision.RuleID = false, EffectDeny, rule.ID
+			}
+			continue
+		}
+		if decision.RuleID == "" {
+			decision.Allowed, decision.Effect, decision.RuleID = true, EffectAllow, rule.ID
+		}
+	}
+	return decision
+}
+
+func (e *Engine) attributes(req Request) map[string]interface{} {
+	now := e.now().In(e.location)
+	ctx := map[string]interface{}{}
+	for key, value := range req.Context {
+		ctx[key] = value
+	}
+	ctx["time"] = map[string]interface{}{
+		"hour":    now.Hour(),
+		"minute":  now.Minute(),
+		"weekday": int(now.Weekday()), // 0 - воскресенье
+		"date":    now.Format(time.DateOnly),
+	}
+
+	resource := map[string]interface{}{}
+	for key, value := range req.Resource.Attributes {
+		resource[key] = value
+	}
+	resource["type"] = req.Resource.Type
+	resource["id"] = req.Resource.ID
+
+	return map[string]interface{}{
+		"subject":  req.Subject,
+		"resource": resource,
+		"context":  ctx,
+		"action":   req.Action,
+	}
+}
+
+func evaluateRule(rule Rule, req Request, attrs map[string]interface{}) RuleEvaluation {
+	evaluation := RuleEvaluation{RuleID: rule.ID, Effect: rule.Effect}
+	if !matchesAny(rule.Actions, req.Action) {
+		evaluation.Reason = "action does not match"
+		return evaluation
+	}
+	if !matchesAny(rule.Resources, req.Resource.Type) {
+		evaluation.Reason = "resource type does not match"
+		return evaluation
+	}
+	evaluation.Matched = true
+	evaluation.Reason = "all conditions are satisfied"
+	for _, condition := range rule.Conditions {
+		result := condition.evaluate(attrs)
+		evaluation.Conditions = append(evaluation.Conditions, result)
+		// Остальные условия всё равно считаем, что б в объяснении было видно все причины отказа
+		if !result.Satisfied && evaluation.Matched {
+			evaluation.Matched = false
+			evaluation.Reason = "condition failed: " + result.Attribute + " " + result.Operator
+		}
+	}
+	return evaluation
+}
+
+// matchesAny Сопоставляет значение с шаблонами: точное совпадение, "*" или префикс вида "users:*"
+func matchesAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if pattern == "*" || pattern == value {
+			return true
+		}
+		if strings.HasSuffix(pattern, "*") && strings.HasPrefix(value, strings.TrimSuffix(pattern, "*")) {
+			return true
+		}
+	}
+	return false
+}
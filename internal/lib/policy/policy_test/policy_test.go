@@ -0,0 +1,174 @@
+package policy_test
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/policy"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type staticStore struct {
+	rules []policy.Rule
+	err   error
+}
+
+func (s *staticStore) LoadRules(_ context.Context) ([]policy.Rule, error) {
+	return s.rules, s.err
+}
+
+var testRules = []policy.Rule{
+	{
+		ID:        "managers-read-own-department",
+		Effect:    policy.EffectAllow,
+		Actions:   []string{"users:read"},
+		Resources: []string{"user"},
+		Conditions: []policy.Condition{
+			{Attribute: "subject.roles", Operator: policy.OpContains, Value: "manager"},
+			{Attribute: "resource.department", Operator: policy.OpEq, ValueFrom: "subject.department"},
+		},
+	},
+	{
+		ID:        "business-hours-only",
+		Effect:    policy.EffectDeny,
+		Actions:   []string{"users:*"},
+		Resources: []string{"*"},
+		Conditions: []policy.Condition{
+			{Attribute: "context.time.hour", Operator: policy.OpLt, Value: 9},
+		},
+	},
+	{
+		ID:        "admins-everything",
+		Effect:    policy.EffectAllow,
+		Actions:   []string{"*"},
+		Resources: []string{"*"},
+		Conditions: []policy.Condition{
+			{Attribute: "subject.roles", Operator: policy.OpContains, Value: "admin"},
+		},
+	},
+}
+
+func newTestEngine(t *testing.T, hour int) *policy.Engine {
+	t.Helper()
+	engine := policy.NewEngine(&staticStore{rules: testRules}, time.UTC, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	engine.SetClock(func() time.Time { return time.Date(2026, 3, 2, hour, 30, 0, 0, time.UTC) })
+	if err := engine.Reload(context.Background()); err != nil {
+		t.Fatal("Reload is failed. Error: ", err)
+	}
+	return engine
+}
+
+func TestEngineEvaluate(t *testing.T) {
+	manager := map[string]interface{}{"roles": []interface{}{"user", "manager"}, "department": "sales"}
+	admin := map[string]interface{}{"roles": []interface{}{"admin"}}
+
+	tests := []struct {
+		TestName        string
+		Hour            int
+		Subject         map[string]interface{}
+		Action          string
+		Resource        policy.Resource
+		ExpectedAllowed bool
+		ExpectedRuleID  string
+	}{
+		{TestName: "Manager reads own department", Hour: 12, Subject: manager, Action: "users:read",
+			Resource:        policy.Resource{Type: "user", Attributes: map[string]interface{}{"department": "sales"}},
+			ExpectedAllowed: true, ExpectedRuleID: "managers-read-own-department"},
+		{TestName: "Manager reads other department", Hour: 12, Subject: manager, Action: "users:read",
+			Resource:        policy.Resource{Type: "user", Attributes: map[string]interface{}{"department": "hr"}},
+			ExpectedAllowed: false},
+		{TestName: "Manager cannot write", Hour: 12, Subject: manager, Action: "users:write",
+			Resource:        policy.Resource{Type: "user", Attributes: map[string]interface{}{"department": "sales"}},
+			ExpectedAllowed: false},
+		{TestName: "Deny overrides allow outside business hours", Hour: 7, Subject: admin, Action: "users:read",
+			Resource:        policy.Resource{Type: "user"},
+			ExpectedAllowed: false, ExpectedRuleID: "business-hours-only"},
+		{TestName: "Admin in business hours", Hour: 12, Subject: admin, Action: "users:write",
+			Resource:        policy.Resource{Type: "user"},
+			ExpectedAllowed: true, ExpectedRuleID: "admins-everything"},
+		{TestName: "Missing attribute does not match", Hour: 12, Subject: map[string]interface{}{}, Action: "users:read",
+			Resource:        policy.Resource{Type: "user"},
+			ExpectedAllowed: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.TestName, func(t *testing.T) {
+			engine := newTestEngine(t, tt.Hour)
+			decision := engine.Evaluate(policy.Request{Subject: tt.Subject, Action: tt.Action, Resource: tt.Resource})
+			if decision.Allowed != tt.ExpectedAllowed {
+				t.Fatalf("Expected allowed %v, got %v (rule %q)", tt.ExpectedAllowed, decision.Allowed, decision.RuleID)
+			}
+			if decision.RuleID != tt.ExpectedRuleID {
+				t.Errorf("Expected rule %q, got %q", tt.ExpectedRuleID, decision.RuleID)
+			}
+			if len(decision.Evaluations) != len(testRules) {
+				t.Errorf("Expected %d evaluations, got %d", len(testRules), len(decision.Evaluations))
+			}
+		})
+	}
+}
+
+func TestEngineExplainsFailedConditions(t *testing.T) {
+	engine := newTestEngine(t, 12)
+	decision := engine.Evaluate(policy.Request{
+		Subject:  map[string]interface{}{"roles": []interface{}{"user"}, "department": "sales"},
+		Action:   "users:read",
+		Resource: policy.Resource{Type: "user", Attributes: map[string]interface{}{"department": "hr"}},
+	})
+	evaluation := decision.Evaluations[0]
+	if evaluation.Matched || len(evaluation.Conditions) != 2 {
+		t.Fatalf("Expected both conditions in explanation, got %+v", evaluation)
+	}
+	for _, condition := range evaluation.Conditions {
+		if condition.Satisfied {
+			t.Errorf("Condition %s should not be satisfied", condition.Attribute)
+		}
+	}
+	if evaluation.Conditions[1].Expected != "sales" {
+		t.Errorf("Expected value_from to resolve to subject department, got %v", evaluation.Conditions[1].Expected)
+	}
+}
+
+func TestEngineReloadKeepsRulesOnError(t *testing.T) {
+	store := &staticStore{rules: testRules}
+	engine := policy.NewEngine(store, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err := engine.Reload(context.Background()); err != nil {
+		t.Fatal("Reload is failed. Error: ", err)
+	}
+
+	store.rules = []policy.Rule{{ID: "broken", Effect: "maybe", Actions: []string{"*"}, Resources: []string{"*"}}}
+	if err := engine.Reload(context.Background()); !errors.Is(err, policy.ErrInvalidRule) {
+		t.Fatalf("Expected ErrInvalidRule, got %v", err)
+	}
+	if len(engine.Rules()) != len(testRules) {
+		t.Errorf("Expected previous rules to be kept, got %d rules", len(engine.Rules()))
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policies.yaml")
+	content := `
+rules:
+  - id: read-own-profile
+    effect: allow
+    actions: ["users:read"]
+    resources: ["user"]
+    conditions:
+      - attribute: resource.id
+        operator: eq
+        value_from: subject.id
+`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := policy.NewFileStore(path).LoadRules(context.Background())
+	if err != nil {
+		t.Fatal("LoadRules is failed. Error: ", err)
+	}
+	if len(rules) != 1 || rules[0].ID != "read-own-profile" || rules[0].Conditions[0].ValueFrom != "subject.id" {
+		t.Fatalf("Unexpected rules: %+v", rules)
+	}
+}
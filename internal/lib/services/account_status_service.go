@@ -0,0 +1,114 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+var ErrInvalidStatusExpiry = errors.New("status expiry must be in the future")
+
+// statusCacheCleanupSize При таком размере кеша из него выбрасываются устаревшие записи
+const statusCacheCleanupSize = 10000
+
+type cachedStatus struct {
+	status    string
+	expiresAt time.Time
+}
+
+// AccountStatusService Меняет статус аккаунта и отвечает AuthMiddleware, активен ли аккаунт.
+// Статусы кешируются на ttl: блокировка на этом экземпляре сервиса действует сразу,
+// на остальных - не позже чем через ttl
+type AccountStatusService struct {
+	userRepo users_db.UserRepository
+	ttl      time.Duration
+	log      *slog.Logger
+
+	mu    sync.Mutex
+	cache map[int64]cachedStatus
+}
+
+// NewAccountStatusService создаёт сервис статусов. ttl 0 отключает кеш
+func NewAccountStatusService(userRepo users_db.UserRepository, ttl time.Duration, log *slog.Logger) *AccountStatusService {
+	return &AccountStatusService{
+		userRepo: userRepo,
+		ttl:      ttl,
+		log:      log,
+		cache:    make(map[int64]cachedStatus),
+	}
+}
+
+// AccountStatus Действующий статус аккаунта, по возможности из кеша
+func (s *AccountStatusService) AccountStatus(ctx context.Context, userID int64) (string, error) {
+	now := time.Now()
+	s.mu.Lock()
+	cached, ok := s.cache[userID]
+	s.mu.Unlock()
+	if ok && now.Before(cached.expiresAt) {
+		return cached.status, nil
+	}
+
+	status, err := s.userRepo.GetUserStatus(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	if s.ttl > 0 {
+		s.mu.Lock()
+		if len(s.cache) >= statusCacheCleanupSize {
+			s.evictExpired(now)
+		}
+		s.cache[userID] = cachedStatus{status: status, expiresAt: now.Add(s.ttl)}
+		s.mu.Unlock()
+	}
+	return status, nil
+}
+
+// AccountActive Реализация middlewares.AccountStatusChecker. Удалённый пользователь считается неактивным
+func (s *AccountStatusService) AccountActive(ctx context.Context, userID int64) (bool, error) {
+	status, err := s.AccountStatus(ctx, userID)
+	if errors.Is(err, users_db.ErrUserNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return AccountStatusError(status) == nil, nil
+}
+
+// SetStatus Меняет статус аккаунта и сбрасывает его кеш
+func (s *AccountStatusService) SetStatus(ctx context.Context, userID int64, change users_db.StatusChange) (users_db.UserInfo, error) {
+	const op = "internal/lib/services/account_status_service.go/SetStatus"
+	log := s.log.With(
+		slog.String("operation", op),
+		slog.Int64("user_id", userID),
+		slog.String("status", change.Status))
+
+	if change.ExpiresAt != nil && !change.ExpiresAt.After(time.Now()) {
+		return users_db.UserInfo{}, ErrInvalidStatusExpiry
+	}
+	user, err := s.userRepo.SetStatus(ctx, userID, change)
+	if err != nil {
+		return users_db.UserInfo{}, err
+	}
+	s.Invalidate(userID)
+	log.Info("Account status changed", "reason", change.Reason, "expires_at", change.ExpiresAt)
+	return user, nil
+}
+
+// Invalidate Убирает статус пользователя из кеша
+func (s *AccountStatusService) Invalidate(userID int64) {
+	s.mu.Lock()
+	delete(s.cache, userID)
+	s.mu.Unlock()
+}
+
+func (s *AccountStatusService) evictExpired(now time.Time) {
+	for userID, cached := range s.cache {
+		if !now.Before(cached.expiresAt) {
+			delete(s.cache, userID)
+		}
+	}
+}
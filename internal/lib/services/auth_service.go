@@ -4,16 +4,36 @@ import (
 	"context"
 	"errors"
 	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/jwt_tokens"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/tenant"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/user_metadata"
 	"github.com/ShlykovPavel/auth-JWT-microservice/internal/server/users"
 	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/auth_db"
 	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
 	tokens2 "github.com/ShlykovPavel/auth-JWT-microservice/models/tokens"
 	getUserDto "github.com/ShlykovPavel/auth-JWT-microservice/models/users/get_user"
 	"log/slog"
+	"strings"
+	"sync"
 	"time"
 )
 
 var ErrWrongPassword = errors.New("Password is incorrect ")
+var ErrNoOrganization = errors.New("user is not a member of any organization")
+var ErrNotOrgMember = errors.New("user is not a member of the organization")
+var ErrAccountSuspended = errors.New("account is suspended")
+var ErrAccountDeactivated = errors.New("account is deactivated")
+
+// AccountStatusError Ошибка входа для статуса аккаунта. Для активного аккаунта nil
+func AccountStatusError(status string) error {
+	switch status {
+	case users_db.StatusSuspended:
+		return ErrAccountSuspended
+	case users_db.StatusDeactivated:
+		return ErrAccountDeactivated
+	default:
+		return nil
+	}
+}
 
 type AuthService struct {
 	userRepo    users_db.UserRepository
@@ -21,40 +41,127 @@ type AuthService struct {
 	log         *slog.Logger
 	secretKey   string
 	JWTDuration time.Duration
+	throttler   *LoginThrottler
+	// metadataClaims Атрибуты пользователя, которые кладутся в access токен
+	metadataClaims user_metadata.ClaimsMapping
+
+	// dummyHash Хеш случайного пароля для выравнивания времени ответа, когда пользователь не найден
+	dummyHash     string
+	dummyHashOnce sync.Once
 }
 
-func NewAuthService(db users_db.UserRepository, tokensRepo auth_db.TokensRepository, log *slog.Logger, secretKey string, jwtDuration time.Duration) *AuthService {
-	return &AuthService{
-		userRepo:    db,
-		tokensRepo:  tokensRepo,
-		log:         log,
-		secretKey:   secretKey,
-		JWTDuration: jwtDuration,
+// NewAuthService создаёт сервис авторизации. throttler может быть nil - тогда неудачные попытки входа не ограничиваются.
+// metadataClaims может быть пустым - тогда атрибуты пользователя в токен не попадают
+func NewAuthService(db users_db.UserRepository, tokensRepo auth_db.TokensRepository, log *slog.Logger, secretKey string, jwtDuration time.Duration, throttler *LoginThrottler, metadataClaims user_metadata.ClaimsMapping) *AuthService {
+	service := &AuthService{
+		userRepo:       db,
+		tokensRepo:     tokensRepo,
+		log:            log,
+		secretKey:      secretKey,
+		JWTDuration:    jwtDuration,
+		throttler:      throttler,
+		metadataClaims: metadataClaims,
 	}
+	// Считаем хеш заранее, иначе первый запрос с несуществующим email был бы заметно медленнее
+	service.getDummyHash()
+	return service
 }
 
-func (a *AuthService) Authentication(user *getUserDto.AuthUser, ctx context.Context) (tokens2.RefreshTokensDto, error) {
+// Authentication проверяет email (или имя пользователя) и пароль и выдаёт пару токенов.
+// clientIP нужен для ограничения неудачных попыток входа с одного адреса.
+// Если указана организация, вход выполняется в неё, иначе - в первую организацию пользователя
+func (a *AuthService) Authentication(user *getUserDto.AuthUser, clientIP string, ctx context.Context) (tokens2.RefreshTokensDto, error) {
 	const op = "server/users/auth/Authentification"
 	log := a.log.With(
 		slog.String("operation", op),
-		slog.String("request email: ", user.Email))
+		slog.String("request login: ", user.Login()))
 
-	// Проверяем что пользователь есть в БД
-	usr, err := a.userRepo.GetUser(ctx, user.Email)
-	if err != nil {
-		if errors.Is(err, users_db.ErrUserNotFound) {
-			log.Debug("UserInfo not found", "user", user)
-			return tokens2.RefreshTokensDto{}, err
-		}
+	if user.OrgID != nil {
+		// Не участник организации выглядит так же, как несуществующий email
+		ctx = tenant.WithOrgID(ctx, *user.OrgID)
+	} else {
+		// Организация ещё не выбрана: ищем среди всех пользователей, токены выдаются в первую организацию
+		ctx = tenant.WithoutOrg(ctx)
+	}
+
+	// Ищем пользователя до проверки блокировки: попытки по email и по имени пользователя считаются одному аккаунту
+	usr, err := a.findUser(ctx, user)
+	if err != nil && !errors.Is(err, users_db.ErrUserNotFound) {
 		log.Error("Error while fetching user", "err", err)
 		return tokens2.RefreshTokensDto{}, err
 	}
+	// Неизвестный логин приводим к нижнему регистру, что б сменой регистра нельзя было обойти блокировку
+	throttleKey := strings.ToLower(user.Login())
+	if err == nil {
+		throttleKey = usr.Email
+	}
+
+	// Попытка учитывается до проверки пароля. Если аккаунт или IP заблокированы, пароль даже не проверяем
+	if a.throttler != nil {
+		if throttleErr := a.throttler.Reserve(ctx, throttleKey, clientIP); throttleErr != nil {
+			log.Debug("Login is throttled", "err", throttleErr)
+			return tokens2.RefreshTokensDto{}, throttleErr
+		}
+	}
+
+	if errors.Is(err, users_db.ErrUserNotFound) {
+		log.Debug("UserInfo not found", "user", user.Login())
+		// Тратим на несуществующего пользователя столько же времени, сколько на проверку пароля,
+		// что б по времени ответа нельзя было понять, зарегистрирован ли email
+		users.ComparePassword(a.getDummyHash(), user.Password, log)
+		a.registerLoginFailure()
+		return tokens2.RefreshTokensDto{}, err
+	}
+	// Пока пароль не задан (импорт без паролей), вход по паролю закрыт, даже если хеш остался: пользователь входит
+	// по ссылке или коду и задаёт пароль. Отвечаем как на неверный пароль, тратя то же время
+	if usr.PasswordHash == "" || usr.PasswordResetRequired {
+		users.ComparePassword(a.getDummyHash(), user.Password, log)
+		a.registerLoginFailure()
+		return tokens2.RefreshTokensDto{}, ErrWrongPassword
+	}
 	// Проверяем что нам предоставили правильный пароль
 	ok := users.ComparePassword(usr.PasswordHash, user.Password, log)
 	if !ok {
+		a.registerLoginFailure()
 		return tokens2.RefreshTokensDto{}, ErrWrongPassword
 	}
-	accessToken, err := jwt_tokens.CreateAccessToken(usr.ID, a.secretKey, usr.Role, a.JWTDuration, a.log)
+	if a.throttler != nil {
+		a.throttler.RegisterSuccess(ctx, throttleKey, clientIP)
+	}
+	// Пароль верный - самое время перехешировать его, если хеш устарел
+	a.rehashPasswordIfNeeded(ctx, usr, user.Password, log)
+	return a.IssueTokens(ctx, usr)
+}
+
+// findUser Пользователь по email или, если email не передан, по имени пользователя
+func (a *AuthService) findUser(ctx context.Context, user *getUserDto.AuthUser) (users_db.UserInfo, error) {
+	if user.Email != "" {
+		return a.userRepo.GetUser(ctx, user.Email)
+	}
+	return a.userRepo.GetUserByUsername(ctx, user.Username)
+}
+
+// IssueTokens выдаёт пару access и refresh токенов уже проверенному пользователю.
+// Используется всеми способами входа: по паролю, по ссылке из письма, по одноразовому коду.
+// Токены выдаются в организацию usr.OrgID с ролями пользователя в ней
+func (a *AuthService) IssueTokens(ctx context.Context, usr users_db.UserInfo) (tokens2.RefreshTokensDto, error) {
+	const op = "internal/lib/services/auth_service.go/IssueTokens"
+	log := a.log.With(
+		slog.String("operation", op),
+		slog.Int64("user_id", usr.ID),
+		slog.Int64("org_id", usr.OrgID))
+
+	// Проверка здесь закрывает все способы входа сразу, в том числе по паролю: он проверяется раньше,
+	// поэтому о блокировке узнаёт только тот, кто знает пароль
+	if err := AccountStatusError(usr.Status); err != nil {
+		log.Info("Login of inactive account rejected", "status", usr.Status)
+		return tokens2.RefreshTokensDto{}, err
+	}
+	if usr.OrgID == 0 {
+		log.Warn("User is not a member of any organization")
+		return tokens2.RefreshTokensDto{}, ErrNoOrganization
+	}
+	accessToken, err := jwt_tokens.CreateAccessTokenWithClaims(usr.ID, usr.OrgID, a.secretKey, usr.Roles, usr.Permissions, a.metadataClaims.Claims(usr.Metadata), a.JWTDuration, a.log)
 	if err != nil {
 		log.Error("Error while creating access token", "err", err)
 		return tokens2.RefreshTokensDto{}, err
@@ -64,28 +171,78 @@ func (a *AuthService) Authentication(user *getUserDto.AuthUser, ctx context.Cont
 		log.Error("Error while creating refresh token", "err", err)
 		return tokens2.RefreshTokensDto{}, err
 	}
-	err = a.tokensRepo.DbPutTokens(ctx, usr.ID, refreshToken)
+	err = a.tokensRepo.DbPutTokens(ctx, usr.ID, usr.OrgID, refreshToken)
 	if err != nil {
 		log.Error("Error while storing tokens", "err", err)
 		return tokens2.RefreshTokensDto{}, err
 	}
 	return tokens2.RefreshTokensDto{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
+		AccessToken:           accessToken,
+		RefreshToken:          refreshToken,
+		PasswordResetRequired: usr.PasswordResetRequired,
 	}, nil
 }
 
+// getDummyHash Хеш считается текущим алгоритмом с текущими параметрами, поэтому его проверка стоит столько же, сколько настоящая
+func (a *AuthService) getDummyHash() string {
+	a.dummyHashOnce.Do(func() {
+		randomPassword, err := jwt_tokens.CreateRefreshToken(a.log)
+		if err != nil {
+			randomPassword = "dummy password for timing equalization"
+		}
+		a.dummyHash, err = users.HashUserPassword(randomPassword, a.log)
+		if err != nil {
+			a.log.Error("Error while creating dummy password hash", "err", err)
+		}
+	})
+	return a.dummyHash
+}
+
+func (a *AuthService) registerLoginFailure() {
+	if a.throttler != nil {
+		a.throttler.RegisterFailure()
+	}
+}
+
+// rehashPasswordIfNeeded переводит хеш пароля на текущий алгоритм и параметры.
+// Ошибка не прерывает логин: пользователь ввёл верный пароль, перехешируем при следующем входе
+func (a *AuthService) rehashPasswordIfNeeded(ctx context.Context, usr users_db.UserInfo, password string, log *slog.Logger) {
+	if !users.PasswordNeedsRehash(usr.PasswordHash) {
+		return
+	}
+	newHash, err := users.HashUserPassword(password, log)
+	if err != nil {
+		log.Warn("Error while rehashing password", "err", err)
+		return
+	}
+	if err = a.userRepo.RehashPassword(ctx, usr.ID, usr.PasswordHash, newHash); err != nil {
+		log.Warn("Error while storing rehashed password", "err", err)
+		return
+	}
+	log.Info("Password hash upgraded", slog.Int64("user_id", usr.ID))
+}
+
 func (a *AuthService) RefreshTokens(tokensForRefresh *tokens2.RefreshTokensDto, ctx context.Context) (tokens2.RefreshTokensDto, error) {
 	const op = "internal/lib/services/auth_service.go/RefreshTokens"
 	log := a.log.With(
 		slog.String("operation", op),
 	)
+	// Организацию определяет сам refresh токен
+	ctx = tenant.WithoutOrg(ctx)
 	tokenData, err := a.tokensRepo.DbGetTokens(ctx, tokensForRefresh.RefreshToken)
 	if err != nil {
 		log.Error("Error while fetching tokensForRefresh", "err", err)
 		return tokens2.RefreshTokensDto{}, err
 	}
-	accessToken, err := jwt_tokens.CreateAccessToken(tokenData.UserId, a.secretKey, tokenData.UserRole, a.JWTDuration, a.log)
+	if err = AccountStatusError(tokenData.UserStatus); err != nil {
+		// Токены удаляются при блокировке, но статус мог истечь сам - тогда токен больше не нужен
+		log.Info("Refresh of inactive account rejected", slog.Int64("user_id", tokenData.UserId), "status", tokenData.UserStatus)
+		if deleteErr := a.tokensRepo.DbDeleteToken(ctx, tokensForRefresh.RefreshToken); deleteErr != nil {
+			log.Warn("Error while deleting token of inactive account", "err", deleteErr)
+		}
+		return tokens2.RefreshTokensDto{}, err
+	}
+	accessToken, err := jwt_tokens.CreateAccessTokenWithClaims(tokenData.UserId, tokenData.OrgID, a.secretKey, tokenData.UserRoles, tokenData.UserPermissions, a.metadataClaims.Claims(tokenData.UserMetadata), a.JWTDuration, a.log)
 	if err != nil {
 		log.Error("Error while creating access token", "err", err)
 		return tokens2.RefreshTokensDto{}, err
@@ -95,7 +252,7 @@ func (a *AuthService) RefreshTokens(tokensForRefresh *tokens2.RefreshTokensDto,
 		log.Error("Error while creating refresh token", "err", err)
 		return tokens2.RefreshTokensDto{}, err
 	}
-	err = a.tokensRepo.DbUpdateTokens(context.Background(), tokenData.UserId, refreshToken, tokensForRefresh.RefreshToken)
+	err = a.tokensRepo.DbUpdateTokens(tenant.WithOrgID(context.Background(), tokenData.OrgID), tokenData.UserId, refreshToken, tokensForRefresh.RefreshToken)
 	if err != nil {
 		log.Error("Error while storing tokensForRefresh", "err", err)
 		return tokens2.RefreshTokensDto{}, err
@@ -106,16 +263,37 @@ func (a *AuthService) RefreshTokens(tokensForRefresh *tokens2.RefreshTokensDto,
 	}, nil
 }
 
+// SwitchOrganization выдаёт новую пару токенов в другую организацию пользователя.
+// Токены текущей организации продолжают действовать
+func (a *AuthService) SwitchOrganization(ctx context.Context, userID int64, orgID int64) (tokens2.RefreshTokensDto, error) {
+	const op = "internal/lib/services/auth_service.go/SwitchOrganization"
+	log := a.log.With(
+		slog.String("operation", op),
+		slog.Int64("user_id", userID),
+		slog.Int64("org_id", orgID))
+
+	usr, err := a.userRepo.GetUserByID(tenant.WithOrgID(ctx, orgID), userID)
+	if err != nil {
+		if errors.Is(err, users_db.ErrUserNotFound) {
+			log.Debug("User is not a member of the organization")
+			return tokens2.RefreshTokensDto{}, ErrNotOrgMember
+		}
+		log.Error("Error while fetching user", "err", err)
+		return tokens2.RefreshTokensDto{}, err
+	}
+	return a.IssueTokens(ctx, usr)
+}
+
 func (a *AuthService) Logout(tokens *tokens2.LogoutRequest, ctx context.Context) error {
 	const op = "server/users/auth/Logout"
 	log := a.log.With(
 		slog.String("operation", op))
-	_, err := a.tokensRepo.DbGetTokens(ctx, tokens.RefreshToken)
+	_, err := a.tokensRepo.DbGetTokens(tenant.WithoutOrg(ctx), tokens.RefreshToken)
 	if err != nil {
 		log.Error("Error while fetching tokens", "err", err)
 		return err
 	}
-	err = a.tokensRepo.DbDeleteToken(context.Background(), tokens.RefreshToken)
+	err = a.tokensRepo.DbDeleteToken(tenant.WithoutOrg(context.Background()), tokens.RefreshToken)
 	if err != nil {
 		log.Error("Error while deleting tokens", "err", err)
 		return err
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"context"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/policy"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"time"
+)
+
+// AuthzService Отвечает на вопросы о доступе: собирает атрибуты субъекта и передаёт запрос движку политик
+type AuthzService struct {
+	engine   *policy.Engine
+	userRepo users_db.UserRepository
+}
+
+func NewAuthzService(engine *policy.Engine, userRepo users_db.UserRepository) *AuthzService {
+	return &AuthzService{
+		engine:   engine,
+		userRepo: userRepo,
+	}
+}
+
+// Check Вычисляет решение. Если userID не nil, атрибуты пользователя из БД перекрывают переданные attributes
+func (s *AuthzService) Check(ctx context.Context, userID *int64, attributes map[string]interface{}, action string, resource policy.Resource, requestContext map[string]interface{}) (policy.Decision, error) {
+	subject := make(map[string]interface{}, len(attributes))
+	for key, value := range attributes {
+		subject[key] = value
+	}
+	if userID != nil {
+		user, err := s.userRepo.GetUserByID(ctx, *userID)
+		if err != nil {
+			return policy.Decision{}, err
+		}
+		for key, value := range UserAttributes(user) {
+			subject[key] = value
+		}
+	}
+	return s.engine.Evaluate(policy.Request{
+		Subject:  subject,
+		Action:   action,
+		Resource: resource,
+		Context:  requestContext,
+	}), nil
+}
+
+// UserAttributes Атрибуты пользователя, доступные в правилах как subject.*. Дополнительные атрибуты - subject.metadata.<секция>.<атрибут>
+func UserAttributes(user users_db.UserInfo) map[string]interface{} {
+	return map[string]interface{}{
+		"id":             user.ID,
+		"email":          user.Email,
+		"first_name":     user.FirstName,
+		"last_name":      user.LastName,
+		"org_id":         user.OrgID,
+		"roles":          user.Roles,
+		"permissions":    user.Permissions,
+		"status":         user.Status,
+		"phone_verified": user.PhoneVerified,
+		"created_at":     user.CreatedAt.UTC().Format(time.RFC3339),
+		"metadata": map[string]interface{}{
+			users_db.MetadataSectionUser:  user.Metadata.User,
+			users_db.MetadataSectionAdmin: user.Metadata.Admin,
+		},
+	}
+}
@@ -0,0 +1,250 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/bulk_users"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/password_hasher"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/bulk_users_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"io"
+	"log/slog"
+	"net/mail"
+	"slices"
+	"unicode/utf8"
+)
+
+// Откуда берутся пароли импортированных пользователей
+const (
+	// PasswordModeHashed В файле готовые хеши bcrypt или argon2id, пользователи входят со старыми паролями
+	PasswordModeHashed = "hashed"
+	// PasswordModeReset Паролей нет: пользователь входит по ссылке или коду и задаёт пароль. Хеши из файла не читаются
+	PasswordModeReset = "reset"
+)
+
+const (
+	// defaultImportBatchSize Сколько строк загружается одним COPY и одной транзакцией
+	defaultImportBatchSize = 1000
+	// maxReportedImportErrors Сколько ошибок попадает в отчёт. Остальные только считаются
+	maxReportedImportErrors = 1000
+)
+
+// Ограничения колонок таблицы users
+const (
+	maxEmailLength        = 256
+	maxNameLength         = 64
+	maxPasswordHashLength = 128
+)
+
+var ErrUnknownPasswordMode = errors.New("unknown password mode, expected hashed or reset")
+
+// ImportOptions Параметры импорта
+type ImportOptions struct {
+	Format       string // bulk_users.FormatCSV или bulk_users.FormatJSONL
+	PasswordMode string
+	DryRun       bool // Только проверить файл и данные в БД, ничего не записывая
+	// GrantRoles Выдавать роли из файла. Без этого строки с ролями сверх user отклоняются:
+	// право users:write не должно позволять создавать администраторов
+	GrantRoles bool
+}
+
+// ImportRowError Ошибка в строке файла
+type ImportRowError struct {
+	Line  int
+	Email string
+	Error string
+}
+
+// ImportReport Итог импорта. Imported при DryRun - сколько строк загрузилось бы
+type ImportReport struct {
+	DryRun          bool
+	Total           int
+	Imported        int
+	Failed          int
+	Errors          []ImportRowError
+	ErrorsTruncated bool // В Errors попали не все ошибки
+}
+
+func (r *ImportReport) addError(line int, email string, message string) {
+	if len(r.Errors) >= maxReportedImportErrors {
+		r.ErrorsTruncated = true
+		return
+	}
+	r.Errors = append(r.Errors, ImportRowError{Line: line, Email: email, Error: message})
+}
+
+// BulkUsersService Массовый импорт и выгрузка пользователей организации запроса.
+// Файл читается потоком и загружается пачками, поэтому размер файла ограничен только временем запроса
+type BulkUsersService struct {
+	repo      bulk_users_db.BulkUsersRepository
+	batchSize int
+	log       *slog.Logger
+}
+
+// NewBulkUsersService batchSize <= 0 - пачки по 1000 строк
+func NewBulkUsersService(repo bulk_users_db.BulkUsersRepository, batchSize int, log *slog.Logger) *BulkUsersService {
+	if batchSize <= 0 {
+		batchSize = defaultImportBatchSize
+	}
+	return &BulkUsersService{
+		repo:      repo,
+		batchSize: batchSize,
+		log:       log,
+	}
+}
+
+// Import Загружает пользователей из r. Ошибки в строках попадают в отчёт и не останавливают импорт,
+// ошибка возвращается, только если файл нельзя читать дальше или упала БД. Уже загруженные пачки при этом остаются
+func (s *BulkUsersService) Import(ctx context.Context, r io.Reader, opts ImportOptions) (ImportReport, error) {
+	const op = "internal/lib/services/bulk_users_service.go/Import"
+	log := s.log.With(
+		slog.String("op", op),
+		slog.String("format", opts.Format),
+		slog.String("password_mode", opts.PasswordMode),
+		slog.Bool("dry_run", opts.DryRun))
+
+	report := ImportReport{DryRun: opts.DryRun, Errors: []ImportRowError{}}
+	if opts.PasswordMode != PasswordModeHashed && opts.PasswordMode != PasswordModeReset {
+		return report, ErrUnknownPasswordMode
+	}
+	reader, err := bulk_users.NewReader(opts.Format, r)
+	if err != nil {
+		return report, err
+	}
+
+	// Дубликаты ищутся по всему файлу, а не только внутри пачки
+	seen := make(map[string]int)
+	batch := make([]bulk_users_db.ImportRow, 0, s.batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		imported, rejected, err := s.repo.ImportBatch(ctx, batch, opts.DryRun)
+		if err != nil {
+			return err
+		}
+		report.Imported += imported
+		report.Failed += len(batch) - imported
+		for _, row := range rejected {
+			report.addError(row.Line, row.Email, row.Reason)
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	for {
+		record, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var rowErr *bulk_users.RowError
+		if errors.As(err, &rowErr) {
+			report.Total++
+			report.Failed++
+			report.addError(rowErr.Line, "", rowErr.Err.Error())
+			continue
+		}
+		if err != nil {
+			log.Error("Error while reading import file", "err", err)
+			return report, err
+		}
+
+		report.Total++
+		row, err := importRow(record, opts)
+		if err == nil {
+			if firstLine, ok := seen[row.Email]; ok {
+				err = fmt.Errorf("duplicate email, first seen on line %d", firstLine)
+			}
+		}
+		if err != nil {
+			report.Failed++
+			report.addError(record.Line, record.Email, err.Error())
+			continue
+		}
+		seen[row.Email] = row.Line
+		batch = append(batch, row)
+		if len(batch) == s.batchSize {
+			if err = flush(); err != nil {
+				log.Error("Error while importing batch", "err", err)
+				return report, err
+			}
+		}
+	}
+	if err = flush(); err != nil {
+		log.Error("Error while importing batch", "err", err)
+		return report, err
+	}
+	log.Info("Users import finished", slog.Int("total", report.Total), slog.Int("imported", report.Imported), slog.Int("failed", report.Failed))
+	return report, nil
+}
+
+// importRow Проверяет строку файла. Без ролей пользователь получает роль user
+func importRow(record bulk_users.Record, opts ImportOptions) (bulk_users_db.ImportRow, error) {
+	row := bulk_users_db.ImportRow{
+		Line:      record.Line,
+		Email:     record.Email,
+		FirstName: record.FirstName,
+		LastName:  record.LastName,
+		Roles:     record.Roles,
+	}
+	if row.Email == "" {
+		return row, errors.New("email is required")
+	}
+	if address, err := mail.ParseAddress(row.Email); err != nil || address.Address != row.Email || utf8.RuneCountInString(row.Email) > maxEmailLength {
+		return row, errors.New("invalid email")
+	}
+	// Email хранится в нижнем регистре, поэтому и дубликаты в файле ищутся без учёта регистра
+	row.Email = users_db.NormalizeEmail(row.Email)
+	if utf8.RuneCountInString(row.FirstName) > maxNameLength || utf8.RuneCountInString(row.LastName) > maxNameLength {
+		return row, fmt.Errorf("first_name and last_name must be at most %d characters", maxNameLength)
+	}
+	if !opts.GrantRoles && slices.ContainsFunc(row.Roles, func(role string) bool { return role != users_db.RoleUser }) {
+		return row, errors.New("granting roles requires the roles:write permission")
+	}
+	if opts.PasswordMode == PasswordModeHashed {
+		if record.PasswordHash == "" {
+			return row, errors.New("password_hash is required")
+		}
+		if utf8.RuneCountInString(record.PasswordHash) > maxPasswordHashLength {
+			return row, errors.New("password_hash is too long")
+		}
+		// Хеш разбирается целиком: с ним будут сравнивать пароль при входе
+		if err := password_hasher.GetHasher().Validate(record.PasswordHash); err != nil {
+			return row, fmt.Errorf("invalid password_hash, expected bcrypt or argon2id: %w", err)
+		}
+		row.PasswordHash = record.PasswordHash
+	}
+	if len(row.Roles) == 0 {
+		row.Roles = []string{users_db.RoleUser}
+	}
+	return row, nil
+}
+
+// Export Пишет пользователей организации в w по одному. Хеши паролей выгружаются, только если includePasswordHashes.
+// Возвращает количество выгруженных пользователей
+func (s *BulkUsersService) Export(ctx context.Context, w io.Writer, format string, includePasswordHashes bool) (int, error) {
+	writer, err := bulk_users.NewWriter(format, w)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	err = s.repo.ExportUsers(ctx, includePasswordHashes, func(user bulk_users_db.ExportedUser) error {
+		createdAt := user.CreatedAt
+		count++
+		return writer.Write(bulk_users.Record{
+			ID:           user.ID,
+			Email:        user.Email,
+			FirstName:    user.FirstName,
+			LastName:     user.LastName,
+			PasswordHash: user.PasswordHash,
+			Roles:        user.Roles,
+			Status:       user.Status,
+			CreatedAt:    &createdAt,
+		})
+	})
+	if err != nil {
+		return count, err
+	}
+	return count, writer.Flush()
+}
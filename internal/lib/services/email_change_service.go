@@ -0,0 +1,206 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/jwt_tokens"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/mailer"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/tenant"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/server/users"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"log/slog"
+	"net/url"
+	"time"
+)
+
+var ErrSameEmail = errors.New("new email is the same as the current one")
+
+// EmailChangeConfig Настройки смены email
+type EmailChangeConfig struct {
+	TTL        time.Duration // Сколько действует ссылка подтверждения на новый адрес
+	CancelTTL  time.Duration // Сколько действует ссылка отмены на старый адрес, в том числе после подтверждения
+	ConfirmURL string        // Страница подтверждения. Токен добавляется параметром token
+	CancelURL  string        // Страница отмены. Токен добавляется параметром token
+}
+
+// EmailChangeService Смена email пользователя.
+//
+// Новый адрес начинает действовать только после перехода по ссылке из письма на него. Старый адрес получает
+// уведомление со ссылкой отмены: если смену запросил не владелец, он откатит её и завершит все сессии.
+// Как и вход по ссылке, ссылки ведут на страницы, которые отправляют токен POST запросом.
+// Ответ не зависит от того, занят ли новый адрес: владелец занятого адреса получает уведомление вместо ссылки,
+// а уникальность окончательно проверяется при подтверждении
+type EmailChangeService struct {
+	userRepo  users_db.UserRepository
+	mailer    mailer.Mailer
+	throttler *LoginThrottler
+	cfg       EmailChangeConfig
+	log       *slog.Logger
+}
+
+func NewEmailChangeService(userRepo users_db.UserRepository, mailer mailer.Mailer, throttler *LoginThrottler, cfg EmailChangeConfig, log *slog.Logger) *EmailChangeService {
+	return &EmailChangeService{
+		userRepo:  userRepo,
+		mailer:    mailer,
+		throttler: throttler,
+		cfg:       cfg,
+		log:       log,
+	}
+}
+
+// RequestChange Проверяет пароль пользователя и отправляет ссылку подтверждения на новый адрес и ссылку отмены на старый.
+// Неверный пароль учитывается как неудачный вход, при блокировке возвращается *LockedError.
+// Пользователь без пароля (из импорта) должен сначала его задать
+func (s *EmailChangeService) RequestChange(ctx context.Context, userID int64, newEmail string, password string, clientIP string) error {
+	const op = "internal/lib/services/email_change_service.go/RequestChange"
+	log := s.log.With(slog.String("op", op), slog.Int64("user_id", userID))
+	// Email общий для всех организаций
+	ctx = tenant.WithoutOrg(ctx)
+
+	usr, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		if !errors.Is(err, users_db.ErrUserNotFound) {
+			log.Error("Error while fetching user", "err", err)
+		}
+		return err
+	}
+	err = s.throttler.VerifyPassword(ctx, usr.Email, clientIP, func() bool {
+		return usr.PasswordHash != "" && users.ComparePassword(usr.PasswordHash, password, log)
+	})
+	if err != nil {
+		return err
+	}
+	newEmail = users_db.NormalizeEmail(newEmail)
+	if newEmail == usr.Email {
+		return ErrSameEmail
+	}
+	_, err = s.userRepo.GetUser(ctx, newEmail)
+	if err != nil && !errors.Is(err, users_db.ErrUserNotFound) {
+		log.Error("Error while checking new email", "err", err)
+		return err
+	}
+	taken := err == nil
+
+	confirmToken, err := jwt_tokens.CreateRefreshToken(s.log)
+	if err != nil {
+		log.Error("Error while creating email change token", "err", err)
+		return err
+	}
+	cancelToken, err := jwt_tokens.CreateRefreshToken(s.log)
+	if err != nil {
+		log.Error("Error while creating email change token", "err", err)
+		return err
+	}
+	confirmLink, err := buildTokenLink(s.cfg.ConfirmURL, confirmToken)
+	if err != nil {
+		log.Error("Error while building confirmation link", "err", err)
+		return err
+	}
+	cancelLink, err := buildTokenLink(s.cfg.CancelURL, cancelToken)
+	if err != nil {
+		log.Error("Error while building cancel link", "err", err)
+		return err
+	}
+
+	now := time.Now()
+	change, err := s.userRepo.CreateEmailChange(ctx, users_db.EmailChange{
+		UserID:          userID,
+		NewEmail:        newEmail,
+		ExpiresAt:       now.Add(s.cfg.TTL),
+		CancelExpiresAt: now.Add(s.cfg.CancelTTL),
+	}, jwt_tokens.HashOpaqueToken(confirmToken), jwt_tokens.HashOpaqueToken(cancelToken))
+	if err != nil {
+		if !errors.Is(err, users_db.ErrUserNotFound) {
+			log.Error("Error while storing email change", "err", err)
+		}
+		return err
+	}
+	log.Info("Email change requested", slog.Int64("email_change_id", change.ID), slog.Bool("taken", taken))
+
+	if taken {
+		// Заявка всё равно создаётся и старый адрес получает уведомление, что б ответ и письма запросившему не отличались
+		s.send(log, mailer.Message{
+			To:      change.NewEmail,
+			Subject: "Someone tried to use your email address",
+			Body: "Someone asked to use this address for another account. It already belongs to your account, so nothing was changed.\n\n" +
+				"If it was not you, you can ignore this message.",
+		})
+	} else {
+		s.send(log, mailer.Message{
+			To:      change.NewEmail,
+			Subject: "Confirm your new email address",
+			Body: fmt.Sprintf("Open this link to use this address for your account. It can be used once and expires in %s:\n\n%s\n\n"+
+				"If you did not request it, you can ignore this message.", s.cfg.TTL, confirmLink),
+		})
+	}
+	s.send(log, mailer.Message{
+		To:      change.OldEmail,
+		Subject: "Your email address is being changed",
+		Body: fmt.Sprintf("Someone asked to change the email address of your account to %s. "+
+			"The change takes effect once the new address is confirmed.\n\n"+
+			"If it was not you, open this link within %s to cancel the change and sign out everywhere:\n\n%s",
+			change.NewEmail, s.cfg.CancelTTL, cancelLink),
+	})
+	return nil
+}
+
+// Confirm Применяет смену по ссылке из письма на новый адрес и завершает все сессии пользователя,
+// кроме сессии с refreshToken (может быть пустым)
+func (s *EmailChangeService) Confirm(ctx context.Context, token string, refreshToken string) error {
+	const op = "internal/lib/services/email_change_service.go/Confirm"
+	log := s.log.With(slog.String("op", op))
+
+	change, err := s.userRepo.ConfirmEmailChange(ctx, jwt_tokens.HashOpaqueToken(token), refreshToken)
+	if err != nil {
+		if !errors.Is(err, users_db.ErrEmailChangeNotFound) && !errors.Is(err, users_db.ErrEmailAlreadyExists) {
+			log.Error("Error while confirming email change", "err", err)
+		}
+		return err
+	}
+	log.Info("Email changed", slog.Int64("user_id", change.UserID), slog.Int64("email_change_id", change.ID))
+	return nil
+}
+
+// Cancel Отменяет смену по ссылке из письма на старый адрес. Подтверждённая смена откатывается,
+// все сессии пользователя завершаются
+func (s *EmailChangeService) Cancel(ctx context.Context, token string) error {
+	const op = "internal/lib/services/email_change_service.go/Cancel"
+	log := s.log.With(slog.String("op", op))
+
+	change, err := s.userRepo.CancelEmailChange(ctx, jwt_tokens.HashOpaqueToken(token))
+	if err != nil {
+		if !errors.Is(err, users_db.ErrEmailChangeNotFound) && !errors.Is(err, users_db.ErrEmailAlreadyExists) {
+			log.Error("Error while cancelling email change", "err", err)
+		}
+		return err
+	}
+	log.Warn("Email change cancelled by the owner of the old address",
+		slog.Int64("user_id", change.UserID),
+		slog.Int64("email_change_id", change.ID),
+		slog.Bool("reverted", change.ConfirmedAt != nil))
+	return nil
+}
+
+// send Отправляет письмо в фоне, что б ответ не ждал почтовый сервер
+func (s *EmailChangeService) send(log *slog.Logger, msg mailer.Message) {
+	go func() {
+		sendCtx, cancel := context.WithTimeout(context.Background(), mailSendTimeout)
+		defer cancel()
+		if err := s.mailer.Send(sendCtx, msg); err != nil {
+			log.Error("Error while sending email change message", "err", err)
+		}
+	}()
+}
+
+// buildTokenLink Добавляет токен параметром token к адресу страницы
+func buildTokenLink(pageURL string, token string) (string, error) {
+	link, err := url.Parse(pageURL)
+	if err != nil {
+		return "", err
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+	return link.String(), nil
+}
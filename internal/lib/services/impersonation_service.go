@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/jwt_tokens"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/user_metadata"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/audit_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+var ErrSelfImpersonation = errors.New("cannot impersonate yourself")
+var ErrImpersonationEscalation = errors.New("user has permissions the administrator does not have")
+
+// ImpersonationToken Access токен пользователя, выданный администратору. Обновить его нельзя
+type ImpersonationToken struct {
+	AccessToken string
+	UserID      int64
+	ExpiresAt   time.Time
+}
+
+// ImpersonationService Выдаёт администраторам поддержки токены от имени пользователей и пишет каждую выдачу в журнал
+type ImpersonationService struct {
+	userRepo  users_db.UserRepository
+	auditRepo audit_db.AuditRepository
+	secretKey string
+	ttl       time.Duration
+	// metadataClaims Те же атрибуты в токене, что и при обычном входе
+	metadataClaims user_metadata.ClaimsMapping
+	log            *slog.Logger
+}
+
+func NewImpersonationService(userRepo users_db.UserRepository, auditRepo audit_db.AuditRepository, secretKey string, ttl time.Duration, metadataClaims user_metadata.ClaimsMapping, log *slog.Logger) *ImpersonationService {
+	return &ImpersonationService{
+		userRepo:       userRepo,
+		auditRepo:      auditRepo,
+		secretKey:      secretKey,
+		ttl:            ttl,
+		metadataClaims: metadataClaims,
+		log:            log,
+	}
+}
+
+// Impersonate Выдаёт токен пользователя targetID в организации запроса.
+// actorPermissions - права администратора: войти под пользователем с правами шире своих нельзя.
+// Если запись в журнал не удалась, токен не выдаётся
+func (s *ImpersonationService) Impersonate(ctx context.Context, actorID int64, actorPermissions []string, targetID int64, reason string, clientIP string) (ImpersonationToken, error) {
+	const op = "internal/lib/services/impersonation_service.go/Impersonate"
+	log := s.log.With(
+		slog.String("operation", op),
+		slog.Int64("actor_id", actorID),
+		slog.Int64("user_id", targetID))
+
+	if actorID == targetID {
+		return ImpersonationToken{}, ErrSelfImpersonation
+	}
+	usr, err := s.userRepo.GetUserByID(ctx, targetID)
+	if err != nil {
+		return ImpersonationToken{}, err
+	}
+	if err = AccountStatusError(usr.Status); err != nil {
+		return ImpersonationToken{}, err
+	}
+	for _, permission := range usr.Permissions {
+		if !slices.Contains(actorPermissions, permission) {
+			log.Warn("Impersonation would escalate privileges", "permission", permission)
+			return ImpersonationToken{}, ErrImpersonationEscalation
+		}
+	}
+
+	expiresAt := time.Now().Add(s.ttl)
+	accessToken, err := jwt_tokens.CreateImpersonationToken(usr.ID, usr.OrgID, actorID, s.secretKey, usr.Roles, usr.Permissions, s.metadataClaims.Claims(usr.Metadata), s.ttl, s.log)
+	if err != nil {
+		log.Error("Error while creating impersonation token", "err", err)
+		return ImpersonationToken{}, err
+	}
+	err = s.auditRepo.Record(ctx, audit_db.Event{
+		OrgID:        &usr.OrgID,
+		ActorID:      &actorID,
+		Action:       audit_db.ActionImpersonate,
+		TargetUserID: &usr.ID,
+		Reason:       reason,
+		IP:           clientIP,
+		Details:      map[string]interface{}{"expires_at": expiresAt.UTC().Format(time.RFC3339)},
+	})
+	if err != nil {
+		log.Error("Error while recording impersonation", "err", err)
+		return ImpersonationToken{}, err
+	}
+	log.Info("Impersonation token issued", "reason", reason, "expires_at", expiresAt)
+	return ImpersonationToken{AccessToken: accessToken, UserID: usr.ID, ExpiresAt: expiresAt}, nil
+}
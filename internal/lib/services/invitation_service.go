@@ -0,0 +1,193 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/jwt_tokens"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/mailer"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/password_policy"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/tenant"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/server/users"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/invitations_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/orgs_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	tokens2 "github.com/ShlykovPavel/auth-JWT-microservice/models/tokens"
+	"github.com/ShlykovPavel/auth-JWT-microservice/models/users/create_user"
+	"log/slog"
+	"net/url"
+	"time"
+)
+
+var ErrInvalidExpiry = errors.New("invitation expiry must be in the future")
+
+// InvitationConfig Настройки приглашений
+type InvitationConfig struct {
+	TTL time.Duration // Срок действия приглашения, если администратор не указал свой
+	URL string        // Адрес страницы принятия приглашения. Токен добавляется параметром token
+}
+
+// InvitationService Приглашения пользователей администраторами.
+// Приглашённый получает письмо со ссылкой, задаёт имя и пароль и сразу получает роли из приглашения.
+// Уже зарегистрированный пользователь вступает в организацию только сам, приняв приглашение после входа (Join)
+type InvitationService struct {
+	userRepo        users_db.UserRepository
+	invitationsRepo invitations_db.InvitationsRepository
+	authService     *AuthService
+	mailer          mailer.Mailer
+	policy          *password_policy.Policy
+	cfg             InvitationConfig
+	log             *slog.Logger
+}
+
+func NewInvitationService(userRepo users_db.UserRepository, invitationsRepo invitations_db.InvitationsRepository, authService *AuthService, mailer mailer.Mailer, policy *password_policy.Policy, cfg InvitationConfig, log *slog.Logger) *InvitationService {
+	return &InvitationService{
+		userRepo:        userRepo,
+		invitationsRepo: invitationsRepo,
+		authService:     authService,
+		mailer:          mailer,
+		policy:          policy,
+		cfg:             cfg,
+		log:             log,
+	}
+}
+
+// Invite создаёт приглашение в организацию orgID и отправляет ссылку на email.
+// expiresAt == nil - приглашение действует InvitationConfig.TTL
+func (s *InvitationService) Invite(ctx context.Context, orgID int64, invitedBy int64, email string, roles []string, expiresAt *time.Time) (invitations_db.Invitation, error) {
+	const op = "internal/lib/services/invitation_service.go/Invite"
+	log := s.log.With(slog.String("op", op), slog.Int64("org_id", orgID))
+
+	expires := time.Now().Add(s.cfg.TTL)
+	if expiresAt != nil {
+		if !expiresAt.After(time.Now()) {
+			return invitations_db.Invitation{}, ErrInvalidExpiry
+		}
+		expires = *expiresAt
+	}
+	if roles == nil {
+		roles = []string{}
+	}
+
+	token, err := jwt_tokens.CreateRefreshToken(s.log)
+	if err != nil {
+		log.Error("Error while creating invitation token", "err", err)
+		return invitations_db.Invitation{}, err
+	}
+	link, err := s.buildLink(token)
+	if err != nil {
+		log.Error("Error while building invitation link", "err", err)
+		return invitations_db.Invitation{}, err
+	}
+	invitation, err := s.invitationsRepo.CreateInvitation(ctx, invitations_db.Invitation{
+		OrgID:     orgID,
+		Email:     email,
+		Roles:     roles,
+		InvitedBy: &invitedBy,
+		ExpiresAt: expires,
+	}, jwt_tokens.HashOpaqueToken(token))
+	if err != nil {
+		return invitations_db.Invitation{}, err
+	}
+
+	msg := mailer.Message{
+		To:      email,
+		Subject: "You have been invited",
+		Body: fmt.Sprintf("You have been invited to join an organization. Open this link before %s to set your name "+
+			"and password, or to join with your existing account after signing in:\n\n%s\n\n"+
+			"If you were not expecting this invitation, you can ignore this message.",
+			expires.UTC().Format(time.RFC1123), link),
+	}
+	go func() {
+		sendCtx, cancel := context.WithTimeout(context.Background(), mailSendTimeout)
+		defer cancel()
+		if err := s.mailer.Send(sendCtx, msg); err != nil {
+			log.Error("Error while sending invitation", "err", err)
+		}
+	}()
+	return invitation, nil
+}
+
+// Accept принимает приглашение: создаёт пользователя с email из приглашения и выдаёт пару токенов в организацию приглашения.
+// Пароль проверяется по политике паролей, ошибку политики можно отрисовать через users.RenderPasswordPolicyError
+func (s *InvitationService) Accept(ctx context.Context, token string, firstName string, lastName string, password string) (tokens2.RefreshTokensDto, error) {
+	const op = "internal/lib/services/invitation_service.go/Accept"
+	log := s.log.With(slog.String("op", op))
+
+	tokenHash := jwt_tokens.HashOpaqueToken(token)
+	invitation, err := s.invitationsRepo.GetPendingInvitation(ctx, tokenHash)
+	if err != nil {
+		if !errors.Is(err, invitations_db.ErrInvitationNotFound) {
+			log.Error("Error while fetching invitation", "err", err)
+		}
+		return tokens2.RefreshTokensDto{}, err
+	}
+
+	err = users.CheckPasswordPolicy(s.policy, password, password_policy.PersonalInfo{
+		Email:     invitation.Email,
+		FirstName: firstName,
+		LastName:  lastName,
+	}, nil, log)
+	if err != nil {
+		return tokens2.RefreshTokensDto{}, err
+	}
+	passwordHash, err := users.HashUserPassword(password, log)
+	if err != nil {
+		log.Error("Error while hashing password", "err", err)
+		return tokens2.RefreshTokensDto{}, err
+	}
+
+	userID, invitation, err := s.invitationsRepo.AcceptInvitation(ctx, tokenHash, &create_user.UserCreate{
+		FirstName: firstName,
+		LastName:  lastName,
+		Password:  passwordHash,
+	})
+	if err != nil {
+		if !errors.Is(err, invitations_db.ErrInvitationNotFound) && !errors.Is(err, users_db.ErrEmailAlreadyExists) {
+			log.Error("Error while accepting invitation", "err", err)
+		}
+		return tokens2.RefreshTokensDto{}, err
+	}
+	log.Info("Invitation accepted", slog.Int64("invitation_id", invitation.ID), slog.Int64("user_id", userID))
+
+	usr, err := s.userRepo.GetUserByID(tenant.WithOrgID(ctx, invitation.OrgID), userID)
+	if err != nil {
+		log.Error("Error while fetching user", "err", err)
+		return tokens2.RefreshTokensDto{}, err
+	}
+	return s.authService.IssueTokens(ctx, usr)
+}
+
+// Join принимает приглашение от имени уже зарегистрированного пользователя userID: добавляет его в организацию приглашения
+// и выдаёт пару токенов в неё. Приглашение должно быть выписано на email пользователя
+func (s *InvitationService) Join(ctx context.Context, token string, userID int64) (tokens2.RefreshTokensDto, error) {
+	const op = "internal/lib/services/invitation_service.go/Join"
+	log := s.log.With(slog.String("op", op), slog.Int64("user_id", userID))
+
+	invitation, err := s.invitationsRepo.JoinInvitation(ctx, jwt_tokens.HashOpaqueToken(token), userID)
+	if err != nil {
+		if !errors.Is(err, invitations_db.ErrInvitationNotFound) && !errors.Is(err, orgs_db.ErrAlreadyMember) {
+			log.Error("Error while joining by invitation", "err", err)
+		}
+		return tokens2.RefreshTokensDto{}, err
+	}
+	log.Info("Invitation accepted", slog.Int64("invitation_id", invitation.ID), slog.Int64("org_id", invitation.OrgID))
+
+	usr, err := s.userRepo.GetUserByID(tenant.WithOrgID(ctx, invitation.OrgID), userID)
+	if err != nil {
+		log.Error("Error while fetching user", "err", err)
+		return tokens2.RefreshTokensDto{}, err
+	}
+	return s.authService.IssueTokens(ctx, usr)
+}
+
+func (s *InvitationService) buildLink(token string) (string, error) {
+	link, err := url.Parse(s.cfg.URL)
+	if err != nil {
+		return "", err
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+	return link.String(), nil
+}
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/login_attempts_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/metrics"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+var ErrTooManyAttempts = errors.New("too many login attempts, try again later")
+
+// Результаты попыток входа для метрики login_attempts_total
+const (
+	LoginResultSuccess = "success"
+	LoginResultFailure = "failure"
+	LoginResultLocked  = "locked"
+)
+
+// maxBackoffShift Ограничение степени двойки, что б задержка не переполнилась
+const maxBackoffShift = 20
+
+// LockedError Вход временно запрещён. RetryAfter - через сколько можно повторить попытку
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("%s (retry after %s)", ErrTooManyAttempts.Error(), e.RetryAfter.Round(time.Second))
+}
+
+func (e *LockedError) Unwrap() error {
+	return ErrTooManyAttempts
+}
+
+// LoginThrottlerConfig Пороги задержек и блокировок после неудачных входов
+type LoginThrottlerConfig struct {
+	DelayAfter      int           // После скольких неудачных попыток на аккаунт начинается экспоненциальная задержка
+	BaseDelay       time.Duration // Первая задержка, дальше удваивается с каждой попыткой
+	LockoutAfter    int           // После скольких неудачных попыток аккаунт блокируется
+	LockoutDuration time.Duration // Первая блокировка, дальше удваивается
+	MaxLockout      time.Duration // Максимальная длительность блокировки
+	IPLockoutAfter  int           // После скольких неудачных попыток с одного IP блокируется IP
+	FailureWindow   time.Duration // Через сколько после последней неудачи счётчик начинается заново
+}
+
+// LoginThrottler Считает неудачные попытки входа по аккаунту и по IP и выставляет задержки и блокировки.
+//
+// Попытки считаются по email из запроса, даже если такого пользователя нет,
+// поэтому блокировка не раскрывает, зарегистрирован ли email
+type LoginThrottler struct {
+	repo    login_attempts_db.LoginAttemptsRepository
+	metrics *metrics.Metrics
+	cfg     LoginThrottlerConfig
+	log     *slog.Logger
+}
+
+func NewLoginThrottler(repo login_attempts_db.LoginAttemptsRepository, metrics *metrics.Metrics, cfg LoginThrottlerConfig, log *slog.Logger) *LoginThrottler {
+	return &LoginThrottler{
+		repo:    repo,
+		metrics: metrics,
+		cfg:     cfg,
+		log:     log,
+	}
+}
+
+// Reserve учитывает попытку входа до проверки пароля и возвращает *LockedError, если вход для email или IP сейчас запрещён.
+// Попытка сначала считается неудачной: счётчик увеличивается и блокировка выставляется сразу, атомарно,
+// поэтому параллельные попытки не проходят мимо порогов. После проверки вызывается RegisterSuccess или RegisterFailure
+func (t *LoginThrottler) Reserve(ctx context.Context, email string, ip string) error {
+	const op = "internal/lib/services/login_throttler.go/Reserve"
+	log := t.log.With(slog.String("op", op))
+
+	keys := t.keys(email, ip)
+	for i, key := range keys {
+		reservation, err := t.repo.ReserveAttempt(ctx, key.scope, key.value, t.cfg.FailureWindow, func(count int) time.Duration {
+			delay, _ := t.penalty(key.scope, count)
+			return delay
+		})
+		if err != nil {
+			t.release(ctx, keys[:i])
+			return err
+		}
+		if !reservation.Reserved {
+			// Попытка не состоится, уже учтённые ключи возвращаем
+			t.release(ctx, keys[:i])
+			t.countAttempt(LoginResultLocked)
+			return &LockedError{RetryAfter: time.Until(*reservation.LockedUntil)}
+		}
+		if _, lockout := t.penalty(key.scope, reservation.FailedCount); lockout && reservation.LockedUntil != nil {
+			log.Warn("Login temporarily locked", "scope", key.scope, "failed_attempts", reservation.FailedCount,
+				"until", *reservation.LockedUntil)
+			if t.metrics != nil {
+				t.metrics.LoginLockoutsTotal.WithLabelValues(key.scope).Inc()
+			}
+		}
+	}
+	return nil
+}
+
+// RegisterFailure Попытка, учтённая Reserve, оказалась неудачной. Счётчики уже увеличены, остаётся метрика
+func (t *LoginThrottler) RegisterFailure() {
+	t.countAttempt(LoginResultFailure)
+}
+
+// RegisterSuccess сбрасывает счётчик аккаунта. Попытка с IP возвращается, но счётчик IP не сбрасывается,
+// иначе атакующий мог бы обнулять его входом в собственный аккаунт
+func (t *LoginThrottler) RegisterSuccess(ctx context.Context, email string, ip string) {
+	t.countAttempt(LoginResultSuccess)
+	if err := t.repo.Reset(ctx, login_attempts_db.ScopeAccount, normalizeEmail(email)); err != nil {
+		t.log.Error("Error while resetting failed login attempts", "err", err)
+	}
+	if ip != "" {
+		t.release(ctx, []throttleKey{{login_attempts_db.ScopeIP, ip}})
+	}
+}
+
+// VerifyPassword Проверяет пароль уже вошедшего пользователя (смена пароля, смена email) с тем же учётом попыток, что и вход.
+// Без ограничения такие ручки дали бы перебирать пароль по украденному access токену.
+// Возвращает *LockedError, ErrWrongPassword или nil
+func (t *LoginThrottler) VerifyPassword(ctx context.Context, email string, ip string, verify func() bool) error {
+	if err := t.Reserve(ctx, email, ip); err != nil {
+		return err
+	}
+	if !verify() {
+		t.RegisterFailure()
+		return ErrWrongPassword
+	}
+	t.RegisterSuccess(ctx, email, ip)
+	return nil
+}
+
+// release Возвращает попытки, учтённые Reserve
+func (t *LoginThrottler) release(ctx context.Context, keys []throttleKey) {
+	for _, key := range keys {
+		if err := t.repo.ReleaseAttempt(ctx, key.scope, key.value); err != nil {
+			t.log.Error("Error while releasing login attempt", "scope", key.scope, "err", err)
+		}
+	}
+}
+
+// Unlock снимает блокировку аккаунта (используется админом)
+func (t *LoginThrottler) Unlock(ctx context.Context, email string) error {
+	return t.repo.Reset(ctx, login_attempts_db.ScopeAccount, normalizeEmail(email))
+}
+
+// penalty Возвращает задержку для count неудачных попыток и признак того, что это уже блокировка
+func (t *LoginThrottler) penalty(scope string, count int) (time.Duration, bool) {
+	if scope == login_attempts_db.ScopeIP {
+		if t.cfg.IPLockoutAfter > 0 && count >= t.cfg.IPLockoutAfter {
+			return backoff(t.cfg.LockoutDuration, count-t.cfg.IPLockoutAfter, t.cfg.MaxLockout), true
+		}
+		return 0, false
+	}
+	if t.cfg.LockoutAfter > 0 && count >= t.cfg.LockoutAfter {
+		return backoff(t.cfg.LockoutDuration, count-t.cfg.LockoutAfter, t.cfg.MaxLockout), true
+	}
+	if t.cfg.DelayAfter > 0 && count >= t.cfg.DelayAfter {
+		return backoff(t.cfg.BaseDelay, count-t.cfg.DelayAfter, t.cfg.LockoutDuration), false
+	}
+	return 0, false
+}
+
+// backoff base * 2^step, но не больше max
+func backoff(base time.Duration, step int, max time.Duration) time.Duration {
+	if step > maxBackoffShift {
+		step = maxBackoffShift
+	}
+	delay := base << step
+	if max > 0 && (delay > max || delay <= 0) {
+		return max
+	}
+	return delay
+}
+
+func (t *LoginThrottler) countAttempt(result string) {
+	if t.metrics != nil {
+		t.metrics.LoginAttemptsTotal.WithLabelValues(result).Inc()
+	}
+}
+
+type throttleKey struct {
+	scope string
+	value string
+}
+
+func (t *LoginThrottler) keys(email string, ip string) []throttleKey {
+	keys := []throttleKey{{login_attempts_db.ScopeAccount, normalizeEmail(email)}}
+	if ip != "" {
+		keys = append(keys, throttleKey{login_attempts_db.ScopeIP, ip})
+	}
+	return keys
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/jwt_tokens"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/mailer"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/tenant"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/magic_links_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	tokens2 "github.com/ShlykovPavel/auth-JWT-microservice/models/tokens"
+	"log/slog"
+	"net/url"
+	"time"
+)
+
+// mailSendTimeout Время на отправку письма. Письма уходят в фоне
+const mailSendTimeout = 30 * time.Second
+
+// MagicLinkConfig Настройки входа по ссылке из письма
+type MagicLinkConfig struct {
+	TTL            time.Duration // Время жизни ссылки
+	URL            string        // Адрес страницы, на которую ведёт ссылка. Токен добавляется параметром token
+	MaxPerWindow   int           // Сколько ссылок можно запросить на один email за Window
+	ThrottleWindow time.Duration
+}
+
+// MagicLinkService Вход без пароля по одноразовой ссылке из письма.
+//
+// Ссылка ведёт на страницу, которая отправляет токен POST запросом.
+// GET по ссылке ничего не списывает, поэтому почтовые сканеры, открывающие ссылки заранее, не "сжигают" её
+type MagicLinkService struct {
+	userRepo    users_db.UserRepository
+	linksRepo   magic_links_db.MagicLinksRepository
+	authService *AuthService
+	mailer      mailer.Mailer
+	cfg         MagicLinkConfig
+	log         *slog.Logger
+}
+
+func NewMagicLinkService(userRepo users_db.UserRepository, linksRepo magic_links_db.MagicLinksRepository, authService *AuthService, mailer mailer.Mailer, cfg MagicLinkConfig, log *slog.Logger) *MagicLinkService {
+	return &MagicLinkService{
+		userRepo:    userRepo,
+		linksRepo:   linksRepo,
+		authService: authService,
+		mailer:      mailer,
+		cfg:         cfg,
+		log:         log,
+	}
+}
+
+// RequestLink создаёт ссылку и отправляет её на email. Вся работа идёт в фоне, а ответ одинаков для любого адреса:
+// ни ошибка, ни время ответа не раскрывают, зарегистрирован ли email и исчерпан ли лимит
+func (s *MagicLinkService) RequestLink(ctx context.Context, email string) {
+	go func() {
+		// Запрос завершится раньше, значения контекста (request id) остаются
+		sendCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), mailSendTimeout)
+		defer cancel()
+		s.sendLink(sendCtx, email)
+	}()
+}
+
+// sendLink Создаёт ссылку для пользователя с email и отправляет её. Ошибки только пишутся в лог
+func (s *MagicLinkService) sendLink(ctx context.Context, email string) {
+	const op = "internal/lib/services/magic_link_service.go/sendLink"
+	log := s.log.With(slog.String("op", op))
+
+	// Вход до выбора организации: ищем среди всех пользователей
+	usr, err := s.userRepo.GetUser(tenant.WithoutOrg(ctx), email)
+	if errors.Is(err, users_db.ErrUserNotFound) {
+		log.Debug("Magic link requested for unknown email")
+		return
+	}
+	if err != nil {
+		log.Error("Error while fetching user", "err", err)
+		return
+	}
+
+	if s.cfg.MaxPerWindow > 0 {
+		count, err := s.linksRepo.CountLinksSince(ctx, usr.ID, time.Now().Add(-s.cfg.ThrottleWindow))
+		if err != nil {
+			log.Error("Error while counting magic links", "err", err)
+			return
+		}
+		if count >= s.cfg.MaxPerWindow {
+			log.Warn("Magic link request throttled", slog.Int64("user_id", usr.ID))
+			return
+		}
+	}
+
+	token, err := jwt_tokens.CreateRefreshToken(s.log)
+	if err != nil {
+		log.Error("Error while creating magic link token", "err", err)
+		return
+	}
+	if err = s.linksRepo.CreateLink(ctx, usr.ID, jwt_tokens.HashOpaqueToken(token), time.Now().Add(s.cfg.TTL)); err != nil {
+		log.Error("Error while storing magic link", "err", err)
+		return
+	}
+
+	link, err := s.buildLink(token)
+	if err != nil {
+		log.Error("Error while building magic link", "err", err)
+		return
+	}
+	msg := mailer.Message{
+		To:      usr.Email,
+		Subject: "Your sign-in link",
+		Body: fmt.Sprintf("Use this link to sign in. It can be used once and expires in %s:\n\n%s\n\n"+
+			"If you did not request it, you can ignore this message.", s.cfg.TTL, link),
+	}
+	if err = s.mailer.Send(ctx, msg); err != nil {
+		log.Error("Error while sending magic link", "err", err)
+	}
+}
+
+// ConsumeLink списывает одноразовую ссылку и выдаёт пару токенов
+func (s *MagicLinkService) ConsumeLink(ctx context.Context, token string) (tokens2.RefreshTokensDto, error) {
+	const op = "internal/lib/services/magic_link_service.go/ConsumeLink"
+	log := s.log.With(slog.String("op", op))
+
+	userID, err := s.linksRepo.ConsumeLink(ctx, jwt_tokens.HashOpaqueToken(token))
+	if err != nil {
+		if !errors.Is(err, magic_links_db.ErrLinkNotFound) {
+			log.Error("Error while consuming magic link", "err", err)
+		}
+		return tokens2.RefreshTokensDto{}, err
+	}
+	usr, err := s.userRepo.GetUserByID(tenant.WithoutOrg(ctx), userID)
+	if err != nil {
+		log.Error("Error while fetching user", "err", err)
+		return tokens2.RefreshTokensDto{}, err
+	}
+	return s.authService.IssueTokens(ctx, usr)
+}
+
+func (s *MagicLinkService) buildLink(token string) (string, error) {
+	link, err := url.Parse(s.cfg.URL)
+	if err != nil {
+		return "", err
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+	return link.String(), nil
+}
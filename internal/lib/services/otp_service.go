@@ -0,0 +1,276 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/message_sender"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/tenant"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/otp_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	tokens2 "github.com/ShlykovPavel/auth-JWT-microservice/models/tokens"
+	"log/slog"
+	"math/big"
+	"time"
+)
+
+var (
+	ErrInvalidCode    = errors.New("one-time code is invalid or expired")
+	ErrResendCooldown = errors.New("code was sent recently, try again later")
+	ErrPhoneNotSet    = errors.New("phone number is not set")
+)
+
+const otpDigits = 6
+
+// otpThrottlePrefix Ключ попыток входа по коду на номер, которого нет у пользователей. Не совпадает ни с одним email
+const otpThrottlePrefix = "phone:"
+
+// CooldownError Повторная отправка кода пока запрещена
+type CooldownError struct {
+	RetryAfter time.Duration
+}
+
+func (e *CooldownError) Error() string {
+	return fmt.Sprintf("%s (retry after %s)", ErrResendCooldown.Error(), e.RetryAfter.Round(time.Second))
+}
+
+func (e *CooldownError) Unwrap() error {
+	return ErrResendCooldown
+}
+
+// OTPConfig Настройки одноразовых кодов
+type OTPConfig struct {
+	TTL            time.Duration // Время жизни кода
+	MaxAttempts    int           // Сколько раз можно ввести код, после этого он сгорает
+	ResendCooldown time.Duration // Пауза между отправками кода на один номер
+}
+
+// OTPService Вход по одноразовому коду на подтверждённый номер телефона и подтверждение номера.
+//
+// Коды хранятся как HMAC-SHA256 с секретом сервиса: 6 цифр легко перебрать по простому хешу, если утечёт таблица
+type OTPService struct {
+	userRepo    users_db.UserRepository
+	otpRepo     otp_db.OTPRepository
+	authService *AuthService
+	sender      message_sender.MessageSender
+	secret      []byte
+	cfg         OTPConfig
+	log         *slog.Logger
+}
+
+func NewOTPService(userRepo users_db.UserRepository, otpRepo otp_db.OTPRepository, authService *AuthService, sender message_sender.MessageSender, secret string, cfg OTPConfig, log *slog.Logger) *OTPService {
+	return &OTPService{
+		userRepo:    userRepo,
+		otpRepo:     otpRepo,
+		authService: authService,
+		sender:      sender,
+		secret:      []byte(secret),
+		cfg:         cfg,
+		log:         log,
+	}
+}
+
+// RequestLoginCode отправляет код для входа на подтверждённый номер.
+// Для неизвестного номера и во время паузы между отправками ошибки нет, что б не раскрывать, есть ли такой номер
+func (s *OTPService) RequestLoginCode(ctx context.Context, phone string) error {
+	const op = "internal/lib/services/otp_service.go/RequestLoginCode"
+	log := s.log.With(slog.String("op", op))
+
+	// Вход до выбора организации: ищем среди всех пользователей
+	usr, err := s.userRepo.GetUserByPhone(tenant.WithoutOrg(ctx), phone)
+	if errors.Is(err, users_db.ErrUserNotFound) {
+		log.Debug("Login code requested for unknown phone")
+		return nil
+	}
+	if err != nil {
+		log.Error("Error while fetching user", "err", err)
+		return err
+	}
+
+	err = s.sendCode(ctx, otp_db.PurposeLogin, usr.ID, phone)
+	var cooldownErr *CooldownError
+	if errors.As(err, &cooldownErr) {
+		log.Debug("Login code resend throttled", slog.Int64("user_id", usr.ID))
+		return nil
+	}
+	return err
+}
+
+// VerifyLoginCode проверяет код и выдаёт пару токенов. Неверные коды считаются неудачными входами в аккаунт владельца номера
+// и с clientIP, как у входа по паролю: новый код не даёт новых попыток подбора, а блокировка аккаунта закрывает и вход по коду.
+// Для неизвестного номера попытки считаются на сам номер
+func (s *OTPService) VerifyLoginCode(ctx context.Context, phone string, code string, clientIP string) (tokens2.RefreshTokensDto, error) {
+	throttleKey := otpThrottlePrefix + phone
+	owner, err := s.userRepo.GetUserByPhone(tenant.WithoutOrg(ctx), phone)
+	if err == nil {
+		throttleKey = owner.Email
+	} else if !errors.Is(err, users_db.ErrUserNotFound) {
+		return tokens2.RefreshTokensDto{}, err
+	}
+	otpCode, err := s.checkCodeThrottled(ctx, otp_db.PurposeLogin, phone, code, throttleKey, clientIP)
+	if err != nil {
+		return tokens2.RefreshTokensDto{}, err
+	}
+	usr, err := s.userRepo.GetUserByID(tenant.WithoutOrg(ctx), otpCode.UserID)
+	if err != nil {
+		return tokens2.RefreshTokensDto{}, err
+	}
+	// Номер могли отвязать, пока код был в пути
+	if usr.Phone != phone || !usr.PhoneVerified {
+		return tokens2.RefreshTokensDto{}, ErrInvalidCode
+	}
+	return s.authService.IssueTokens(ctx, usr)
+}
+
+// RequestPhoneVerification указывает пользователю новый номер и отправляет на него код подтверждения
+func (s *OTPService) RequestPhoneVerification(ctx context.Context, userID int64, phone string) error {
+	if err := s.checkCooldown(ctx, otp_db.PurposeVerifyPhone, phone); err != nil {
+		return err
+	}
+	if err := s.userRepo.SetPhone(ctx, userID, phone); err != nil {
+		return err
+	}
+	return s.sendCode(ctx, otp_db.PurposeVerifyPhone, userID, phone)
+}
+
+// VerifyPhone подтверждает номер пользователя кодом из сообщения. Неверные коды считаются неудачными входами в аккаунт, как в VerifyLoginCode
+func (s *OTPService) VerifyPhone(ctx context.Context, userID int64, code string, clientIP string) error {
+	usr, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if usr.Phone == "" {
+		return ErrPhoneNotSet
+	}
+	otpCode, err := s.checkCodeThrottled(ctx, otp_db.PurposeVerifyPhone, usr.Phone, code, usr.Email, clientIP)
+	if err != nil {
+		return err
+	}
+	if otpCode.UserID != userID {
+		return ErrInvalidCode
+	}
+	return s.userRepo.MarkPhoneVerified(ctx, userID, usr.Phone)
+}
+
+func (s *OTPService) sendCode(ctx context.Context, purpose string, userID int64, phone string) error {
+	const op = "internal/lib/services/otp_service.go/sendCode"
+	log := s.log.With(slog.String("op", op), slog.String("purpose", purpose))
+
+	if err := s.checkCooldown(ctx, purpose, phone); err != nil {
+		return err
+	}
+	code, err := generateCode()
+	if err != nil {
+		log.Error("Error while generating code", "err", err)
+		return err
+	}
+	err = s.otpRepo.CreateCode(ctx, otp_db.OTPCode{
+		UserID:    userID,
+		Phone:     phone,
+		CodeHash:  s.hashCode(purpose, phone, code),
+		ExpiresAt: time.Now().Add(s.cfg.TTL),
+	}, purpose)
+	if err != nil {
+		log.Error("Error while storing code", "err", err)
+		return err
+	}
+	text := fmt.Sprintf("Your code: %s. It expires in %s. Do not share it with anyone.", code, s.cfg.TTL)
+	if err = s.sender.Send(ctx, phone, text); err != nil {
+		log.Error("Error while sending code", "err", err)
+		return err
+	}
+	return nil
+}
+
+func (s *OTPService) checkCooldown(ctx context.Context, purpose string, phone string) error {
+	latest, err := s.otpRepo.GetLatestCode(ctx, purpose, phone)
+	if errors.Is(err, otp_db.ErrCodeNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if wait := time.Until(latest.CreatedAt.Add(s.cfg.ResendCooldown)); wait > 0 {
+		return &CooldownError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// checkCodeThrottled checkCode с учётом попытки в LoginThrottler сервиса входа по ключу throttleKey (email аккаунта) и clientIP.
+// Попытка резервируется до проверки кода, поэтому параллельные запросы не обходят блокировку. Возвращает *LockedError
+func (s *OTPService) checkCodeThrottled(ctx context.Context, purpose string, phone string, code string, throttleKey string, clientIP string) (otp_db.OTPCode, error) {
+	throttler := s.authService.throttler
+	if throttler == nil {
+		return s.checkCode(ctx, purpose, phone, code)
+	}
+	if err := throttler.Reserve(ctx, throttleKey, clientIP); err != nil {
+		return otp_db.OTPCode{}, err
+	}
+	otpCode, err := s.checkCode(ctx, purpose, phone, code)
+	if err != nil {
+		throttler.RegisterFailure()
+		return otp_db.OTPCode{}, err
+	}
+	throttler.RegisterSuccess(ctx, throttleKey, clientIP)
+	return otpCode, nil
+}
+
+// checkCode проверяет последний код на номер. Неверный ввод расходует попытку, после MaxAttempts код сгорает
+func (s *OTPService) checkCode(ctx context.Context, purpose string, phone string, code string) (otp_db.OTPCode, error) {
+	otpCode, err := s.otpRepo.GetLatestCode(ctx, purpose, phone)
+	if errors.Is(err, otp_db.ErrCodeNotFound) {
+		return otp_db.OTPCode{}, ErrInvalidCode
+	}
+	if err != nil {
+		return otp_db.OTPCode{}, err
+	}
+	if otpCode.ConsumedAt != nil || time.Now().After(otpCode.ExpiresAt) || otpCode.Attempts >= s.cfg.MaxAttempts {
+		return otp_db.OTPCode{}, ErrInvalidCode
+	}
+
+	attempts, err := s.otpRepo.IncrementAttempts(ctx, otpCode.ID)
+	if err != nil {
+		return otp_db.OTPCode{}, err
+	}
+	if attempts > s.cfg.MaxAttempts {
+		return otp_db.OTPCode{}, ErrInvalidCode
+	}
+	expected, err := hex.DecodeString(otpCode.CodeHash)
+	if err != nil {
+		return otp_db.OTPCode{}, err
+	}
+	actual, _ := hex.DecodeString(s.hashCode(purpose, phone, code))
+	if !hmac.Equal(expected, actual) {
+		return otp_db.OTPCode{}, ErrInvalidCode
+	}
+	if err = s.otpRepo.ConsumeCode(ctx, otpCode.ID); err != nil {
+		if errors.Is(err, otp_db.ErrCodeNotFound) {
+			return otp_db.OTPCode{}, ErrInvalidCode
+		}
+		return otp_db.OTPCode{}, err
+	}
+	return otpCode, nil
+}
+
+func (s *OTPService) hashCode(purpose string, phone string, code string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(purpose + "|" + phone + "|" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// generateCode Случайный код из otpDigits цифр с ведущими нулями
+func generateCode() (string, error) {
+	max := big.NewInt(1)
+	for i := 0; i < otpDigits; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", otpDigits, n.Int64()), nil
+}
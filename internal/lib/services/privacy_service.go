@@ -0,0 +1,178 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/mailer"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/tenant"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/audit_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/privacy_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"log/slog"
+	"time"
+)
+
+// erasureBatchSize Сколько аккаунтов обезличивается за один проход фоновой задачи
+const erasureBatchSize = 100
+
+// ErasureConfig Настройки удаления персональных данных
+type ErasureConfig struct {
+	GracePeriod   time.Duration // Сколько ждать после запроса пользователя: в это время запрос можно отменить
+	CheckInterval time.Duration // Как часто искать запросы с истёкшим сроком
+}
+
+// UserDataExport Выгрузка персональных данных пользователя
+type UserDataExport struct {
+	User users_db.UserInfo
+	privacy_db.PersonalData
+}
+
+// PrivacyService Запросы субъектов персональных данных: выгрузка и удаление с отсрочкой
+type PrivacyService struct {
+	userRepo      users_db.UserRepository
+	privacyRepo   privacy_db.PrivacyRepository
+	auditRepo     audit_db.AuditRepository
+	statusService *AccountStatusService
+	mailer        mailer.Mailer
+	cfg           ErasureConfig
+	log           *slog.Logger
+}
+
+func NewPrivacyService(userRepo users_db.UserRepository, privacyRepo privacy_db.PrivacyRepository, auditRepo audit_db.AuditRepository,
+	statusService *AccountStatusService, mailer mailer.Mailer, cfg ErasureConfig, log *slog.Logger) *PrivacyService {
+	return &PrivacyService{
+		userRepo:      userRepo,
+		privacyRepo:   privacyRepo,
+		auditRepo:     auditRepo,
+		statusService: statusService,
+		mailer:        mailer,
+		cfg:           cfg,
+		log:           log,
+	}
+}
+
+// Export Собирает все данные пользователя: профиль, участие в организациях, сессии и записи журнала
+func (s *PrivacyService) Export(ctx context.Context, userID int64) (UserDataExport, error) {
+	// Выгружаются данные из всех организаций, а не только из организации токена
+	ctx = tenant.WithoutOrg(ctx)
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return UserDataExport{}, err
+	}
+	data, err := s.privacyRepo.ExportData(ctx, userID)
+	if err != nil {
+		return UserDataExport{}, err
+	}
+	return UserDataExport{User: user, PersonalData: data}, nil
+}
+
+// RequestErasure Ставит удаление данных пользователя через GracePeriod и сообщает об этом письмом
+func (s *PrivacyService) RequestErasure(ctx context.Context, userID int64, clientIP string) (privacy_db.Erasure, error) {
+	const op = "internal/lib/services/privacy_service.go/RequestErasure"
+	log := s.log.With(slog.String("op", op), slog.Int64("user_id", userID))
+
+	user, err := s.userRepo.GetUserByID(tenant.WithoutOrg(ctx), userID)
+	if err != nil {
+		return privacy_db.Erasure{}, err
+	}
+	erasure, err := s.privacyRepo.RequestErasure(ctx, userID, time.Now().Add(s.cfg.GracePeriod))
+	if err != nil {
+		return privacy_db.Erasure{}, err
+	}
+	s.record(ctx, log, audit_db.Event{ActorID: &userID, Action: audit_db.ActionErasureRequested, TargetUserID: &userID, IP: clientIP})
+	log.Info("Account erasure requested", "due_at", erasure.DueAt)
+
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: "Your account will be deleted",
+		Body: fmt.Sprintf("We received a request to delete your account and personal data.\n\n"+
+			"Your data will be erased on %s. Until then you can sign in and cancel the request.\n\n"+
+			"If you didn't request this, sign in and cancel it right away.", erasure.DueAt.UTC().Format(time.RFC1123)),
+	}
+	go func() {
+		sendCtx, cancel := context.WithTimeout(context.Background(), mailSendTimeout)
+		defer cancel()
+		if err := s.mailer.Send(sendCtx, msg); err != nil {
+			log.Error("Error while sending erasure notice", "err", err)
+		}
+	}()
+	return erasure, nil
+}
+
+// CancelErasure Отменяет запрос на удаление до истечения срока
+func (s *PrivacyService) CancelErasure(ctx context.Context, actorID int64, userID int64, clientIP string) error {
+	const op = "internal/lib/services/privacy_service.go/CancelErasure"
+	log := s.log.With(slog.String("op", op), slog.Int64("user_id", userID))
+
+	if err := s.privacyRepo.CancelErasure(ctx, userID); err != nil {
+		return err
+	}
+	s.record(ctx, log, audit_db.Event{ActorID: &actorID, Action: audit_db.ActionErasureCancelled, TargetUserID: &userID, IP: clientIP})
+	log.Info("Account erasure cancelled", slog.Int64("actor_id", actorID))
+	return nil
+}
+
+// EraseNow Обезличивает пользователя сразу, без ожидания. Для администраторов
+func (s *PrivacyService) EraseNow(ctx context.Context, actorID int64, userID int64, reason string, clientIP string) error {
+	const op = "internal/lib/services/privacy_service.go/EraseNow"
+	log := s.log.With(slog.String("op", op), slog.Int64("user_id", userID), slog.Int64("actor_id", actorID))
+
+	if err := s.erase(ctx, userID); err != nil {
+		return err
+	}
+	s.record(ctx, log, audit_db.Event{ActorID: &actorID, Action: audit_db.ActionErase, TargetUserID: &userID, Reason: reason, IP: clientIP})
+	log.Info("Account erased by administrator", "reason", reason)
+	return nil
+}
+
+// RunEraser Обезличивает аккаунты с истёкшим сроком ожидания, пока не отменён ctx
+func (s *PrivacyService) RunEraser(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.EraseDue(ctx)
+		}
+	}
+}
+
+// EraseDue Один проход фоновой задачи. Ошибка по одному аккаунту не останавливает остальные
+func (s *PrivacyService) EraseDue(ctx context.Context) {
+	const op = "internal/lib/services/privacy_service.go/EraseDue"
+	log := s.log.With(slog.String("op", op))
+
+	ids, err := s.privacyRepo.DueErasures(ctx, time.Now(), erasureBatchSize)
+	if err != nil {
+		log.Error("Error while fetching due erasures", "err", err)
+		return
+	}
+	for _, userID := range ids {
+		if err = s.erase(ctx, userID); err != nil {
+			// Например, пользователь стал последним администратором: запрос останется до следующего прохода
+			log.Error("Error while erasing account", slog.Int64("user_id", userID), "err", err)
+			continue
+		}
+		s.record(ctx, log, audit_db.Event{Action: audit_db.ActionErase, TargetUserID: &userID, Reason: "grace period expired"})
+		log.Info("Account erased", slog.Int64("user_id", userID))
+	}
+}
+
+func (s *PrivacyService) erase(ctx context.Context, userID int64) error {
+	if err := s.privacyRepo.Anonymize(ctx, userID); err != nil {
+		return err
+	}
+	if s.statusService != nil {
+		s.statusService.Invalidate(userID)
+	}
+	return nil
+}
+
+// record Пишет событие в журнал. Действие уже выполнено, поэтому ошибка журнала только логируется
+func (s *PrivacyService) record(ctx context.Context, log *slog.Logger, event audit_db.Event) {
+	if err := s.auditRepo.Record(tenant.WithoutOrg(ctx), event); err != nil {
+		log.Error("Error while recording audit event", "action", event.Action, "err", err)
+	}
+}
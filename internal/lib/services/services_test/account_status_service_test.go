@@ -0,0 +1,139 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/services"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/auth_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	tokens2 "github.com/ShlykovPavel/auth-JWT-microservice/models/tokens"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+// fakeStatusUsersRepo Статусы аккаунтов в памяти. Считает обращения к GetUserStatus, что б проверить кеш
+type fakeStatusUsersRepo struct {
+	users_db.UserRepository
+	statuses map[int64]string
+	lookups  int
+}
+
+func (f *fakeStatusUsersRepo) GetUserStatus(_ context.Context, id int64) (string, error) {
+	f.lookups++
+	status, ok := f.statuses[id]
+	if !ok {
+		return "", users_db.ErrUserNotFound
+	}
+	return status, nil
+}
+
+func (f *fakeStatusUsersRepo) SetStatus(_ context.Context, id int64, change users_db.StatusChange) (users_db.UserInfo, error) {
+	if _, ok := f.statuses[id]; !ok {
+		return users_db.UserInfo{}, users_db.ErrUserNotFound
+	}
+	f.statuses[id] = change.Status
+	return users_db.UserInfo{ID: id, Status: change.Status, StatusReason: change.Reason, StatusExpiresAt: change.ExpiresAt}, nil
+}
+
+// fakeRefreshTokensRepo Один refresh токен пользователя со статусом аккаунта
+type fakeRefreshTokensRepo struct {
+	auth_db.TokensRepository
+	token   string
+	data    auth_db.JWTTokenData
+	deleted bool
+}
+
+func (f *fakeRefreshTokensRepo) DbPutTokens(_ context.Context, _ int64, _ int64, refreshToken string) error {
+	f.token = refreshToken
+	return nil
+}
+
+func (f *fakeRefreshTokensRepo) DbGetTokens(_ context.Context, refreshToken string) (auth_db.JWTTokenData, error) {
+	if f.deleted || refreshToken != f.token {
+		return auth_db.JWTTokenData{}, users_db.ErrUserNotFound
+	}
+	return f.data, nil
+}
+
+func (f *fakeRefreshTokensRepo) DbUpdateTokens(_ context.Context, _ int64, refreshToken string, _ string) error {
+	f.token = refreshToken
+	return nil
+}
+
+func (f *fakeRefreshTokensRepo) DbDeleteToken(_ context.Context, _ string) error {
+	f.deleted = true
+	return nil
+}
+
+func TestAccountStatusService_Cache(t *testing.T) {
+	usersRepo := &fakeStatusUsersRepo{statuses: map[int64]string{1: users_db.StatusActive}}
+	statusService := services.NewAccountStatusService(usersRepo, time.Minute, slog.Default())
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		active, err := statusService.AccountActive(ctx, 1)
+		if err != nil || !active {
+			t.Fatalf("Expected active account, got %v, %v", active, err)
+		}
+	}
+	if usersRepo.lookups != 1 {
+		t.Errorf("Expected status to be read once, got %d lookups", usersRepo.lookups)
+	}
+
+	// Блокировка через сервис сбрасывает кеш и действует сразу
+	if _, err := statusService.SetStatus(ctx, 1, users_db.StatusChange{Status: users_db.StatusSuspended, Reason: "fraud"}); err != nil {
+		t.Fatal("SetStatus is failed. Error: ", err)
+	}
+	active, err := statusService.AccountActive(ctx, 1)
+	if err != nil || active {
+		t.Errorf("Expected suspended account to be inactive, got %v, %v", active, err)
+	}
+
+	// Удалённый пользователь неактивен, но это не ошибка
+	active, err = statusService.AccountActive(ctx, 2)
+	if err != nil || active {
+		t.Errorf("Expected unknown user to be inactive without error, got %v, %v", active, err)
+	}
+
+	past := time.Now().Add(-time.Hour)
+	_, err = statusService.SetStatus(ctx, 1, users_db.StatusChange{Status: users_db.StatusSuspended, ExpiresAt: &past})
+	if !errors.Is(err, services.ErrInvalidStatusExpiry) {
+		t.Errorf("Expected %v, got %v", services.ErrInvalidStatusExpiry, err)
+	}
+}
+
+func TestAuthService_InactiveAccount(t *testing.T) {
+	tests := []struct {
+		TestName    string
+		Status      string
+		ExpectedErr error
+	}{
+		{TestName: "Active", Status: users_db.StatusActive},
+		{TestName: "Suspended", Status: users_db.StatusSuspended, ExpectedErr: services.ErrAccountSuspended},
+		{TestName: "Deactivated", Status: users_db.StatusDeactivated, ExpectedErr: services.ErrAccountDeactivated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.TestName, func(t *testing.T) {
+			tokensRepo := &fakeRefreshTokensRepo{
+				token: "refresh",
+				data:  auth_db.JWTTokenData{UserId: 1, OrgID: 1, UserRoles: []string{users_db.RoleUser}, UserStatus: tt.Status},
+			}
+			authService := services.NewAuthService(&fakeStatusUsersRepo{}, tokensRepo, slog.Default(), testSecret, time.Minute, nil, nil)
+
+			_, err := authService.IssueTokens(context.Background(), users_db.UserInfo{ID: 1, OrgID: 1, Status: tt.Status})
+			if !errors.Is(err, tt.ExpectedErr) {
+				t.Errorf("IssueTokens: expected %v, got %v", tt.ExpectedErr, err)
+			}
+
+			tokensRepo.token = "refresh"
+			_, err = authService.RefreshTokens(&tokens2.RefreshTokensDto{RefreshToken: "refresh"}, context.Background())
+			if !errors.Is(err, tt.ExpectedErr) {
+				t.Errorf("RefreshTokens: expected %v, got %v", tt.ExpectedErr, err)
+			}
+			if tokensRepo.deleted != (tt.ExpectedErr != nil) {
+				t.Errorf("Expected refresh token deleted: %v, got %v", tt.ExpectedErr != nil, tokensRepo.deleted)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/services"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/server/users"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/models/users/get_user"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+// fakeLoginUsersRepo Один пользователь. Как и настоящий репозиторий, ищет email и имя без учёта регистра
+type fakeLoginUsersRepo struct {
+	users_db.UserRepository
+	user users_db.UserInfo
+}
+
+func (f *fakeLoginUsersRepo) GetUser(_ context.Context, email string) (users_db.UserInfo, error) {
+	if users_db.NormalizeEmail(email) != f.user.Email {
+		return users_db.UserInfo{}, users_db.ErrUserNotFound
+	}
+	return f.user, nil
+}
+
+func (f *fakeLoginUsersRepo) GetUserByUsername(_ context.Context, username string) (users_db.UserInfo, error) {
+	if users_db.NormalizeUsername(username) != f.user.Username {
+		return users_db.UserInfo{}, users_db.ErrUserNotFound
+	}
+	return f.user, nil
+}
+
+func TestAuthService_AuthenticationByEmailOrUsername(t *testing.T) {
+	hash, err := users.HashUserPassword("password", slog.Default())
+	if err != nil {
+		t.Fatal("HashUserPassword is failed. Error: ", err)
+	}
+	usersRepo := &fakeLoginUsersRepo{user: users_db.UserInfo{
+		ID: 7, OrgID: 1, Email: "neo@example.com", Username: "neo", PasswordHash: hash, Roles: []string{users_db.RoleUser},
+	}}
+	authService := services.NewAuthService(usersRepo, &fakeTokensRepo{}, slog.Default(), testSecret, time.Minute, nil, nil)
+
+	tests := []struct {
+		TestName    string
+		Login       get_user.AuthUser
+		ExpectedErr error
+	}{
+		{TestName: "email", Login: get_user.AuthUser{Email: "neo@example.com", Password: "password"}},
+		{TestName: "email in another case", Login: get_user.AuthUser{Email: "Neo@Example.COM", Password: "password"}},
+		{TestName: "username in another case", Login: get_user.AuthUser{Username: "NEO", Password: "password"}},
+		{TestName: "unknown username", Login: get_user.AuthUser{Username: "trinity", Password: "password"}, ExpectedErr: users_db.ErrUserNotFound},
+		{TestName: "wrong password", Login: get_user.AuthUser{Username: "neo", Password: "wrong"}, ExpectedErr: services.ErrWrongPassword},
+	}
+	for _, tt := range tests {
+		t.Run(tt.TestName, func(t *testing.T) {
+			pair, err := authService.Authentication(&tt.Login, "127.0.0.1", context.Background())
+			if tt.ExpectedErr != nil {
+				if !errors.Is(err, tt.ExpectedErr) {
+					t.Fatalf("Expected %v, got %v", tt.ExpectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("Authentication is failed. Error: ", err)
+			}
+			if pair.AccessToken == "" {
+				t.Error("Expected access token")
+			}
+		})
+	}
+}
+
+func TestAuthService_PasswordResetRequired(t *testing.T) {
+	hash, err := users.HashUserPassword("password", slog.Default())
+	if err != nil {
+		t.Fatal("HashUserPassword is failed. Error: ", err)
+	}
+	// Хеш есть, но пароль требуется задать заново: вход по паролю закрыт
+	user := users_db.UserInfo{
+		ID: 7, OrgID: 1, Email: "neo@example.com", PasswordHash: hash, PasswordResetRequired: true, Roles: []string{users_db.RoleUser},
+	}
+	authService := services.NewAuthService(&fakeLoginUsersRepo{user: user}, &fakeTokensRepo{}, slog.Default(), testSecret, time.Minute, nil, nil)
+
+	_, err = authService.Authentication(&get_user.AuthUser{Email: "neo@example.com", Password: "password"}, "127.0.0.1", context.Background())
+	if !errors.Is(err, services.ErrWrongPassword) {
+		t.Fatalf("Expected %v, got %v", services.ErrWrongPassword, err)
+	}
+
+	// Вход по ссылке или коду выдаёт токены и сообщает, что пароль нужно задать
+	pair, err := authService.IssueTokens(context.Background(), user)
+	if err != nil {
+		t.Fatal("IssueTokens is failed. Error: ", err)
+	}
+	if !pair.PasswordResetRequired {
+		t.Error("Expected password_reset_required in issued tokens")
+	}
+}
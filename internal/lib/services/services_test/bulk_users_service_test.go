@@ -0,0 +1,164 @@
+package services_test
+
+import (
+	"bytes"
+	"context"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/bulk_users"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/password_hasher"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/services"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/bulk_users_db"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeBulkRepo Запоминает загруженные пачки. Email из taken считаются занятыми
+type fakeBulkRepo struct {
+	taken    map[string]bool
+	batches  [][]bulk_users_db.ImportRow
+	exported []bulk_users_db.ExportedUser
+}
+
+func (f *fakeBulkRepo) ImportBatch(_ context.Context, rows []bulk_users_db.ImportRow, dryRun bool) (int, []bulk_users_db.RejectedRow, error) {
+	var rejected []bulk_users_db.RejectedRow
+	var accepted []bulk_users_db.ImportRow
+	for _, row := range rows {
+		if f.taken[row.Email] {
+			rejected = append(rejected, bulk_users_db.RejectedRow{Line: row.Line, Email: row.Email, Reason: bulk_users_db.RejectEmailExists})
+			continue
+		}
+		accepted = append(accepted, row)
+	}
+	if !dryRun {
+		f.batches = append(f.batches, accepted)
+	}
+	return len(accepted), rejected, nil
+}
+
+func (f *fakeBulkRepo) ExportUsers(_ context.Context, includePasswordHashes bool, fn func(bulk_users_db.ExportedUser) error) error {
+	for _, user := range f.exported {
+		if !includePasswordHashes {
+			user.PasswordHash = ""
+		}
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestBulkUsersService_Import(t *testing.T) {
+	hash, err := password_hasher.NewBcryptHasher(4).Hash("password")
+	if err != nil {
+		t.Fatal("Hash is failed. Error: ", err)
+	}
+	csvFile := "email,first_name,last_name,password_hash,roles\n" +
+		"first@example.com,First,User," + hash + ",user;manager\n" +
+		"not-an-email,Bad,Email," + hash + ",\n" +
+		"FIRST@Example.com,Duplicate,User," + hash + ",\n" +
+		"nohash@example.com,No,Hash,,\n" +
+		"taken@example.com,Taken,User," + hash + ",\n" +
+		"second@example.com,Second,User," + hash + ",\n" +
+		"third@example.com,Third,User,plaintext,\n" +
+		// argon2id с p=0 и 4 GiB памяти: при входе такой хеш уронил бы сервис
+		`hostile@example.com,Hostile,User,"$argon2id$v=19$m=4194304,t=1,p=0$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5",` + "\n"
+
+	tests := []struct {
+		TestName     string
+		PasswordMode string
+		DryRun       bool
+		GrantRoles   bool
+		Imported     int
+		FailedLines  []int
+		Batches      int
+	}{
+		{TestName: "hashed passwords", PasswordMode: services.PasswordModeHashed, GrantRoles: true, Imported: 2, FailedLines: []int{3, 4, 5, 6, 8, 9}, Batches: 2},
+		{TestName: "hashed passwords dry run", PasswordMode: services.PasswordModeHashed, DryRun: true, GrantRoles: true, Imported: 2, FailedLines: []int{3, 4, 5, 6, 8, 9}},
+		// Хеши не читаются, поэтому строки без хеша и с неподдерживаемым хешем загружаются
+		{TestName: "reset on first login", PasswordMode: services.PasswordModeReset, GrantRoles: true, Imported: 5, FailedLines: []int{3, 4, 6}, Batches: 3},
+		// Без roles:write строка с ролью manager отклоняется, а строка 4 перестаёт быть дубликатом
+		{TestName: "roles without roles:write", PasswordMode: services.PasswordModeReset, Imported: 5, FailedLines: []int{2, 3, 6}, Batches: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.TestName, func(t *testing.T) {
+			repo := &fakeBulkRepo{taken: map[string]bool{"taken@example.com": true}}
+			bulkService := services.NewBulkUsersService(repo, 2, slog.Default())
+			report, err := bulkService.Import(context.Background(), strings.NewReader(csvFile), services.ImportOptions{
+				Format:       bulk_users.FormatCSV,
+				PasswordMode: tt.PasswordMode,
+				DryRun:       tt.DryRun,
+				GrantRoles:   tt.GrantRoles,
+			})
+			if err != nil {
+				t.Fatal("Import is failed. Error: ", err)
+			}
+			if report.Total != 8 || report.Imported != tt.Imported || report.Failed != len(tt.FailedLines) {
+				t.Errorf("Expected 8 total, %d imported and %d failed, got %+v", tt.Imported, len(tt.FailedLines), report)
+			}
+			failedLines := make(map[int]bool)
+			for _, rowErr := range report.Errors {
+				failedLines[rowErr.Line] = true
+			}
+			for _, line := range tt.FailedLines {
+				if !failedLines[line] {
+					t.Errorf("Expected error for line %d, got %+v", line, report.Errors)
+				}
+			}
+			if len(repo.batches) != tt.Batches {
+				t.Errorf("Expected %d written batches, got %d", tt.Batches, len(repo.batches))
+			}
+			if len(repo.batches) == 0 || !tt.GrantRoles {
+				return
+			}
+			first := repo.batches[0][0]
+			if first.Email != "first@example.com" || len(first.Roles) != 2 {
+				t.Errorf("Expected first@example.com with two roles, got %+v", first)
+			}
+			if (tt.PasswordMode == services.PasswordModeHashed) != (first.PasswordHash == hash) {
+				t.Errorf("Unexpected password hash %q in %s mode", first.PasswordHash, tt.PasswordMode)
+			}
+			if last := repo.batches[len(repo.batches)-1]; last[len(last)-1].Roles[0] != "user" {
+				t.Errorf("Expected default role user, got %v", last[len(last)-1].Roles)
+			}
+		})
+	}
+}
+
+func TestBulkUsersService_ExportImportRoundTrip(t *testing.T) {
+	hash, err := password_hasher.NewBcryptHasher(4).Hash("password")
+	if err != nil {
+		t.Fatal("Hash is failed. Error: ", err)
+	}
+	source := &fakeBulkRepo{exported: []bulk_users_db.ExportedUser{
+		{ID: 1, Email: "first@example.com", FirstName: "First", LastName: "User", PasswordHash: hash, Roles: []string{"admin", "user"}, Status: "active", CreatedAt: time.Now()},
+		{ID: 2, Email: "second@example.com", FirstName: "Иван", LastName: "Петров, мл.", PasswordHash: hash, Roles: []string{"user"}, Status: "suspended", CreatedAt: time.Now()},
+	}}
+
+	for _, format := range []string{bulk_users.FormatCSV, bulk_users.FormatJSONL} {
+		t.Run(format, func(t *testing.T) {
+			var file bytes.Buffer
+			count, err := services.NewBulkUsersService(source, 0, slog.Default()).Export(context.Background(), &file, format, true)
+			if err != nil || count != 2 {
+				t.Fatalf("Expected 2 exported users, got %d. Error: %v", count, err)
+			}
+
+			target := &fakeBulkRepo{}
+			report, err := services.NewBulkUsersService(target, 0, slog.Default()).Import(context.Background(), &file, services.ImportOptions{
+				Format:       format,
+				PasswordMode: services.PasswordModeHashed,
+				GrantRoles:   true,
+			})
+			if err != nil {
+				t.Fatal("Import is failed. Error: ", err)
+			}
+			if report.Imported != 2 || report.Failed != 0 {
+				t.Fatalf("Expected export to import back without errors, got %+v", report)
+			}
+			second := target.batches[0][1]
+			if second.LastName != "Петров, мл." || second.PasswordHash != hash || len(second.Roles) != 1 {
+				t.Errorf("Unexpected imported user %+v", second)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/mailer"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/services"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/server/users"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"log/slog"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// fakeEmailChangeRepo Пользователь и заявки на смену email в памяти. Повторяет правила репозитория:
+// одна активная заявка, ссылки одноразовые, отмена откатывает подтверждённую смену
+type fakeEmailChangeRepo struct {
+	users_db.UserRepository
+	user           users_db.UserInfo
+	changes        map[string]*users_db.EmailChange // По хешу токена подтверждения или отмены
+	revokedAllKeep []string                         // keepRefreshToken каждого завершения сессий
+}
+
+func (f *fakeEmailChangeRepo) GetUserByID(_ context.Context, id int64) (users_db.UserInfo, error) {
+	if id != f.user.ID {
+		return users_db.UserInfo{}, users_db.ErrUserNotFound
+	}
+	return f.user, nil
+}
+
+func (f *fakeEmailChangeRepo) GetUser(_ context.Context, email string) (users_db.UserInfo, error) {
+	if email == f.user.Email {
+		return f.user, nil
+	}
+	if email == "taken@example.com" {
+		return users_db.UserInfo{ID: 4, Email: email}, nil
+	}
+	return users_db.UserInfo{}, users_db.ErrUserNotFound
+}
+
+func (f *fakeEmailChangeRepo) CreateEmailChange(_ context.Context, change users_db.EmailChange, confirmTokenHash string, cancelTokenHash string) (users_db.EmailChange, error) {
+	change.OldEmail = f.user.Email
+	f.changes[confirmTokenHash] = &change
+	f.changes[cancelTokenHash] = &change
+	return change, nil
+}
+
+func (f *fakeEmailChangeRepo) ConfirmEmailChange(_ context.Context, confirmTokenHash string, keepRefreshToken string) (users_db.EmailChange, error) {
+	change, ok := f.changes[confirmTokenHash]
+	if !ok || change.ConfirmedAt != nil || change.CancelledAt != nil {
+		return users_db.EmailChange{}, users_db.ErrEmailChangeNotFound
+	}
+	now := time.Now()
+	change.ConfirmedAt = &now
+	f.user.Email = change.NewEmail
+	f.revokedAllKeep = append(f.revokedAllKeep, keepRefreshToken)
+	return *change, nil
+}
+
+func (f *fakeEmailChangeRepo) CancelEmailChange(_ context.Context, cancelTokenHash string) (users_db.EmailChange, error) {
+	change, ok := f.changes[cancelTokenHash]
+	if !ok || change.CancelledAt != nil {
+		return users_db.EmailChange{}, users_db.ErrEmailChangeNotFound
+	}
+	now := time.Now()
+	change.CancelledAt = &now
+	if change.ConfirmedAt != nil && f.user.Email == change.NewEmail {
+		f.user.Email = change.OldEmail
+	}
+	f.revokedAllKeep = append(f.revokedAllKeep, "")
+	return *change, nil
+}
+
+// emailChangeTokens Токены из писем на новый и старый адреса. Письма уходят в фоне в любом порядке
+func emailChangeTokens(t *testing.T, sent chanMailer, newEmail string, oldEmail string) (string, string) {
+	t.Helper()
+	tokens := make(map[string]string)
+	for i := 0; i < 2; i++ {
+		var msg mailer.Message
+		select {
+		case msg = <-sent:
+		case <-time.After(time.Second):
+			t.Fatalf("email change messages were not sent")
+		}
+		link, err := url.Parse(invitationTokenPattern.FindString(msg.Body))
+		if err != nil {
+			t.Fatalf("parse email change link: %v", err)
+		}
+		tokens[msg.To] = link.Query().Get("token")
+	}
+	if tokens[newEmail] == "" || tokens[oldEmail] == "" {
+		t.Fatalf("Expected messages to %s and %s, got %v", newEmail, oldEmail, tokens)
+	}
+	return tokens[newEmail], tokens[oldEmail]
+}
+
+func TestEmailChangeService(t *testing.T) {
+	hash, err := users.HashUserPassword("password", slog.Default())
+	if err != nil {
+		t.Fatal("HashUserPassword is failed. Error: ", err)
+	}
+	repo := &fakeEmailChangeRepo{
+		user:    users_db.UserInfo{ID: 3, Email: "old@example.com", PasswordHash: hash},
+		changes: make(map[string]*users_db.EmailChange),
+	}
+	sent := make(chanMailer, 4)
+	service := services.NewEmailChangeService(repo, sent, newTestThrottler(newFakeAttemptsRepo()), services.EmailChangeConfig{
+		TTL:        time.Hour,
+		CancelTTL:  24 * time.Hour,
+		ConfirmURL: "http://localhost/email/confirm",
+		CancelURL:  "http://localhost/email/cancel",
+	}, slog.Default())
+	ctx := context.Background()
+
+	for _, tt := range []struct {
+		TestName    string
+		NewEmail    string
+		Password    string
+		ExpectedErr error
+	}{
+		{TestName: "wrong password", NewEmail: "new@example.com", Password: "wrong", ExpectedErr: services.ErrWrongPassword},
+		{TestName: "same email in another case", NewEmail: "Old@Example.com", Password: "password", ExpectedErr: services.ErrSameEmail},
+	} {
+		if err = service.RequestChange(ctx, 3, tt.NewEmail, tt.Password, "10.0.0.1"); !errors.Is(err, tt.ExpectedErr) {
+			t.Errorf("%s: expected %v, got %v", tt.TestName, tt.ExpectedErr, err)
+		}
+	}
+	if len(sent) != 0 {
+		t.Fatalf("Expected no messages for rejected requests, got %d", len(sent))
+	}
+
+	// Занятый адрес не выдаётся ответом: его владелец получает уведомление без ссылки, старый адрес - ссылку отмены
+	if err = service.RequestChange(ctx, 3, "taken@example.com", "password", "10.0.0.1"); err != nil {
+		t.Fatal("RequestChange is failed. Error: ", err)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case msg := <-sent:
+			hasLink := invitationTokenPattern.MatchString(msg.Body)
+			if msg.To == "taken@example.com" && hasLink || msg.To == "old@example.com" && !hasLink {
+				t.Errorf("Unexpected message to %s: %s", msg.To, msg.Body)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("email change messages were not sent")
+		}
+	}
+
+	// Подтверждение нового адреса меняет email и завершает остальные сессии
+	if err = service.RequestChange(ctx, 3, "New@Example.com", "password", "10.0.0.1"); err != nil {
+		t.Fatal("RequestChange is failed. Error: ", err)
+	}
+	confirmToken, cancelToken := emailChangeTokens(t, sent, "new@example.com", "old@example.com")
+	if repo.user.Email != "old@example.com" {
+		t.Fatalf("Expected email to stay unchanged before confirmation, got %s", repo.user.Email)
+	}
+	if err = service.Confirm(ctx, confirmToken, "current-session"); err != nil {
+		t.Fatal("Confirm is failed. Error: ", err)
+	}
+	if repo.user.Email != "new@example.com" {
+		t.Errorf("Expected new email after confirmation, got %s", repo.user.Email)
+	}
+	if err = service.Confirm(ctx, confirmToken, ""); !errors.Is(err, users_db.ErrEmailChangeNotFound) {
+		t.Errorf("Expected confirmation link to be single use, got %v", err)
+	}
+
+	// Владелец старого адреса откатывает уже подтверждённую смену
+	if err = service.Cancel(ctx, cancelToken); err != nil {
+		t.Fatal("Cancel is failed. Error: ", err)
+	}
+	if repo.user.Email != "old@example.com" {
+		t.Errorf("Expected old email after cancellation, got %s", repo.user.Email)
+	}
+	if len(repo.revokedAllKeep) != 2 || repo.revokedAllKeep[0] != "current-session" || repo.revokedAllKeep[1] != "" {
+		t.Errorf("Expected other sessions revoked on confirmation and all sessions on cancellation, got %v", repo.revokedAllKeep)
+	}
+}
+
+// Подбор пароля через смену email блокирует аккаунт так же, как вход
+func TestEmailChangeService_Throttled(t *testing.T) {
+	hash, err := users.HashUserPassword("password", slog.Default())
+	if err != nil {
+		t.Fatal("HashUserPassword is failed. Error: ", err)
+	}
+	repo := &fakeEmailChangeRepo{
+		user:    users_db.UserInfo{ID: 3, Email: "old@example.com", PasswordHash: hash},
+		changes: make(map[string]*users_db.EmailChange),
+	}
+	service := services.NewEmailChangeService(repo, make(chanMailer, 2), newTestThrottler(newFakeAttemptsRepo()), services.EmailChangeConfig{
+		TTL:        time.Hour,
+		CancelTTL:  24 * time.Hour,
+		ConfirmURL: "http://localhost/email/confirm",
+		CancelURL:  "http://localhost/email/cancel",
+	}, slog.Default())
+	ctx := context.Background()
+
+	// После DelayAfter неудач следующая попытка ждёт задержку даже с верным паролем
+	for i := 0; i < 2; i++ {
+		if err = service.RequestChange(ctx, 3, "new@example.com", "wrong", "10.0.0.1"); !errors.Is(err, services.ErrWrongPassword) {
+			t.Fatalf("attempt %d: expected ErrWrongPassword, got %v", i+1, err)
+		}
+	}
+	var locked *services.LockedError
+	if err = service.RequestChange(ctx, 3, "new@example.com", "password", "10.0.0.2"); !errors.As(err, &locked) {
+		t.Errorf("Expected throttled account to reject the right password, got %v", err)
+	}
+}
@@ -0,0 +1,229 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/mailer"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/password_policy"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/services"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/invitations_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/orgs_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/models/users/create_user"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// fakeInvitationsRepo Приглашения в памяти. Принятое приглашение создаёт пользователя в fakePhoneUsersRepo
+type fakeInvitationsRepo struct {
+	invitations []invitations_db.Invitation
+	hashes      []string
+	users       *fakePhoneUsersRepo
+}
+
+func (f *fakeInvitationsRepo) CreateInvitation(_ context.Context, invitation invitations_db.Invitation, tokenHash string) (invitations_db.Invitation, error) {
+	invitation.ID = int64(len(f.invitations) + 1)
+	invitation.CreatedAt = time.Now()
+	f.invitations = append(f.invitations, invitation)
+	f.hashes = append(f.hashes, tokenHash)
+	return invitation, nil
+}
+
+func (f *fakeInvitationsRepo) ListInvitations(_ context.Context, _ int64) ([]invitations_db.Invitation, error) {
+	return f.invitations, nil
+}
+
+func (f *fakeInvitationsRepo) RevokeInvitation(_ context.Context, _ int64, id int64) error {
+	now := time.Now()
+	f.invitations[id-1].RevokedAt = &now
+	return nil
+}
+
+func (f *fakeInvitationsRepo) GetPendingInvitation(_ context.Context, tokenHash string) (invitations_db.Invitation, error) {
+	for i, hash := range f.hashes {
+		if hash == tokenHash && f.invitations[i].Status(time.Now()) == invitations_db.StatusPending {
+			return f.invitations[i], nil
+		}
+	}
+	return invitations_db.Invitation{}, invitations_db.ErrInvitationNotFound
+}
+
+func (f *fakeInvitationsRepo) AcceptInvitation(ctx context.Context, tokenHash string, userinfo *create_user.UserCreate) (int64, invitations_db.Invitation, error) {
+	invitation, err := f.GetPendingInvitation(ctx, tokenHash)
+	if err != nil {
+		return 0, invitations_db.Invitation{}, err
+	}
+	now := time.Now()
+	f.invitations[invitation.ID-1].AcceptedAt = &now
+
+	id := int64(len(f.users.users) + 1)
+	f.users.users[id] = users_db.UserInfo{
+		ID:           id,
+		FirstName:    userinfo.FirstName,
+		LastName:     userinfo.LastName,
+		Email:        invitation.Email,
+		PasswordHash: userinfo.Password,
+		OrgID:        invitation.OrgID,
+		Roles:        append([]string{users_db.RoleUser}, invitation.Roles...),
+	}
+	return id, invitation, nil
+}
+
+// JoinInvitation Переводит существующего пользователя в организацию приглашения: у fakePhoneUsersRepo одна организация на пользователя
+func (f *fakeInvitationsRepo) JoinInvitation(ctx context.Context, tokenHash string, userID int64) (invitations_db.Invitation, error) {
+	invitation, err := f.GetPendingInvitation(ctx, tokenHash)
+	if err != nil {
+		return invitations_db.Invitation{}, err
+	}
+	usr, ok := f.users.users[userID]
+	if !ok || usr.Email != invitation.Email {
+		return invitations_db.Invitation{}, invitations_db.ErrInvitationNotFound
+	}
+	if usr.OrgID == invitation.OrgID {
+		return invitations_db.Invitation{}, orgs_db.ErrAlreadyMember
+	}
+	now := time.Now()
+	f.invitations[invitation.ID-1].AcceptedAt = &now
+
+	usr.OrgID = invitation.OrgID
+	usr.Roles = append([]string{users_db.RoleUser}, invitation.Roles...)
+	f.users.users[userID] = usr
+	return invitation, nil
+}
+
+// chanMailer Передаёт письма в канал: сервис отправляет их в фоне
+type chanMailer chan mailer.Message
+
+func (m chanMailer) Send(_ context.Context, msg mailer.Message) error {
+	m <- msg
+	return nil
+}
+
+var invitationTokenPattern = regexp.MustCompile(`https?://\S+`)
+
+func invitationToken(t *testing.T, sent chanMailer) string {
+	t.Helper()
+	select {
+	case msg := <-sent:
+		link, err := url.Parse(invitationTokenPattern.FindString(msg.Body))
+		if err != nil {
+			t.Fatalf("parse invitation link: %v", err)
+		}
+		return link.Query().Get("token")
+	case <-time.After(time.Second):
+		t.Fatalf("invitation was not sent")
+		return ""
+	}
+}
+
+func newTestInvitationService() (*services.InvitationService, *fakeInvitationsRepo, *fakeTokensRepo, chanMailer) {
+	usersRepo := &fakePhoneUsersRepo{users: map[int64]users_db.UserInfo{}}
+	invitationsRepo := &fakeInvitationsRepo{users: usersRepo}
+	tokensRepo := &fakeTokensRepo{}
+	sent := make(chanMailer, 4)
+	authService := services.NewAuthService(usersRepo, tokensRepo, slog.Default(), testSecret, time.Minute, nil, nil)
+	invitationService := services.NewInvitationService(usersRepo, invitationsRepo, authService, sent,
+		password_policy.NewPolicy(password_policy.Policy{MinLength: 8}), services.InvitationConfig{
+			TTL: time.Hour,
+			URL: "http://localhost:3000/invitations/accept",
+		}, slog.Default())
+	return invitationService, invitationsRepo, tokensRepo, sent
+}
+
+func TestInvitationService_Accept(t *testing.T) {
+	invitationService, invitationsRepo, tokensRepo, sent := newTestInvitationService()
+	ctx := context.Background()
+
+	invitation, err := invitationService.Invite(ctx, 2, 1, "new@example.com", []string{"manager"}, nil)
+	if err != nil {
+		t.Fatalf("Invite: %v", err)
+	}
+	if invitation.Status(time.Now()) != invitations_db.StatusPending {
+		t.Fatalf("status = %s, want pending", invitation.Status(time.Now()))
+	}
+	token := invitationToken(t, sent)
+
+	// Пароль проверяется по политике до списания приглашения
+	_, err = invitationService.Accept(ctx, token, "New", "User", "short")
+	var violationErr *password_policy.ViolationError
+	if !errors.As(err, &violationErr) {
+		t.Fatalf("weak password: got %v, want ViolationError", err)
+	}
+
+	authTokens, err := invitationService.Accept(ctx, token, "New", "User", "correct-horse-battery")
+	if err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+	if authTokens.AccessToken == "" || tokensRepo.issued != 1 {
+		t.Fatalf("tokens were not issued")
+	}
+	usr := invitationsRepo.users.users[1]
+	if usr.Email != "new@example.com" || usr.OrgID != 2 || !usr.HasRole("manager") || !usr.HasRole(users_db.RoleUser) {
+		t.Fatalf("unexpected user %+v", usr)
+	}
+	// Приглашение одноразовое
+	if _, err = invitationService.Accept(ctx, token, "New", "User", "correct-horse-battery"); !errors.Is(err, invitations_db.ErrInvitationNotFound) {
+		t.Fatalf("reused invitation: got %v, want ErrInvitationNotFound", err)
+	}
+}
+
+func TestInvitationService_Join(t *testing.T) {
+	invitationService, invitationsRepo, tokensRepo, sent := newTestInvitationService()
+	ctx := context.Background()
+	invitationsRepo.users.users[1] = users_db.UserInfo{ID: 1, Email: "member@example.com", OrgID: 1, Roles: []string{users_db.RoleUser}}
+	invitationsRepo.users.users[2] = users_db.UserInfo{ID: 2, Email: "other@example.com", OrgID: 1, Roles: []string{users_db.RoleUser}}
+
+	if _, err := invitationService.Invite(ctx, 2, 1, "member@example.com", []string{"manager"}, nil); err != nil {
+		t.Fatalf("Invite: %v", err)
+	}
+	token := invitationToken(t, sent)
+
+	// Чужой ссылкой вступить нельзя, приглашение при этом не списывается
+	if _, err := invitationService.Join(ctx, token, 2); !errors.Is(err, invitations_db.ErrInvitationNotFound) {
+		t.Fatalf("join by another user: got %v, want ErrInvitationNotFound", err)
+	}
+	if invitationsRepo.users.users[2].OrgID != 1 {
+		t.Fatalf("another user joined the organization")
+	}
+
+	authTokens, err := invitationService.Join(ctx, token, 1)
+	if err != nil {
+		t.Fatalf("Join: %v", err)
+	}
+	if authTokens.AccessToken == "" || tokensRepo.issued != 1 {
+		t.Fatalf("tokens were not issued")
+	}
+	usr := invitationsRepo.users.users[1]
+	if usr.OrgID != 2 || !usr.HasRole("manager") {
+		t.Fatalf("unexpected user %+v", usr)
+	}
+	if _, err = invitationService.Join(ctx, token, 1); !errors.Is(err, invitations_db.ErrInvitationNotFound) {
+		t.Fatalf("reused invitation: got %v, want ErrInvitationNotFound", err)
+	}
+}
+
+func TestInvitationService_Expiry(t *testing.T) {
+	invitationService, invitationsRepo, _, sent := newTestInvitationService()
+	ctx := context.Background()
+
+	past := time.Now().Add(-time.Minute)
+	if _, err := invitationService.Invite(ctx, 1, 1, "new@example.com", nil, &past); !errors.Is(err, services.ErrInvalidExpiry) {
+		t.Fatalf("expiry in the past: got %v, want ErrInvalidExpiry", err)
+	}
+
+	if _, err := invitationService.Invite(ctx, 1, 1, "new@example.com", nil, nil); err != nil {
+		t.Fatalf("Invite: %v", err)
+	}
+	token := invitationToken(t, sent)
+	invitationsRepo.invitations[0].ExpiresAt = time.Now().Add(-time.Second)
+
+	if _, err := invitationService.Accept(ctx, token, "New", "User", "correct-horse-battery"); !errors.Is(err, invitations_db.ErrInvitationNotFound) {
+		t.Fatalf("expired invitation: got %v, want ErrInvitationNotFound", err)
+	}
+	if len(invitationsRepo.users.users) != 0 {
+		t.Fatalf("user was created from expired invitation")
+	}
+}
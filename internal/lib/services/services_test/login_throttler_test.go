@@ -0,0 +1,176 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/services"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/login_attempts_db"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeAttemptsRepo Хранит попытки в памяти вместо таблицы login_attempts
+type fakeAttemptsRepo struct {
+	mu       sync.Mutex
+	attempts map[string]login_attempts_db.LoginAttempt
+}
+
+func newFakeAttemptsRepo() *fakeAttemptsRepo {
+	return &fakeAttemptsRepo{attempts: map[string]login_attempts_db.LoginAttempt{}}
+}
+
+func (f *fakeAttemptsRepo) GetAttempt(_ context.Context, scope string, key string) (login_attempts_db.LoginAttempt, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.attempts[scope+"|"+key], nil
+}
+
+func (f *fakeAttemptsRepo) ReserveAttempt(_ context.Context, scope string, key string, window time.Duration, lockFor func(count int) time.Duration) (login_attempts_db.Reservation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+	reservation, locked := login_attempts_db.NextReservation(f.attempts[scope+"|"+key], now, window, lockFor)
+	if !locked {
+		f.attempts[scope+"|"+key] = login_attempts_db.LoginAttempt{
+			FailedCount:  reservation.FailedCount,
+			LastFailedAt: now,
+			LockedUntil:  reservation.LockedUntil,
+		}
+	}
+	return reservation, nil
+}
+
+func (f *fakeAttemptsRepo) ReleaseAttempt(_ context.Context, scope string, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	attempt := f.attempts[scope+"|"+key]
+	if attempt.FailedCount > 0 {
+		attempt.FailedCount--
+	}
+	f.attempts[scope+"|"+key] = attempt
+	return nil
+}
+
+func (f *fakeAttemptsRepo) Reset(_ context.Context, scope string, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.attempts, scope+"|"+key)
+	return nil
+}
+
+// failLogin Неудачная попытка входа: учитывается до проверки пароля
+func failLogin(t *testing.T, throttler *services.LoginThrottler, email string, ip string) {
+	t.Helper()
+	if err := throttler.Reserve(context.Background(), email, ip); err != nil {
+		t.Fatal("Attempt must not be locked yet. Error: ", err)
+	}
+	throttler.RegisterFailure()
+}
+
+func newTestThrottler(repo *fakeAttemptsRepo) *services.LoginThrottler {
+	return services.NewLoginThrottler(repo, nil, services.LoginThrottlerConfig{
+		DelayAfter:      2,
+		BaseDelay:       time.Second,
+		LockoutAfter:    4,
+		LockoutDuration: time.Minute,
+		MaxLockout:      time.Hour,
+		IPLockoutAfter:  100,
+		FailureWindow:   time.Hour,
+	}, slog.Default())
+}
+
+func TestLoginThrottler(t *testing.T) {
+	repo := newFakeAttemptsRepo()
+	throttler := newTestThrottler(repo)
+	ctx := context.Background()
+
+	failLogin(t, throttler, "User@Example.com", "10.0.0.1")
+
+	// Вторая неудача - начинается задержка
+	failLogin(t, throttler, "user@example.com", "10.0.0.1")
+	var lockedErr *services.LockedError
+	err := throttler.Reserve(ctx, "user@example.com", "10.0.0.2")
+	if !errors.As(err, &lockedErr) || !errors.Is(err, services.ErrTooManyAttempts) {
+		t.Fatal("Expected back-off after second failure, got: ", err)
+	}
+	if lockedErr.RetryAfter > time.Second {
+		t.Errorf("expected delay up to 1s, got %s", lockedErr.RetryAfter)
+	}
+	// Отклонённая попытка не учитывается ни для аккаунта, ни для IP
+	if attempt, _ := repo.GetAttempt(ctx, login_attempts_db.ScopeIP, "10.0.0.2"); attempt.FailedCount != 0 {
+		t.Errorf("Rejected attempt must not be counted, got %+v", attempt)
+	}
+
+	// Четвёртая неудача - блокировка на LockoutDuration
+	repo.attempts[login_attempts_db.ScopeAccount+"|user@example.com"] = login_attempts_db.LoginAttempt{FailedCount: 3, LastFailedAt: time.Now()}
+	failLogin(t, throttler, "user@example.com", "10.0.0.1")
+	err = throttler.Reserve(ctx, "user@example.com", "10.0.0.3")
+	if !errors.As(err, &lockedErr) || lockedErr.RetryAfter < 59*time.Second {
+		t.Fatal("Expected lockout after fourth failure, got: ", err)
+	}
+
+	// Другой аккаунт с того же IP не заблокирован
+	if err = throttler.Reserve(ctx, "other@example.com", "10.0.0.1"); err != nil {
+		t.Error("Other account must not be locked. Error: ", err)
+	}
+	throttler.RegisterSuccess(ctx, "other@example.com", "10.0.0.1")
+
+	// Админ разблокировал
+	if err = throttler.Unlock(ctx, "USER@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err = throttler.Reserve(ctx, "user@example.com", "10.0.0.1"); err != nil {
+		t.Error("Unlocked account must be able to login. Error: ", err)
+	}
+	throttler.RegisterSuccess(ctx, "user@example.com", "10.0.0.1")
+	// Успешные входы не копятся в счётчике IP
+	if attempt, _ := repo.GetAttempt(ctx, login_attempts_db.ScopeIP, "10.0.0.1"); attempt.FailedCount != 3 {
+		t.Errorf("Expected 3 failures from ip, got %+v", attempt)
+	}
+}
+
+// Параллельные попытки резервируются до проверки пароля, поэтому пачка запросов не проходит мимо порога
+func TestLoginThrottler_ConcurrentAttempts(t *testing.T) {
+	throttler := newTestThrottler(newFakeAttemptsRepo())
+	var wg sync.WaitGroup
+	var passed atomic.Int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if throttler.Reserve(context.Background(), "user@example.com", "10.0.0.1") == nil {
+				passed.Add(1)
+				throttler.RegisterFailure()
+			}
+		}()
+	}
+	wg.Wait()
+	// Вторая попытка выставляет задержку, дальше не проходит ни одна
+	if passed.Load() != 2 {
+		t.Errorf("Expected 2 attempts before back-off, got %d", passed.Load())
+	}
+}
+
+func TestLoginThrottler_VerifyPassword(t *testing.T) {
+	throttler := newTestThrottler(newFakeAttemptsRepo())
+	ctx := context.Background()
+	wrong := func() bool { return false }
+
+	for i := 0; i < 2; i++ {
+		if err := throttler.VerifyPassword(ctx, "user@example.com", "10.0.0.1", wrong); !errors.Is(err, services.ErrWrongPassword) {
+			t.Fatal("Expected wrong password, got: ", err)
+		}
+	}
+	// После задержки даже верный пароль не проверяется
+	checked := false
+	err := throttler.VerifyPassword(ctx, "user@example.com", "10.0.0.1", func() bool {
+		checked = true
+		return true
+	})
+	if !errors.Is(err, services.ErrTooManyAttempts) || checked {
+		t.Errorf("Expected throttled check without verifying password, got %v (checked %v)", err, checked)
+	}
+}
@@ -0,0 +1,90 @@
+package services_test
+
+import (
+	"context"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/services"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+// fakeSlowUsersRepo Поиск пользователя ждёт release, как медленная БД
+type fakeSlowUsersRepo struct {
+	users_db.UserRepository
+	release chan struct{}
+}
+
+func (f *fakeSlowUsersRepo) GetUser(_ context.Context, email string) (users_db.UserInfo, error) {
+	<-f.release
+	if email != "alice@example.com" {
+		return users_db.UserInfo{}, users_db.ErrUserNotFound
+	}
+	return users_db.UserInfo{ID: 1, Email: email}, nil
+}
+
+// fakeLinksRepo Ссылки в памяти вместо таблицы magic_links
+type fakeLinksRepo struct {
+	created chan int64
+}
+
+func (f *fakeLinksRepo) CreateLink(_ context.Context, userID int64, _ string, _ time.Time) error {
+	f.created <- userID
+	return nil
+}
+
+func (f *fakeLinksRepo) CountLinksSince(_ context.Context, _ int64, _ time.Time) (int, error) {
+	return 0, nil
+}
+
+func (f *fakeLinksRepo) ConsumeLink(_ context.Context, _ string) (int64, error) {
+	return 0, nil
+}
+
+// Запрос ссылки не ждёт ни поиска пользователя, ни записи ссылки: время ответа не зависит от того, есть ли аккаунт
+func TestMagicLinkService_RequestLinkInBackground(t *testing.T) {
+	usersRepo := &fakeSlowUsersRepo{release: make(chan struct{})}
+	linksRepo := &fakeLinksRepo{created: make(chan int64, 2)}
+	sent := make(chanMailer, 2)
+	service := services.NewMagicLinkService(usersRepo, linksRepo, nil, sent, services.MagicLinkConfig{
+		TTL:          time.Minute,
+		URL:          "https://app.example.com/login",
+		MaxPerWindow: 5,
+	}, slog.Default())
+
+	for _, email := range []string{"alice@example.com", "nobody@example.com"} {
+		returned := make(chan struct{})
+		go func() {
+			service.RequestLink(context.Background(), email)
+			close(returned)
+		}()
+		select {
+		case <-returned:
+		case <-time.After(time.Second):
+			t.Fatalf("RequestLink for %s waited for the database", email)
+		}
+	}
+	close(usersRepo.release)
+
+	select {
+	case userID := <-linksRepo.created:
+		if userID != 1 {
+			t.Errorf("Expected link for user 1, got %d", userID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Link was not created")
+	}
+	select {
+	case msg := <-sent:
+		if msg.To != "alice@example.com" {
+			t.Errorf("Expected link sent to alice, got %s", msg.To)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Link was not sent")
+	}
+	select {
+	case msg := <-sent:
+		t.Errorf("Unknown email must not get a link, got %+v", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,81 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/jwt_tokens"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/services"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/tenant"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+// fakeOrgUsersRepo Пользователь с разными ролями в разных организациях. Как и настоящий репозиторий,
+// читает роли в организации из контекста и не видит пользователя вне его организаций
+type fakeOrgUsersRepo struct {
+	users_db.UserRepository
+	user  users_db.UserInfo
+	roles map[int64][]string
+}
+
+func (f *fakeOrgUsersRepo) GetUserByID(ctx context.Context, id int64) (users_db.UserInfo, error) {
+	orgID := tenant.OrgIDOrDefault(ctx)
+	roles, ok := f.roles[orgID]
+	if id != f.user.ID || !ok {
+		return users_db.UserInfo{}, users_db.ErrUserNotFound
+	}
+	usr := f.user
+	usr.OrgID, usr.Roles = orgID, roles
+	return usr, nil
+}
+
+func TestAuthService_SwitchOrganization(t *testing.T) {
+	usersRepo := &fakeOrgUsersRepo{
+		user: users_db.UserInfo{ID: 5, Email: "user@example.com"},
+		roles: map[int64][]string{
+			tenant.DefaultOrgID: {users_db.RoleUser},
+			2:                   {users_db.RoleAdmin, users_db.RoleUser},
+		},
+	}
+	tokensRepo := &fakeTokensRepo{}
+	authService := services.NewAuthService(usersRepo, tokensRepo, slog.Default(), testSecret, time.Minute, nil, nil)
+
+	tests := []struct {
+		TestName      string
+		OrgID         int64
+		ExpectedRoles []interface{}
+		ExpectedErr   error
+	}{
+		{TestName: "Member of organization", OrgID: 2, ExpectedRoles: []interface{}{users_db.RoleAdmin, users_db.RoleUser}},
+		{TestName: "Not a member", OrgID: 3, ExpectedErr: services.ErrNotOrgMember},
+	}
+	for _, tt := range tests {
+		t.Run(tt.TestName, func(t *testing.T) {
+			// Текущий токен выдан в организацию по умолчанию
+			ctx := tenant.WithOrgID(context.Background(), tenant.DefaultOrgID)
+			pair, err := authService.SwitchOrganization(ctx, 5, tt.OrgID)
+			if tt.ExpectedErr != nil {
+				if !errors.Is(err, tt.ExpectedErr) {
+					t.Fatalf("Expected %v, got %v", tt.ExpectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("SwitchOrganization is failed. Error: ", err)
+			}
+			claims, err := jwt_tokens.VerifyToken(pair.AccessToken, testSecret)
+			if err != nil {
+				t.Fatal("VerifyToken is failed. Error: ", err)
+			}
+			if claims["org_id"] != float64(tt.OrgID) {
+				t.Errorf("Expected org_id %d, got %v", tt.OrgID, claims["org_id"])
+			}
+			roles, _ := claims["roles"].([]interface{})
+			if len(roles) != len(tt.ExpectedRoles) || roles[0] != tt.ExpectedRoles[0] {
+				t.Errorf("Expected roles %v, got %v", tt.ExpectedRoles, roles)
+			}
+		})
+	}
+}
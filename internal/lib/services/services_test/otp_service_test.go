@@ -0,0 +1,263 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/message_sender"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/services"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/tenant"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/auth_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/otp_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"log/slog"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// fakePhoneUsersRepo Пользователи в памяти. Реализованы только методы, нужные OTPService
+type fakePhoneUsersRepo struct {
+	users_db.UserRepository
+	users map[int64]users_db.UserInfo
+}
+
+func (f *fakePhoneUsersRepo) GetUserByID(_ context.Context, id int64) (users_db.UserInfo, error) {
+	usr, ok := f.users[id]
+	if !ok {
+		return users_db.UserInfo{}, users_db.ErrUserNotFound
+	}
+	return usr, nil
+}
+
+func (f *fakePhoneUsersRepo) GetUserByPhone(_ context.Context, phone string) (users_db.UserInfo, error) {
+	for _, usr := range f.users {
+		if usr.Phone == phone && usr.PhoneVerified {
+			return usr, nil
+		}
+	}
+	return users_db.UserInfo{}, users_db.ErrUserNotFound
+}
+
+func (f *fakePhoneUsersRepo) SetPhone(_ context.Context, id int64, phone string) error {
+	usr := f.users[id]
+	usr.Phone, usr.PhoneVerified = phone, false
+	f.users[id] = usr
+	return nil
+}
+
+func (f *fakePhoneUsersRepo) MarkPhoneVerified(_ context.Context, id int64, phone string) error {
+	usr := f.users[id]
+	if usr.Phone != phone {
+		return users_db.ErrUserNotFound
+	}
+	usr.PhoneVerified = true
+	f.users[id] = usr
+	return nil
+}
+
+type fakeTokensRepo struct {
+	auth_db.TokensRepository
+	issued int
+}
+
+func (f *fakeTokensRepo) DbPutTokens(_ context.Context, _ int64, _ int64, _ string) error {
+	f.issued++
+	return nil
+}
+
+// fakeOTPRepo Коды в памяти вместо таблицы otp_codes
+type fakeOTPRepo struct {
+	codes   []otp_db.OTPCode
+	purpose []string
+}
+
+func (f *fakeOTPRepo) CreateCode(_ context.Context, code otp_db.OTPCode, purpose string) error {
+	now := time.Now()
+	for i := range f.codes {
+		if f.purpose[i] == purpose && f.codes[i].Phone == code.Phone && f.codes[i].ConsumedAt == nil {
+			f.codes[i].ConsumedAt = &now
+		}
+	}
+	code.ID = int64(len(f.codes) + 1)
+	code.CreatedAt = now
+	f.codes = append(f.codes, code)
+	f.purpose = append(f.purpose, purpose)
+	return nil
+}
+
+func (f *fakeOTPRepo) GetLatestCode(_ context.Context, purpose string, phone string) (otp_db.OTPCode, error) {
+	for i := len(f.codes) - 1; i >= 0; i-- {
+		if f.purpose[i] == purpose && f.codes[i].Phone == phone {
+			return f.codes[i], nil
+		}
+	}
+	return otp_db.OTPCode{}, otp_db.ErrCodeNotFound
+}
+
+func (f *fakeOTPRepo) IncrementAttempts(_ context.Context, id int64) (int, error) {
+	f.codes[id-1].Attempts++
+	return f.codes[id-1].Attempts, nil
+}
+
+func (f *fakeOTPRepo) ConsumeCode(_ context.Context, id int64) error {
+	if f.codes[id-1].ConsumedAt != nil {
+		return otp_db.ErrCodeNotFound
+	}
+	now := time.Now()
+	f.codes[id-1].ConsumedAt = &now
+	return nil
+}
+
+var codePattern = regexp.MustCompile(`\d{6}`)
+
+const testSecret = "test-secret-key-with-enough-length-32"
+
+func lastCode(t *testing.T, sender *message_sender.MemorySender, phone string) string {
+	t.Helper()
+	msg, ok := sender.Last(phone)
+	if !ok {
+		t.Fatalf("no message sent to %s", phone)
+	}
+	return codePattern.FindString(msg.Text)
+}
+
+func newTestOTPService(cooldown time.Duration, throttler *services.LoginThrottler) (*services.OTPService, *fakePhoneUsersRepo, *fakeTokensRepo, *message_sender.MemorySender) {
+	usersRepo := &fakePhoneUsersRepo{users: map[int64]users_db.UserInfo{
+		1: {ID: 1, Email: "user@example.com", OrgID: tenant.DefaultOrgID, Roles: []string{users_db.RoleUser}},
+	}}
+	tokensRepo := &fakeTokensRepo{}
+	sender := message_sender.NewMemorySender()
+	authService := services.NewAuthService(usersRepo, tokensRepo, slog.Default(), testSecret, time.Minute, throttler, nil)
+	otpService := services.NewOTPService(usersRepo, &fakeOTPRepo{}, authService, sender, testSecret, services.OTPConfig{
+		TTL:            time.Minute,
+		MaxAttempts:    2,
+		ResendCooldown: cooldown,
+	}, slog.Default())
+	return otpService, usersRepo, tokensRepo, sender
+}
+
+func TestOTPService_LoginAfterPhoneVerification(t *testing.T) {
+	otpService, usersRepo, tokensRepo, sender := newTestOTPService(0, nil)
+	ctx := context.Background()
+	const phone = "+79991234567"
+
+	// До подтверждения номера код для входа не отправляется
+	if err := otpService.RequestLoginCode(ctx, phone); err != nil {
+		t.Fatalf("RequestLoginCode: %v", err)
+	}
+	if len(sender.Messages()) != 0 {
+		t.Fatalf("code was sent to unverified phone")
+	}
+
+	if err := otpService.RequestPhoneVerification(ctx, 1, phone); err != nil {
+		t.Fatalf("RequestPhoneVerification: %v", err)
+	}
+	if err := otpService.VerifyPhone(ctx, 1, lastCode(t, sender, phone), "10.0.0.1"); err != nil {
+		t.Fatalf("VerifyPhone: %v", err)
+	}
+	if !usersRepo.users[1].PhoneVerified {
+		t.Fatalf("phone is not verified")
+	}
+
+	if err := otpService.RequestLoginCode(ctx, phone); err != nil {
+		t.Fatalf("RequestLoginCode: %v", err)
+	}
+	code := lastCode(t, sender, phone)
+	authTokens, err := otpService.VerifyLoginCode(ctx, phone, code, "10.0.0.1")
+	if err != nil {
+		t.Fatalf("VerifyLoginCode: %v", err)
+	}
+	if authTokens.AccessToken == "" || tokensRepo.issued != 1 {
+		t.Fatalf("tokens were not issued")
+	}
+	// Код одноразовый
+	if _, err = otpService.VerifyLoginCode(ctx, phone, code, "10.0.0.1"); !errors.Is(err, services.ErrInvalidCode) {
+		t.Fatalf("reused code: got %v, want ErrInvalidCode", err)
+	}
+}
+
+func TestOTPService_AttemptsLimit(t *testing.T) {
+	otpService, _, _, sender := newTestOTPService(0, nil)
+	ctx := context.Background()
+	const phone = "+79991234567"
+
+	if err := otpService.RequestPhoneVerification(ctx, 1, phone); err != nil {
+		t.Fatalf("RequestPhoneVerification: %v", err)
+	}
+	code := lastCode(t, sender, phone)
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	for i := 0; i < 2; i++ {
+		if err := otpService.VerifyPhone(ctx, 1, wrong, "10.0.0.1"); !errors.Is(err, services.ErrInvalidCode) {
+			t.Fatalf("wrong code: got %v, want ErrInvalidCode", err)
+		}
+	}
+	// Попытки кончились, верный код уже не принимается
+	if err := otpService.VerifyPhone(ctx, 1, code, "10.0.0.1"); !errors.Is(err, services.ErrInvalidCode) {
+		t.Fatalf("code after attempts limit: got %v, want ErrInvalidCode", err)
+	}
+}
+
+func TestOTPService_ResendCooldown(t *testing.T) {
+	otpService, _, _, _ := newTestOTPService(time.Minute, nil)
+	ctx := context.Background()
+	const phone = "+79991234567"
+
+	if err := otpService.RequestPhoneVerification(ctx, 1, phone); err != nil {
+		t.Fatalf("RequestPhoneVerification: %v", err)
+	}
+	err := otpService.RequestPhoneVerification(ctx, 1, phone)
+	var cooldownErr *services.CooldownError
+	if !errors.As(err, &cooldownErr) || cooldownErr.RetryAfter <= 0 {
+		t.Fatalf("got %v, want CooldownError", err)
+	}
+}
+
+// Новый код после паузы не даёт новых попыток: неверные коды считаются неудачными входами в аккаунт
+func TestOTPService_LockoutAcrossCodes(t *testing.T) {
+	throttler := services.NewLoginThrottler(newFakeAttemptsRepo(), nil, services.LoginThrottlerConfig{
+		LockoutAfter:    3,
+		LockoutDuration: time.Minute,
+		MaxLockout:      time.Hour,
+		IPLockoutAfter:  100,
+		FailureWindow:   time.Hour,
+	}, slog.Default())
+	otpService, usersRepo, tokensRepo, sender := newTestOTPService(0, throttler)
+	ctx := context.Background()
+	const phone = "+79991234567"
+	usersRepo.users[1] = users_db.UserInfo{ID: 1, Email: "user@example.com", OrgID: tenant.DefaultOrgID, Phone: phone, PhoneVerified: true}
+
+	// Каждый код получает одну неверную попытку, но счётчик общий
+	for i := 0; i < 3; i++ {
+		if err := otpService.RequestLoginCode(ctx, phone); err != nil {
+			t.Fatalf("RequestLoginCode: %v", err)
+		}
+		code := lastCode(t, sender, phone)
+		wrong := "000000"
+		if code == wrong {
+			wrong = "111111"
+		}
+		if _, err := otpService.VerifyLoginCode(ctx, phone, wrong, "10.0.0.1"); !errors.Is(err, services.ErrInvalidCode) {
+			t.Fatalf("wrong code: got %v, want ErrInvalidCode", err)
+		}
+	}
+
+	// Новый код после блокировки не принимается, даже верный и с другого IP
+	if err := otpService.RequestLoginCode(ctx, phone); err != nil {
+		t.Fatalf("RequestLoginCode: %v", err)
+	}
+	_, err := otpService.VerifyLoginCode(ctx, phone, lastCode(t, sender, phone), "10.0.0.2")
+	var lockedErr *services.LockedError
+	if !errors.As(err, &lockedErr) {
+		t.Fatalf("code after lockout: got %v, want LockedError", err)
+	}
+	if tokensRepo.issued != 0 {
+		t.Fatalf("tokens were issued to locked account")
+	}
+	// Блокировка общая с входом по паролю
+	if err = throttler.Reserve(ctx, "user@example.com", "10.0.0.3"); !errors.As(err, &lockedErr) {
+		t.Fatalf("password login after code lockout: got %v, want LockedError", err)
+	}
+}
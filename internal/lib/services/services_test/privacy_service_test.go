@@ -0,0 +1,114 @@
+package services_test
+
+import (
+	"context"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/services"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/audit_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/privacy_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+// fakePrivacyRepo Запросы на удаление в памяти. Пользователи из lastAdmins обезличить нельзя
+type fakePrivacyRepo struct {
+	privacy_db.PrivacyRepository
+	due        map[int64]time.Time
+	erased     map[int64]bool
+	lastAdmins map[int64]bool
+}
+
+func (f *fakePrivacyRepo) RequestErasure(_ context.Context, userID int64, dueAt time.Time) (privacy_db.Erasure, error) {
+	if existing, ok := f.due[userID]; ok {
+		dueAt = existing
+	}
+	f.due[userID] = dueAt
+	return privacy_db.Erasure{DueAt: &dueAt}, nil
+}
+
+func (f *fakePrivacyRepo) DueErasures(_ context.Context, now time.Time, _ int) ([]int64, error) {
+	var ids []int64
+	for userID, dueAt := range f.due {
+		if !dueAt.After(now) {
+			ids = append(ids, userID)
+		}
+	}
+	return ids, nil
+}
+
+func (f *fakePrivacyRepo) Anonymize(_ context.Context, userID int64) error {
+	if f.lastAdmins[userID] {
+		return users_db.ErrLastAdmin
+	}
+	delete(f.due, userID)
+	f.erased[userID] = true
+	return nil
+}
+
+type fakeAuditRepo struct {
+	audit_db.AuditRepository
+	events []audit_db.Event
+}
+
+func (f *fakeAuditRepo) Record(_ context.Context, event audit_db.Event) error {
+	f.events = append(f.events, event)
+	return nil
+}
+
+func TestPrivacyService_Erasure(t *testing.T) {
+	usersRepo := &fakePhoneUsersRepo{users: map[int64]users_db.UserInfo{
+		1: {ID: 1, Email: "first@example.com"},
+		2: {ID: 2, Email: "admin@example.com"},
+	}}
+	privacyRepo := &fakePrivacyRepo{due: map[int64]time.Time{}, erased: map[int64]bool{}, lastAdmins: map[int64]bool{2: true}}
+	auditRepo := &fakeAuditRepo{}
+	sent := make(chanMailer, 4)
+	privacyService := services.NewPrivacyService(usersRepo, privacyRepo, auditRepo, nil, sent, services.ErasureConfig{GracePeriod: time.Hour}, slog.Default())
+	ctx := context.Background()
+
+	erasure, err := privacyService.RequestErasure(ctx, 1, "127.0.0.1")
+	if err != nil {
+		t.Fatal("RequestErasure is failed. Error: ", err)
+	}
+	if erasure.DueAt == nil || erasure.DueAt.Before(time.Now().Add(59*time.Minute)) {
+		t.Errorf("Expected erasure to be due in an hour, got %v", erasure.DueAt)
+	}
+	select {
+	case msg := <-sent:
+		if msg.To != "first@example.com" {
+			t.Errorf("Expected notice to first@example.com, got %s", msg.To)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Erasure notice was not sent")
+	}
+
+	// Срок ещё не вышел - ничего не удаляется
+	privacyService.EraseDue(ctx)
+	if privacyRepo.erased[1] {
+		t.Fatal("Expected account to wait for the grace period")
+	}
+
+	// Срок вышел. Ошибка по одному аккаунту не мешает остальным
+	privacyRepo.due[1] = time.Now().Add(-time.Minute)
+	privacyRepo.due[2] = time.Now().Add(-time.Minute)
+	privacyService.EraseDue(ctx)
+	if !privacyRepo.erased[1] {
+		t.Error("Expected account to be erased after the grace period")
+	}
+	if privacyRepo.erased[2] {
+		t.Error("Expected last admin not to be erased")
+	}
+
+	actions := make([]string, 0, len(auditRepo.events))
+	for _, event := range auditRepo.events {
+		actions = append(actions, event.Action)
+	}
+	expected := []string{audit_db.ActionErasureRequested, audit_db.ActionErase}
+	if len(actions) != len(expected) || actions[0] != expected[0] || actions[1] != expected[1] {
+		t.Errorf("Expected audit actions %v, got %v", expected, actions)
+	}
+	if last := auditRepo.events[len(auditRepo.events)-1]; last.ActorID != nil || last.TargetUserID == nil || *last.TargetUserID != 1 {
+		t.Errorf("Expected scheduled erasure of user 1 without actor, got %+v", last)
+	}
+}
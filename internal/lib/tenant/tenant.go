@@ -0,0 +1,54 @@
+package tenant
+
+import "context"
+
+// DefaultOrgID Организация по умолчанию, создаётся миграцией. В неё попадают публичная регистрация и пользователи,
+// которые были до появления организаций. Её администраторы управляют организациями и общими ролями
+const DefaultOrgID int64 = 1
+
+// noOrgID Несуществующая организация. Её подставляет OrgIDArg, если запрос не привязан к организации и не отвязан явно
+const noOrgID int64 = 0
+
+type orgIDKey struct{}
+
+// withoutOrg Значение orgIDKey у запроса, явно отвязанного от организации
+type withoutOrg struct{}
+
+// WithOrgID Привязывает запрос к организации. Репозитории видят только её пользователей, роли и сессии
+func WithOrgID(ctx context.Context, orgID int64) context.Context {
+	return context.WithValue(ctx, orgIDKey{}, orgID)
+}
+
+// WithoutOrg Явно отвязывает запрос от организации: репозитории видят пользователей и сессии всех организаций.
+// Для входа до выбора организации, обновления токенов и действий над аккаунтом целиком,
+// которые доступны только из организации по умолчанию (middlewares.RequireDefaultOrg)
+func WithoutOrg(ctx context.Context) context.Context {
+	return context.WithValue(ctx, orgIDKey{}, withoutOrg{})
+}
+
+// OrgIDFromContext Организация, к которой привязан запрос
+func OrgIDFromContext(ctx context.Context) (int64, bool) {
+	orgID, ok := ctx.Value(orgIDKey{}).(int64)
+	return orgID, ok
+}
+
+// OrgIDArg Значение для SQL параметра: id организации или nil, если запрос явно отвязан от организации (WithoutOrg).
+// Запрос, для которого организация не выбрана вовсе, получает id несуществующей организации и не видит ничего
+func OrgIDArg(ctx context.Context) *int64 {
+	switch orgID := ctx.Value(orgIDKey{}).(type) {
+	case int64:
+		return &orgID
+	case withoutOrg:
+		return nil
+	}
+	orgID := noOrgID
+	return &orgID
+}
+
+// OrgIDOrDefault Организация запроса, а без неё - организация по умолчанию
+func OrgIDOrDefault(ctx context.Context) int64 {
+	if orgID, ok := OrgIDFromContext(ctx); ok {
+		return orgID
+	}
+	return DefaultOrgID
+}
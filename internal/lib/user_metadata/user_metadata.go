@@ -0,0 +1,124 @@
+package user_metadata
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/json_schema"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"strings"
+)
+
+// defaultMaxBytes Размер одной секции в JSON, если в конфиге не задан
+const defaultMaxBytes = 16 * 1024
+
+var ErrMetadataTooLarge = errors.New("metadata is too large")
+
+// Validator Проверяет секции атрибутов пользователя. Схема описывает весь документ metadata:
+// каждая секция проверяется по properties.user и properties.admin. Без схемы принимается любой объект
+type Validator struct {
+	schema   *json_schema.Schema
+	maxBytes int
+}
+
+// NewValidator schema может быть nil. maxBytes <= 0 - 16 КБ на секцию
+func NewValidator(schema *json_schema.Schema, maxBytes int) *Validator {
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxBytes
+	}
+	return &Validator{schema: schema, maxBytes: maxBytes}
+}
+
+// LoadValidator Загружает схему из файла. Пустой путь - проверяется только размер
+func LoadValidator(schemaFile string, maxBytes int) (*Validator, error) {
+	if schemaFile == "" {
+		return NewValidator(nil, maxBytes), nil
+	}
+	schema, err := json_schema.LoadFile(schemaFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load metadata schema %s: %w", schemaFile, err)
+	}
+	return NewValidator(schema, maxBytes), nil
+}
+
+// Validate Проверяет новое содержимое секции. Ошибка схемы - *json_schema.ValidationError
+func (v *Validator) Validate(section string, values map[string]interface{}) error {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	if len(data) > v.maxBytes {
+		return fmt.Errorf("%w: %s section is %d bytes, at most %d allowed", ErrMetadataTooLarge, section, len(data), v.maxBytes)
+	}
+	sectionSchema := v.schema.Property(section)
+	if sectionSchema == nil {
+		return nil
+	}
+	// Проверяем значение в том виде, в каком его прочитает encoding/json: числа float64, вложенные объекты map
+	var decoded interface{}
+	if err = json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	return sectionSchema.Validate(decoded)
+}
+
+// reservedClaims Claims, которые выставляет сам сервис. Атрибутами их не перезаписать
+var reservedClaims = map[string]bool{
+	"sub": true, "exp": true, "iat": true, "nbf": true, "iss": true, "aud": true, "jti": true,
+	"org_id": true, "roles": true, "user_role": true, "permissions": true, "scope": true, "act": true,
+}
+
+// ClaimMapping Атрибут, который кладётся в access токен
+type ClaimMapping struct {
+	Claim     string
+	Section   string
+	Attribute string
+}
+
+// ClaimsMapping Атрибуты пользователя, попадающие в access токен
+type ClaimsMapping []ClaimMapping
+
+// ParseClaimsMapping Разбирает строку вида "department=admin.department,team=user.team":
+// claim department берётся из атрибута department секции admin. Пустая строка - атрибуты в токен не попадают
+func ParseClaimsMapping(raw string) (ClaimsMapping, error) {
+	var mapping ClaimsMapping
+	seen := make(map[string]bool)
+	for _, item := range strings.Split(raw, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		claim, source, ok := strings.Cut(item, "=")
+		section, attribute, okSource := strings.Cut(strings.TrimSpace(source), ".")
+		claim = strings.TrimSpace(claim)
+		if !ok || !okSource || claim == "" || attribute == "" {
+			return nil, fmt.Errorf("invalid metadata claim %q, expected claim=section.attribute", item)
+		}
+		if section != users_db.MetadataSectionUser && section != users_db.MetadataSectionAdmin {
+			return nil, fmt.Errorf("invalid metadata claim %q: unknown section %q", item, section)
+		}
+		if reservedClaims[claim] {
+			return nil, fmt.Errorf("invalid metadata claim %q: claim %s is reserved", item, claim)
+		}
+		if seen[claim] {
+			return nil, fmt.Errorf("invalid metadata claim %q: claim %s is mapped twice", item, claim)
+		}
+		seen[claim] = true
+		mapping = append(mapping, ClaimMapping{Claim: claim, Section: section, Attribute: attribute})
+	}
+	return mapping, nil
+}
+
+// Claims Claims из атрибутов пользователя. Отсутствующие атрибуты пропускаются
+func (m ClaimsMapping) Claims(metadata users_db.Metadata) map[string]interface{} {
+	if len(m) == 0 {
+		return nil
+	}
+	claims := make(map[string]interface{}, len(m))
+	for _, mapping := range m {
+		if value, ok := metadata.Section(mapping.Section)[mapping.Attribute]; ok {
+			claims[mapping.Claim] = value
+		}
+	}
+	return claims
+}
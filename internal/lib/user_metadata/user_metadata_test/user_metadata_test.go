@@ -0,0 +1,138 @@
+package user_metadata_test
+
+import (
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/json_schema"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/jwt_tokens"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/user_metadata"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSchema = `{
+  "type": "object",
+  "properties": {
+    "user": {
+      "type": "object",
+      "properties": {
+        "nickname": {"type": "string", "minLength": 2, "maxLength": 20},
+        "birthday": {"type": "string", "format": "date"},
+        "languages": {"type": "array", "items": {"enum": ["ru", "en"]}, "uniqueItems": true}
+      },
+      "additionalProperties": false
+    },
+    "admin": {
+      "type": "object",
+      "properties": {
+        "department": {"type": "string"},
+        "level": {"type": "integer", "minimum": 1, "maximum": 5}
+      },
+      "required": ["department"]
+    }
+  }
+}`
+
+func TestValidator_Validate(t *testing.T) {
+	schema, err := json_schema.Compile([]byte(testSchema))
+	if err != nil {
+		t.Fatal("Compile is failed. Error: ", err)
+	}
+	validator := user_metadata.NewValidator(schema, 256)
+
+	tests := []struct {
+		TestName   string
+		Section    string
+		Values     map[string]interface{}
+		Violations []string // Пусто - секция подходит
+	}{
+		{TestName: "valid user section", Section: users_db.MetadataSectionUser,
+			Values: map[string]interface{}{"nickname": "neo", "birthday": "1999-03-31", "languages": []interface{}{"ru", "en"}}},
+		{TestName: "empty user section", Section: users_db.MetadataSectionUser, Values: map[string]interface{}{}},
+		{TestName: "unknown user attribute", Section: users_db.MetadataSectionUser,
+			Values: map[string]interface{}{"role": "admin"}, Violations: []string{"/role: property is not allowed"}},
+		{TestName: "invalid user attributes", Section: users_db.MetadataSectionUser,
+			Values:     map[string]interface{}{"nickname": "x", "birthday": "31.03.1999", "languages": []interface{}{"ru", "de", "ru"}},
+			Violations: []string{"/birthday: must be a valid date", "/languages: items must be unique", "/languages/1: must be one of", "/nickname: must be at least 2 characters"}},
+		{TestName: "valid admin section", Section: users_db.MetadataSectionAdmin,
+			Values: map[string]interface{}{"department": "sales", "level": 3, "cost_center": 42}},
+		{TestName: "admin section without required attribute", Section: users_db.MetadataSectionAdmin,
+			Values: map[string]interface{}{"level": 2.5}, Violations: []string{`/: property "department" is required`, "/level: must be integer"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.TestName, func(t *testing.T) {
+			err := validator.Validate(tt.Section, tt.Values)
+			if len(tt.Violations) == 0 {
+				if err != nil {
+					t.Errorf("Expected valid section, got %v", err)
+				}
+				return
+			}
+			var validationErr *json_schema.ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("Expected validation error, got %v", err)
+			}
+			if len(validationErr.Violations) != len(tt.Violations) {
+				t.Fatalf("Expected %d violations, got %v", len(tt.Violations), validationErr.Violations)
+			}
+			for i, violation := range tt.Violations {
+				if !strings.HasPrefix(validationErr.Violations[i], violation) {
+					t.Errorf("Expected violation %q, got %q", violation, validationErr.Violations[i])
+				}
+			}
+		})
+	}
+
+	large := map[string]interface{}{"department": strings.Repeat("a", 300)}
+	if err = validator.Validate(users_db.MetadataSectionAdmin, large); !errors.Is(err, user_metadata.ErrMetadataTooLarge) {
+		t.Errorf("Expected ErrMetadataTooLarge, got %v", err)
+	}
+}
+
+func TestCompile_RejectsUnsupportedKeywords(t *testing.T) {
+	for _, schema := range []string{
+		`{"type": "object", "patternProperties": {"^x": {"type": "string"}}}`,
+		`{"properties": {"a": {"$ref": "#/definitions/a"}}}`,
+		`{"type": "string", "format": "uri"}`,
+		`{"type": "decimal"}`,
+	} {
+		if _, err := json_schema.Compile([]byte(schema)); !errors.Is(err, json_schema.ErrInvalidSchema) {
+			t.Errorf("Expected ErrInvalidSchema for %s, got %v", schema, err)
+		}
+	}
+}
+
+func TestParseClaimsMapping(t *testing.T) {
+	mapping, err := user_metadata.ParseClaimsMapping("department=admin.department, nick=user.nickname")
+	if err != nil {
+		t.Fatal("ParseClaimsMapping is failed. Error: ", err)
+	}
+	for _, raw := range []string{"department", "department=admin", "x=secret.attr", "roles=admin.roles", "a=user.x,a=admin.y"} {
+		if _, err = user_metadata.ParseClaimsMapping(raw); err == nil {
+			t.Errorf("Expected error for %q", raw)
+		}
+	}
+
+	metadata := users_db.Metadata{
+		User:  map[string]interface{}{"nickname": "neo"},
+		Admin: map[string]interface{}{"department": "sales", "salary": 100},
+	}
+	token, err := jwt_tokens.CreateAccessTokenWithClaims(1, 1, strings.Repeat("s", 32), []string{"user"}, nil,
+		mapping.Claims(metadata), time.Minute, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal("CreateAccessTokenWithClaims is failed. Error: ", err)
+	}
+	claims, err := jwt_tokens.VerifyToken(token, strings.Repeat("s", 32))
+	if err != nil {
+		t.Fatal("VerifyToken is failed. Error: ", err)
+	}
+	if claims["department"] != "sales" || claims["nick"] != "neo" {
+		t.Errorf("Expected mapped claims in token, got %v", claims)
+	}
+	if _, ok := claims["salary"]; ok {
+		t.Errorf("Expected only mapped attributes in token, got %v", claims)
+	}
+}
@@ -0,0 +1,85 @@
+package audit
+
+import (
+	"context"
+	resp "github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/audit_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/models/audit"
+	"github.com/go-chi/chi/v5/middleware"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultLimit = 50
+	maxLimit     = 500
+)
+
+// ListEventsHandler godoc
+// @Summary Журнал действий администраторов
+// @Description Записи организации текущего токена, новые первыми
+// @Tags admin
+// @Security BearerAuth
+// @Param action query string false "Действие, например impersonate"
+// @Param user_id query int false "Пользователь как исполнитель или как цель"
+// @Param limit query int false "Количество записей, до 500" default(50)
+// @Success 200 {array} audit.EventResponse
+// @Failure 400 {object} response.Response
+// @Router /admin/audit [get]
+func ListEventsHandler(log *slog.Logger, auditRepo audit_db.AuditRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/audit/ListEventsHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		query := r.URL.Query()
+		filter := audit_db.EventFilter{Action: query.Get("action"), Limit: defaultLimit}
+		if raw := query.Get("user_id"); raw != "" {
+			userID, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error("Invalid user_id"))
+				return
+			}
+			filter.UserID = &userID
+		}
+		if raw := query.Get("limit"); raw != "" {
+			limit, err := strconv.Atoi(raw)
+			if err != nil || limit < 1 || limit > maxLimit {
+				resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error("limit must be between 1 and 500"))
+				return
+			}
+			filter.Limit = limit
+		}
+
+		events, err := auditRepo.ListEvents(ctx, filter)
+		if err != nil {
+			log.Error("Error while listing audit events", "err", err)
+			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("Failed to list audit events"))
+			return
+		}
+		response := make([]audit.EventResponse, 0, len(events))
+		for _, event := range events {
+			response = append(response, ToEventResponse(event))
+		}
+		resp.RenderResponse(w, r, http.StatusOK, response)
+	}
+}
+
+func ToEventResponse(event audit_db.Event) audit.EventResponse {
+	return audit.EventResponse{
+		ID:           event.ID,
+		ActorID:      event.ActorID,
+		Action:       event.Action,
+		TargetUserID: event.TargetUserID,
+		Reason:       event.Reason,
+		IP:           event.IP,
+		Details:      event.Details,
+		CreatedAt:    event.CreatedAt,
+	}
+}
@@ -0,0 +1,93 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/body"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/middlewares"
+	resp "github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/policy"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/services"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/models/authz"
+	"github.com/go-chi/chi/v5/middleware"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// CheckHandler godoc
+// @Summary Проверка доступа по политикам
+// @Description Отвечает, может ли субъект выполнить действие над ресурсом. С explain=true возвращает разбор каждого правила
+// @Tags authz
+// @Security BearerAuth
+// @Param input body authz.CheckRequest true "Субъект, действие, ресурс и контекст"
+// @Success 200 {object} authz.CheckResponse
+// @Failure 404 {object} response.Response
+// @Router /authz/check [post]
+func CheckHandler(log *slog.Logger, authzService *services.AuthzService, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/authz/CheckHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		var request authz.CheckRequest
+		if err := body.DecodeAndValidateJson(r, &request); err != nil {
+			log.Error("Error while decoding request body", "err", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+			return
+		}
+
+		var userID *int64
+		attributes := map[string]interface{}{}
+		if request.Subject != nil {
+			userID = request.Subject.UserID
+			attributes = request.Subject.Attributes
+		} else {
+			// Без субъекта проверяем самого вызывающего
+			claims, err := middlewares.ClaimsFromContext(r.Context())
+			if err != nil {
+				resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("Unauthorized"))
+				return
+			}
+			callerID, err := middlewares.UserIDFromContext(r.Context())
+			if err != nil {
+				resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("Unauthorized"))
+				return
+			}
+			userID = &callerID
+			attributes["claims"] = map[string]interface{}(claims)
+		}
+
+		decision, err := authzService.Check(ctx, userID, attributes, request.Action, policy.Resource{
+			Type:       request.Resource.Type,
+			ID:         request.Resource.ID,
+			Attributes: request.Resource.Attributes,
+		}, request.Context)
+		if err != nil {
+			if errors.Is(err, users_db.ErrUserNotFound) {
+				resp.RenderResponse(w, r, http.StatusNotFound, resp.Error("Subject user not found"))
+				return
+			}
+			log.Error("Error while evaluating policy", "err", err)
+			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("Failed to evaluate policy"))
+			return
+		}
+		log.Debug("Policy decision", "action", request.Action, "resource", request.Resource.Type,
+			"allowed", decision.Allowed, "rule_id", decision.RuleID)
+
+		response := authz.CheckResponse{
+			Allowed:  decision.Allowed,
+			Decision: decision.Effect,
+			RuleID:   decision.RuleID,
+		}
+		if request.Explain {
+			response.Evaluations = decision.Evaluations
+		}
+		resp.RenderResponse(w, r, http.StatusOK, response)
+	}
+}
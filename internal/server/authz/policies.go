@@ -0,0 +1,116 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/body"
+	resp "github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/policy"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/policy_db"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// ListPoliciesHandler godoc
+// @Summary Действующие правила доступа
+// @Tags authz
+// @Security BearerAuth
+// @Success 200 {array} policy.Rule
+// @Router /admin/policies [get]
+func ListPoliciesHandler(engine *policy.Engine) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rules := engine.Rules()
+		if rules == nil {
+			rules = []policy.Rule{}
+		}
+		resp.RenderResponse(w, r, http.StatusOK, rules)
+	}
+}
+
+// UpsertPolicyHandler godoc
+// @Summary Создать или заменить правило доступа
+// @Description Доступно, когда правила хранятся в БД. Правило начинает действовать сразу
+// @Tags authz
+// @Security BearerAuth
+// @Param id path string true "ID правила"
+// @Param input body policy.Rule true "Правило"
+// @Success 204
+// @Failure 400 {object} response.Response
+// @Router /admin/policies/{id} [put]
+func UpsertPolicyHandler(log *slog.Logger, policyRepo policy_db.PolicyRepository, engine *policy.Engine, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/authz/UpsertPolicyHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		var rule policy.Rule
+		if err := body.DecodeAndValidateJson(r, &rule); err != nil {
+			log.Error("Error while decoding request body", "err", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+			return
+		}
+		rule.ID = chi.URLParam(r, "id")
+		if err := rule.Validate(); err != nil {
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+			return
+		}
+
+		if err := policyRepo.UpsertRule(ctx, rule); err != nil {
+			log.Error("Error while saving policy rule", "err", err)
+			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("Failed to save policy rule"))
+			return
+		}
+		reloadRules(ctx, log, engine)
+		log.Info("Policy rule saved", "rule_id", rule.ID)
+		render.NoContent(w, r)
+	}
+}
+
+// DeletePolicyHandler godoc
+// @Summary Удалить правило доступа
+// @Tags authz
+// @Security BearerAuth
+// @Param id path string true "ID правила"
+// @Success 204
+// @Failure 404 {object} response.Response
+// @Router /admin/policies/{id} [delete]
+func DeletePolicyHandler(log *slog.Logger, policyRepo policy_db.PolicyRepository, engine *policy.Engine, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/authz/DeletePolicyHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		ruleID := chi.URLParam(r, "id")
+		if err := policyRepo.DeleteRule(ctx, ruleID); err != nil {
+			if errors.Is(err, policy_db.ErrRuleNotFound) {
+				resp.RenderResponse(w, r, http.StatusNotFound, resp.Error(err.Error()))
+				return
+			}
+			log.Error("Error while deleting policy rule", "err", err)
+			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("Failed to delete policy rule"))
+			return
+		}
+		reloadRules(ctx, log, engine)
+		log.Info("Policy rule deleted", "rule_id", ruleID)
+		render.NoContent(w, r)
+	}
+}
+
+// reloadRules Изменение уже сохранено, поэтому ошибка перезагрузки не ломает ответ: правила подтянутся при следующей плановой перезагрузке
+func reloadRules(ctx context.Context, log *slog.Logger, engine *policy.Engine) {
+	if err := engine.Reload(ctx); err != nil {
+		log.Error("Error while reloading policy rules", "err", err)
+	}
+}
@@ -0,0 +1,164 @@
+package groups
+
+import (
+	"context"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/body"
+	resp "github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/groups_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/models/users/roles"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// GrantRoleHandler godoc
+// @Summary Выдать роль группе
+// @Description Роль получат все участники группы
+// @Tags admin
+// @Security BearerAuth
+// @Param id path int true "ID группы"
+// @Param input body roles.GrantRoleRequest true "Роль"
+// @Success 204
+// @Failure 404 {object} response.Response
+// @Router /admin/groups/{id}/roles [post]
+func GrantRoleHandler(log *slog.Logger, groupsRepo groups_db.GroupsRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/groups/GrantRoleHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		id, ok := groupIDParam(w, r, log)
+		if !ok {
+			return
+		}
+		var request roles.GrantRoleRequest
+		if err := body.DecodeAndValidateJson(r, &request); err != nil {
+			log.Error("Error while decoding request body", "err", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+			return
+		}
+
+		if err := groupsRepo.GrantRole(ctx, id, request.Role); err != nil {
+			renderGroupError(w, r, log, err)
+			return
+		}
+		log.Info("Role granted to group", "group_id", id, "role", request.Role)
+		render.NoContent(w, r)
+	}
+}
+
+// RevokeRoleHandler godoc
+// @Summary Забрать роль у группы
+// @Tags admin
+// @Security BearerAuth
+// @Param id path int true "ID группы"
+// @Param role path string true "Название роли"
+// @Success 204
+// @Failure 404 {object} response.Response
+// @Failure 409 {object} response.Response "Последний администратор организации"
+// @Router /admin/groups/{id}/roles/{role} [delete]
+func RevokeRoleHandler(log *slog.Logger, groupsRepo groups_db.GroupsRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/groups/RevokeRoleHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		id, ok := groupIDParam(w, r, log)
+		if !ok {
+			return
+		}
+		roleName := chi.URLParam(r, "role")
+
+		if err := groupsRepo.RevokeRole(ctx, id, roleName); err != nil {
+			renderGroupError(w, r, log, err)
+			return
+		}
+		log.Info("Role revoked from group", "group_id", id, "role", roleName)
+		render.NoContent(w, r)
+	}
+}
+
+// GrantPermissionHandler godoc
+// @Summary Выдать право группе
+// @Description Право выдаётся группе напрямую, без отдельной роли
+// @Tags admin
+// @Security BearerAuth
+// @Param id path int true "ID группы"
+// @Param input body roles.GrantPermissionRequest true "Право"
+// @Success 204
+// @Failure 404 {object} response.Response
+// @Router /admin/groups/{id}/permissions [post]
+func GrantPermissionHandler(log *slog.Logger, groupsRepo groups_db.GroupsRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/groups/GrantPermissionHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		id, ok := groupIDParam(w, r, log)
+		if !ok {
+			return
+		}
+		var request roles.GrantPermissionRequest
+		if err := body.DecodeAndValidateJson(r, &request); err != nil {
+			log.Error("Error while decoding request body", "err", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+			return
+		}
+
+		if err := groupsRepo.GrantPermission(ctx, id, request.Permission); err != nil {
+			renderGroupError(w, r, log, err)
+			return
+		}
+		log.Info("Permission granted to group", "group_id", id, "permission", request.Permission)
+		render.NoContent(w, r)
+	}
+}
+
+// RevokePermissionHandler godoc
+// @Summary Убрать право у группы
+// @Tags admin
+// @Security BearerAuth
+// @Param id path int true "ID группы"
+// @Param permission path string true "Право"
+// @Success 204
+// @Failure 404 {object} response.Response
+// @Router /admin/groups/{id}/permissions/{permission} [delete]
+func RevokePermissionHandler(log *slog.Logger, groupsRepo groups_db.GroupsRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/groups/RevokePermissionHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		id, ok := groupIDParam(w, r, log)
+		if !ok {
+			return
+		}
+		permission := chi.URLParam(r, "permission")
+
+		if err := groupsRepo.RevokePermission(ctx, id, permission); err != nil {
+			renderGroupError(w, r, log, err)
+			return
+		}
+		log.Info("Permission revoked from group", "group_id", id, "permission", permission)
+		render.NoContent(w, r)
+	}
+}
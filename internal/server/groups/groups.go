@@ -0,0 +1,226 @@
+package groups
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/body"
+	resp "github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/groups_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/roles_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/models/groups"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ListGroupsHandler godoc
+// @Summary Список групп
+// @Description Группы организации текущего токена
+// @Tags admin
+// @Security BearerAuth
+// @Success 200 {array} groups.GroupResponse
+// @Router /admin/groups [get]
+func ListGroupsHandler(log *slog.Logger, groupsRepo groups_db.GroupsRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/groups/ListGroupsHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		list, err := groupsRepo.ListGroups(ctx)
+		if err != nil {
+			renderGroupError(w, r, log, err)
+			return
+		}
+		response := make([]groups.GroupResponse, 0, len(list))
+		for _, group := range list {
+			response = append(response, toGroupResponse(group))
+		}
+		resp.RenderResponse(w, r, http.StatusOK, response)
+	}
+}
+
+// GetGroupHandler godoc
+// @Summary Группа
+// @Tags admin
+// @Security BearerAuth
+// @Param id path int true "ID группы"
+// @Success 200 {object} groups.GroupResponse
+// @Failure 404 {object} response.Response
+// @Router /admin/groups/{id} [get]
+func GetGroupHandler(log *slog.Logger, groupsRepo groups_db.GroupsRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/groups/GetGroupHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		id, ok := groupIDParam(w, r, log)
+		if !ok {
+			return
+		}
+		group, err := groupsRepo.GetGroup(ctx, id)
+		if err != nil {
+			renderGroupError(w, r, log, err)
+			return
+		}
+		resp.RenderResponse(w, r, http.StatusOK, toGroupResponse(group))
+	}
+}
+
+// CreateGroupHandler godoc
+// @Summary Создать группу
+// @Tags admin
+// @Security BearerAuth
+// @Param input body groups.CreateGroupRequest true "Группа"
+// @Success 201 {object} groups.GroupResponse
+// @Failure 409 {object} response.Response
+// @Router /admin/groups [post]
+func CreateGroupHandler(log *slog.Logger, groupsRepo groups_db.GroupsRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/groups/CreateGroupHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		var request groups.CreateGroupRequest
+		if err := body.DecodeAndValidateJson(r, &request); err != nil {
+			log.Error("Error while decoding request body", "err", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+			return
+		}
+
+		group, err := groupsRepo.CreateGroup(ctx, request.Name, request.Description)
+		if err != nil {
+			renderGroupError(w, r, log, err)
+			return
+		}
+		log.Info("Group created", slog.Int64("group_id", group.ID), slog.String("name", group.Name))
+		resp.RenderResponse(w, r, http.StatusCreated, toGroupResponse(group))
+	}
+}
+
+// UpdateGroupHandler godoc
+// @Summary Изменить группу
+// @Description Меняет только переданные поля
+// @Tags admin
+// @Security BearerAuth
+// @Param id path int true "ID группы"
+// @Param input body groups.UpdateGroupRequest true "Изменения"
+// @Success 200 {object} groups.GroupResponse
+// @Failure 404 {object} response.Response
+// @Failure 409 {object} response.Response
+// @Router /admin/groups/{id} [patch]
+func UpdateGroupHandler(log *slog.Logger, groupsRepo groups_db.GroupsRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/groups/UpdateGroupHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		id, ok := groupIDParam(w, r, log)
+		if !ok {
+			return
+		}
+		var request groups.UpdateGroupRequest
+		if err := body.DecodeAndValidateJson(r, &request); err != nil {
+			log.Error("Error while decoding request body", "err", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+			return
+		}
+
+		group, err := groupsRepo.UpdateGroup(ctx, id, groups_db.GroupUpdate{Name: request.Name, Description: request.Description})
+		if err != nil {
+			renderGroupError(w, r, log, err)
+			return
+		}
+		log.Info("Group updated", slog.Int64("group_id", id))
+		resp.RenderResponse(w, r, http.StatusOK, toGroupResponse(group))
+	}
+}
+
+// DeleteGroupHandler godoc
+// @Summary Удалить группу
+// @Description Участники теряют роли и права, полученные через группу, при следующем обновлении токена
+// @Tags admin
+// @Security BearerAuth
+// @Param id path int true "ID группы"
+// @Success 204
+// @Failure 404 {object} response.Response
+// @Failure 409 {object} response.Response "Последний администратор организации"
+// @Router /admin/groups/{id} [delete]
+func DeleteGroupHandler(log *slog.Logger, groupsRepo groups_db.GroupsRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/groups/DeleteGroupHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		id, ok := groupIDParam(w, r, log)
+		if !ok {
+			return
+		}
+		if err := groupsRepo.DeleteGroup(ctx, id); err != nil {
+			renderGroupError(w, r, log, err)
+			return
+		}
+		log.Info("Group deleted", slog.Int64("group_id", id))
+		render.NoContent(w, r)
+	}
+}
+
+// groupIDParam Разбирает id группы из пути. При ошибке сам отвечает 400
+func groupIDParam(w http.ResponseWriter, r *http.Request, log *slog.Logger) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		log.Error("Group ID is invalid", "error", err)
+		resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error("Invalid group ID"))
+		return 0, false
+	}
+	return id, true
+}
+
+func toGroupResponse(group groups_db.Group) groups.GroupResponse {
+	return groups.GroupResponse{
+		ID:           group.ID,
+		Name:         group.Name,
+		Description:  group.Description,
+		Roles:        group.Roles,
+		Permissions:  group.Permissions,
+		MembersCount: group.MembersCount,
+		CreatedAt:    group.CreatedAt,
+	}
+}
+
+func renderGroupError(w http.ResponseWriter, r *http.Request, log *slog.Logger, err error) {
+	switch {
+	case errors.Is(err, groups_db.ErrGroupNotFound), errors.Is(err, groups_db.ErrNotGroupMember), errors.Is(err, groups_db.ErrNotGranted),
+		errors.Is(err, roles_db.ErrRoleNotFound), errors.Is(err, roles_db.ErrPermissionNotFound), errors.Is(err, users_db.ErrUserNotFound):
+		resp.RenderResponse(w, r, http.StatusNotFound, resp.Error(err.Error()))
+	case errors.Is(err, groups_db.ErrGroupAlreadyExists), errors.Is(err, users_db.ErrLastAdmin):
+		resp.RenderResponse(w, r, http.StatusConflict, resp.Error(err.Error()))
+	default:
+		log.Error("Error while changing groups", "err", err)
+		resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("Failed to change groups"))
+	}
+}
@@ -0,0 +1,137 @@
+package groups
+
+import (
+	"context"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/body"
+	resp "github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/groups_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/models/groups"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ListMembersHandler godoc
+// @Summary Участники группы
+// @Tags admin
+// @Security BearerAuth
+// @Param id path int true "ID группы"
+// @Success 200 {array} groups.GroupMemberResponse
+// @Failure 404 {object} response.Response
+// @Router /admin/groups/{id}/members [get]
+func ListMembersHandler(log *slog.Logger, groupsRepo groups_db.GroupsRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/groups/ListMembersHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		id, ok := groupIDParam(w, r, log)
+		if !ok {
+			return
+		}
+		members, err := groupsRepo.ListMembers(ctx, id)
+		if err != nil {
+			renderGroupError(w, r, log, err)
+			return
+		}
+		response := make([]groups.GroupMemberResponse, 0, len(members))
+		for _, member := range members {
+			response = append(response, groups.GroupMemberResponse{
+				UserID:    member.UserID,
+				Email:     member.Email,
+				FirstName: member.FirstName,
+				LastName:  member.LastName,
+				AddedAt:   member.AddedAt,
+			})
+		}
+		resp.RenderResponse(w, r, http.StatusOK, response)
+	}
+}
+
+// AddMemberHandler godoc
+// @Summary Добавить пользователя в группу
+// @Description Пользователь должен состоять в организации. Роли группы попадут в токен при следующем входе или обновлении токена
+// @Tags admin
+// @Security BearerAuth
+// @Param id path int true "ID группы"
+// @Param input body groups.AddGroupMemberRequest true "Пользователь"
+// @Success 204
+// @Failure 404 {object} response.Response
+// @Router /admin/groups/{id}/members [post]
+func AddMemberHandler(log *slog.Logger, groupsRepo groups_db.GroupsRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/groups/AddMemberHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		id, ok := groupIDParam(w, r, log)
+		if !ok {
+			return
+		}
+		var request groups.AddGroupMemberRequest
+		if err := body.DecodeAndValidateJson(r, &request); err != nil {
+			log.Error("Error while decoding request body", "err", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+			return
+		}
+
+		if err := groupsRepo.AddMember(ctx, id, request.UserID); err != nil {
+			renderGroupError(w, r, log, err)
+			return
+		}
+		log.Info("Group member added", slog.Int64("group_id", id), slog.Int64("user_id", request.UserID))
+		render.NoContent(w, r)
+	}
+}
+
+// RemoveMemberHandler godoc
+// @Summary Исключить пользователя из группы
+// @Tags admin
+// @Security BearerAuth
+// @Param id path int true "ID группы"
+// @Param user_id path int true "ID пользователя"
+// @Success 204
+// @Failure 404 {object} response.Response
+// @Failure 409 {object} response.Response "Последний администратор организации"
+// @Router /admin/groups/{id}/members/{user_id} [delete]
+func RemoveMemberHandler(log *slog.Logger, groupsRepo groups_db.GroupsRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/groups/RemoveMemberHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		id, ok := groupIDParam(w, r, log)
+		if !ok {
+			return
+		}
+		userID, err := strconv.ParseInt(chi.URLParam(r, "user_id"), 10, 64)
+		if err != nil {
+			log.Error("User ID is invalid", "error", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error("Invalid user ID"))
+			return
+		}
+
+		if err = groupsRepo.RemoveMember(ctx, id, userID); err != nil {
+			renderGroupError(w, r, log, err)
+			return
+		}
+		log.Info("Group member removed", slog.Int64("group_id", id), slog.Int64("user_id", userID))
+		render.NoContent(w, r)
+	}
+}
@@ -0,0 +1,122 @@
+package invitations
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/body"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/middlewares"
+	resp "github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/services"
+	users "github.com/ShlykovPavel/auth-JWT-microservice/internal/server/users"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/invitations_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/orgs_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/models/invitations"
+	"github.com/go-chi/chi/v5/middleware"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// AcceptInvitationHandler godoc
+// @Summary Принять приглашение
+// @Description Создаёт пользователя с email и ролями из приглашения и выдаёт пару токенов в организацию приглашения. Работает и при выключенной публичной регистрации.
+// @Description Если email уже зарегистрирован - 409, такой пользователь принимает приглашение через /invitations/join
+// @Tags Users
+// @Param input body invitations.AcceptInvitationRequest true "Токен из ссылки, имя и пароль"
+// @Success 201 {object} tokens.RefreshTokensDto
+// @Failure 400 {object} password.PasswordPolicyErrorResponse
+// @Failure 404 {object} response.Response
+// @Failure 409 {object} response.Response
+// @Router /invitations/accept [post]
+func AcceptInvitationHandler(log *slog.Logger, timeout time.Duration, invitationService *services.InvitationService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/invitations/AcceptInvitationHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		var request invitations.AcceptInvitationRequest
+		if err := body.DecodeAndValidateJson(r, &request); err != nil {
+			log.Error("Error while decoding request body", "err", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+			return
+		}
+
+		authTokens, err := invitationService.Accept(ctx, request.Token, request.FirstName, request.LastName, request.Password)
+		if err != nil {
+			if users.RenderPasswordPolicyError(w, r, err) {
+				log.Debug("Password does not satisfy password policy", "err", err)
+				return
+			}
+			switch {
+			case errors.Is(err, invitations_db.ErrInvitationNotFound):
+				resp.RenderResponse(w, r, http.StatusNotFound, resp.Error(err.Error()))
+			case errors.Is(err, users_db.ErrEmailAlreadyExists):
+				resp.RenderResponse(w, r, http.StatusConflict, resp.Error("User with this email is already registered, sign in and join the organization instead"))
+			default:
+				log.Error("Error while accepting invitation", "err", err)
+				resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("Failed to accept invitation"))
+			}
+			return
+		}
+		resp.RenderResponse(w, r, http.StatusCreated, authTokens)
+	}
+}
+
+// JoinInvitationHandler godoc
+// @Summary Вступить в организацию по приглашению
+// @Description Добавляет текущего пользователя в организацию приглашения с ролями из приглашения и выдаёт пару токенов в неё.
+// @Description Приглашение должно быть выписано на email пользователя
+// @Tags orgs
+// @Security BearerAuth
+// @Param input body invitations.JoinInvitationRequest true "Токен из ссылки"
+// @Success 200 {object} tokens.RefreshTokensDto
+// @Failure 403 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Failure 409 {object} response.Response "Пользователь уже состоит в организации"
+// @Router /invitations/join [post]
+func JoinInvitationHandler(log *slog.Logger, timeout time.Duration, invitationService *services.InvitationService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/invitations/JoinInvitationHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		userID, err := middlewares.UserIDFromContext(r.Context())
+		if err != nil {
+			log.Error("Error while getting user id from token", "err", err)
+			resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("Unauthorized"))
+			return
+		}
+		var request invitations.JoinInvitationRequest
+		if err = body.DecodeAndValidateJson(r, &request); err != nil {
+			log.Error("Error while decoding request body", "err", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+			return
+		}
+
+		authTokens, err := invitationService.Join(ctx, request.Token, userID)
+		if err != nil {
+			switch {
+			case errors.Is(err, invitations_db.ErrInvitationNotFound):
+				resp.RenderResponse(w, r, http.StatusNotFound, resp.Error(err.Error()))
+			case errors.Is(err, orgs_db.ErrAlreadyMember):
+				resp.RenderResponse(w, r, http.StatusConflict, resp.Error(err.Error()))
+			case errors.Is(err, services.ErrAccountSuspended), errors.Is(err, services.ErrAccountDeactivated):
+				resp.RenderResponse(w, r, http.StatusForbidden, resp.Error(err.Error()))
+			default:
+				log.Error("Error while joining by invitation", "err", err)
+				resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("Failed to accept invitation"))
+			}
+			return
+		}
+		resp.RenderResponse(w, r, http.StatusOK, authTokens)
+	}
+}
@@ -0,0 +1,176 @@
+package invitations
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/body"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/middlewares"
+	resp "github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/permissions"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/services"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/tenant"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/invitations_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/orgs_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/roles_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/models/invitations"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// CreateInvitationHandler godoc
+// @Summary Пригласить пользователя
+// @Description Отправляет на email ссылку для вступления в организацию текущего токена: новый пользователь по ней регистрируется,
+// @Description зарегистрированный вступает сам после входа. Роли сверх user можно выдать только с правом roles:write
+// @Tags admin
+// @Security BearerAuth
+// @Param input body invitations.CreateInvitationRequest true "Приглашение"
+// @Success 201 {object} invitations.InvitationResponse
+// @Failure 400 {object} response.Response
+// @Failure 403 {object} response.Response
+// @Failure 409 {object} response.Response "Пользователь уже состоит в организации"
+// @Router /admin/invitations [post]
+func CreateInvitationHandler(log *slog.Logger, invitationService *services.InvitationService, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/invitations/CreateInvitationHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		claims, err := middlewares.ClaimsFromContext(r.Context())
+		if err != nil {
+			log.Error("Failed to retrieve claims from context")
+			resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("Unauthorized"))
+			return
+		}
+		userID, err := middlewares.UserIDFromContext(r.Context())
+		if err != nil {
+			log.Error("Failed to retrieve user id from context", "err", err)
+			resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("Unauthorized"))
+			return
+		}
+
+		var request invitations.CreateInvitationRequest
+		if err = body.DecodeAndValidateJson(r, &request); err != nil {
+			log.Error("Error while decoding request body", "err", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+			return
+		}
+		// Иначе через приглашение можно было бы выдать роли в обход ручек управления ролями
+		if len(request.Roles) > 0 && !slices.Contains(middlewares.PermissionsFromClaims(claims), permissions.RolesWrite) {
+			log.Debug("Roles in invitation require roles:write")
+			resp.RenderResponse(w, r, http.StatusForbidden, resp.Error("Granting roles requires the roles:write permission"))
+			return
+		}
+
+		orgID := tenant.OrgIDOrDefault(r.Context())
+		invitation, err := invitationService.Invite(ctx, orgID, userID, request.Email, request.Roles, request.ExpiresAt)
+		if err != nil {
+			renderInvitationError(w, r, log, err)
+			return
+		}
+		log.Info("Invitation created", slog.Int64("invitation_id", invitation.ID), slog.Int64("org_id", orgID))
+		resp.RenderResponse(w, r, http.StatusCreated, toInvitationResponse(invitation, time.Now()))
+	}
+}
+
+// ListInvitationsHandler godoc
+// @Summary Список приглашений
+// @Description Приглашения организации текущего токена, сначала новые
+// @Tags admin
+// @Security BearerAuth
+// @Success 200 {array} invitations.InvitationResponse
+// @Router /admin/invitations [get]
+func ListInvitationsHandler(log *slog.Logger, invitationsRepo invitations_db.InvitationsRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/invitations/ListInvitationsHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		list, err := invitationsRepo.ListInvitations(ctx, tenant.OrgIDOrDefault(r.Context()))
+		if err != nil {
+			renderInvitationError(w, r, log, err)
+			return
+		}
+		now := time.Now()
+		response := make([]invitations.InvitationResponse, 0, len(list))
+		for _, invitation := range list {
+			response = append(response, toInvitationResponse(invitation, now))
+		}
+		resp.RenderResponse(w, r, http.StatusOK, response)
+	}
+}
+
+// RevokeInvitationHandler godoc
+// @Summary Отозвать приглашение
+// @Description Ссылка из отозванного приглашения перестаёт работать
+// @Tags admin
+// @Security BearerAuth
+// @Param id path int true "ID приглашения"
+// @Success 204
+// @Failure 404 {object} response.Response
+// @Router /admin/invitations/{id} [delete]
+func RevokeInvitationHandler(log *slog.Logger, invitationsRepo invitations_db.InvitationsRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/invitations/RevokeInvitationHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			log.Error("Invitation ID is invalid", "error", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error("Invalid invitation ID"))
+			return
+		}
+
+		if err = invitationsRepo.RevokeInvitation(ctx, tenant.OrgIDOrDefault(r.Context()), id); err != nil {
+			renderInvitationError(w, r, log, err)
+			return
+		}
+		log.Info("Invitation revoked", slog.Int64("invitation_id", id))
+		render.NoContent(w, r)
+	}
+}
+
+func toInvitationResponse(invitation invitations_db.Invitation, now time.Time) invitations.InvitationResponse {
+	return invitations.InvitationResponse{
+		ID:         invitation.ID,
+		Email:      invitation.Email,
+		Roles:      invitation.Roles,
+		InvitedBy:  invitation.InvitedBy,
+		Status:     invitation.Status(now),
+		ExpiresAt:  invitation.ExpiresAt,
+		AcceptedAt: invitation.AcceptedAt,
+		CreatedAt:  invitation.CreatedAt,
+	}
+}
+
+func renderInvitationError(w http.ResponseWriter, r *http.Request, log *slog.Logger, err error) {
+	switch {
+	case errors.Is(err, invitations_db.ErrInvitationNotFound):
+		resp.RenderResponse(w, r, http.StatusNotFound, resp.Error(err.Error()))
+	case errors.Is(err, roles_db.ErrRoleNotFound), errors.Is(err, services.ErrInvalidExpiry):
+		resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+	case errors.Is(err, orgs_db.ErrAlreadyMember):
+		resp.RenderResponse(w, r, http.StatusConflict, resp.Error(err.Error()))
+	default:
+		log.Error("Error while processing invitation", "err", err)
+		resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("Failed to process invitation"))
+	}
+}
@@ -0,0 +1,105 @@
+package orgs
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/body"
+	resp "github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/tenant"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/orgs_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/models/orgs"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// CreateOrganizationHandler godoc
+// @Summary Создать организацию
+// @Description Доступно только из организации по умолчанию. Владелец становится администратором новой организации
+// @Tags admin
+// @Security BearerAuth
+// @Param input body orgs.CreateOrganizationRequest true "Организация"
+// @Success 201 {object} orgs.OrganizationResponse
+// @Failure 404 {object} response.Response
+// @Failure 409 {object} response.Response
+// @Router /admin/orgs [post]
+func CreateOrganizationHandler(log *slog.Logger, orgsRepo orgs_db.OrgsRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/orgs/CreateOrganizationHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		var request orgs.CreateOrganizationRequest
+		if err := body.DecodeAndValidateJson(r, &request); err != nil {
+			log.Error("Error while decoding request body", "err", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+			return
+		}
+
+		org, err := orgsRepo.CreateOrganization(ctx, request.Slug, request.Name, request.OwnerID)
+		if err != nil {
+			renderOrgError(w, r, log, err)
+			return
+		}
+		log.Info("Organization created", slog.Int64("org_id", org.ID), slog.Int64("owner_id", request.OwnerID))
+		resp.RenderResponse(w, r, http.StatusCreated, toOrganizationResponse(org))
+	}
+}
+
+// RemoveMemberHandler godoc
+// @Summary Исключить пользователя из организации
+// @Description Пользователь теряет роли и сессии в организации текущего токена. Последнего администратора исключить нельзя
+// @Tags admin
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Success 204
+// @Failure 404 {object} response.Response
+// @Failure 409 {object} response.Response
+// @Router /admin/members/{id} [delete]
+func RemoveMemberHandler(log *slog.Logger, orgsRepo orgs_db.OrgsRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/orgs/RemoveMemberHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			log.Error("User ID is invalid", "error", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error("Invalid user ID"))
+			return
+		}
+
+		orgID := tenant.OrgIDOrDefault(r.Context())
+		if err = orgsRepo.RemoveMember(ctx, orgID, id); err != nil {
+			renderOrgError(w, r, log, err)
+			return
+		}
+		log.Info("Member removed", slog.Int64("org_id", orgID), slog.Int64("user_id", id))
+		render.NoContent(w, r)
+	}
+}
+
+func renderOrgError(w http.ResponseWriter, r *http.Request, log *slog.Logger, err error) {
+	switch {
+	case errors.Is(err, users_db.ErrUserNotFound), errors.Is(err, orgs_db.ErrNotMember):
+		resp.RenderResponse(w, r, http.StatusNotFound, resp.Error(err.Error()))
+	case errors.Is(err, orgs_db.ErrOrgAlreadyExists), errors.Is(err, orgs_db.ErrAlreadyMember), errors.Is(err, users_db.ErrLastAdmin):
+		resp.RenderResponse(w, r, http.StatusConflict, resp.Error(err.Error()))
+	default:
+		log.Error("Error while changing organization", "err", err)
+		resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("Failed to change organization"))
+	}
+}
@@ -0,0 +1,117 @@
+package orgs
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/body"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/middlewares"
+	resp "github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/services"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/tenant"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/orgs_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/models/orgs"
+	"github.com/ShlykovPavel/auth-JWT-microservice/models/tokens"
+	"github.com/go-chi/chi/v5/middleware"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// ListMyOrganizationsHandler godoc
+// @Summary Мои организации
+// @Description Организации, в которых состоит текущий пользователь. current - организация текущего токена
+// @Tags orgs
+// @Security BearerAuth
+// @Success 200 {array} orgs.OrganizationResponse
+// @Router /orgs [get]
+func ListMyOrganizationsHandler(log *slog.Logger, orgsRepo orgs_db.OrgsRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/orgs/ListMyOrganizationsHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		userID, err := middlewares.UserIDFromContext(r.Context())
+		if err != nil {
+			log.Error("Error while getting user id from token", "err", err)
+			resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("Unauthorized"))
+			return
+		}
+		list, err := orgsRepo.ListUserOrganizations(ctx, userID)
+		if err != nil {
+			log.Error("Error while listing organizations", "err", err)
+			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("Failed to list organizations"))
+			return
+		}
+		currentOrgID, _ := tenant.OrgIDFromContext(r.Context())
+		response := make([]orgs.OrganizationResponse, 0, len(list))
+		for _, org := range list {
+			item := toOrganizationResponse(org)
+			item.Current = org.ID == currentOrgID
+			response = append(response, item)
+		}
+		resp.RenderResponse(w, r, http.StatusOK, response)
+	}
+}
+
+// SwitchOrganizationHandler godoc
+// @Summary Перейти в другую организацию
+// @Description Выдаёт новую пару токенов с ролями пользователя в выбранной организации. Токены текущей организации продолжают действовать
+// @Tags orgs
+// @Security BearerAuth
+// @Param input body orgs.SwitchOrganizationRequest true "Организация"
+// @Success 200 {object} tokens.RefreshTokensDto
+// @Failure 403 {object} response.Response
+// @Router /orgs/switch [post]
+func SwitchOrganizationHandler(log *slog.Logger, authService *services.AuthService, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/orgs/SwitchOrganizationHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		userID, err := middlewares.UserIDFromContext(r.Context())
+		if err != nil {
+			log.Error("Error while getting user id from token", "err", err)
+			resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("Unauthorized"))
+			return
+		}
+		var request orgs.SwitchOrganizationRequest
+		if err = body.DecodeAndValidateJson(r, &request); err != nil {
+			log.Error("Error while decoding request body", "err", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+			return
+		}
+
+		authTokens, err := authService.SwitchOrganization(ctx, userID, request.OrgID)
+		if err != nil {
+			if errors.Is(err, services.ErrNotOrgMember) || errors.Is(err, services.ErrAccountSuspended) || errors.Is(err, services.ErrAccountDeactivated) {
+				resp.RenderResponse(w, r, http.StatusForbidden, resp.Error(err.Error()))
+				return
+			}
+			log.Error("Error while switching organization", "err", err)
+			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("Failed to switch organization"))
+			return
+		}
+		log.Info("Organization switched", slog.Int64("user_id", userID), slog.Int64("org_id", request.OrgID))
+		resp.RenderResponse(w, r, http.StatusOK, tokens.RefreshTokensDto{
+			AccessToken:  authTokens.AccessToken,
+			RefreshToken: authTokens.RefreshToken,
+		})
+	}
+}
+
+func toOrganizationResponse(org orgs_db.Organization) orgs.OrganizationResponse {
+	return orgs.OrganizationResponse{
+		ID:        org.ID,
+		Slug:      org.Slug,
+		Name:      org.Name,
+		CreatedAt: org.CreatedAt,
+	}
+}
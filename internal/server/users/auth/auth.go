@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/body"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/request"
 	resp "github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/response"
 	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/services"
 	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
@@ -11,7 +12,9 @@ import (
 	"github.com/ShlykovPavel/auth-JWT-microservice/models/users/get_user"
 	"github.com/go-chi/chi/v5/middleware"
 	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 )
 
@@ -19,10 +22,13 @@ var ErrIncorrectCredentials = errors.New("invalid email or password")
 
 // AuthenticationHandler godoc
 // @Summary Логин
-// @Description Логинит пользователя. Выдаёт access и refresh токены
+// @Description Логинит пользователя по email или имени пользователя (без учёта регистра). Выдаёт access и refresh токены
 // @Tags Users
 // @Param input body get_user.AuthUser true "Данные пользователя"
 // @Success 200 {object} tokens.RefreshTokensDto
+// @Failure 401 {object} response.Response
+// @Failure 403 {object} response.Response
+// @Failure 429 {object} response.Response
 // @Router /login [post]
 func AuthenticationHandler(log *slog.Logger, timeout time.Duration, authService *services.AuthService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -45,8 +51,13 @@ func AuthenticationHandler(log *slog.Logger, timeout time.Duration, authService
 		}
 
 		//TODO Посмотреть что можно сделать с телом ответа при валидации полей (приходит 2 json)
-		authTokens, err := authService.Authentication(&user, ctx)
+		authTokens, err := authService.Authentication(&user, request.ClientIP(r), ctx)
 		if err != nil {
+			// Ответ одинаковый для существующих и несуществующих email
+			if RenderLockedError(w, r, err) {
+				log.Debug("Login is temporarily locked", "err", err)
+				return
+			}
 			if errors.Is(err, users_db.ErrUserNotFound) {
 				log.Debug("User not found", "user", user)
 				resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error(ErrIncorrectCredentials.Error()))
@@ -54,6 +65,10 @@ func AuthenticationHandler(log *slog.Logger, timeout time.Duration, authService
 			} else if errors.Is(err, services.ErrWrongPassword) {
 				log.Debug("Password is incorrect", "user", user)
 				resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error(ErrIncorrectCredentials.Error()))
+				return
+			} else if errors.Is(err, services.ErrNoOrganization) || errors.Is(err, services.ErrAccountSuspended) || errors.Is(err, services.ErrAccountDeactivated) {
+				resp.RenderResponse(w, r, http.StatusForbidden, resp.Error(err.Error()))
+				return
 			}
 			log.Error("Error while Authentification user: ", "err", err)
 			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error(err.Error()))
@@ -67,3 +82,15 @@ func AuthenticationHandler(log *slog.Logger, timeout time.Duration, authService
 
 	}
 }
+
+// RenderLockedError Отвечает 429 с Retry-After, если попытки исчерпаны (*services.LockedError), и возвращает true.
+// Для остальных ошибок ничего не пишет и возвращает false
+func RenderLockedError(w http.ResponseWriter, r *http.Request, err error) bool {
+	var lockedErr *services.LockedError
+	if !errors.As(err, &lockedErr) {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(lockedErr.RetryAfter.Seconds()))))
+	resp.RenderResponse(w, r, http.StatusTooManyRequests, resp.Error(services.ErrTooManyAttempts.Error()))
+	return true
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/body"
+	resp "github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/services"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/magic_links_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/models/tokens"
+	"github.com/go-chi/chi/v5/middleware"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// MagicLinkRequestHandler godoc
+// @Summary Запросить ссылку для входа
+// @Description Отправляет на email одноразовую ссылку для входа без пароля. Ответ одинаковый для любых email
+// @Tags Users
+// @Param input body tokens.MagicLinkRequest true "Email пользователя"
+// @Success 202 {object} response.Response
+// @Router /login/magic-link [post]
+func MagicLinkRequestHandler(log *slog.Logger, timeout time.Duration, magicLinkService *services.MagicLinkService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/users/auth/MagicLinkRequestHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		var request tokens.MagicLinkRequest
+		if err := body.DecodeAndValidateJson(r, &request); err != nil {
+			log.Error("Error while decoding request body", "err", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+			return
+		}
+
+		magicLinkService.RequestLink(ctx, request.Email)
+		resp.RenderResponse(w, r, http.StatusAccepted, resp.OK())
+	}
+}
+
+// MagicLinkConsumeHandler godoc
+// @Summary Войти по ссылке
+// @Description Обменивает одноразовый токен из ссылки на пару access и refresh токенов. Только POST, что б ссылку не списали почтовые сканеры
+// @Tags Users
+// @Param input body tokens.MagicLinkConsumeRequest true "Токен из ссылки"
+// @Success 200 {object} tokens.RefreshTokensDto
+// @Failure 401 {object} response.Response
+// @Router /login/magic-link/consume [post]
+func MagicLinkConsumeHandler(log *slog.Logger, timeout time.Duration, magicLinkService *services.MagicLinkService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/users/auth/MagicLinkConsumeHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		var request tokens.MagicLinkConsumeRequest
+		if err := body.DecodeAndValidateJson(r, &request); err != nil {
+			log.Error("Error while decoding request body", "err", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+			return
+		}
+
+		authTokens, err := magicLinkService.ConsumeLink(ctx, request.Token)
+		if err != nil {
+			if errors.Is(err, magic_links_db.ErrLinkNotFound) {
+				log.Debug("Magic link is invalid")
+				resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error(err.Error()))
+				return
+			}
+			if errors.Is(err, services.ErrAccountSuspended) || errors.Is(err, services.ErrAccountDeactivated) {
+				resp.RenderResponse(w, r, http.StatusForbidden, resp.Error(err.Error()))
+				return
+			}
+			log.Error("Error while consuming magic link", "err", err)
+			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("Failed to sign in"))
+			return
+		}
+		resp.RenderResponse(w, r, http.StatusOK, authTokens)
+	}
+}
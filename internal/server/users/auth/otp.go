@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/body"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/request"
+	resp "github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/services"
+	"github.com/ShlykovPavel/auth-JWT-microservice/models/tokens"
+	"github.com/go-chi/chi/v5/middleware"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// OTPRequestHandler godoc
+// @Summary Запросить код для входа
+// @Description Отправляет одноразовый код на подтверждённый номер телефона. Ответ одинаковый для любых номеров
+// @Tags Users
+// @Param input body tokens.OTPRequest true "Номер телефона"
+// @Success 202 {object} response.Response
+// @Router /login/otp [post]
+func OTPRequestHandler(log *slog.Logger, timeout time.Duration, otpService *services.OTPService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/users/auth/OTPRequestHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		var request tokens.OTPRequest
+		if err := body.DecodeAndValidateJson(r, &request); err != nil {
+			log.Error("Error while decoding request body", "err", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+			return
+		}
+
+		if err := otpService.RequestLoginCode(ctx, request.Phone); err != nil {
+			log.Error("Error while requesting login code", "err", err)
+			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("Failed to send code"))
+			return
+		}
+		resp.RenderResponse(w, r, http.StatusAccepted, resp.OK())
+	}
+}
+
+// OTPVerifyHandler godoc
+// @Summary Войти по коду
+// @Description Обменивает одноразовый код из SMS на пару access и refresh токенов
+// @Tags Users
+// @Param input body tokens.OTPVerifyRequest true "Номер телефона и код"
+// @Success 200 {object} tokens.RefreshTokensDto
+// @Failure 401 {object} response.Response
+// @Failure 429 {object} response.Response
+// @Router /login/otp/verify [post]
+func OTPVerifyHandler(log *slog.Logger, timeout time.Duration, otpService *services.OTPService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/users/auth/OTPVerifyHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		var requestBody tokens.OTPVerifyRequest
+		if err := body.DecodeAndValidateJson(r, &requestBody); err != nil {
+			log.Error("Error while decoding request body", "err", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+			return
+		}
+
+		authTokens, err := otpService.VerifyLoginCode(ctx, requestBody.Phone, requestBody.Code, request.ClientIP(r))
+		if err != nil {
+			if RenderLockedError(w, r, err) {
+				log.Debug("Login code check is throttled", "err", err)
+				return
+			}
+			if errors.Is(err, services.ErrInvalidCode) {
+				log.Debug("Login code is invalid")
+				resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error(err.Error()))
+				return
+			}
+			if errors.Is(err, services.ErrAccountSuspended) || errors.Is(err, services.ErrAccountDeactivated) {
+				resp.RenderResponse(w, r, http.StatusForbidden, resp.Error(err.Error()))
+				return
+			}
+			log.Error("Error while verifying login code", "err", err)
+			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("Failed to sign in"))
+			return
+		}
+		resp.RenderResponse(w, r, http.StatusOK, authTokens)
+	}
+}
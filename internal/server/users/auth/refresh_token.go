@@ -45,6 +45,10 @@ func RefreshTokenHandler(log *slog.Logger, timeout time.Duration, authService *s
 				resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error(ErrSessionNotFound.Error()))
 				return
 			}
+			if errors.Is(err, services.ErrAccountSuspended) || errors.Is(err, services.ErrAccountDeactivated) {
+				resp.RenderResponse(w, r, http.StatusForbidden, resp.Error(err.Error()))
+				return
+			}
 			log.Error("Error while updating tokens", "err", err)
 			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error(err.Error()))
 			return
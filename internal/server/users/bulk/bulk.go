@@ -0,0 +1,174 @@
+package bulk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/middlewares"
+	resp "github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/bulk_users"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/permissions"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/services"
+	"github.com/ShlykovPavel/auth-JWT-microservice/models/users/bulk"
+	"github.com/go-chi/chi/v5/middleware"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// ImportUsersHandler godoc
+// @Summary Массовый импорт пользователей
+// @Description Загружает пользователей в организацию токена из CSV (первая строка - заголовки email, first_name, last_name, password_hash, roles через ";") или JSON Lines. Файл читается потоком и загружается пачками: ошибки в строках попадают в отчёт и не останавливают импорт. Строки с ролями сверх user загружаются только с правом roles:write. С dry_run=true ничего не записывается
+// @Tags admin
+// @Security BearerAuth
+// @Accept text/csv
+// @Accept application/x-ndjson
+// @Produce json
+// @Param format query string true "csv или jsonl"
+// @Param password_mode query string true "hashed - готовые хеши bcrypt/argon2id из password_hash, reset - без пароля, пользователь задаёт его после первого входа по ссылке или коду"
+// @Param dry_run query bool false "Только проверить файл"
+// @Success 200 {object} bulk.ImportReportResponse
+// @Failure 400 {object} response.Response
+// @Failure 413 {object} response.Response
+// @Router /admin/users/import [post]
+func ImportUsersHandler(log *slog.Logger, bulkService *services.BulkUsersService, timeout time.Duration, maxBytes int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/users/bulk/ImportUsersHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		query := r.URL.Query()
+		opts := services.ImportOptions{
+			Format:       query.Get("format"),
+			PasswordMode: query.Get("password_mode"),
+			// Иначе через импорт можно было бы выдать роли в обход ручек управления ролями
+			GrantRoles: hasPermission(r, permissions.RolesWrite),
+		}
+		if !bulk_users.ValidFormat(opts.Format) {
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(bulk_users.ErrUnknownFormat.Error()))
+			return
+		}
+		if raw := query.Get("dry_run"); raw != "" {
+			dryRun, err := strconv.ParseBool(raw)
+			if err != nil {
+				resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error("Invalid dry_run"))
+				return
+			}
+			opts.DryRun = dryRun
+		}
+
+		extendDeadlines(w, log, timeout)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		report, err := bulkService.Import(ctx, http.MaxBytesReader(w, r.Body, maxBytes), opts)
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			switch {
+			case errors.As(err, &maxBytesErr):
+				resp.RenderResponse(w, r, http.StatusRequestEntityTooLarge, resp.Error(fmt.Sprintf("File is larger than %d bytes", maxBytesErr.Limit)))
+			case errors.Is(err, services.ErrUnknownPasswordMode), errors.Is(err, bulk_users.ErrMissingEmailColumn):
+				resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+			default:
+				// Пачки, загруженные до ошибки, остаются: повторный импорт того же файла отклонит их как занятые email
+				log.Error("Error while importing users", "err", err, slog.Int("imported", report.Imported))
+				resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error(fmt.Sprintf("Import stopped after %d imported users", report.Imported)))
+			}
+			return
+		}
+		resp.RenderResponse(w, r, http.StatusOK, ToImportReportResponse(report))
+	}
+}
+
+// ExportUsersHandler godoc
+// @Summary Выгрузка пользователей
+// @Description Все пользователи организации токена потоком в CSV или JSON Lines, в том же формате, что принимает импорт. Хеши паролей выгружаются только с password_hashes=true и правом users:write
+// @Tags admin
+// @Security BearerAuth
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Param format query string true "csv или jsonl"
+// @Param password_hashes query bool false "Выгрузить хеши паролей"
+// @Success 200 {file} file
+// @Failure 400 {object} response.Response
+// @Failure 403 {object} response.Response
+// @Router /admin/users/export [get]
+func ExportUsersHandler(log *slog.Logger, bulkService *services.BulkUsersService, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/users/bulk/ExportUsersHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		query := r.URL.Query()
+		format := query.Get("format")
+		if !bulk_users.ValidFormat(format) {
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(bulk_users.ErrUnknownFormat.Error()))
+			return
+		}
+		includePasswordHashes := false
+		if raw := query.Get("password_hashes"); raw != "" {
+			value, err := strconv.ParseBool(raw)
+			if err != nil {
+				resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error("Invalid password_hashes"))
+				return
+			}
+			includePasswordHashes = value
+		}
+		if includePasswordHashes && !hasPermission(r, permissions.UsersWrite) {
+			resp.RenderResponse(w, r, http.StatusForbidden, resp.Error("Exporting password hashes requires "+permissions.UsersWrite))
+			return
+		}
+
+		extendDeadlines(w, log, timeout)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		w.Header().Set("Content-Type", bulk_users.ContentType(format))
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="users.%s"`, format))
+		count, err := bulkService.Export(ctx, w, format, includePasswordHashes)
+		if err != nil {
+			// Заголовки и часть файла уже отправлены, клиент увидит оборванный файл
+			log.Error("Error while exporting users", "err", err, slog.Int("exported", count))
+			return
+		}
+		log.Info("Users exported", slog.Int("count", count), slog.Bool("password_hashes", includePasswordHashes))
+	}
+}
+
+// extendDeadlines Импорт и выгрузка идут дольше обычного SERVER_TIMEOUT
+func extendDeadlines(w http.ResponseWriter, log *slog.Logger, timeout time.Duration) {
+	controller := http.NewResponseController(w)
+	deadline := time.Now().Add(timeout)
+	if err := controller.SetReadDeadline(deadline); err != nil {
+		log.Warn("Failed to extend read deadline", "err", err)
+	}
+	if err := controller.SetWriteDeadline(deadline); err != nil {
+		log.Warn("Failed to extend write deadline", "err", err)
+	}
+}
+
+// hasPermission Есть ли право в токене запроса
+func hasPermission(r *http.Request, permission string) bool {
+	claims, err := middlewares.ClaimsFromContext(r.Context())
+	if err != nil {
+		return false
+	}
+	return slices.Contains(middlewares.PermissionsFromClaims(claims), permission)
+}
+
+func ToImportReportResponse(report services.ImportReport) bulk.ImportReportResponse {
+	response := bulk.ImportReportResponse{
+		DryRun:          report.DryRun,
+		Total:           report.Total,
+		Imported:        report.Imported,
+		Failed:          report.Failed,
+		Errors:          make([]bulk.ImportRowErrorResponse, 0, len(report.Errors)),
+		ErrorsTruncated: report.ErrorsTruncated,
+	}
+	for _, rowErr := range report.Errors {
+		response.Errors = append(response.Errors, bulk.ImportRowErrorResponse{Line: rowErr.Line, Email: rowErr.Email, Error: rowErr.Error})
+	}
+	return response
+}
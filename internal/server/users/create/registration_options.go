@@ -0,0 +1,42 @@
+package users
+
+import (
+	"context"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/mailer"
+	"log/slog"
+	"time"
+)
+
+// notifyTimeout Время на отправку письма владельцу email. Письмо уходит в фоне и не задерживает ответ
+const notifyTimeout = 30 * time.Second
+
+// RegistrationOptions Дополнительные настройки регистрации
+type RegistrationOptions struct {
+	// EnumerationSafe Всегда отвечать одинаково (202 без id пользователя), что б регистрацией нельзя было проверить занят ли email
+	EnumerationSafe bool
+	// Disabled Публичная регистрация выключена, новые пользователи создаются только по приглашениям
+	Disabled bool
+	// Mailer Через него владельцу email уходит уведомление о попытке регистрации
+	Mailer mailer.Mailer
+}
+
+// notifyExistingOwner Отправляет владельцу email письмо о попытке зарегистрироваться на его адрес.
+// Отправка идёт в горутине, что б время ответа не отличалось от обычной регистрации
+func notifyExistingOwner(m mailer.Mailer, email string, log *slog.Logger) {
+	if m == nil {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		defer cancel()
+		err := m.Send(ctx, mailer.Message{
+			To:      email,
+			Subject: "Registration attempt with your email",
+			Body: "Someone tried to create an account with this email address, but you already have one.\n" +
+				"If it was you, just sign in or reset your password. Otherwise you can ignore this message.",
+		})
+		if err != nil {
+			log.Error("Error while notifying existing account owner", "err", err)
+		}
+	}()
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/body"
 	resp "github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/password_policy"
 	users "github.com/ShlykovPavel/auth-JWT-microservice/internal/server/users"
 	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
 	"github.com/ShlykovPavel/auth-JWT-microservice/models/users/create_user"
@@ -20,8 +21,11 @@ import (
 // @Tags Users
 // @Param input body create_user.UserCreate true "Данные пользователя"
 // @Success 201 {object} create_user.CreateUserResponse
+// @Success 202 {object} response.Response "В режиме защиты от перебора email ответ всегда одинаковый"
+// @Failure 400 {object} password.PasswordPolicyErrorResponse
+// @Failure 403 {object} response.Response "Публичная регистрация выключена"
 // @Router /user/register [post]
-func CreateUser(log *slog.Logger, userRepo users_db.UserRepository, timeout time.Duration) http.HandlerFunc {
+func CreateUser(log *slog.Logger, userRepo users_db.UserRepository, timeout time.Duration, policy *password_policy.Policy, opts RegistrationOptions) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "server/users.CreateUser"
 		log = log.With(
@@ -29,6 +33,12 @@ func CreateUser(log *slog.Logger, userRepo users_db.UserRepository, timeout time
 			slog.String("request_id", middleware.GetReqID(r.Context())),
 			slog.String("url", r.URL.Path))
 
+		if opts.Disabled {
+			log.Debug("Public registration is disabled")
+			resp.RenderResponse(w, r, http.StatusForbidden, resp.Error("Public registration is disabled, ask an administrator for an invitation"))
+			return
+		}
+
 		ctx, cancel := context.WithTimeout(r.Context(), timeout)
 		defer cancel()
 
@@ -40,6 +50,21 @@ func CreateUser(log *slog.Logger, userRepo users_db.UserRepository, timeout time
 			return
 		}
 
+		// Проверяем пароль по политике паролей
+		err = users.CheckPasswordPolicy(policy, user.Password, password_policy.PersonalInfo{
+			Email:     user.Email,
+			FirstName: user.FirstName,
+			LastName:  user.LastName,
+		}, nil, log)
+		if err != nil {
+			log.Debug("Password does not satisfy password policy", "err", err)
+			if users.RenderPasswordPolicyError(w, r, err) {
+				return
+			}
+			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error(err.Error()))
+			return
+		}
+
 		//	Хешируем пароль
 		passwordHash, err := users.HashUserPassword(user.Password, log)
 		if err != nil {
@@ -53,7 +78,13 @@ func CreateUser(log *slog.Logger, userRepo users_db.UserRepository, timeout time
 		userId, err := userRepo.CreateUser(ctx, &user)
 		if err != nil {
 			log.Error("Error while creating user", "err", err)
-			if errors.Is(err, users_db.ErrEmailAlreadyExists) {
+			if errors.Is(err, users_db.ErrEmailAlreadyExists) && opts.EnumerationSafe {
+				// Не сообщаем что email занят, а предупреждаем владельца письмом
+				notifyExistingOwner(opts.Mailer, user.Email, log)
+				resp.RenderResponse(w, r, http.StatusAccepted, resp.OK())
+				return
+			}
+			if errors.Is(err, users_db.ErrEmailAlreadyExists) || errors.Is(err, users_db.ErrUsernameAlreadyExists) {
 				resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(
 					err.Error()))
 				return
@@ -63,9 +94,13 @@ func CreateUser(log *slog.Logger, userRepo users_db.UserRepository, timeout time
 		}
 
 		log.Info("Created user", "user id", userId)
+		if opts.EnumerationSafe {
+			resp.RenderResponse(w, r, http.StatusAccepted, resp.OK())
+			return
+		}
 		resp.RenderResponse(w, r, http.StatusCreated, create_user.CreateUserResponse{
-			resp.OK(),
-			userId,
+			Response: resp.OK(),
+			UserID:   userId,
 		})
 	}
 }
@@ -0,0 +1,127 @@
+package directory
+
+import (
+	"context"
+	"errors"
+	resp "github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/models/users/directory"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ListUsersHandler godoc
+// @Summary Список пользователей
+// @Description Постраничный список пользователей с поиском, фильтрами и сортировкой. Следующая страница запрашивается с cursor из ответа и теми же параметрами. Фильтр по атрибутам - параметры metadata.<user|admin>.<атрибут>=значение: значение читается как JSON, если это JSON, иначе как строка
+// @Tags admin
+// @Security BearerAuth
+// @Param q query string false "Поиск по имени, фамилии и email"
+// @Param role query string false "Роль (пользователи, у которых она есть среди прочих)"
+// @Param status query string false "Статус аккаунта"
+// @Param created_from query string false "Создан не раньше (RFC3339)"
+// @Param created_to query string false "Создан раньше (RFC3339)"
+// @Param sort query string false "created_at, email или last_name; '-' в начале - по убыванию" default(created_at)
+// @Param limit query int false "Размер страницы, до 100" default(20)
+// @Param cursor query string false "Курсор следующей страницы"
+// @Success 200 {object} directory.ListUsersResponse
+// @Failure 400 {object} response.Response
+// @Router /admin/users [get]
+func ListUsersHandler(log *slog.Logger, userRepo users_db.UserRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/users/directory/ListUsersHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		filter, err := parseListQuery(r.URL.Query())
+		if err != nil {
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+			return
+		}
+		pageSize := filter.Limit
+		// Берём на одну запись больше, что б понять, есть ли следующая страница
+		filter.Limit++
+
+		users, err := userRepo.ListUsers(ctx, filter)
+		if err != nil {
+			log.Error("Error while listing users", "err", err)
+			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("Failed to list users"))
+			return
+		}
+
+		response := directory.ListUsersResponse{Users: make([]directory.UserResponse, 0, len(users))}
+		if len(users) > pageSize {
+			users = users[:pageSize]
+			response.NextCursor = encodeCursor(filter, users_db.CursorFor(users[pageSize-1], filter.SortBy))
+		}
+		for _, user := range users {
+			response.Users = append(response.Users, toUserResponse(user))
+		}
+		resp.RenderResponse(w, r, http.StatusOK, response)
+	}
+}
+
+// GetUserHandler godoc
+// @Summary Пользователь по id
+// @Tags admin
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Success 200 {object} directory.UserResponse
+// @Failure 404 {object} response.Response
+// @Router /admin/users/{id} [get]
+func GetUserHandler(log *slog.Logger, userRepo users_db.UserRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/users/directory/GetUserHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			log.Error("User ID is invalid", "error", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error("Invalid user ID"))
+			return
+		}
+
+		user, err := userRepo.GetUserByID(ctx, id)
+		if err != nil {
+			if errors.Is(err, users_db.ErrUserNotFound) {
+				resp.RenderResponse(w, r, http.StatusNotFound, resp.Error("User not found"))
+				return
+			}
+			log.Error("Error while fetching user", "err", err)
+			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("Failed to fetch user"))
+			return
+		}
+		resp.RenderResponse(w, r, http.StatusOK, toUserResponse(user))
+	}
+}
+
+func toUserResponse(user users_db.UserInfo) directory.UserResponse {
+	return directory.UserResponse{
+		ID:              user.ID,
+		FirstName:       user.FirstName,
+		LastName:        user.LastName,
+		Email:           user.Email,
+		Username:        user.Username,
+		Roles:           user.Roles,
+		Status:          user.Status,
+		StatusReason:    user.StatusReason,
+		StatusExpiresAt: user.StatusExpiresAt,
+		Phone:           user.Phone,
+		PhoneVerified:   user.PhoneVerified,
+		Metadata:        directory.Metadata{User: user.Metadata.User, Admin: user.Metadata.Admin},
+		CreatedAt:       user.CreatedAt,
+		UpdatedAt:       user.UpdatedAt,
+	}
+}
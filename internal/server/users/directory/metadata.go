@@ -0,0 +1,83 @@
+package directory
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/body"
+	resp "github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/tenant"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/user_metadata"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/models/users/directory"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// SetMetadataHandler godoc
+// @Summary Изменить атрибуты пользователя
+// @Description Заменяет переданные секции атрибутов целиком. Каждая секция проверяется JSON схемой из METADATA_SCHEMA_FILE. Атрибуты общие для всех организаций и попадают в access токен при следующем входе или обновлении токена
+// @Tags admin
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Param input body directory.SetMetadataRequest true "Секции user и/или admin"
+// @Success 200 {object} directory.UserResponse
+// @Failure 400 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Router /admin/users/{id}/metadata [put]
+func SetMetadataHandler(log *slog.Logger, userRepo users_db.UserRepository, metadataValidator *user_metadata.Validator, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/users/directory/SetMetadataHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		// Атрибуты, как и статус, общие для всех организаций
+		ctx, cancel := context.WithTimeout(tenant.WithoutOrg(r.Context()), timeout)
+		defer cancel()
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			log.Error("User ID is invalid", "error", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error("Invalid user ID"))
+			return
+		}
+		var request directory.SetMetadataRequest
+		if err = body.DecodeAndValidateJson(r, &request); err != nil {
+			log.Error("Error while decoding request body", "err", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+			return
+		}
+		if request.User == nil && request.Admin == nil {
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error("user or admin section is required"))
+			return
+		}
+		update := users_db.Metadata{User: request.User, Admin: request.Admin}
+		for _, section := range []string{users_db.MetadataSectionUser, users_db.MetadataSectionAdmin} {
+			values := update.Section(section)
+			if values == nil {
+				continue
+			}
+			if err = metadataValidator.Validate(section, values); err != nil {
+				resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+				return
+			}
+		}
+
+		user, err := userRepo.SetMetadata(ctx, id, users_db.MetadataUpdate{User: request.User, Admin: request.Admin})
+		if err != nil {
+			if errors.Is(err, users_db.ErrUserNotFound) {
+				resp.RenderResponse(w, r, http.StatusNotFound, resp.Error("User not found"))
+				return
+			}
+			log.Error("Error while setting user metadata", "err", err)
+			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("Failed to set user metadata"))
+			return
+		}
+		log.Info("User metadata changed", slog.Int64("user_id", id))
+		resp.RenderResponse(w, r, http.StatusOK, toUserResponse(user))
+	}
+}
@@ -0,0 +1,129 @@
+package directory
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultLimit = 20
+	maxLimit     = 100
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// cursorPayload Содержимое курсора. Сортировка зашита в курсор, что б его нельзя было применить к другому порядку
+type cursorPayload struct {
+	SortBy string `json:"s"`
+	Desc   bool   `json:"d,omitempty"`
+	Value  string `json:"v"`
+	ID     int64  `json:"id"`
+}
+
+func encodeCursor(filter users_db.ListUsersFilter, cursor users_db.ListUsersCursor) string {
+	raw, _ := json.Marshal(cursorPayload{SortBy: filter.SortBy, Desc: filter.Desc, Value: cursor.Value, ID: cursor.ID})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(value string, filter users_db.ListUsersFilter) (*users_db.ListUsersCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var payload cursorPayload
+	if err = json.Unmarshal(raw, &payload); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if payload.SortBy != filter.SortBy || payload.Desc != filter.Desc {
+		return nil, ErrInvalidCursor
+	}
+	return &users_db.ListUsersCursor{Value: payload.Value, ID: payload.ID}, nil
+}
+
+// parseListQuery Разбирает параметры запроса:
+// q, role, status, created_from, created_to (RFC3339), sort (поле, "-" в начале - по убыванию), limit, cursor
+// и metadata.<секция>.<атрибут>
+func parseListQuery(query url.Values) (users_db.ListUsersFilter, error) {
+	filter := users_db.ListUsersFilter{
+		Search: strings.TrimSpace(query.Get("q")),
+		Role:   query.Get("role"),
+		Status: query.Get("status"),
+		SortBy: users_db.SortByCreatedAt,
+		Limit:  defaultLimit,
+	}
+
+	if sort := query.Get("sort"); sort != "" {
+		filter.Desc = strings.HasPrefix(sort, "-")
+		filter.SortBy = strings.TrimPrefix(sort, "-")
+		switch filter.SortBy {
+		case users_db.SortByCreatedAt, users_db.SortByEmail, users_db.SortByLastName:
+		default:
+			return filter, errors.New("sort must be one of created_at, email, last_name")
+		}
+	}
+	if limit := query.Get("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value < 1 || value > maxLimit {
+			return filter, errors.New("limit must be between 1 and " + strconv.Itoa(maxLimit))
+		}
+		filter.Limit = value
+	}
+	for param, target := range map[string]**time.Time{"created_from": &filter.CreatedFrom, "created_to": &filter.CreatedTo} {
+		value := query.Get(param)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return filter, errors.New(param + " must be RFC3339 date-time")
+		}
+		*target = &parsed
+	}
+	metadata, err := parseMetadataFilter(query)
+	if err != nil {
+		return filter, err
+	}
+	filter.Metadata = metadata
+	if cursor := query.Get("cursor"); cursor != "" {
+		after, err := decodeCursor(cursor, filter)
+		if err != nil {
+			return filter, err
+		}
+		filter.After = after
+	}
+	return filter, nil
+}
+
+// parseMetadataFilter Собирает фильтр из параметров metadata.<секция>.<атрибут>. Значение, которое разбирается как JSON
+// (число, true, "строка в кавычках", массив), сравнивается как JSON, остальное - как строка
+func parseMetadataFilter(query url.Values) (users_db.MetadataFilter, error) {
+	var filter users_db.MetadataFilter
+	for param, values := range query {
+		path, ok := strings.CutPrefix(param, "metadata.")
+		if !ok {
+			continue
+		}
+		section, attribute, ok := strings.Cut(path, ".")
+		if !ok || attribute == "" || (section != users_db.MetadataSectionUser && section != users_db.MetadataSectionAdmin) {
+			return nil, errors.New(param + ": expected metadata.user.<attribute> or metadata.admin.<attribute>")
+		}
+		var value interface{}
+		if err := json.Unmarshal([]byte(values[0]), &value); err != nil {
+			value = values[0]
+		}
+		if filter == nil {
+			filter = make(users_db.MetadataFilter)
+		}
+		if filter[section] == nil {
+			filter[section] = make(map[string]interface{})
+		}
+		filter[section][attribute] = value
+	}
+	return filter, nil
+}
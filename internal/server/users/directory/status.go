@@ -0,0 +1,115 @@
+package directory
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/body"
+	resp "github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/services"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/tenant"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/models/users/status"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// SuspendUserHandler godoc
+// @Summary Заблокировать пользователя
+// @Description Блокировка действует во всех организациях. Refresh токены удаляются сразу, access токены перестают приниматься в течение ACCOUNT_STATUS_CACHE_TTL. С expires_at блокировка снимается сама
+// @Tags admin
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Param input body status.SuspendUserRequest true "Причина и срок"
+// @Success 200 {object} directory.UserResponse
+// @Failure 404 {object} response.Response
+// @Failure 409 {object} response.Response
+// @Router /admin/users/{id}/suspend [post]
+func SuspendUserHandler(log *slog.Logger, statusService *services.AccountStatusService, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request status.SuspendUserRequest
+		changeStatus(w, r, log.With(slog.String("op", "server/users/directory/SuspendUserHandler")), statusService, timeout, &request, func() users_db.StatusChange {
+			return users_db.StatusChange{Status: users_db.StatusSuspended, Reason: request.Reason, ExpiresAt: request.ExpiresAt}
+		})
+	}
+}
+
+// DeactivateUserHandler godoc
+// @Summary Отключить пользователя
+// @Description Аккаунт отключается бессрочно во всех организациях, вернуть его может только администратор
+// @Tags admin
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Param input body status.DeactivateUserRequest true "Причина"
+// @Success 200 {object} directory.UserResponse
+// @Failure 404 {object} response.Response
+// @Failure 409 {object} response.Response
+// @Router /admin/users/{id}/deactivate [post]
+func DeactivateUserHandler(log *slog.Logger, statusService *services.AccountStatusService, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request status.DeactivateUserRequest
+		changeStatus(w, r, log.With(slog.String("op", "server/users/directory/DeactivateUserHandler")), statusService, timeout, &request, func() users_db.StatusChange {
+			return users_db.StatusChange{Status: users_db.StatusDeactivated, Reason: request.Reason}
+		})
+	}
+}
+
+// ReactivateUserHandler godoc
+// @Summary Вернуть пользователя в работу
+// @Description Снимает блокировку или отключение. С expires_at аккаунт активен до этого момента, потом отключается сам
+// @Tags admin
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Param input body status.ReactivateUserRequest true "Срок действия аккаунта"
+// @Success 200 {object} directory.UserResponse
+// @Failure 404 {object} response.Response
+// @Router /admin/users/{id}/reactivate [post]
+func ReactivateUserHandler(log *slog.Logger, statusService *services.AccountStatusService, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var request status.ReactivateUserRequest
+		changeStatus(w, r, log.With(slog.String("op", "server/users/directory/ReactivateUserHandler")), statusService, timeout, &request, func() users_db.StatusChange {
+			return users_db.StatusChange{Status: users_db.StatusActive, ExpiresAt: request.ExpiresAt}
+		})
+	}
+}
+
+// changeStatus Общая часть ручек статуса: разбирает id и тело запроса в request и применяет изменение из change
+func changeStatus(w http.ResponseWriter, r *http.Request, log *slog.Logger, statusService *services.AccountStatusService, timeout time.Duration,
+	request interface{}, change func() users_db.StatusChange) {
+	log = log.With(slog.String("request_id", middleware.GetReqID(r.Context())))
+	// Статус общий для всех организаций, поэтому пользователь ищется без учёта организации запроса
+	ctx, cancel := context.WithTimeout(tenant.WithoutOrg(r.Context()), timeout)
+	defer cancel()
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		log.Error("User ID is invalid", "error", err)
+		resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error("Invalid user ID"))
+		return
+	}
+	if err = body.DecodeAndValidateJson(r, request); err != nil {
+		log.Error("Error while decoding request body", "err", err)
+		resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+		return
+	}
+
+	user, err := statusService.SetStatus(ctx, id, change())
+	if err != nil {
+		switch {
+		case errors.Is(err, users_db.ErrUserNotFound):
+			resp.RenderResponse(w, r, http.StatusNotFound, resp.Error(err.Error()))
+		case errors.Is(err, users_db.ErrLastAdmin):
+			resp.RenderResponse(w, r, http.StatusConflict, resp.Error(err.Error()))
+		case errors.Is(err, services.ErrInvalidStatusExpiry):
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+		default:
+			log.Error("Error while changing account status", "err", err)
+			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("Failed to change account status"))
+		}
+		return
+	}
+	resp.RenderResponse(w, r, http.StatusOK, toUserResponse(user))
+}
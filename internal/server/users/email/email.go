@@ -0,0 +1,155 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/body"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/middlewares"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/request"
+	resp "github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/services"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/server/users/auth"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/models/users/email"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// ChangeEmailHandler godoc
+// @Summary Сменить email
+// @Description Отправляет ссылку подтверждения на новый адрес и уведомление со ссылкой отмены на текущий. Email меняется только после подтверждения
+// @Tags Users
+// @Security BearerAuth
+// @Param input body email.ChangeEmailRequest true "Новый email и текущий пароль"
+// @Success 202 {object} response.Response
+// @Failure 400 {object} response.Response
+// @Failure 429 {object} response.Response
+// @Router /user/email [post]
+func ChangeEmailHandler(log *slog.Logger, timeout time.Duration, emailChangeService *services.EmailChangeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/users/email/ChangeEmailHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		userID, err := middlewares.UserIDFromContext(r.Context())
+		if err != nil {
+			log.Error("Error while getting user id from token", "err", err)
+			resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("Unauthorized"))
+			return
+		}
+
+		var requestBody email.ChangeEmailRequest
+		if err = body.DecodeAndValidateJson(r, &requestBody); err != nil {
+			log.Error("Error while decoding request body", "err", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+			return
+		}
+
+		err = emailChangeService.RequestChange(ctx, userID, requestBody.NewEmail, requestBody.Password, request.ClientIP(r))
+		if err != nil {
+			if auth.RenderLockedError(w, r, err) {
+				return
+			}
+			switch {
+			case errors.Is(err, services.ErrWrongPassword), errors.Is(err, services.ErrSameEmail):
+				resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+			case errors.Is(err, users_db.ErrUserNotFound):
+				resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("Unauthorized"))
+			default:
+				log.Error("Error while requesting email change", "err", err)
+				resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("Failed to change email"))
+			}
+			return
+		}
+		resp.RenderResponse(w, r, http.StatusAccepted, resp.OK())
+	}
+}
+
+// ConfirmEmailChangeHandler godoc
+// @Summary Подтвердить новый email
+// @Description Меняет email по токену из письма на новый адрес и завершает все сессии пользователя, кроме переданной в refresh_token
+// @Tags Users
+// @Param input body email.ConfirmEmailChangeRequest true "Токен из ссылки"
+// @Success 204
+// @Failure 400 {object} response.Response
+// @Failure 409 {object} response.Response
+// @Router /user/email/confirm [post]
+func ConfirmEmailChangeHandler(log *slog.Logger, timeout time.Duration, emailChangeService *services.EmailChangeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/users/email/ConfirmEmailChangeHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		var requestBody email.ConfirmEmailChangeRequest
+		if err := body.DecodeAndValidateJson(r, &requestBody); err != nil {
+			log.Error("Error while decoding request body", "err", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+			return
+		}
+
+		if err := emailChangeService.Confirm(ctx, requestBody.Token, requestBody.RefreshToken); err != nil {
+			renderEmailChangeError(w, r, log, err)
+			return
+		}
+		render.NoContent(w, r)
+	}
+}
+
+// CancelEmailChangeHandler godoc
+// @Summary Отменить смену email
+// @Description Отменяет смену по токену из письма на старый адрес. Уже подтверждённая смена откатывается. Все сессии пользователя завершаются
+// @Tags Users
+// @Param input body email.CancelEmailChangeRequest true "Токен из ссылки"
+// @Success 204
+// @Failure 400 {object} response.Response
+// @Failure 409 {object} response.Response
+// @Router /user/email/cancel [post]
+func CancelEmailChangeHandler(log *slog.Logger, timeout time.Duration, emailChangeService *services.EmailChangeService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/users/email/CancelEmailChangeHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		var requestBody email.CancelEmailChangeRequest
+		if err := body.DecodeAndValidateJson(r, &requestBody); err != nil {
+			log.Error("Error while decoding request body", "err", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+			return
+		}
+
+		if err := emailChangeService.Cancel(ctx, requestBody.Token); err != nil {
+			renderEmailChangeError(w, r, log, err)
+			return
+		}
+		render.NoContent(w, r)
+	}
+}
+
+// renderEmailChangeError Ответ на ошибку подтверждения или отмены смены email
+func renderEmailChangeError(w http.ResponseWriter, r *http.Request, log *slog.Logger, err error) {
+	switch {
+	case errors.Is(err, users_db.ErrEmailChangeNotFound):
+		resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+	case errors.Is(err, users_db.ErrEmailAlreadyExists):
+		// Адрес успели занять после запроса смены
+		resp.RenderResponse(w, r, http.StatusConflict, resp.Error(err.Error()))
+	default:
+		log.Error("Error while processing email change", "err", err)
+		resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("Failed to process email change"))
+	}
+}
@@ -0,0 +1,88 @@
+package impersonation
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/body"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/middlewares"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/request"
+	resp "github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/services"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/models/users/impersonation"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ImpersonateHandler godoc
+// @Summary Войти под пользователем
+// @Description Выдаёт короткоживущий access токен пользователя организации с claim act (id администратора). Refresh токена нет, смена пароля, телефона и удаление аккаунта с таким токеном недоступны. Каждая выдача пишется в журнал
+// @Tags admin
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Param input body impersonation.ImpersonateRequest true "Причина"
+// @Success 200 {object} impersonation.ImpersonationResponse
+// @Failure 403 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Router /admin/users/{id}/impersonate [post]
+func ImpersonateHandler(log *slog.Logger, impersonationService *services.ImpersonationService, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/users/impersonation/ImpersonateHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			log.Error("User ID is invalid", "error", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error("Invalid user ID"))
+			return
+		}
+		var requestBody impersonation.ImpersonateRequest
+		if err = body.DecodeAndValidateJson(r, &requestBody); err != nil {
+			log.Error("Error while decoding request body", "err", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+			return
+		}
+		claims, err := middlewares.ClaimsFromContext(r.Context())
+		if err != nil {
+			log.Error("Failed to retrieve claims from context", "err", err)
+			resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("Unauthorized"))
+			return
+		}
+		actorID, err := middlewares.UserIDFromClaims(claims)
+		if err != nil {
+			log.Error("Invalid user ID in token", "err", err)
+			resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("Invalid token"))
+			return
+		}
+
+		token, err := impersonationService.Impersonate(ctx, actorID, middlewares.PermissionsFromClaims(claims), id, requestBody.Reason, request.ClientIP(r))
+		if err != nil {
+			switch {
+			case errors.Is(err, users_db.ErrUserNotFound):
+				resp.RenderResponse(w, r, http.StatusNotFound, resp.Error(err.Error()))
+			case errors.Is(err, services.ErrSelfImpersonation):
+				resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+			case errors.Is(err, services.ErrImpersonationEscalation), errors.Is(err, services.ErrAccountSuspended), errors.Is(err, services.ErrAccountDeactivated):
+				resp.RenderResponse(w, r, http.StatusForbidden, resp.Error(err.Error()))
+			default:
+				log.Error("Error while impersonating user", "err", err)
+				resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("Failed to impersonate user"))
+			}
+			return
+		}
+		resp.RenderResponse(w, r, http.StatusOK, impersonation.ImpersonationResponse{
+			AccessToken: token.AccessToken,
+			UserID:      token.UserID,
+			ExpiresAt:   token.ExpiresAt,
+		})
+	}
+}
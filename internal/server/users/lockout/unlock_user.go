@@ -0,0 +1,63 @@
+package lockout
+
+import (
+	"context"
+	"errors"
+	resp "github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/services"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// UnlockUserHandler godoc
+// @Summary Разблокировать вход пользователя
+// @Description Сбрасывает счётчик неудачных попыток входа и блокировку аккаунта
+// @Tags admin
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Success 204
+// @Router /admin/users/{id}/unlock [post]
+func UnlockUserHandler(log *slog.Logger, userRepo users_db.UserRepository, throttler *services.LoginThrottler, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/users/lockout/UnlockUserHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			log.Error("User ID is invalid", "error", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error("Invalid user ID"))
+			return
+		}
+
+		user, err := userRepo.GetUserByID(ctx, id)
+		if err != nil {
+			if errors.Is(err, users_db.ErrUserNotFound) {
+				log.Debug("user not found", "error", err)
+				resp.RenderResponse(w, r, http.StatusNotFound, resp.Error("User not found"))
+				return
+			}
+			log.Error("error fetching user", "error", err)
+			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("Failed to unlock user"))
+			return
+		}
+
+		if err = throttler.Unlock(ctx, user.Email); err != nil {
+			log.Error("error unlocking user", "error", err)
+			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("Failed to unlock user"))
+			return
+		}
+		log.Info("User login unlocked", "user_id", id)
+		render.NoContent(w, r)
+	}
+}
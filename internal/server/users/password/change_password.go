@@ -0,0 +1,129 @@
+package password
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/body"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/middlewares"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/request"
+	resp "github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/password_policy"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/services"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/server/users"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/server/users/auth"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/models/users/password"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+var ErrWrongOldPassword = errors.New("old password is incorrect")
+
+// ChangePasswordHandler godoc
+// @Summary Смена пароля
+// @Description Меняет пароль текущего пользователя. Новый пароль проверяется по политике паролей и истории. Если пароль требуется задать при первом входе, старый пароль не нужен.
+// @Description Неверный старый пароль учитывается как неудачная попытка входа в аккаунт
+// @Tags Users
+// @Security BearerAuth
+// @Param input body password.ChangePasswordRequest true "Старый и новый пароль"
+// @Success 204
+// @Failure 400 {object} password.PasswordPolicyErrorResponse
+// @Failure 429 {object} response.Response
+// @Router /user/password [put]
+func ChangePasswordHandler(log *slog.Logger, userRepo users_db.UserRepository, timeout time.Duration, policy *password_policy.Policy, throttler *services.LoginThrottler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/users/password/ChangePasswordHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			slog.String("url", r.URL.Path),
+		)
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		userID, err := middlewares.UserIDFromContext(r.Context())
+		if err != nil {
+			log.Error("Error while getting user id from token", "err", err)
+			resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("Unauthorized"))
+			return
+		}
+
+		var requestBody password.ChangePasswordRequest
+		if err = body.DecodeAndValidateJson(r, &requestBody); err != nil {
+			log.Error("Error while decoding request body", "err", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+			return
+		}
+
+		user, err := userRepo.GetUserByID(ctx, userID)
+		if err != nil {
+			if errors.Is(err, users_db.ErrUserNotFound) {
+				log.Debug("User not found", "user_id", userID)
+				resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("Unauthorized"))
+				return
+			}
+			log.Error("Error while fetching user", "err", err)
+			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error(err.Error()))
+			return
+		}
+
+		// Пользователь из импорта ещё не задавал пароль: вошёл по ссылке или коду и задаёт его впервые
+		if !user.PasswordResetRequired {
+			err = throttler.VerifyPassword(ctx, user.Email, request.ClientIP(r), func() bool {
+				return users.ComparePassword(user.PasswordHash, requestBody.OldPassword, log)
+			})
+			if auth.RenderLockedError(w, r, err) {
+				log.Debug("Password check is throttled", "err", err)
+				return
+			}
+			if errors.Is(err, services.ErrWrongPassword) {
+				resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(ErrWrongOldPassword.Error()))
+				return
+			}
+			if err != nil {
+				log.Error("Error while checking old password", "err", err)
+				resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error(err.Error()))
+				return
+			}
+		}
+
+		history, err := userRepo.GetPasswordHistory(ctx, userID, policy.HistorySize)
+		if err != nil {
+			log.Error("Error while fetching password history", "err", err)
+			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error(err.Error()))
+			return
+		}
+		err = users.CheckPasswordPolicy(policy, requestBody.NewPassword, password_policy.PersonalInfo{
+			Email:     user.Email,
+			FirstName: user.FirstName,
+			LastName:  user.LastName,
+		}, history, log)
+		if err != nil {
+			log.Debug("Password does not satisfy password policy", "err", err)
+			if users.RenderPasswordPolicyError(w, r, err) {
+				return
+			}
+			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error(err.Error()))
+			return
+		}
+
+		passwordHash, err := users.HashUserPassword(requestBody.NewPassword, log)
+		if err != nil {
+			log.Error("Error while hashing password", "err", err)
+			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error(err.Error()))
+			return
+		}
+		if err = userRepo.UpdatePassword(ctx, userID, passwordHash); err != nil {
+			log.Error("Error while updating password", "err", err)
+			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error(err.Error()))
+			return
+		}
+
+		log.Info("Password changed", "user_id", userID)
+		render.NoContent(w, r)
+	}
+}
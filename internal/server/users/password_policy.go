@@ -0,0 +1,35 @@
+package users
+
+import (
+	"errors"
+	resp "github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/password_policy"
+	"github.com/ShlykovPavel/auth-JWT-microservice/models/users/password"
+	"log/slog"
+	"net/http"
+)
+
+// CheckPasswordPolicy проверяет новый пароль по политике паролей и по истории предыдущих хешей пользователя.
+// Для нового пользователя history пустой
+func CheckPasswordPolicy(policy *password_policy.Policy, newPassword string, info password_policy.PersonalInfo, history []string, log *slog.Logger) error {
+	if err := policy.Validate(newPassword, info); err != nil {
+		return err
+	}
+	return policy.CheckHistory(newPassword, history, func(hash, pass string) bool {
+		return ComparePassword(hash, pass, log)
+	})
+}
+
+// RenderPasswordPolicyError Отдаёт клиенту 400 со списком нарушенных правил, если err - ошибка политики паролей.
+// Возвращает false, если ошибка другого типа и её нужно обработать вызывающей стороне
+func RenderPasswordPolicyError(w http.ResponseWriter, r *http.Request, err error) bool {
+	var violationErr *password_policy.ViolationError
+	if !errors.As(err, &violationErr) {
+		return false
+	}
+	resp.RenderResponse(w, r, http.StatusBadRequest, password.PasswordPolicyErrorResponse{
+		Response:   resp.Error(password_policy.ErrPasswordPolicy.Error()),
+		Violations: violationErr.Violations,
+	})
+	return true
+}
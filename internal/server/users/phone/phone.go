@@ -0,0 +1,133 @@
+package phone
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/body"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/middlewares"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/request"
+	resp "github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/services"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/server/users/auth"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/models/users/phone"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// SetPhoneHandler godoc
+// @Summary Указать номер телефона
+// @Description Сохраняет новый номер текущего пользователя и отправляет на него код подтверждения. Входить по коду можно только после подтверждения
+// @Tags Users
+// @Security BearerAuth
+// @Param input body phone.SetPhoneRequest true "Номер телефона"
+// @Success 202 {object} response.Response
+// @Failure 429 {object} response.Response
+// @Router /user/phone [post]
+func SetPhoneHandler(log *slog.Logger, timeout time.Duration, otpService *services.OTPService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/users/phone/SetPhoneHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		userID, err := middlewares.UserIDFromContext(r.Context())
+		if err != nil {
+			log.Error("Error while getting user id from token", "err", err)
+			resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("Unauthorized"))
+			return
+		}
+
+		var request phone.SetPhoneRequest
+		if err = body.DecodeAndValidateJson(r, &request); err != nil {
+			log.Error("Error while decoding request body", "err", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+			return
+		}
+
+		err = otpService.RequestPhoneVerification(ctx, userID, request.Phone)
+		if err != nil {
+			var cooldownErr *services.CooldownError
+			if errors.As(err, &cooldownErr) {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(cooldownErr.RetryAfter.Seconds()))))
+				resp.RenderResponse(w, r, http.StatusTooManyRequests, resp.Error(services.ErrResendCooldown.Error()))
+				return
+			}
+			if errors.Is(err, users_db.ErrUserNotFound) {
+				resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("Unauthorized"))
+				return
+			}
+			log.Error("Error while requesting phone verification", "err", err)
+			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("Failed to send code"))
+			return
+		}
+		resp.RenderResponse(w, r, http.StatusAccepted, resp.OK())
+	}
+}
+
+// VerifyPhoneHandler godoc
+// @Summary Подтвердить номер телефона
+// @Description Подтверждает номер текущего пользователя кодом из SMS
+// @Tags Users
+// @Security BearerAuth
+// @Param input body phone.VerifyPhoneRequest true "Код из SMS"
+// @Success 204
+// @Failure 400 {object} response.Response
+// @Failure 409 {object} response.Response
+// @Failure 429 {object} response.Response
+// @Router /user/phone/verify [post]
+func VerifyPhoneHandler(log *slog.Logger, timeout time.Duration, otpService *services.OTPService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/users/phone/VerifyPhoneHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		userID, err := middlewares.UserIDFromContext(r.Context())
+		if err != nil {
+			log.Error("Error while getting user id from token", "err", err)
+			resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("Unauthorized"))
+			return
+		}
+
+		var requestBody phone.VerifyPhoneRequest
+		if err = body.DecodeAndValidateJson(r, &requestBody); err != nil {
+			log.Error("Error while decoding request body", "err", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+			return
+		}
+
+		err = otpService.VerifyPhone(ctx, userID, requestBody.Code, request.ClientIP(r))
+		if err != nil {
+			if auth.RenderLockedError(w, r, err) {
+				log.Debug("Phone verification is throttled", "err", err)
+				return
+			}
+			switch {
+			case errors.Is(err, services.ErrInvalidCode), errors.Is(err, services.ErrPhoneNotSet):
+				resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+			case errors.Is(err, users_db.ErrPhoneAlreadyExists):
+				resp.RenderResponse(w, r, http.StatusConflict, resp.Error(err.Error()))
+			case errors.Is(err, users_db.ErrUserNotFound):
+				resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("Unauthorized"))
+			default:
+				log.Error("Error while verifying phone", "err", err)
+				resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("Failed to verify phone"))
+			}
+			return
+		}
+		log.Info("Phone verified", "user_id", userID)
+		render.NoContent(w, r)
+	}
+}
@@ -0,0 +1,284 @@
+package privacy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/body"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/middlewares"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/request"
+	resp "github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/services"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/tenant"
+	auditHandlers "github.com/ShlykovPavel/auth-JWT-microservice/internal/server/audit"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/privacy_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/models/audit"
+	"github.com/ShlykovPavel/auth-JWT-microservice/models/users/privacy"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ExportMeHandler godoc
+// @Summary Выгрузка моих данных
+// @Description Все персональные данные текущего пользователя одним JSON файлом: профиль, организации с ролями и группами, сессии, даты смены пароля и записи журнала
+// @Tags Users
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} privacy.ExportResponse
+// @Failure 401 {object} response.Response
+// @Router /me/export [get]
+func ExportMeHandler(log *slog.Logger, privacyService *services.PrivacyService, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/users/privacy/ExportMeHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		userID, ok := currentUserID(w, r, log)
+		if !ok {
+			return
+		}
+		export, err := privacyService.Export(ctx, userID)
+		if err != nil {
+			renderPrivacyError(w, r, log, err)
+			return
+		}
+		log.Info("Personal data exported", slog.Int64("user_id", userID))
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="user-%d-export.json"`, userID))
+		resp.RenderResponse(w, r, http.StatusOK, toExportResponse(export))
+	}
+}
+
+// RequestErasureHandler godoc
+// @Summary Запросить удаление моих данных
+// @Description Данные будут обезличены по истечении ERASURE_GRACE_PERIOD. До этого запрос можно отменить, на email уходит уведомление. Повторный запрос срок не сдвигает
+// @Tags Users
+// @Security BearerAuth
+// @Success 202 {object} privacy.ErasureResponse
+// @Failure 409 {object} response.Response
+// @Router /me/erasure [post]
+func RequestErasureHandler(log *slog.Logger, privacyService *services.PrivacyService, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/users/privacy/RequestErasureHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		userID, ok := currentUserID(w, r, log)
+		if !ok {
+			return
+		}
+		erasure, err := privacyService.RequestErasure(ctx, userID, request.ClientIP(r))
+		if err != nil {
+			renderPrivacyError(w, r, log, err)
+			return
+		}
+		resp.RenderResponse(w, r, http.StatusAccepted, privacy.ErasureResponse{RequestedAt: erasure.RequestedAt, DueAt: erasure.DueAt})
+	}
+}
+
+// CancelErasureHandler godoc
+// @Summary Отменить удаление моих данных
+// @Tags Users
+// @Security BearerAuth
+// @Success 204
+// @Failure 404 {object} response.Response
+// @Router /me/erasure [delete]
+func CancelErasureHandler(log *slog.Logger, privacyService *services.PrivacyService, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/users/privacy/CancelErasureHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		userID, ok := currentUserID(w, r, log)
+		if !ok {
+			return
+		}
+		if err := privacyService.CancelErasure(ctx, userID, userID, request.ClientIP(r)); err != nil {
+			renderPrivacyError(w, r, log, err)
+			return
+		}
+		render.NoContent(w, r)
+	}
+}
+
+// EraseUserHandler godoc
+// @Summary Удалить данные пользователя сразу
+// @Description Обезличивает пользователя без ожидания: профиль заменяется заглушкой, сессии, история паролей и участие в организациях удаляются, аккаунт отключается. Записи журнала остаются
+// @Tags admin
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Param input body privacy.EraseUserRequest true "Причина"
+// @Success 204
+// @Failure 404 {object} response.Response
+// @Failure 409 {object} response.Response
+// @Router /admin/users/{id}/erase [post]
+func EraseUserHandler(log *slog.Logger, privacyService *services.PrivacyService, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/users/privacy/EraseUserHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(tenant.WithoutOrg(r.Context()), timeout)
+		defer cancel()
+
+		actorID, ok := currentUserID(w, r, log)
+		if !ok {
+			return
+		}
+		id, ok := userIDParam(w, r, log)
+		if !ok {
+			return
+		}
+		var requestBody privacy.EraseUserRequest
+		if err := body.DecodeAndValidateJson(r, &requestBody); err != nil {
+			log.Error("Error while decoding request body", "err", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+			return
+		}
+
+		if err := privacyService.EraseNow(ctx, actorID, id, requestBody.Reason, request.ClientIP(r)); err != nil {
+			renderPrivacyError(w, r, log, err)
+			return
+		}
+		render.NoContent(w, r)
+	}
+}
+
+// AdminCancelErasureHandler godoc
+// @Summary Отменить удаление данных пользователя
+// @Description Отменяет запрос пользователя на удаление, пока срок ожидания не истёк
+// @Tags admin
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Success 204
+// @Failure 404 {object} response.Response
+// @Router /admin/users/{id}/erasure [delete]
+func AdminCancelErasureHandler(log *slog.Logger, privacyService *services.PrivacyService, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/users/privacy/AdminCancelErasureHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(tenant.WithoutOrg(r.Context()), timeout)
+		defer cancel()
+
+		actorID, ok := currentUserID(w, r, log)
+		if !ok {
+			return
+		}
+		id, ok := userIDParam(w, r, log)
+		if !ok {
+			return
+		}
+		if err := privacyService.CancelErasure(ctx, actorID, id, request.ClientIP(r)); err != nil {
+			renderPrivacyError(w, r, log, err)
+			return
+		}
+		render.NoContent(w, r)
+	}
+}
+
+func currentUserID(w http.ResponseWriter, r *http.Request, log *slog.Logger) (int64, bool) {
+	userID, err := middlewares.UserIDFromContext(r.Context())
+	if err != nil {
+		log.Error("Error while getting user id from token", "err", err)
+		resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("Unauthorized"))
+		return 0, false
+	}
+	return userID, true
+}
+
+func userIDParam(w http.ResponseWriter, r *http.Request, log *slog.Logger) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		log.Error("User ID is invalid", "error", err)
+		resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error("Invalid user ID"))
+		return 0, false
+	}
+	return id, true
+}
+
+func toExportResponse(export services.UserDataExport) privacy.ExportResponse {
+	user := export.User
+	response := privacy.ExportResponse{
+		ExportedAt: time.Now().UTC(),
+		Profile: privacy.ExportProfile{
+			ID:              user.ID,
+			FirstName:       user.FirstName,
+			LastName:        user.LastName,
+			Email:           user.Email,
+			Username:        user.Username,
+			Phone:           user.Phone,
+			PhoneVerified:   user.PhoneVerified,
+			Status:          user.Status,
+			StatusReason:    user.StatusReason,
+			StatusExpiresAt: user.StatusExpiresAt,
+			Metadata: map[string]map[string]interface{}{
+				users_db.MetadataSectionUser:  user.Metadata.User,
+				users_db.MetadataSectionAdmin: user.Metadata.Admin,
+			},
+			CreatedAt: user.CreatedAt,
+			UpdatedAt: user.UpdatedAt,
+		},
+		Organizations:   make([]privacy.ExportMembership, 0, len(export.Memberships)),
+		Sessions:        make([]privacy.ExportSession, 0, len(export.Sessions)),
+		PasswordChanges: export.PasswordChanges,
+		AuditEvents:     make([]audit.EventResponse, 0, len(export.AuditEvents)),
+	}
+	if export.Erasure.DueAt != nil {
+		response.Erasure = &privacy.ErasureResponse{RequestedAt: export.Erasure.RequestedAt, DueAt: export.Erasure.DueAt}
+	}
+	for _, membership := range export.Memberships {
+		response.Organizations = append(response.Organizations, privacy.ExportMembership{
+			OrgID:    membership.OrgID,
+			OrgSlug:  membership.OrgSlug,
+			OrgName:  membership.OrgName,
+			JoinedAt: membership.JoinedAt,
+			Roles:    membership.Roles,
+			Groups:   membership.Groups,
+		})
+	}
+	for _, session := range export.Sessions {
+		response.Sessions = append(response.Sessions, privacy.ExportSession{
+			ID:        session.ID,
+			OrgID:     session.OrgID,
+			CreatedAt: session.CreatedAt,
+			UpdatedAt: session.UpdatedAt,
+		})
+	}
+	for _, event := range export.AuditEvents {
+		response.AuditEvents = append(response.AuditEvents, auditHandlers.ToEventResponse(event))
+	}
+	return response
+}
+
+func renderPrivacyError(w http.ResponseWriter, r *http.Request, log *slog.Logger, err error) {
+	switch {
+	case errors.Is(err, users_db.ErrUserNotFound), errors.Is(err, privacy_db.ErrNoErasureRequest):
+		resp.RenderResponse(w, r, http.StatusNotFound, resp.Error(err.Error()))
+	case errors.Is(err, users_db.ErrLastAdmin):
+		resp.RenderResponse(w, r, http.StatusConflict, resp.Error(err.Error()))
+	default:
+		log.Error("Error while processing personal data request", "err", err)
+		resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("Failed to process personal data request"))
+	}
+}
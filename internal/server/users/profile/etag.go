@@ -0,0 +1,30 @@
+package profile
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidIfMatch = errors.New("invalid If-Match header")
+
+// profileETag Версия профиля для оптимистичной блокировки. В Postgres updated_at хранится с точностью до микросекунд
+func profileETag(updatedAt time.Time) string {
+	return `"` + strconv.FormatInt(updatedAt.UnixMicro(), 10) + `"`
+}
+
+// expectedVersion Достаёт версию из If-Match. nil - заголовка нет или он равен "*", т.е. изменять можно любую версию
+func expectedVersion(r *http.Request) (*time.Time, error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" || header == "*" {
+		return nil, nil
+	}
+	micros, err := strconv.ParseInt(strings.Trim(strings.TrimPrefix(header, "W/"), `"`), 10, 64)
+	if err != nil {
+		return nil, ErrInvalidIfMatch
+	}
+	version := time.UnixMicro(micros)
+	return &version, nil
+}
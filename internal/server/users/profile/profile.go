@@ -0,0 +1,200 @@
+package profile
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/body"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/middlewares"
+	resp "github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/user_metadata"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/models/users/profile"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// GetMeHandler godoc
+// @Summary Мой профиль
+// @Description Возвращает профиль текущего пользователя. Заголовок ETag нужен для If-Match при изменении и удалении
+// @Tags Users
+// @Security BearerAuth
+// @Success 200 {object} profile.ProfileResponse
+// @Failure 401 {object} response.Response
+// @Router /me [get]
+func GetMeHandler(log *slog.Logger, userRepo users_db.UserRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/users/profile/GetMeHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		userID, err := middlewares.UserIDFromContext(r.Context())
+		if err != nil {
+			log.Error("Error while getting user id from token", "err", err)
+			resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("Unauthorized"))
+			return
+		}
+
+		user, err := userRepo.GetUserByID(ctx, userID)
+		if err != nil {
+			renderProfileError(w, r, log, err)
+			return
+		}
+		renderProfile(w, r, http.StatusOK, user)
+	}
+}
+
+// UpdateMeHandler godoc
+// @Summary Изменить мой профиль
+// @Description Частично обновляет профиль текущего пользователя. При переданном If-Match (или updated_at в теле) профиль меняется, только если его не изменили с момента чтения. metadata.user заменяет секцию user атрибутов целиком и проверяется JSON схемой из METADATA_SCHEMA_FILE. Секцию admin менять нельзя
+// @Tags Users
+// @Security BearerAuth
+// @Param If-Match header string false "ETag из GET /me"
+// @Param input body profile.UpdateProfileRequest true "Изменяемые поля"
+// @Success 200 {object} profile.ProfileResponse
+// @Failure 400 {object} response.Response
+// @Failure 403 {object} response.Response
+// @Failure 412 {object} response.Response
+// @Router /me [patch]
+func UpdateMeHandler(log *slog.Logger, userRepo users_db.UserRepository, metadataValidator *user_metadata.Validator, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/users/profile/UpdateMeHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		userID, err := middlewares.UserIDFromContext(r.Context())
+		if err != nil {
+			log.Error("Error while getting user id from token", "err", err)
+			resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("Unauthorized"))
+			return
+		}
+		version, err := expectedVersion(r)
+		if err != nil {
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+			return
+		}
+
+		var request profile.UpdateProfileRequest
+		if err = body.DecodeAndValidateJson(r, &request); err != nil {
+			log.Error("Error while decoding request body", "err", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+			return
+		}
+		if version == nil && request.UpdatedAt != nil {
+			truncated := request.UpdatedAt.Truncate(time.Microsecond)
+			version = &truncated
+		}
+
+		update := users_db.ProfileUpdate{
+			FirstName: request.FirstName,
+			LastName:  request.LastName,
+			Username:  request.Username,
+		}
+		if request.Metadata != nil {
+			if request.Metadata.Admin != nil {
+				resp.RenderResponse(w, r, http.StatusForbidden, resp.Error("Admin metadata is read-only"))
+				return
+			}
+			if request.Metadata.User != nil {
+				if err = metadataValidator.Validate(users_db.MetadataSectionUser, request.Metadata.User); err != nil {
+					resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+					return
+				}
+				update.UserMetadata = request.Metadata.User
+			}
+		}
+
+		user, err := userRepo.UpdateProfile(ctx, userID, update, version)
+		if err != nil {
+			renderProfileError(w, r, log, err)
+			return
+		}
+		log.Info("Profile updated", "user_id", userID)
+		renderProfile(w, r, http.StatusOK, user)
+	}
+}
+
+// DeleteMeHandler godoc
+// @Summary Удалить мой аккаунт
+// @Description Удаляет текущего пользователя вместе со всеми его refresh токенами. Единственный администратор удалить себя не может
+// @Tags Users
+// @Security BearerAuth
+// @Param If-Match header string false "ETag из GET /me"
+// @Success 204
+// @Failure 409 {object} response.Response
+// @Failure 412 {object} response.Response
+// @Router /me [delete]
+func DeleteMeHandler(log *slog.Logger, userRepo users_db.UserRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/users/profile/DeleteMeHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		userID, err := middlewares.UserIDFromContext(r.Context())
+		if err != nil {
+			log.Error("Error while getting user id from token", "err", err)
+			resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("Unauthorized"))
+			return
+		}
+		version, err := expectedVersion(r)
+		if err != nil {
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+			return
+		}
+
+		if err = userRepo.DeleteUser(ctx, userID, version); err != nil {
+			renderProfileError(w, r, log, err)
+			return
+		}
+		log.Info("User deleted own account", "user_id", userID)
+		render.NoContent(w, r)
+	}
+}
+
+func renderProfile(w http.ResponseWriter, r *http.Request, status int, user users_db.UserInfo) {
+	w.Header().Set("ETag", profileETag(user.UpdatedAt))
+	resp.RenderResponse(w, r, status, profile.ProfileResponse{
+		ID:                    user.ID,
+		FirstName:             user.FirstName,
+		LastName:              user.LastName,
+		Email:                 user.Email,
+		Username:              user.Username,
+		OrgID:                 user.OrgID,
+		Roles:                 user.Roles,
+		Phone:                 user.Phone,
+		PhoneVerified:         user.PhoneVerified,
+		PasswordResetRequired: user.PasswordResetRequired,
+		Metadata:              profile.MetadataResponse{User: user.Metadata.User, Admin: user.Metadata.Admin},
+		CreatedAt:             user.CreatedAt,
+		UpdatedAt:             user.UpdatedAt,
+	})
+}
+
+func renderProfileError(w http.ResponseWriter, r *http.Request, log *slog.Logger, err error) {
+	switch {
+	case errors.Is(err, users_db.ErrUserNotFound):
+		// Токен ещё жив, а пользователя уже удалили
+		resp.RenderResponse(w, r, http.StatusUnauthorized, resp.Error("Unauthorized"))
+	case errors.Is(err, users_db.ErrUserModified):
+		resp.RenderResponse(w, r, http.StatusPreconditionFailed, resp.Error(err.Error()))
+	case errors.Is(err, users_db.ErrLastAdmin), errors.Is(err, users_db.ErrUsernameAlreadyExists):
+		resp.RenderResponse(w, r, http.StatusConflict, resp.Error(err.Error()))
+	default:
+		log.Error("Error while processing profile", "err", err)
+		resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error(err.Error()))
+	}
+}
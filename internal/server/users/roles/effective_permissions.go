@@ -0,0 +1,80 @@
+package roles
+
+import (
+	"context"
+	resp "github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/roles_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/models/users/roles"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Типы источников права
+const (
+	sourceRole      = "role"
+	sourceGroupRole = "group_role"
+	sourceGroup     = "group"
+)
+
+// EffectivePermissionsHandler godoc
+// @Summary Итоговые права пользователя
+// @Description Права пользователя в организации текущего токена с источниками: прямые роли, роли групп и права групп
+// @Tags admin
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Success 200 {array} roles.EffectivePermissionResponse
+// @Failure 404 {object} response.Response
+// @Router /admin/users/{id}/permissions [get]
+func EffectivePermissionsHandler(log *slog.Logger, rolesRepo roles_db.RolesRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/users/roles/EffectivePermissionsHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			log.Error("User ID is invalid", "error", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error("Invalid user ID"))
+			return
+		}
+
+		list, err := rolesRepo.EffectivePermissions(ctx, id)
+		if err != nil {
+			renderRoleError(w, r, log, err)
+			return
+		}
+		response := make([]roles.EffectivePermissionResponse, 0, len(list))
+		for _, permission := range list {
+			sources := make([]roles.PermissionSourceResponse, 0, len(permission.Sources))
+			for _, source := range permission.Sources {
+				sources = append(sources, toPermissionSourceResponse(source))
+			}
+			response = append(response, roles.EffectivePermissionResponse{Permission: permission.Name, Sources: sources})
+		}
+		resp.RenderResponse(w, r, http.StatusOK, response)
+	}
+}
+
+func toPermissionSourceResponse(source roles_db.PermissionSource) roles.PermissionSourceResponse {
+	response := roles.PermissionSourceResponse{
+		Type:      sourceRole,
+		Role:      source.Role,
+		GroupID:   source.GroupID,
+		GroupName: source.GroupName,
+	}
+	switch {
+	case source.GroupID != nil && source.Role != "":
+		response.Type = sourceGroupRole
+	case source.GroupID != nil:
+		response.Type = sourceGroup
+	}
+	return response
+}
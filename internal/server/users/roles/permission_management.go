@@ -0,0 +1,115 @@
+package roles
+
+import (
+	"context"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/body"
+	resp "github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/roles_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/models/users/roles"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// ListPermissionsHandler godoc
+// @Summary Список прав
+// @Tags admin
+// @Security BearerAuth
+// @Success 200 {array} roles.PermissionResponse
+// @Router /admin/permissions [get]
+func ListPermissionsHandler(log *slog.Logger, rolesRepo roles_db.RolesRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/users/roles/ListPermissionsHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		list, err := rolesRepo.ListPermissions(ctx)
+		if err != nil {
+			log.Error("Error while listing permissions", "err", err)
+			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("Failed to list permissions"))
+			return
+		}
+		response := make([]roles.PermissionResponse, 0, len(list))
+		for _, permission := range list {
+			response = append(response, roles.PermissionResponse{Name: permission.Name, Description: permission.Description})
+		}
+		resp.RenderResponse(w, r, http.StatusOK, response)
+	}
+}
+
+// GrantPermissionHandler godoc
+// @Summary Добавить право роли
+// @Description Изменения попадут в токены пользователей при следующем входе или обновлении токена
+// @Tags admin
+// @Security BearerAuth
+// @Param role path string true "Название роли"
+// @Param input body roles.GrantPermissionRequest true "Право"
+// @Success 204
+// @Failure 404 {object} response.Response
+// @Router /admin/roles/{role}/permissions [post]
+func GrantPermissionHandler(log *slog.Logger, rolesRepo roles_db.RolesRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/users/roles/GrantPermissionHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		roleName := chi.URLParam(r, "role")
+		var request roles.GrantPermissionRequest
+		if err := body.DecodeAndValidateJson(r, &request); err != nil {
+			log.Error("Error while decoding request body", "err", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+			return
+		}
+
+		if err := rolesRepo.GrantPermission(ctx, roleName, request.Permission); err != nil {
+			renderRoleError(w, r, log, err)
+			return
+		}
+		log.Info("Permission granted to role", "role", roleName, "permission", request.Permission)
+		render.NoContent(w, r)
+	}
+}
+
+// RevokePermissionHandler godoc
+// @Summary Убрать право у роли
+// @Description У роли admin права не забираются
+// @Tags admin
+// @Security BearerAuth
+// @Param role path string true "Название роли"
+// @Param permission path string true "Право"
+// @Success 204
+// @Failure 404 {object} response.Response
+// @Failure 409 {object} response.Response
+// @Router /admin/roles/{role}/permissions/{permission} [delete]
+func RevokePermissionHandler(log *slog.Logger, rolesRepo roles_db.RolesRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/users/roles/RevokePermissionHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		roleName := chi.URLParam(r, "role")
+		permission := chi.URLParam(r, "permission")
+
+		if err := rolesRepo.RevokePermission(ctx, roleName, permission); err != nil {
+			renderRoleError(w, r, log, err)
+			return
+		}
+		log.Info("Permission revoked from role", "role", roleName, "permission", permission)
+		render.NoContent(w, r)
+	}
+}
@@ -0,0 +1,194 @@
+package roles
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/body"
+	resp "github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/roles_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/models/users/roles"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ListRolesHandler godoc
+// @Summary Список ролей
+// @Tags admin
+// @Security BearerAuth
+// @Success 200 {array} roles.RoleResponse
+// @Router /admin/roles [get]
+func ListRolesHandler(log *slog.Logger, rolesRepo roles_db.RolesRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/users/roles/ListRolesHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		list, err := rolesRepo.ListRoles(ctx)
+		if err != nil {
+			log.Error("Error while listing roles", "err", err)
+			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("Failed to list roles"))
+			return
+		}
+		response := make([]roles.RoleResponse, 0, len(list))
+		for _, role := range list {
+			response = append(response, toRoleResponse(role))
+		}
+		resp.RenderResponse(w, r, http.StatusOK, response)
+	}
+}
+
+// CreateRoleHandler godoc
+// @Summary Создать роль
+// @Tags admin
+// @Security BearerAuth
+// @Param input body roles.CreateRoleRequest true "Роль"
+// @Success 201 {object} roles.RoleResponse
+// @Failure 409 {object} response.Response
+// @Router /admin/roles [post]
+func CreateRoleHandler(log *slog.Logger, rolesRepo roles_db.RolesRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/users/roles/CreateRoleHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		var request roles.CreateRoleRequest
+		if err := body.DecodeAndValidateJson(r, &request); err != nil {
+			log.Error("Error while decoding request body", "err", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+			return
+		}
+
+		role, err := rolesRepo.CreateRole(ctx, request.Name, request.Description)
+		if err != nil {
+			if errors.Is(err, roles_db.ErrRoleAlreadyExists) {
+				resp.RenderResponse(w, r, http.StatusConflict, resp.Error(err.Error()))
+				return
+			}
+			log.Error("Error while creating role", "err", err)
+			resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("Failed to create role"))
+			return
+		}
+		log.Info("Role created", "role", role.Name)
+		resp.RenderResponse(w, r, http.StatusCreated, toRoleResponse(role))
+	}
+}
+
+// GrantRoleHandler godoc
+// @Summary Выдать роль пользователю
+// @Description Новая роль попадёт в токен при следующем входе или обновлении токена
+// @Tags admin
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Param input body roles.GrantRoleRequest true "Роль"
+// @Success 204
+// @Failure 404 {object} response.Response
+// @Router /admin/users/{id}/roles [post]
+func GrantRoleHandler(log *slog.Logger, rolesRepo roles_db.RolesRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/users/roles/GrantRoleHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			log.Error("User ID is invalid", "error", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error("Invalid user ID"))
+			return
+		}
+		var request roles.GrantRoleRequest
+		if err = body.DecodeAndValidateJson(r, &request); err != nil {
+			log.Error("Error while decoding request body", "err", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error(err.Error()))
+			return
+		}
+
+		if err = rolesRepo.GrantRole(ctx, id, request.Role); err != nil {
+			renderRoleError(w, r, log, err)
+			return
+		}
+		log.Info("Role granted", "user_id", id, "role", request.Role)
+		render.NoContent(w, r)
+	}
+}
+
+// RevokeRoleHandler godoc
+// @Summary Забрать роль у пользователя
+// @Description Последнего администратора нельзя лишить роли admin
+// @Tags admin
+// @Security BearerAuth
+// @Param id path int true "ID пользователя"
+// @Param role path string true "Название роли"
+// @Success 204
+// @Failure 404 {object} response.Response
+// @Failure 409 {object} response.Response
+// @Router /admin/users/{id}/roles/{role} [delete]
+func RevokeRoleHandler(log *slog.Logger, rolesRepo roles_db.RolesRepository, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "server/users/roles/RevokeRoleHandler"
+		log := log.With(
+			slog.String("op", op),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			log.Error("User ID is invalid", "error", err)
+			resp.RenderResponse(w, r, http.StatusBadRequest, resp.Error("Invalid user ID"))
+			return
+		}
+		roleName := chi.URLParam(r, "role")
+
+		if err = rolesRepo.RevokeRole(ctx, id, roleName); err != nil {
+			renderRoleError(w, r, log, err)
+			return
+		}
+		log.Info("Role revoked", "user_id", id, "role", roleName)
+		render.NoContent(w, r)
+	}
+}
+
+func renderRoleError(w http.ResponseWriter, r *http.Request, log *slog.Logger, err error) {
+	switch {
+	case errors.Is(err, roles_db.ErrRoleNotFound), errors.Is(err, roles_db.ErrRoleNotGranted),
+		errors.Is(err, roles_db.ErrPermissionNotFound), errors.Is(err, users_db.ErrUserNotFound):
+		resp.RenderResponse(w, r, http.StatusNotFound, resp.Error(err.Error()))
+	case errors.Is(err, users_db.ErrLastAdmin), errors.Is(err, roles_db.ErrAdminPermissions):
+		resp.RenderResponse(w, r, http.StatusConflict, resp.Error(err.Error()))
+	case errors.Is(err, roles_db.ErrSharedRole):
+		resp.RenderResponse(w, r, http.StatusForbidden, resp.Error(err.Error()))
+	default:
+		log.Error("Error while changing user roles", "err", err)
+		resp.RenderResponse(w, r, http.StatusInternalServerError, resp.Error("Failed to change user roles"))
+	}
+}
+
+func toRoleResponse(role roles_db.Role) roles.RoleResponse {
+	return roles.RoleResponse{
+		ID:          role.ID,
+		OrgID:       role.OrgID,
+		Name:        role.Name,
+		Description: role.Description,
+		Permissions: role.Permissions,
+		CreatedAt:   role.CreatedAt,
+	}
+}
@@ -0,0 +1,86 @@
+package roles_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/server/users/roles"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/roles_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	rolesDto "github.com/ShlykovPavel/auth-JWT-microservice/models/users/roles"
+	"github.com/go-chi/chi/v5"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type fakeRolesRepo struct {
+	roles_db.RolesRepository
+	permissions map[int64][]roles_db.EffectivePermission
+}
+
+func (f *fakeRolesRepo) EffectivePermissions(_ context.Context, userID int64) ([]roles_db.EffectivePermission, error) {
+	list, ok := f.permissions[userID]
+	if !ok {
+		return nil, users_db.ErrUserNotFound
+	}
+	return list, nil
+}
+
+func TestEffectivePermissionsHandler(t *testing.T) {
+	groupID := int64(7)
+	repo := &fakeRolesRepo{permissions: map[int64][]roles_db.EffectivePermission{
+		1: {
+			{Name: "users:read", Sources: []roles_db.PermissionSource{
+				{Role: "support"},
+				{Role: "auditor", GroupID: &groupID, GroupName: "ops"},
+			}},
+			{Name: "users:write", Sources: []roles_db.PermissionSource{{GroupID: &groupID, GroupName: "ops"}}},
+		},
+	}}
+	router := chi.NewRouter()
+	router.Get("/admin/users/{id}/permissions", roles.EffectivePermissionsHandler(slog.Default(), repo, time.Second))
+
+	tests := []struct {
+		TestName       string
+		Path           string
+		ExpectedStatus int
+		ExpectedTypes  map[string][]string
+	}{
+		{
+			TestName:       "Direct and group sources",
+			Path:           "/admin/users/1/permissions",
+			ExpectedStatus: http.StatusOK,
+			ExpectedTypes:  map[string][]string{"users:read": {"role", "group_role"}, "users:write": {"group"}},
+		},
+		{TestName: "Not a member", Path: "/admin/users/2/permissions", ExpectedStatus: http.StatusNotFound},
+		{TestName: "Invalid id", Path: "/admin/users/abc/permissions", ExpectedStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.TestName, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.Path, nil))
+			if rec.Code != tt.ExpectedStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.ExpectedStatus)
+			}
+			if tt.ExpectedTypes == nil {
+				return
+			}
+			var response []rolesDto.EffectivePermissionResponse
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			types := make(map[string][]string)
+			for _, permission := range response {
+				for _, source := range permission.Sources {
+					types[permission.Permission] = append(types[permission.Permission], source.Type)
+				}
+			}
+			if !reflect.DeepEqual(types, tt.ExpectedTypes) {
+				t.Fatalf("source types = %v, want %v", types, tt.ExpectedTypes)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package roles_test
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/password_policy"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/tenant"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/server/users"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/server/users/roles"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/memory"
+	"log/slog"
+	"testing"
+)
+
+// Пустое хранилище без BOOTSTRAP_ADMIN_* не получает администратора с известным паролем
+func TestCheckAdminInDB(t *testing.T) {
+	repo := memory.NewUserRepository(memory.NewStore())
+	policy := password_policy.NewPolicy(password_policy.Policy{MinLength: 12})
+	log := slog.Default()
+
+	for _, tt := range []struct {
+		TestName string
+		Email    string
+		Password string
+	}{
+		{TestName: "no email and password"},
+		{TestName: "no password", Email: "root@example.com"},
+		{TestName: "invalid email", Email: "root", Password: "long enough password"},
+		{TestName: "weak password", Email: "root@example.com", Password: "password"},
+	} {
+		if err := roles.CheckAdminInDB(repo, tt.Email, tt.Password, policy, log); err == nil {
+			t.Errorf("%s: expected error", tt.TestName)
+		}
+	}
+	if err := roles.CheckAdminInDB(repo, "", "", policy, log); !errors.Is(err, roles.ErrNoBootstrapAdmin) {
+		t.Errorf("Expected ErrNoBootstrapAdmin, got %v", err)
+	}
+	if _, err := repo.CheckAdminInDB(context.Background()); err == nil {
+		t.Fatal("Expected no admin after rejected configs")
+	}
+
+	if err := roles.CheckAdminInDB(repo, "Root@Example.com", "long enough password", policy, log); err != nil {
+		t.Fatal("CheckAdminInDB is failed. Error: ", err)
+	}
+	admin, err := repo.GetUser(tenant.WithoutOrg(context.Background()), "root@example.com")
+	if err != nil {
+		t.Fatal("GetUser is failed. Error: ", err)
+	}
+	if !admin.HasRole(users_db.RoleAdmin) || !users.ComparePassword(admin.PasswordHash, "long enough password", log) {
+		t.Errorf("Unexpected admin %+v", admin)
+	}
+
+	// Администратор уже есть: конфиг больше не нужен
+	if err = roles.CheckAdminInDB(repo, "", "", policy, log); err != nil {
+		t.Errorf("Expected existing admin to be enough, got %v", err)
+	}
+}
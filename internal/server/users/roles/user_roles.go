@@ -5,39 +5,53 @@ import (
 	"errors"
 	"fmt"
 	resp "github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/password_policy"
 	"github.com/ShlykovPavel/auth-JWT-microservice/internal/server/users"
 	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
 	"github.com/go-chi/chi/v5"
 	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
 	"log/slog"
 	"net/http"
+	"net/mail"
 	"strconv"
 )
 
-func CheckAdminInDB(poll *pgxpool.Pool, log *slog.Logger) error {
-	userRepository := users_db.NewUsersDB(poll, log)
+// ErrNoBootstrapAdmin В хранилище нет администратора, а первый администратор не задан в конфиге
+var ErrNoBootstrapAdmin = errors.New("no admin found: set BOOTSTRAP_ADMIN_EMAIL and BOOTSTRAP_ADMIN_PASSWORD to create the first one")
 
+// CheckAdminInDB Создаёт первого администратора с email и паролем из конфига, если в организации по умолчанию нет ни одного.
+// Администратора с известным паролем по умолчанию нет: без email и пароля на пустом хранилище возвращается ErrNoBootstrapAdmin.
+// Пароль проверяется политикой паролей, как при регистрации
+func CheckAdminInDB(userRepository users_db.UserRepository, email string, password string, policy *password_policy.Policy, log *slog.Logger) error {
 	user, err := userRepository.CheckAdminInDB(context.Background())
-	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			log.Error("no admin role found", "error", err)
-			//Создаём захэшированный пароль
-			passwordHash, err := users.HashUserPassword("password", log)
-			if err != nil {
-				log.Error("Error while hashing password", "err", err)
-				return fmt.Errorf("failed to hash password: %w", err)
-			}
-			err = userRepository.AddFirstAdmin(context.Background(), passwordHash)
-			if err != nil {
-				log.Error("error adding admin role", "error", err)
-				return err
-			}
-		}
+	if err == nil {
+		log.Info("admin role check ok. no need to create admin role", "user_id", user.ID)
+		return nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
 		log.Error("error checking admin role", "error", err)
 		return err
 	}
-	log.Info("admin role check ok. no need to create admin role. Found admin:", "user", user)
+	if email == "" || password == "" {
+		return ErrNoBootstrapAdmin
+	}
+	if _, err = mail.ParseAddress(email); err != nil {
+		return fmt.Errorf("invalid BOOTSTRAP_ADMIN_EMAIL: %w", err)
+	}
+	email = users_db.NormalizeEmail(email)
+	if err = users.CheckPasswordPolicy(policy, password, password_policy.PersonalInfo{Email: email}, nil, log); err != nil {
+		return fmt.Errorf("BOOTSTRAP_ADMIN_PASSWORD does not satisfy the password policy: %w", err)
+	}
+	passwordHash, err := users.HashUserPassword(password, log)
+	if err != nil {
+		log.Error("Error while hashing password", "err", err)
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	if err = userRepository.AddFirstAdmin(context.Background(), email, passwordHash); err != nil {
+		log.Error("error adding admin role", "error", err)
+		return err
+	}
+	log.Warn("First admin created from BOOTSTRAP_ADMIN_EMAIL", "email", email)
 	return nil
 }
 
@@ -64,7 +78,7 @@ func SetAdminRole(log *slog.Logger, userRepo users_db.UserRepository) http.Handl
 			return
 		}
 
-		err = userRepo.SetAdminRole(context.Background(), id)
+		err = userRepo.SetAdminRole(r.Context(), id)
 		if err != nil {
 			if errors.Is(err, users_db.ErrUserNotFound) {
 				log.Debug("user not found", "error", err)
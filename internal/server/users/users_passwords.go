@@ -1,35 +1,44 @@
 package users
 
 import (
-	"golang.org/x/crypto/bcrypt"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/password_hasher"
 	"log/slog"
 )
 
-// HashUserPassword хеширует пароль
+// HashUserPassword хеширует пароль основным алгоритмом приложения (bcrypt или argon2id)
 // при хешировании автоматически генерируется соль
-// ограничение длинны пароля 72 байта (можно выставить 64 символа)
+// для bcrypt ограничение длинны пароля 72 байта, это учитывает политика паролей
 func HashUserPassword(password string, log *slog.Logger) (string, error) {
 	log = log.With(
 		slog.String("operation", "server/users.HashUserPassword"))
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := password_hasher.GetHasher().Hash(password)
 	if err != nil {
 		log.Error("Hashing password is failed. Error: ", "err", err)
 		return "", err
 	}
-	return string(hashedPassword), nil
+	return hashedPassword, nil
 }
 
 // ComparePassword Проверяет пароль на соответствие
 //
-// Из переданного хеша пароля он сам достаёт соль, и хеширует пароль с этой солью
-// Если пароли совпадают, то ничего не возвращается
+// Алгоритм и соль определяются по самому хешу, поэтому проверяются и хеши старых алгоритмов
+// Если пароли совпадают, возвращается true
 func ComparePassword(hashedPassword string, password string, log *slog.Logger) bool {
 	log = log.With(
 		slog.String("operation", "server/users.ComparePassword"))
-	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+	ok, err := password_hasher.GetHasher().Compare(hashedPassword, password)
 	if err != nil {
-		log.Error("Password is incorrect. Error: ", "err", err)
+		log.Error("Password compare is failed. Error: ", "err", err)
+		return false
+	}
+	if !ok {
+		log.Debug("Password is incorrect")
 		return false
 	}
 	return true
 }
+
+// PasswordNeedsRehash Проверяет, сделан ли хеш устаревшим алгоритмом или с устаревшими параметрами
+func PasswordNeedsRehash(hashedPassword string) bool {
+	return password_hasher.GetHasher().NeedsRehash(hashedPassword)
+}
@@ -9,8 +9,10 @@ import (
 const PSQLUniqueError = "23505"                    // Нарушение уникальности поля
 const PSQLForeignKeyError = "23503"                // Нарушение внешнего ключа
 const PSQLNotNullError = "23502"                   // Нельзя вставить NULL
+const PSQLCheckError = "23514"                     // Нарушение ограничения CHECK
 const PSQLStringDataRightTruncationError = "22001" // Данные слишком длинные
 const PSQLSyntaxError = "42601"                    // Синтаксическая ошибка в SQL
+const PSQLInvalidDatetimeError = "22007"           // Строку нельзя привести к дате и времени
 
 func PsqlErrorHandler(err error) error {
 	if pgErr, ok := err.(*pgconn.PgError); ok {
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS password_history
+(
+    id            SERIAL PRIMARY KEY,
+    user_id       INTEGER      NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    password_hash VARCHAR(256) NOT NULL,
+    created_at    TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_password_history_user_id_created_at ON password_history (user_id, created_at DESC);
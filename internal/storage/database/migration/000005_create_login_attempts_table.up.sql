@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS login_attempts
+(
+    scope          VARCHAR(16)  NOT NULL,
+    key            VARCHAR(256) NOT NULL,
+    failed_count   INTEGER      NOT NULL DEFAULT 0,
+    last_failed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    locked_until   TIMESTAMP WITH TIME ZONE,
+    PRIMARY KEY (scope, key)
+);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS otp_codes;
+DROP INDEX IF EXISTS idx_users_verified_phone;
+ALTER TABLE users
+    DROP COLUMN IF EXISTS phone_verified_at,
+    DROP COLUMN IF EXISTS phone;
@@ -0,0 +1,22 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS phone             VARCHAR(32),
+    ADD COLUMN IF NOT EXISTS phone_verified_at TIMESTAMP WITH TIME ZONE;
+
+-- Номер может быть указан у нескольких пользователей, пока его не подтвердили, но подтверждён только у одного
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_verified_phone ON users (phone) WHERE phone_verified_at IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS otp_codes
+(
+    id          SERIAL PRIMARY KEY,
+    purpose     VARCHAR(16) NOT NULL,
+    phone       VARCHAR(32) NOT NULL,
+    user_id     INTEGER     NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    code_hash   VARCHAR(64) NOT NULL,
+    attempts    INTEGER     NOT NULL DEFAULT 0,
+    expires_at  TIMESTAMP WITH TIME ZONE NOT NULL,
+    consumed_at TIMESTAMP WITH TIME ZONE,
+    created_at  TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_otp_codes_purpose_phone_created_at ON otp_codes (purpose, phone, created_at DESC);
@@ -0,0 +1,16 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS role VARCHAR;
+
+UPDATE users
+SET role = CASE
+               WHEN EXISTS (SELECT 1
+                            FROM user_roles
+                                     JOIN roles ON roles.id = user_roles.role_id
+                            WHERE user_roles.user_id = users.id
+                              AND roles.name = 'admin') THEN 'admin'
+               ELSE 'user' END;
+
+CREATE INDEX IF NOT EXISTS idx_users_role ON users (role);
+
+DROP TABLE IF EXISTS user_roles;
+DROP TABLE IF EXISTS roles;
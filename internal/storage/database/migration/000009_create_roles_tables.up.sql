@@ -0,0 +1,41 @@
+CREATE TABLE IF NOT EXISTS roles
+(
+    id          SERIAL PRIMARY KEY,
+    name        VARCHAR(64)  NOT NULL UNIQUE,
+    description VARCHAR(256) NOT NULL DEFAULT '',
+    created_at  TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO roles (name, description)
+VALUES ('admin', 'Full access to administrative endpoints'),
+       ('user', 'Default role of every registered user')
+ON CONFLICT (name) DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS user_roles
+(
+    user_id    INTEGER NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    role_id    INTEGER NOT NULL,
+    FOREIGN KEY (role_id) REFERENCES roles (id) ON DELETE CASCADE,
+    granted_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, role_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_roles_role_id ON user_roles (role_id);
+
+-- Переносим единственную роль из users.role. Раньше админом считался любой, у кого в роли есть "admin"
+INSERT INTO user_roles (user_id, role_id)
+SELECT users.id, roles.id
+FROM users
+         JOIN roles ON roles.name = CASE WHEN users.role LIKE '%admin%' THEN 'admin' ELSE 'user' END
+ON CONFLICT DO NOTHING;
+
+-- Админы остаются и обычными пользователями
+INSERT INTO user_roles (user_id, role_id)
+SELECT users.id, roles.id
+FROM users
+         JOIN roles ON roles.name = 'user'
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS role;
@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS permissions
+(
+    id          SERIAL PRIMARY KEY,
+    name        VARCHAR(64)  NOT NULL UNIQUE,
+    description VARCHAR(256) NOT NULL DEFAULT ''
+);
+
+INSERT INTO permissions (name, description)
+VALUES ('users:read', 'View users in the admin directory'),
+       ('users:write', 'Modify other users, unlock logins'),
+       ('roles:read', 'View roles and their permissions'),
+       ('roles:write', 'Create roles, grant and revoke roles and permissions'),
+       ('sessions:revoke', 'Revoke refresh tokens of other users')
+ON CONFLICT (name) DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS role_permissions
+(
+    role_id       INTEGER NOT NULL,
+    FOREIGN KEY (role_id) REFERENCES roles (id) ON DELETE CASCADE,
+    permission_id INTEGER NOT NULL,
+    FOREIGN KEY (permission_id) REFERENCES permissions (id) ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_role_permissions_permission_id ON role_permissions (permission_id);
+
+-- Администратор получает все права, что были у него раньше
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles,
+     permissions
+WHERE roles.name = 'admin'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,2 @@
+DELETE FROM permissions WHERE name IN ('authz:check', 'policies:write');
+DROP TABLE IF EXISTS policy_rules;
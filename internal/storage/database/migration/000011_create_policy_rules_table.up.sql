@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS policy_rules
+(
+    id          SERIAL PRIMARY KEY,
+    rule_id     VARCHAR(128) NOT NULL UNIQUE,
+    description VARCHAR(512) NOT NULL DEFAULT '',
+    effect      VARCHAR(8)   NOT NULL CHECK (effect IN ('allow', 'deny')),
+    actions     JSONB        NOT NULL,
+    resources   JSONB        NOT NULL,
+    conditions  JSONB        NOT NULL DEFAULT '[]',
+    enabled     BOOLEAN      NOT NULL DEFAULT TRUE,
+    created_at  TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at  TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TRIGGER update_policy_rules_updated_at
+    BEFORE UPDATE ON policy_rules
+    FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
+
+INSERT INTO permissions (name, description)
+VALUES ('authz:check', 'Ask the policy engine for access decisions'),
+       ('policies:write', 'Create, change and delete access policy rules')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles,
+     permissions
+WHERE roles.name = 'admin'
+  AND permissions.name IN ('authz:check', 'policies:write')
+ON CONFLICT DO NOTHING;
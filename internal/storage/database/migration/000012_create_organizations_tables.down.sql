@@ -0,0 +1,30 @@
+DELETE FROM permissions WHERE name = 'orgs:write';
+
+-- Возвращаемся к одной организации: всё, что выдано в других, теряется
+ALTER TABLE tokens
+    DROP CONSTRAINT IF EXISTS fk_tokens_membership;
+DELETE FROM tokens WHERE org_id <> 1;
+ALTER TABLE tokens
+    DROP COLUMN IF EXISTS org_id;
+
+ALTER TABLE user_roles
+    DROP CONSTRAINT IF EXISTS fk_user_roles_membership;
+DROP INDEX IF EXISTS idx_user_roles_user_id;
+DELETE FROM user_roles WHERE org_id <> 1;
+ALTER TABLE user_roles
+    DROP CONSTRAINT IF EXISTS user_roles_pkey;
+ALTER TABLE user_roles
+    DROP COLUMN IF EXISTS org_id;
+ALTER TABLE user_roles
+    ADD PRIMARY KEY (user_id, role_id);
+
+DELETE FROM roles WHERE org_id IS NOT NULL;
+DROP INDEX IF EXISTS idx_roles_org_name;
+DROP INDEX IF EXISTS idx_roles_shared_name;
+ALTER TABLE roles
+    DROP COLUMN IF EXISTS org_id;
+ALTER TABLE roles
+    ADD CONSTRAINT roles_name_key UNIQUE (name);
+
+DROP TABLE IF EXISTS organization_members;
+DROP TABLE IF EXISTS organizations;
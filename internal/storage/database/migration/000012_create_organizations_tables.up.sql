@@ -0,0 +1,75 @@
+CREATE TABLE IF NOT EXISTS organizations
+(
+    id         SERIAL PRIMARY KEY,
+    slug       VARCHAR(64)  NOT NULL UNIQUE,
+    name       VARCHAR(128) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Организация по умолчанию (tenant.DefaultOrgID в коде): в неё попадают все существующие пользователи
+-- и публичная регистрация, её администраторы управляют организациями и общими ролями
+INSERT INTO organizations (id, slug, name)
+VALUES (1, 'default', 'Default organization')
+ON CONFLICT (id) DO NOTHING;
+SELECT setval(pg_get_serial_sequence('organizations', 'id'), GREATEST((SELECT MAX(id) FROM organizations), 1));
+
+-- Пользователь (и его email) один на все организации, а состоять он может в нескольких
+CREATE TABLE IF NOT EXISTS organization_members
+(
+    org_id    INTEGER NOT NULL,
+    FOREIGN KEY (org_id) REFERENCES organizations (id) ON DELETE CASCADE,
+    user_id   INTEGER NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    joined_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (org_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_organization_members_user_id ON organization_members (user_id);
+
+INSERT INTO organization_members (org_id, user_id)
+SELECT 1, id
+FROM users
+ON CONFLICT DO NOTHING;
+
+-- Встроенные роли (org_id IS NULL) общие для всех организаций, свои роли организация заводит сама
+ALTER TABLE roles
+    ADD COLUMN IF NOT EXISTS org_id INTEGER REFERENCES organizations (id) ON DELETE CASCADE;
+ALTER TABLE roles
+    DROP CONSTRAINT IF EXISTS roles_name_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_roles_shared_name ON roles (name) WHERE org_id IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_roles_org_name ON roles (org_id, name) WHERE org_id IS NOT NULL;
+
+-- Роли выдаются в рамках организации. Исключённый из организации пользователь теряет её роли и сессии
+ALTER TABLE user_roles
+    ADD COLUMN IF NOT EXISTS org_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE user_roles
+    ALTER COLUMN org_id DROP DEFAULT;
+ALTER TABLE user_roles
+    DROP CONSTRAINT IF EXISTS user_roles_pkey;
+ALTER TABLE user_roles
+    ADD PRIMARY KEY (org_id, user_id, role_id);
+ALTER TABLE user_roles
+    ADD CONSTRAINT fk_user_roles_membership FOREIGN KEY (org_id, user_id)
+        REFERENCES organization_members (org_id, user_id) ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS idx_user_roles_user_id ON user_roles (user_id);
+
+ALTER TABLE tokens
+    ADD COLUMN IF NOT EXISTS org_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE tokens
+    ALTER COLUMN org_id DROP DEFAULT;
+ALTER TABLE tokens
+    ADD CONSTRAINT fk_tokens_membership FOREIGN KEY (org_id, user_id)
+        REFERENCES organization_members (org_id, user_id) ON DELETE CASCADE;
+
+INSERT INTO permissions (name, description)
+VALUES ('orgs:write', 'Create organizations (only from the default organization)')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles,
+     permissions
+WHERE roles.name = 'admin'
+  AND roles.org_id IS NULL
+  AND permissions.name = 'orgs:write'
+ON CONFLICT DO NOTHING;
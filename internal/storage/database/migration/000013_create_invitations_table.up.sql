@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS invitations
+(
+    id               SERIAL PRIMARY KEY,
+    org_id           INTEGER      NOT NULL,
+    FOREIGN KEY (org_id) REFERENCES organizations (id) ON DELETE CASCADE,
+    email            VARCHAR(256) NOT NULL,
+    roles            TEXT[]       NOT NULL DEFAULT '{}',
+    token_hash       VARCHAR(64)  NOT NULL UNIQUE,
+    invited_by       INTEGER,
+    FOREIGN KEY (invited_by) REFERENCES users (id) ON DELETE SET NULL,
+    expires_at       TIMESTAMP WITH TIME ZONE NOT NULL,
+    accepted_at      TIMESTAMP WITH TIME ZONE,
+    accepted_user_id INTEGER,
+    FOREIGN KEY (accepted_user_id) REFERENCES users (id) ON DELETE SET NULL,
+    revoked_at       TIMESTAMP WITH TIME ZONE,
+    created_at       TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_invitations_org_id_created_at ON invitations (org_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_invitations_email ON invitations (email);
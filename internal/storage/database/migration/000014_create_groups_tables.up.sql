@@ -0,0 +1,44 @@
+CREATE TABLE IF NOT EXISTS groups
+(
+    id          SERIAL PRIMARY KEY,
+    org_id      INTEGER     NOT NULL,
+    FOREIGN KEY (org_id) REFERENCES organizations (id) ON DELETE CASCADE,
+    name        VARCHAR(64) NOT NULL,
+    description VARCHAR(256) NOT NULL DEFAULT '',
+    created_at  TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (org_id, name),
+    -- Для внешнего ключа участников: группа и участник должны быть из одной организации
+    UNIQUE (org_id, id)
+);
+
+CREATE TABLE IF NOT EXISTS group_members
+(
+    org_id   INTEGER NOT NULL,
+    group_id INTEGER NOT NULL,
+    user_id  INTEGER NOT NULL,
+    added_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (group_id, user_id),
+    FOREIGN KEY (org_id, group_id) REFERENCES groups (org_id, id) ON DELETE CASCADE,
+    -- Исключённый из организации пользователь выходит и из её групп
+    FOREIGN KEY (org_id, user_id) REFERENCES organization_members (org_id, user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_group_members_user_id ON group_members (user_id, org_id);
+
+CREATE TABLE IF NOT EXISTS group_roles
+(
+    group_id INTEGER NOT NULL,
+    role_id  INTEGER NOT NULL,
+    PRIMARY KEY (group_id, role_id),
+    FOREIGN KEY (group_id) REFERENCES groups (id) ON DELETE CASCADE,
+    FOREIGN KEY (role_id) REFERENCES roles (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS group_permissions
+(
+    group_id      INTEGER NOT NULL,
+    permission_id INTEGER NOT NULL,
+    PRIMARY KEY (group_id, permission_id),
+    FOREIGN KEY (group_id) REFERENCES groups (id) ON DELETE CASCADE,
+    FOREIGN KEY (permission_id) REFERENCES permissions (id) ON DELETE CASCADE
+);
@@ -0,0 +1,8 @@
+ALTER TABLE users
+    DROP COLUMN IF EXISTS status_changed_at;
+ALTER TABLE users
+    DROP COLUMN IF EXISTS status_expires_at;
+ALTER TABLE users
+    DROP COLUMN IF EXISTS status_reason;
+ALTER TABLE users
+    DROP CONSTRAINT IF EXISTS chk_users_status;
@@ -0,0 +1,11 @@
+-- Статус аккаунта: active, suspended (временная блокировка администратором) или deactivated.
+-- status_expires_at - когда текущий статус перестаёт действовать: блокировка снимается, а активный аккаунт истекает
+UPDATE users SET status = 'active' WHERE status NOT IN ('active', 'suspended', 'deactivated');
+ALTER TABLE users
+    ADD CONSTRAINT chk_users_status CHECK (status IN ('active', 'suspended', 'deactivated'));
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS status_reason VARCHAR(512) NOT NULL DEFAULT '';
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS status_expires_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS status_changed_at TIMESTAMP WITH TIME ZONE;
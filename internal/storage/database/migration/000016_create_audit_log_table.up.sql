@@ -0,0 +1,31 @@
+-- Журнал действий администраторов. Внешних ключей на users нет намеренно:
+-- запись должна пережить удаление и администратора, и пользователя
+CREATE TABLE IF NOT EXISTS audit_log
+(
+    id             BIGSERIAL PRIMARY KEY,
+    org_id         INTEGER,
+    actor_id       INTEGER,
+    action         VARCHAR(64) NOT NULL,
+    target_user_id INTEGER,
+    reason         VARCHAR(512) NOT NULL DEFAULT '',
+    ip             VARCHAR(64)  NOT NULL DEFAULT '',
+    details        JSONB        NOT NULL DEFAULT '{}'::jsonb,
+    created_at     TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_org_created ON audit_log (org_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor_id ON audit_log (actor_id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_target_user_id ON audit_log (target_user_id);
+
+INSERT INTO permissions (name, description)
+VALUES ('users:impersonate', 'Sign in as another user of the organization for support')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles,
+     permissions
+WHERE roles.name = 'admin'
+  AND roles.org_id IS NULL
+  AND permissions.name = 'users:impersonate'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,9 @@
+-- Удаление персональных данных по запросу пользователя: запрос ждёт erasure_due_at, потом профиль обезличивается.
+-- Строка users остаётся, что б ссылки из tokens и audit_log не повисли
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS erasure_requested_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS erasure_due_at       TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS erased_at            TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_users_erasure_due_at ON users (erasure_due_at)
+    WHERE erasure_due_at IS NOT NULL AND erased_at IS NULL;
@@ -0,0 +1,3 @@
+-- Пользователи из массового импорта без пароля: пароль пустой, задать его нужно после первого входа по ссылке или коду
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS password_reset_required BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_users_metadata;
+
+ALTER TABLE users
+    DROP CONSTRAINT IF EXISTS users_metadata_sections_check;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS metadata;
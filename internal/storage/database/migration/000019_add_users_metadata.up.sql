@@ -0,0 +1,11 @@
+-- Дополнительные атрибуты пользователя: user меняет сам пользователь, admin - только администраторы.
+-- Содержимое секций проверяется JSON схемой на стороне сервиса
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '{"user": {}, "admin": {}}'::jsonb;
+
+ALTER TABLE users
+    ADD CONSTRAINT users_metadata_sections_check CHECK (
+        jsonb_typeof(metadata -> 'user') = 'object' AND jsonb_typeof(metadata -> 'admin') = 'object');
+
+-- Фильтр списка пользователей по атрибутам работает через metadata @> '{...}'
+CREATE INDEX IF NOT EXISTS idx_users_metadata ON users USING GIN (metadata jsonb_path_ops);
@@ -0,0 +1,12 @@
+DROP INDEX IF EXISTS idx_invitations_email_lower;
+CREATE INDEX IF NOT EXISTS idx_invitations_email ON invitations (email);
+
+DROP INDEX IF EXISTS users_username_lower_key;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS username;
+
+DROP INDEX IF EXISTS users_email_lower_key;
+
+ALTER TABLE users
+    ADD CONSTRAINT users_email_key UNIQUE (email);
@@ -0,0 +1,40 @@
+-- Email сравнивается без учёта регистра: John@Corp.com и john@corp.com - один аккаунт.
+-- Если такие дубликаты уже есть, уникальный индекс не создать: миграция останавливается и перечисляет их.
+-- Дубликаты нужно разрешить вручную (объединить или переименовать аккаунты) и запустить миграцию снова
+DO $$
+DECLARE
+    collisions TEXT;
+BEGIN
+    SELECT string_agg(format('%s (ids %s)', normalized, ids), '; ' ORDER BY normalized)
+    INTO collisions
+    FROM (
+        SELECT lower(email) AS normalized, string_agg(id::text, ', ' ORDER BY id) AS ids
+        FROM users
+        GROUP BY lower(email)
+        HAVING count(*) > 1
+    ) AS duplicates;
+
+    IF collisions IS NOT NULL THEN
+        RAISE EXCEPTION 'users.email differs only in letter case: %', collisions
+            USING HINT = 'Merge or rename these accounts, then run the migration again';
+    END IF;
+END
+$$;
+
+-- Коллизий нет, приводим сохранённые адреса к виду, в котором их записывает сервис
+UPDATE users SET email = lower(email) WHERE email <> lower(email);
+
+ALTER TABLE users
+    DROP CONSTRAINT IF EXISTS users_email_key;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_lower_key ON users (lower(email));
+
+-- Необязательное имя пользователя для входа вместо email. Хранится в нижнем регистре
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS username VARCHAR(32);
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_username_lower_key ON users (lower(username)) WHERE username IS NOT NULL;
+
+-- Приглашения ищутся по email без учёта регистра
+DROP INDEX IF EXISTS idx_invitations_email;
+CREATE INDEX IF NOT EXISTS idx_invitations_email_lower ON invitations (lower(email));
@@ -0,0 +1,19 @@
+-- Смена email. Новый адрес подтверждается ссылкой из письма на него, а старый адрес получает ссылку отмены.
+-- Отменить можно и уже подтверждённую смену, пока не истёк cancel_expires_at: тогда email возвращается обратно
+CREATE TABLE IF NOT EXISTS email_changes
+(
+    id                 SERIAL PRIMARY KEY,
+    user_id            INTEGER      NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    old_email          VARCHAR(256) NOT NULL,
+    new_email          VARCHAR(256) NOT NULL,
+    confirm_token_hash VARCHAR(64)  NOT NULL UNIQUE,
+    cancel_token_hash  VARCHAR(64)  NOT NULL UNIQUE,
+    expires_at         TIMESTAMP WITH TIME ZONE NOT NULL,
+    cancel_expires_at  TIMESTAMP WITH TIME ZONE NOT NULL,
+    confirmed_at       TIMESTAMP WITH TIME ZONE,
+    cancelled_at       TIMESTAMP WITH TIME ZONE,
+    created_at         TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_changes_user_id ON email_changes (user_id);
@@ -0,0 +1,9 @@
+package migration
+
+import "embed"
+
+// FS SQL миграции схемы БД, встроенные в бинарник. Применяются при запуске сервиса пакетом migrator.
+// Новую миграцию достаточно положить в этот каталог парой файлов NNNNNN_<name>.up.sql и NNNNNN_<name>.down.sql
+//
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,349 @@
+package migrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"io/fs"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// advisoryLockKey Ключ pg_advisory_lock, под которым выполняются миграции. Реплики, запущенные одновременно,
+// ждут, пока первая закончит, и потом видят, что применять уже нечего
+const advisoryLockKey int64 = 7_241_856_301_001
+
+// versionTable Таблица с текущей версией схемы. Формат как у golang-migrate: одна строка (version, dirty),
+// поэтому базы, которые раньше мигрировались контейнером migrate/migrate, подхватываются как есть
+const versionTable = "schema_migrations"
+
+var (
+	ErrDirty           = errors.New("database schema is dirty: a previous migration failed halfway, fix the schema and force the version")
+	ErrNoDownMigration = errors.New("down migration is missing")
+	ErrUnknownVersion  = errors.New("unknown migration version")
+	ErrInvalidName     = errors.New("invalid migration file name")
+)
+
+var fileNamePattern = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Migration Одна миграция: SQL для применения и для отката
+type Migration struct {
+	Version uint
+	Name    string
+	Up      string
+	Down    string // Пустая строка - миграцию нельзя откатить
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("%06d_%s", m.Version, m.Name)
+}
+
+// Status Состояние схемы
+type Status struct {
+	Version uint // 0 - ни одна миграция не применялась
+	Dirty   bool
+	Latest  uint        // Последняя версия среди встроенных миграций
+	Pending []Migration // Ещё не применённые миграции по порядку
+}
+
+// Load Читает миграции из каталога fsys: файлы NNNNNN_<name>.up.sql и NNNNNN_<name>.down.sql.
+// Остальные файлы пропускаются. Миграции возвращаются по возрастанию версии
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[uint]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		match := fileNamePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			if strings.HasSuffix(entry.Name(), ".sql") {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidName, entry.Name())
+			}
+			continue
+		}
+		version, err := strconv.ParseUint(match[1], 10, 32)
+		if err != nil || version == 0 {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidName, entry.Name())
+		}
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[uint(version)]
+		if !ok {
+			migration = &Migration{Version: uint(version), Name: match[2]}
+			byVersion[uint(version)] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("%w: version %d has files with different names %q and %q", ErrInvalidName, version, migration.Name, match[2])
+		}
+		direction := &migration.Up
+		if match[3] == "down" {
+			direction = &migration.Down
+		}
+		if *direction != "" {
+			return nil, fmt.Errorf("%w: duplicate %s", ErrInvalidName, entry.Name())
+		}
+		*direction = string(data)
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("%w: %s has no up file", ErrInvalidName, migration)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrator Применяет миграции к БД. Каждая миграция выполняется в своей транзакции вместе с записью версии,
+// поэтому упавшая миграция не оставляет схему наполовину изменённой. Миграции с командами, которые нельзя
+// выполнять в транзакции (CREATE INDEX CONCURRENTLY и т.п.), не поддерживаются
+type Migrator struct {
+	pool       *pgxpool.Pool
+	migrations []Migration
+	log        *slog.Logger
+}
+
+// New Загружает миграции из fsys
+func New(pool *pgxpool.Pool, fsys fs.FS, log *slog.Logger) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{
+		pool:       pool,
+		migrations: migrations,
+		log:        log.With(slog.String("op", "internal/storage/database/migrator")),
+	}, nil
+}
+
+// Up Применяет все ещё не применённые миграции
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		version, dirty, err := readVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return fmt.Errorf("%w (version %d)", ErrDirty, version)
+		}
+		if latest := m.latest(); version > latest {
+			// Схему уже обновила реплика с более новой версией сервиса: это нормально во время выкатки
+			m.log.Warn("Database schema is newer than embedded migrations", slog.Uint64("version", uint64(version)), slog.Uint64("latest", uint64(latest)))
+			return nil
+		}
+		applied := 0
+		for _, migration := range m.migrations {
+			if migration.Version <= version {
+				continue
+			}
+			if err = m.apply(ctx, conn, migration.Up, migration.Version); err != nil {
+				return fmt.Errorf("migration %s failed: %w", migration, err)
+			}
+			m.log.Info("Migration applied", slog.String("migration", migration.String()))
+			applied++
+		}
+		if applied == 0 {
+			m.log.Info("Database schema is up to date", slog.Uint64("version", uint64(version)))
+		}
+		return nil
+	})
+}
+
+// Down Откатывает steps последних применённых миграций
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	return m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		version, dirty, err := readVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return fmt.Errorf("%w (version %d)", ErrDirty, version)
+		}
+		for ; steps > 0 && version > 0; steps-- {
+			index := m.index(version)
+			if index < 0 {
+				return fmt.Errorf("%w: database is at version %d", ErrUnknownVersion, version)
+			}
+			migration := m.migrations[index]
+			if migration.Down == "" {
+				return fmt.Errorf("%w: %s", ErrNoDownMigration, migration)
+			}
+			previous := uint(0)
+			if index > 0 {
+				previous = m.migrations[index-1].Version
+			}
+			if err = m.apply(ctx, conn, migration.Down, previous); err != nil {
+				return fmt.Errorf("rollback of %s failed: %w", migration, err)
+			}
+			m.log.Info("Migration rolled back", slog.String("migration", migration.String()))
+			version = previous
+		}
+		return nil
+	})
+}
+
+// Status Текущая версия схемы и миграции, которые ещё не применены
+func (m *Migrator) Status(ctx context.Context) (Status, error) {
+	conn, err := m.pool.Acquire(ctx)
+	if err != nil {
+		return Status{}, database.PsqlErrorHandler(err)
+	}
+	defer conn.Release()
+	if err = ensureVersionTable(ctx, conn); err != nil {
+		return Status{}, err
+	}
+	version, dirty, err := readVersion(ctx, conn)
+	if err != nil {
+		return Status{}, err
+	}
+	status := Status{Version: version, Dirty: dirty, Latest: m.latest()}
+	for _, migration := range m.migrations {
+		if migration.Version > version {
+			status.Pending = append(status.Pending, migration)
+		}
+	}
+	return status, nil
+}
+
+// Force Записывает версию схемы без выполнения миграций и снимает пометку dirty.
+// Нужен, когда миграцию доделали или откатили вручную. 0 - ни одна миграция не применялась
+func (m *Migrator) Force(ctx context.Context, version uint) error {
+	if version != 0 && m.index(version) < 0 {
+		return fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+	return m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		tx, err := conn.Begin(ctx)
+		if err != nil {
+			return database.PsqlErrorHandler(err)
+		}
+		defer tx.Rollback(ctx)
+		if err = writeVersion(ctx, tx, version); err != nil {
+			return err
+		}
+		if err = tx.Commit(ctx); err != nil {
+			return database.PsqlErrorHandler(err)
+		}
+		m.log.Warn("Database schema version forced", slog.Uint64("version", uint64(version)))
+		return nil
+	})
+}
+
+// withLock Выполняет fn на одном соединении под advisory lock
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := m.pool.Acquire(ctx)
+	if err != nil {
+		return database.PsqlErrorHandler(err)
+	}
+	defer conn.Release()
+
+	if _, err = conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, advisoryLockKey); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer func() {
+		// Блокировка сессионная: снимаем её даже если ctx уже отменён, иначе она останется на соединении в пуле
+		if _, err := conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, advisoryLockKey); err != nil {
+			m.log.Error("Failed to release migration lock", "err", err)
+		}
+	}()
+
+	if err = ensureVersionTable(ctx, conn); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+// apply Выполняет SQL миграции и записывает новую версию одной транзакцией
+func (m *Migrator) apply(ctx context.Context, conn *pgxpool.Conn, sql string, newVersion uint) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return database.PsqlErrorHandler(err)
+	}
+	defer tx.Rollback(ctx)
+	// Без параметров pgx отправляет запрос простым протоколом, поэтому файл может содержать несколько команд
+	if _, err = tx.Exec(ctx, sql); err != nil {
+		// Подсказка из RAISE ... USING HINT в тексте ошибки pgx не попадает, а она объясняет, что делать
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Hint != "" {
+			return fmt.Errorf("%w (hint: %s)", database.PsqlErrorHandler(err), pgErr.Hint)
+		}
+		return database.PsqlErrorHandler(err)
+	}
+	if err = writeVersion(ctx, tx, newVersion); err != nil {
+		return err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return database.PsqlErrorHandler(err)
+	}
+	return nil
+}
+
+func (m *Migrator) latest() uint {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// index Позиция миграции с версией version. -1, если такой нет
+func (m *Migrator) index(version uint) int {
+	for i, migration := range m.migrations {
+		if migration.Version == version {
+			return i
+		}
+	}
+	return -1
+}
+
+func ensureVersionTable(ctx context.Context, conn *pgxpool.Conn) error {
+	_, err := conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS `+versionTable+` (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL)`)
+	if err != nil {
+		return database.PsqlErrorHandler(err)
+	}
+	return nil
+}
+
+func readVersion(ctx context.Context, conn *pgxpool.Conn) (uint, bool, error) {
+	var version int64
+	var dirty bool
+	err := conn.QueryRow(ctx, `SELECT version, dirty FROM `+versionTable+` LIMIT 1`).Scan(&version, &dirty)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, database.PsqlErrorHandler(err)
+	}
+	// golang-migrate записывает -1, когда откачены все миграции
+	if version < 0 {
+		return 0, dirty, nil
+	}
+	return uint(version), dirty, nil
+}
+
+func writeVersion(ctx context.Context, tx pgx.Tx, version uint) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM `+versionTable); err != nil {
+		return database.PsqlErrorHandler(err)
+	}
+	if version == 0 {
+		return nil
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO `+versionTable+` (version, dirty) VALUES ($1, false)`, int64(version)); err != nil {
+		return database.PsqlErrorHandler(err)
+	}
+	return nil
+}
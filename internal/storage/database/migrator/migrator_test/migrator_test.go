@@ -0,0 +1,66 @@
+package migrator_test
+
+import (
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/migration"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/migrator"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"000010_add_phone.up.sql":      {Data: []byte("ALTER TABLE users ADD COLUMN phone TEXT;")},
+		"000010_add_phone.down.sql":    {Data: []byte("ALTER TABLE users DROP COLUMN phone;")},
+		"000002_create_users.up.sql":   {Data: []byte("CREATE TABLE users (id SERIAL);")},
+		"000003_seed_admin.up.sql":     {Data: []byte("INSERT INTO users DEFAULT VALUES;")},
+		"migration.go":                 {Data: []byte("package migration")},
+		"000002_create_users.down.sql": {Data: []byte("DROP TABLE users;")},
+	}
+	migrations, err := migrator.Load(fsys)
+	if err != nil {
+		t.Fatal("Load is failed. Error: ", err)
+	}
+	expected := []string{"000002_create_users", "000003_seed_admin", "000010_add_phone"}
+	if len(migrations) != len(expected) {
+		t.Fatalf("Expected %d migrations, got %v", len(expected), migrations)
+	}
+	for i, name := range expected {
+		if migrations[i].String() != name {
+			t.Errorf("Expected migration %s at %d, got %s", name, i, migrations[i])
+		}
+	}
+	if migrations[1].Down != "" || migrations[2].Down == "" {
+		t.Errorf("Expected down SQL only where the file exists, got %+v", migrations)
+	}
+
+	for _, invalid := range []fstest.MapFS{
+		{"000001_users.down.sql": {Data: []byte("DROP TABLE users;")}},
+		{"create_users.up.sql": {Data: []byte("CREATE TABLE users (id SERIAL);")}},
+		{"000000_zero.up.sql": {Data: []byte("SELECT 1;")}},
+		{"000001_users.up.sql": {Data: []byte("SELECT 1;")}, "000001_accounts.down.sql": {Data: []byte("SELECT 1;")}},
+	} {
+		if _, err = migrator.Load(invalid); !errors.Is(err, migrator.ErrInvalidName) {
+			t.Errorf("Expected ErrInvalidName for %v, got %v", invalid, err)
+		}
+	}
+}
+
+// Встроенные миграции идут без пропусков и все откатываются
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := migrator.Load(migration.FS)
+	if err != nil {
+		t.Fatal("Load is failed. Error: ", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("Expected embedded migrations")
+	}
+	for i, m := range migrations {
+		if m.Version != uint(i+1) {
+			t.Errorf("Expected version %d, got %s", i+1, m)
+		}
+		if m.Down == "" {
+			t.Errorf("Expected down migration for %s", m)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package audit_db
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/tenant"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
+	"time"
+)
+
+// Действия в журнале
+const (
+	ActionImpersonate      = "impersonate"
+	ActionErasureRequested = "erasure_requested"
+	ActionErasureCancelled = "erasure_cancelled"
+	ActionErase            = "erase"
+)
+
+// Event Запись журнала. ActorID - кто выполнил действие, TargetUserID - над кем
+type Event struct {
+	ID           int64
+	OrgID        *int64
+	ActorID      *int64
+	Action       string
+	TargetUserID *int64
+	Reason       string
+	IP           string
+	Details      map[string]interface{}
+	CreatedAt    time.Time
+}
+
+// EventFilter Фильтр журнала. Пустые поля не фильтруют
+type EventFilter struct {
+	Action string
+	UserID *int64 // Пользователь как исполнитель или как цель
+	Limit  int
+}
+
+// AuditRepository Журнал действий администраторов. Записи только добавляются.
+// Если запрос привязан к организации (tenant.WithOrgID), видны только её записи, все - только запросу с tenant.WithoutOrg
+type AuditRepository interface {
+	Record(ctx context.Context, event Event) error
+	ListEvents(ctx context.Context, filter EventFilter) ([]Event, error)
+}
+
+type AuditRepositoryImpl struct {
+	db  *pgxpool.Pool
+	log *slog.Logger
+}
+
+func NewAuditRepository(db *pgxpool.Pool, log *slog.Logger) *AuditRepositoryImpl {
+	return &AuditRepositoryImpl{
+		db:  db,
+		log: log,
+	}
+}
+
+// Record Добавляет запись. Если организация в событии не указана, берётся организация запроса
+func (r *AuditRepositoryImpl) Record(ctx context.Context, event Event) error {
+	const op = "internal/storage/database/repositories/audit_db/audit_db.go/Record"
+	log := r.log.With(
+		slog.String("operation", op),
+		slog.String("action", event.Action))
+
+	if event.OrgID == nil {
+		event.OrgID = tenant.OrgIDArg(ctx)
+	}
+	details := event.Details
+	if details == nil {
+		details = map[string]interface{}{}
+	}
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO audit_log (org_id, actor_id, action, target_user_id, reason, ip, details)
+VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err = r.db.Exec(ctx, query, event.OrgID, event.ActorID, event.Action, event.TargetUserID, event.Reason, event.IP, detailsJSON)
+	if err != nil {
+		log.Error("Error while recording audit event", "err", err)
+		return database.PsqlErrorHandler(err)
+	}
+	return nil
+}
+
+// ListEvents Последние записи, новые первыми
+func (r *AuditRepositoryImpl) ListEvents(ctx context.Context, filter EventFilter) ([]Event, error) {
+	query := `SELECT id, org_id, actor_id, action, target_user_id, reason, ip, details, created_at
+FROM audit_log
+WHERE ($1::int IS NULL OR org_id = $1)
+  AND ($2 = '' OR action = $2)
+  AND ($3::int IS NULL OR actor_id = $3 OR target_user_id = $3)
+ORDER BY created_at DESC, id DESC
+LIMIT $4`
+	rows, err := r.db.Query(ctx, query, tenant.OrgIDArg(ctx), filter.Action, filter.UserID, filter.Limit)
+	if err != nil {
+		return nil, database.PsqlErrorHandler(err)
+	}
+	defer rows.Close()
+
+	events := make([]Event, 0)
+	for rows.Next() {
+		var event Event
+		var details []byte
+		if err = rows.Scan(&event.ID, &event.OrgID, &event.ActorID, &event.Action, &event.TargetUserID, &event.Reason, &event.IP, &details, &event.CreatedAt); err != nil {
+			return nil, database.PsqlErrorHandler(err)
+		}
+		if err = json.Unmarshal(details, &event.Details); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, database.PsqlErrorHandler(err)
+	}
+	return events, nil
+}
@@ -2,18 +2,29 @@ package auth_db
 
 import (
 	"context"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/tenant"
 	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"log/slog"
 	"strconv"
 )
 
 type JWTTokenData struct {
-	UserId   int64
-	UserRole string
+	UserId          int64
+	OrgID           int64 // Организация, в которую выполнен вход
+	UserRoles       []string
+	UserPermissions []string
+	UserStatus      string // Статус аккаунта владельца токена с учётом срока действия
+	UserMetadata    users_db.Metadata
 }
+
+// TokensRepository Refresh токены. Токен выдаётся в рамках организации: роли при обновлении читаются в ней,
+// а исключение из организации удаляет её токены (каскадом по членству).
+// Если запрос привязан к организации (tenant.WithOrgID), методы видят только её токены, все токены - только
+// запрос, явно отвязанный от организации (tenant.WithoutOrg)
 type TokensRepository interface {
-	DbPutTokens(ctx context.Context, userId int64, refreshToken string) error
+	DbPutTokens(ctx context.Context, userId int64, orgID int64, refreshToken string) error
 	DbGetTokens(ctx context.Context, refreshToken string) (JWTTokenData, error)
 	DbUpdateTokens(ctx context.Context, userId int64, refreshToken string, oldRefreshToken string) error
 	DbDeleteToken(ctx context.Context, refreshToken string) error
@@ -30,15 +41,16 @@ func NewTokensRepositoryImpl(db *pgxpool.Pool, log *slog.Logger) *TokensReposito
 	}
 }
 
-func (r *TokensRepositoryImpl) DbPutTokens(ctx context.Context, userId int64, refreshToken string) error {
+func (r *TokensRepositoryImpl) DbPutTokens(ctx context.Context, userId int64, orgID int64, refreshToken string) error {
 	const op = "internal/storage/database/repositories/auth_db/auth_db.go/db.PutTokens"
 	log := r.log.With(
 		slog.String("operation", op),
 		slog.String("User_id", strconv.FormatInt(userId, 10)),
+		slog.Int64("org_id", orgID),
 		slog.String("refresh_token", refreshToken))
 
-	query := `INSERT INTO tokens(user_id, refresh_token) VALUES($1, $2)`
-	_, err := r.db.Exec(ctx, query, userId, refreshToken)
+	query := `INSERT INTO tokens(user_id, org_id, refresh_token) VALUES($1, $2, $3)`
+	_, err := r.db.Exec(ctx, query, userId, orgID, refreshToken)
 	if err != nil {
 		log.Error("Error while put tokens in db", "err", err.Error())
 		return database.PsqlErrorHandler(err)
@@ -51,9 +63,12 @@ func (r *TokensRepositoryImpl) DbGetTokens(ctx context.Context, refreshToken str
 	log := r.log.With(
 		slog.String("operation", op),
 		slog.String("refresh_token", refreshToken))
-	query := `SELECT public.tokens.user_id, users.role FROM tokens JOIN public.users ON tokens.user_id = users.id WHERE refresh_token = $1`
+	query := `SELECT tokens.user_id, tokens.org_id, ` + users_db.RolesQuery("tokens.user_id", "tokens.org_id") + `, ` + users_db.PermissionsQuery("tokens.user_id", "tokens.org_id") + `,
+` + users_db.StatusExpr("users") + `, users.metadata
+FROM tokens JOIN users ON users.id = tokens.user_id
+WHERE refresh_token = $1 AND ($2::int IS NULL OR tokens.org_id = $2)`
 	var tokenData JWTTokenData
-	err := r.db.QueryRow(ctx, query, refreshToken).Scan(&tokenData.UserId, &tokenData.UserRole)
+	err := r.db.QueryRow(ctx, query, refreshToken, tenant.OrgIDArg(ctx)).Scan(&tokenData.UserId, &tokenData.OrgID, &tokenData.UserRoles, &tokenData.UserPermissions, &tokenData.UserStatus, &tokenData.UserMetadata)
 	if err != nil {
 		log.Error("Error while get tokens", "err", err.Error())
 		return tokenData, database.PsqlErrorHandler(err)
@@ -66,8 +81,9 @@ func (r *TokensRepositoryImpl) DbUpdateTokens(ctx context.Context, userId int64,
 	log := r.log.With(
 		slog.String("operation", op),
 	)
-	query := `UPDATE tokens SET refresh_token = $1, updated_at = CURRENT_TIMESTAMP WHERE user_id = $2 AND refresh_token = $3`
-	_, err := r.db.Exec(ctx, query, refreshToken, userId, oldRefreshToken)
+	query := `UPDATE tokens SET refresh_token = $1, updated_at = CURRENT_TIMESTAMP
+WHERE user_id = $2 AND refresh_token = $3 AND ($4::int IS NULL OR org_id = $4)`
+	_, err := r.db.Exec(ctx, query, refreshToken, userId, oldRefreshToken, tenant.OrgIDArg(ctx))
 	if err != nil {
 		log.Error("Error while update tokens", "err", err.Error())
 		return database.PsqlErrorHandler(err)
@@ -80,8 +96,8 @@ func (r *TokensRepositoryImpl) DbDeleteToken(ctx context.Context, refreshToken s
 	log := r.log.With(
 		slog.String("operation", op),
 	)
-	query := `DELETE FROM tokens WHERE refresh_token = $1`
-	_, err := r.db.Exec(ctx, query, refreshToken)
+	query := `DELETE FROM tokens WHERE refresh_token = $1 AND ($2::int IS NULL OR org_id = $2)`
+	_, err := r.db.Exec(ctx, query, refreshToken, tenant.OrgIDArg(ctx))
 	if err != nil {
 		log.Error("Error while delete token", "err", err.Error())
 		return database.PsqlErrorHandler(err)
@@ -0,0 +1,226 @@
+package bulk_users_db
+
+import (
+	"context"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/tenant"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
+	"time"
+)
+
+// Причины, по которым строка не загружена
+const (
+	RejectEmailExists = "email already exists"
+	RejectUnknownRole = "unknown role"
+)
+
+// ImportRow Строка файла, прошедшая проверку формата. Пустой PasswordHash - пароль задаётся при первом входе
+type ImportRow struct {
+	Line         int
+	Email        string // В нижнем регистре, см. users_db.NormalizeEmail
+	FirstName    string
+	LastName     string
+	PasswordHash string
+	Roles        []string
+}
+
+// RejectedRow Строка, которую нельзя загрузить из-за данных в БД
+type RejectedRow struct {
+	Line   int
+	Email  string
+	Reason string
+}
+
+// ExportedUser Пользователь в выгрузке. PasswordHash заполнен, только если выгрузка хешей запрошена явно
+type ExportedUser struct {
+	ID           int64
+	Email        string
+	FirstName    string
+	LastName     string
+	PasswordHash string
+	Roles        []string
+	Status       string
+	CreatedAt    time.Time
+}
+
+// BulkUsersRepository Массовая загрузка и выгрузка пользователей организации запроса (без неё - организации по умолчанию)
+type BulkUsersRepository interface {
+	// ImportBatch Загружает пачку строк одной транзакцией. Строки с занятым email или неизвестной ролью пропускаются
+	// и возвращаются в rejected, остальные загружаются. dryRun - только проверить, ничего не записывая
+	ImportBatch(ctx context.Context, rows []ImportRow, dryRun bool) (imported int, rejected []RejectedRow, err error)
+	// ExportUsers Передаёт в fn участников организации по одному, по возрастанию id. Ошибка fn останавливает выгрузку
+	ExportUsers(ctx context.Context, includePasswordHashes bool, fn func(ExportedUser) error) error
+}
+
+type BulkUsersRepositoryImpl struct {
+	db  *pgxpool.Pool
+	log *slog.Logger
+}
+
+func NewBulkUsersRepository(db *pgxpool.Pool, log *slog.Logger) *BulkUsersRepositoryImpl {
+	return &BulkUsersRepositoryImpl{
+		db:  db,
+		log: log,
+	}
+}
+
+// importColumns Колонки временной таблицы, в которую строки попадают через COPY
+var importColumns = []string{"line", "email", "first_name", "last_name", "password", "roles"}
+
+// ImportBatch Строки копируются через COPY во временную таблицу, проверяются там одним запросом
+// и переносятся в users вместе с участием в организации, ролями и историей паролей
+func (r *BulkUsersRepositoryImpl) ImportBatch(ctx context.Context, rows []ImportRow, dryRun bool) (int, []RejectedRow, error) {
+	const op = "internal/storage/database/repositories/bulk_users_db/bulk_users_db.go/ImportBatch"
+	log := r.log.With(
+		slog.String("operation", op),
+		slog.Int("rows", len(rows)))
+
+	orgID := tenant.OrgIDOrDefault(ctx)
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, nil, database.PsqlErrorHandler(err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+CREATE TEMP TABLE import_users
+(
+    line       INTEGER      NOT NULL,
+    email      VARCHAR(256) NOT NULL,
+    first_name VARCHAR(64)  NOT NULL,
+    last_name  VARCHAR(64)  NOT NULL,
+    password   VARCHAR(128) NOT NULL,
+    roles      TEXT[]       NOT NULL
+) ON COMMIT DROP`)
+	if err != nil {
+		return 0, nil, database.PsqlErrorHandler(err)
+	}
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"import_users"}, importColumns, pgx.CopyFromSlice(len(rows), func(i int) ([]any, error) {
+		row := rows[i]
+		return []any{row.Line, row.Email, row.FirstName, row.LastName, row.PasswordHash, row.Roles}, nil
+	}))
+	if err != nil {
+		log.Error("Error while copying rows to staging table", "err", err)
+		return 0, nil, database.PsqlErrorHandler(err)
+	}
+
+	rejected, err := rejectRows(ctx, tx, orgID)
+	if err != nil {
+		return 0, nil, err
+	}
+	if dryRun {
+		return len(rows) - countLines(rejected), rejected, nil
+	}
+
+	// Email мог занять параллельный запрос уже после проверки: такие строки не вставятся и попадут в отказы
+	query := `
+WITH new_users AS (
+    INSERT INTO users (first_name, last_name, email, password, password_reset_required)
+    SELECT first_name, last_name, email, password, password = '' FROM import_users ORDER BY line
+    ON CONFLICT DO NOTHING
+    RETURNING id, email, password
+), history AS (
+    INSERT INTO password_history (user_id, password_hash)
+    SELECT id, password FROM new_users WHERE password <> ''
+), membership AS (
+    INSERT INTO organization_members (org_id, user_id)
+    SELECT $1, id FROM new_users
+), granted_roles AS (
+    INSERT INTO user_roles (org_id, user_id, role_id)
+    SELECT $1, new_users.id, roles.id
+    FROM new_users
+    JOIN import_users ON import_users.email = new_users.email
+    JOIN roles ON roles.name = ANY(import_users.roles) AND (roles.org_id IS NULL OR roles.org_id = $1)
+)
+SELECT line, email FROM import_users
+WHERE NOT EXISTS (SELECT 1 FROM new_users WHERE new_users.email = import_users.email)
+ORDER BY line`
+	conflicts, err := tx.Query(ctx, query, orgID)
+	if err != nil {
+		log.Error("Error while inserting imported users", "err", err)
+		return 0, nil, database.PsqlErrorHandler(err)
+	}
+	raced, err := pgx.CollectRows(conflicts, func(row pgx.CollectableRow) (RejectedRow, error) {
+		rejectedRow := RejectedRow{Reason: RejectEmailExists}
+		err := row.Scan(&rejectedRow.Line, &rejectedRow.Email)
+		return rejectedRow, err
+	})
+	if err != nil {
+		return 0, nil, database.PsqlErrorHandler(err)
+	}
+	rejected = append(rejected, raced...)
+	if err = tx.Commit(ctx); err != nil {
+		return 0, nil, database.PsqlErrorHandler(err)
+	}
+	return len(rows) - countLines(rejected), rejected, nil
+}
+
+// rejectRows Находит строки с занятым email или неизвестной ролью и убирает их из временной таблицы
+func rejectRows(ctx context.Context, tx pgx.Tx, orgID int64) ([]RejectedRow, error) {
+	query := `
+WITH rejected AS (
+    SELECT line, email, $2::text AS reason FROM import_users
+    WHERE EXISTS (SELECT 1 FROM users WHERE lower(users.email) = import_users.email)
+    UNION ALL
+    SELECT line, email, $3::text || ' ' || role_name FROM import_users, unnest(import_users.roles) AS role_name
+    WHERE NOT EXISTS (SELECT 1 FROM roles WHERE roles.name = role_name AND (roles.org_id IS NULL OR roles.org_id = $1))
+), removed AS (
+    DELETE FROM import_users WHERE line IN (SELECT line FROM rejected)
+)
+SELECT line, email, reason FROM rejected ORDER BY line`
+	rows, err := tx.Query(ctx, query, orgID, RejectEmailExists, RejectUnknownRole)
+	if err != nil {
+		return nil, database.PsqlErrorHandler(err)
+	}
+	rejected, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (RejectedRow, error) {
+		var rejectedRow RejectedRow
+		err := row.Scan(&rejectedRow.Line, &rejectedRow.Email, &rejectedRow.Reason)
+		return rejectedRow, err
+	})
+	if err != nil {
+		return nil, database.PsqlErrorHandler(err)
+	}
+	return rejected, nil
+}
+
+// countLines Количество разных строк файла среди отказов: у одной строки может быть несколько причин
+func countLines(rejected []RejectedRow) int {
+	lines := make(map[int]struct{}, len(rejected))
+	for _, row := range rejected {
+		lines[row.Line] = struct{}{}
+	}
+	return len(lines)
+}
+
+// ExportUsers Строки читаются курсором по мере записи, вся организация в память не загружается.
+// Обезличенные пользователи не выгружаются
+func (r *BulkUsersRepositoryImpl) ExportUsers(ctx context.Context, includePasswordHashes bool, fn func(ExportedUser) error) error {
+	orgID := tenant.OrgIDOrDefault(ctx)
+	query := `SELECT users.id, users.email, users.first_name, users.last_name,
+    CASE WHEN $2::boolean THEN users.password ELSE '' END, ` + users_db.RolesQuery("users.id", "$1") + `, ` + users_db.StatusExpr("users") + `, users.created_at
+FROM users
+WHERE users.erased_at IS NULL AND ` + users_db.MemberFilter("users.id", "$1") + `
+ORDER BY users.id`
+	rows, err := r.db.Query(ctx, query, orgID, includePasswordHashes)
+	if err != nil {
+		return database.PsqlErrorHandler(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var user ExportedUser
+		if err = rows.Scan(&user.ID, &user.Email, &user.FirstName, &user.LastName, &user.PasswordHash, &user.Roles, &user.Status, &user.CreatedAt); err != nil {
+			return database.PsqlErrorHandler(err)
+		}
+		if err = fn(user); err != nil {
+			return err
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return database.PsqlErrorHandler(err)
+	}
+	return nil
+}
@@ -0,0 +1,358 @@
+package groups_db
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/tenant"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/roles_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
+	"time"
+)
+
+var (
+	ErrGroupNotFound      = errors.New("group not found")
+	ErrGroupAlreadyExists = errors.New("group already exists")
+	ErrNotGroupMember     = errors.New("user is not a member of the group")
+	ErrNotGranted         = errors.New("group does not have this role or permission")
+)
+
+// Group Группа пользователей организации. Участники группы получают её роли и права в дополнение к своим
+type Group struct {
+	ID           int64
+	OrgID        int64
+	Name         string
+	Description  string
+	Roles        []string
+	Permissions  []string // Права, выданные группе напрямую, без учёта прав её ролей
+	MembersCount int
+	CreatedAt    time.Time
+}
+
+// GroupUpdate Изменяемые поля группы. nil - поле не меняется
+type GroupUpdate struct {
+	Name        *string
+	Description *string
+}
+
+// GroupMember Участник группы
+type GroupMember struct {
+	UserID    int64
+	Email     string
+	FirstName string
+	LastName  string
+	AddedAt   time.Time
+}
+
+// GroupsRepository Группы организации запроса (tenant.WithOrgID). Группы других организаций не видны
+type GroupsRepository interface {
+	ListGroups(ctx context.Context) ([]Group, error)
+	GetGroup(ctx context.Context, id int64) (Group, error)
+	CreateGroup(ctx context.Context, name string, description string) (Group, error)
+	UpdateGroup(ctx context.Context, id int64, update GroupUpdate) (Group, error)
+	DeleteGroup(ctx context.Context, id int64) error
+	ListMembers(ctx context.Context, groupID int64) ([]GroupMember, error)
+	AddMember(ctx context.Context, groupID int64, userID int64) error
+	RemoveMember(ctx context.Context, groupID int64, userID int64) error
+	GrantRole(ctx context.Context, groupID int64, roleName string) error
+	RevokeRole(ctx context.Context, groupID int64, roleName string) error
+	GrantPermission(ctx context.Context, groupID int64, permission string) error
+	RevokePermission(ctx context.Context, groupID int64, permission string) error
+}
+
+type GroupsRepositoryImpl struct {
+	db  *pgxpool.Pool
+	log *slog.Logger
+}
+
+func NewGroupsRepository(db *pgxpool.Pool, log *slog.Logger) *GroupsRepositoryImpl {
+	return &GroupsRepositoryImpl{
+		db:  db,
+		log: log,
+	}
+}
+
+// groupColumns Колонки, которые читаются в Group функцией scanGroup
+const groupColumns = `groups.id, groups.org_id, groups.name, groups.description, ARRAY(
+    SELECT roles.name FROM group_roles JOIN roles ON roles.id = group_roles.role_id
+    WHERE group_roles.group_id = groups.id ORDER BY roles.name), ARRAY(
+    SELECT permissions.name FROM group_permissions JOIN permissions ON permissions.id = group_permissions.permission_id
+    WHERE group_permissions.group_id = groups.id ORDER BY permissions.name),
+    (SELECT count(*) FROM group_members WHERE group_members.group_id = groups.id), groups.created_at`
+
+func scanGroup(row pgx.Row) (Group, error) {
+	var group Group
+	err := row.Scan(&group.ID, &group.OrgID, &group.Name, &group.Description, &group.Roles, &group.Permissions, &group.MembersCount, &group.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Group{}, ErrGroupNotFound
+	}
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == database.PSQLUniqueError {
+			return Group{}, ErrGroupAlreadyExists
+		}
+		return Group{}, database.PsqlErrorHandler(err)
+	}
+	return group, nil
+}
+
+func (r *GroupsRepositoryImpl) ListGroups(ctx context.Context) ([]Group, error) {
+	query := `SELECT ` + groupColumns + ` FROM groups WHERE org_id = $1 ORDER BY name`
+	rows, err := r.db.Query(ctx, query, tenant.OrgIDOrDefault(ctx))
+	if err != nil {
+		return nil, database.PsqlErrorHandler(err)
+	}
+	defer rows.Close()
+
+	groups := make([]Group, 0)
+	for rows.Next() {
+		group, err := scanGroup(rows)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, database.PsqlErrorHandler(err)
+	}
+	return groups, nil
+}
+
+func (r *GroupsRepositoryImpl) GetGroup(ctx context.Context, id int64) (Group, error) {
+	query := `SELECT ` + groupColumns + ` FROM groups WHERE id = $1 AND org_id = $2`
+	return scanGroup(r.db.QueryRow(ctx, query, id, tenant.OrgIDOrDefault(ctx)))
+}
+
+func (r *GroupsRepositoryImpl) CreateGroup(ctx context.Context, name string, description string) (Group, error) {
+	query := `INSERT INTO groups (org_id, name, description) VALUES ($1, $2, $3) RETURNING ` + groupColumns
+	return scanGroup(r.db.QueryRow(ctx, query, tenant.OrgIDOrDefault(ctx), name, description))
+}
+
+func (r *GroupsRepositoryImpl) UpdateGroup(ctx context.Context, id int64, update GroupUpdate) (Group, error) {
+	query := `
+UPDATE groups SET name = COALESCE($3, name), description = COALESCE($4, description)
+WHERE id = $1 AND org_id = $2
+RETURNING ` + groupColumns
+	return scanGroup(r.db.QueryRow(ctx, query, id, tenant.OrgIDOrDefault(ctx), update.Name, update.Description))
+}
+
+// DeleteGroup Удаляет группу. Участники теряют роли и права, полученные через неё.
+// Группу, через которую получил роль admin последний администратор организации, удалить нельзя
+func (r *GroupsRepositoryImpl) DeleteGroup(ctx context.Context, id int64) error {
+	orgID := tenant.OrgIDOrDefault(ctx)
+	return r.withAdminGuard(ctx, orgID, func(tx pgx.Tx) error {
+		result, err := tx.Exec(ctx, `DELETE FROM groups WHERE id = $1 AND org_id = $2`, id, orgID)
+		if err != nil {
+			return database.PsqlErrorHandler(err)
+		}
+		if result.RowsAffected() == 0 {
+			return ErrGroupNotFound
+		}
+		return nil
+	})
+}
+
+func (r *GroupsRepositoryImpl) ListMembers(ctx context.Context, groupID int64) ([]GroupMember, error) {
+	if err := r.ensureGroup(ctx, groupID); err != nil {
+		return nil, err
+	}
+	query := `
+SELECT users.id, users.email, users.first_name, users.last_name, group_members.added_at
+FROM group_members JOIN users ON users.id = group_members.user_id
+WHERE group_members.group_id = $1
+ORDER BY group_members.added_at, users.id`
+	rows, err := r.db.Query(ctx, query, groupID)
+	if err != nil {
+		return nil, database.PsqlErrorHandler(err)
+	}
+	defer rows.Close()
+
+	members := make([]GroupMember, 0)
+	for rows.Next() {
+		var member GroupMember
+		if err = rows.Scan(&member.UserID, &member.Email, &member.FirstName, &member.LastName, &member.AddedAt); err != nil {
+			return nil, database.PsqlErrorHandler(err)
+		}
+		members = append(members, member)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, database.PsqlErrorHandler(err)
+	}
+	return members, nil
+}
+
+// AddMember Добавляет в группу участника организации. Повторное добавление не ошибка
+func (r *GroupsRepositoryImpl) AddMember(ctx context.Context, groupID int64, userID int64) error {
+	orgID := tenant.OrgIDOrDefault(ctx)
+	if err := r.ensureGroup(ctx, groupID); err != nil {
+		return err
+	}
+	query := `INSERT INTO group_members (org_id, group_id, user_id) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`
+	if _, err := r.db.Exec(ctx, query, orgID, groupID, userID); err != nil {
+		// Пользователь не состоит в организации
+		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == database.PSQLForeignKeyError {
+			return users_db.ErrUserNotFound
+		}
+		return database.PsqlErrorHandler(err)
+	}
+	return nil
+}
+
+// RemoveMember Исключает участника из группы. Последний администратор организации, получивший роль admin через группу,
+// из неё не исключается
+func (r *GroupsRepositoryImpl) RemoveMember(ctx context.Context, groupID int64, userID int64) error {
+	if err := r.ensureGroup(ctx, groupID); err != nil {
+		return err
+	}
+	return r.withAdminGuard(ctx, tenant.OrgIDOrDefault(ctx), func(tx pgx.Tx) error {
+		result, err := tx.Exec(ctx, `DELETE FROM group_members WHERE group_id = $1 AND user_id = $2`, groupID, userID)
+		if err != nil {
+			return database.PsqlErrorHandler(err)
+		}
+		if result.RowsAffected() == 0 {
+			return ErrNotGroupMember
+		}
+		return nil
+	})
+}
+
+// GrantRole Выдаёт группе встроенную роль или роль организации. Повторная выдача не ошибка
+func (r *GroupsRepositoryImpl) GrantRole(ctx context.Context, groupID int64, roleName string) error {
+	if err := r.ensureGroup(ctx, groupID); err != nil {
+		return err
+	}
+	roleID, err := r.roleID(ctx, roleName)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO group_roles (group_id, role_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+	if _, err = r.db.Exec(ctx, query, groupID, roleID); err != nil {
+		return database.PsqlErrorHandler(err)
+	}
+	return nil
+}
+
+// RevokeRole Забирает роль у группы. Роль admin нельзя забрать, если через группу её получил последний администратор организации
+func (r *GroupsRepositoryImpl) RevokeRole(ctx context.Context, groupID int64, roleName string) error {
+	if err := r.ensureGroup(ctx, groupID); err != nil {
+		return err
+	}
+	roleID, err := r.roleID(ctx, roleName)
+	if err != nil {
+		return err
+	}
+	return r.withAdminGuard(ctx, tenant.OrgIDOrDefault(ctx), func(tx pgx.Tx) error {
+		result, err := tx.Exec(ctx, `DELETE FROM group_roles WHERE group_id = $1 AND role_id = $2`, groupID, roleID)
+		if err != nil {
+			return database.PsqlErrorHandler(err)
+		}
+		if result.RowsAffected() == 0 {
+			return ErrNotGranted
+		}
+		return nil
+	})
+}
+
+// GrantPermission Выдаёт право группе напрямую, без отдельной роли. Повторная выдача не ошибка
+func (r *GroupsRepositoryImpl) GrantPermission(ctx context.Context, groupID int64, permission string) error {
+	if err := r.ensureGroup(ctx, groupID); err != nil {
+		return err
+	}
+	permissionID, err := r.permissionID(ctx, permission)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO group_permissions (group_id, permission_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+	if _, err = r.db.Exec(ctx, query, groupID, permissionID); err != nil {
+		return database.PsqlErrorHandler(err)
+	}
+	return nil
+}
+
+func (r *GroupsRepositoryImpl) RevokePermission(ctx context.Context, groupID int64, permission string) error {
+	if err := r.ensureGroup(ctx, groupID); err != nil {
+		return err
+	}
+	permissionID, err := r.permissionID(ctx, permission)
+	if err != nil {
+		return err
+	}
+	result, err := r.db.Exec(ctx, `DELETE FROM group_permissions WHERE group_id = $1 AND permission_id = $2`, groupID, permissionID)
+	if err != nil {
+		return database.PsqlErrorHandler(err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrNotGranted
+	}
+	return nil
+}
+
+// withAdminGuard Выполняет fn в транзакции и откатывает её с users_db.ErrLastAdmin,
+// если после fn в организации, где был администратор, его не осталось
+func (r *GroupsRepositoryImpl) withAdminGuard(ctx context.Context, orgID int64, fn func(tx pgx.Tx) error) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return database.PsqlErrorHandler(err)
+	}
+	defer tx.Rollback(ctx)
+
+	hadAdmin, err := users_db.LockOrgAdmins(ctx, tx, orgID)
+	if err != nil {
+		return err
+	}
+	if err = fn(tx); err != nil {
+		return err
+	}
+	if hadAdmin {
+		if err = users_db.EnsureOrgHasAdmin(ctx, tx, orgID); err != nil {
+			return err
+		}
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return database.PsqlErrorHandler(err)
+	}
+	return nil
+}
+
+// ensureGroup Проверяет, что группа принадлежит организации запроса
+func (r *GroupsRepositoryImpl) ensureGroup(ctx context.Context, id int64) error {
+	var exists bool
+	err := r.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM groups WHERE id = $1 AND org_id = $2)`, id, tenant.OrgIDOrDefault(ctx)).Scan(&exists)
+	if err != nil {
+		return database.PsqlErrorHandler(err)
+	}
+	if !exists {
+		return ErrGroupNotFound
+	}
+	return nil
+}
+
+// roleID Ищет роль среди встроенных и ролей организации запроса
+func (r *GroupsRepositoryImpl) roleID(ctx context.Context, roleName string) (int64, error) {
+	var id int64
+	query := `SELECT id FROM roles WHERE name = $1 AND (org_id IS NULL OR org_id = $2)`
+	err := r.db.QueryRow(ctx, query, roleName, tenant.OrgIDOrDefault(ctx)).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, roles_db.ErrRoleNotFound
+	}
+	if err != nil {
+		return 0, database.PsqlErrorHandler(err)
+	}
+	return id, nil
+}
+
+func (r *GroupsRepositoryImpl) permissionID(ctx context.Context, permission string) (int64, error) {
+	var id int64
+	err := r.db.QueryRow(ctx, `SELECT id FROM permissions WHERE name = $1`, permission).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, roles_db.ErrPermissionNotFound
+	}
+	if err != nil {
+		return 0, database.PsqlErrorHandler(err)
+	}
+	return id, nil
+}
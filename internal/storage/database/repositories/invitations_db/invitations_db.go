@@ -0,0 +1,260 @@
+package invitations_db
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/orgs_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/roles_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/models/users/create_user"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
+	"time"
+)
+
+var ErrInvitationNotFound = errors.New("invitation is invalid, expired or already used")
+
+// Состояния приглашения
+const (
+	StatusPending  = "pending"
+	StatusAccepted = "accepted"
+	StatusRevoked  = "revoked"
+	StatusExpired  = "expired"
+)
+
+// Invitation Приглашение в организацию. По нему создаётся новый пользователь с ролью user и ролями Roles,
+// либо вступает в организацию уже зарегистрированный пользователь с этим email
+type Invitation struct {
+	ID         int64
+	OrgID      int64
+	Email      string
+	Roles      []string
+	InvitedBy  *int64 // nil - пригласивший удалён
+	ExpiresAt  time.Time
+	AcceptedAt *time.Time
+	RevokedAt  *time.Time
+	CreatedAt  time.Time
+}
+
+// Status Состояние приглашения на момент now
+func (i Invitation) Status(now time.Time) string {
+	switch {
+	case i.AcceptedAt != nil:
+		return StatusAccepted
+	case i.RevokedAt != nil:
+		return StatusRevoked
+	case !i.ExpiresAt.After(now):
+		return StatusExpired
+	default:
+		return StatusPending
+	}
+}
+
+type InvitationsRepository interface {
+	CreateInvitation(ctx context.Context, invitation Invitation, tokenHash string) (Invitation, error)
+	ListInvitations(ctx context.Context, orgID int64) ([]Invitation, error)
+	RevokeInvitation(ctx context.Context, orgID int64, id int64) error
+	GetPendingInvitation(ctx context.Context, tokenHash string) (Invitation, error)
+	AcceptInvitation(ctx context.Context, tokenHash string, userinfo *create_user.UserCreate) (int64, Invitation, error)
+	JoinInvitation(ctx context.Context, tokenHash string, userID int64) (Invitation, error)
+}
+
+type InvitationsRepositoryImpl struct {
+	db  *pgxpool.Pool
+	log *slog.Logger
+}
+
+func NewInvitationsRepository(db *pgxpool.Pool, log *slog.Logger) *InvitationsRepositoryImpl {
+	return &InvitationsRepositoryImpl{
+		db:  db,
+		log: log,
+	}
+}
+
+const invitationColumns = `id, org_id, email, roles, invited_by, expires_at, accepted_at, revoked_at, created_at`
+
+// pendingCondition Приглашение ещё можно принять
+const pendingCondition = `accepted_at IS NULL AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP`
+
+func scanInvitation(row pgx.Row) (Invitation, error) {
+	var inv Invitation
+	err := row.Scan(&inv.ID, &inv.OrgID, &inv.Email, &inv.Roles, &inv.InvitedBy, &inv.ExpiresAt, &inv.AcceptedAt, &inv.RevokedAt, &inv.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Invitation{}, ErrInvitationNotFound
+	}
+	if err != nil {
+		return Invitation{}, database.PsqlErrorHandler(err)
+	}
+	return inv, nil
+}
+
+// CreateInvitation Сохраняет приглашение. Прежние неиспользованные приглашения на этот email в организацию отзываются.
+// Зарегистрирован ли email, не проверяется: такой пользователь сам принимает приглашение через JoinInvitation.
+// Возвращает orgs_db.ErrAlreadyMember, если пользователь с этим email уже состоит в организации,
+// и roles_db.ErrRoleNotFound, если какой-то из ролей нет среди встроенных и ролей организации
+func (r *InvitationsRepositoryImpl) CreateInvitation(ctx context.Context, invitation Invitation, tokenHash string) (Invitation, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return Invitation{}, database.PsqlErrorHandler(err)
+	}
+	defer tx.Rollback(ctx)
+
+	invitation.Email = users_db.NormalizeEmail(invitation.Email)
+	var member bool
+	query := `
+SELECT EXISTS (
+    SELECT 1 FROM users JOIN organization_members ON organization_members.user_id = users.id
+    WHERE lower(users.email) = $1 AND organization_members.org_id = $2)`
+	if err = tx.QueryRow(ctx, query, invitation.Email, invitation.OrgID).Scan(&member); err != nil {
+		return Invitation{}, database.PsqlErrorHandler(err)
+	}
+	if member {
+		return Invitation{}, orgs_db.ErrAlreadyMember
+	}
+
+	var missing bool
+	query = `
+SELECT EXISTS (
+    SELECT 1 FROM unnest($1::text[]) AS invited(name)
+    WHERE NOT EXISTS (SELECT 1 FROM roles WHERE roles.name = invited.name AND (roles.org_id IS NULL OR roles.org_id = $2)))`
+	if err = tx.QueryRow(ctx, query, invitation.Roles, invitation.OrgID).Scan(&missing); err != nil {
+		return Invitation{}, database.PsqlErrorHandler(err)
+	}
+	if missing {
+		return Invitation{}, roles_db.ErrRoleNotFound
+	}
+
+	query = `UPDATE invitations SET revoked_at = CURRENT_TIMESTAMP WHERE org_id = $1 AND lower(email) = $2 AND ` + pendingCondition
+	if _, err = tx.Exec(ctx, query, invitation.OrgID, invitation.Email); err != nil {
+		return Invitation{}, database.PsqlErrorHandler(err)
+	}
+
+	query = `
+INSERT INTO invitations (org_id, email, roles, token_hash, invited_by, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING ` + invitationColumns
+	created, err := scanInvitation(tx.QueryRow(ctx, query,
+		invitation.OrgID, invitation.Email, invitation.Roles, tokenHash, invitation.InvitedBy, invitation.ExpiresAt))
+	if err != nil {
+		return Invitation{}, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return Invitation{}, database.PsqlErrorHandler(err)
+	}
+	return created, nil
+}
+
+// ListInvitations Приглашения организации, сначала новые
+func (r *InvitationsRepositoryImpl) ListInvitations(ctx context.Context, orgID int64) ([]Invitation, error) {
+	query := `SELECT ` + invitationColumns + ` FROM invitations WHERE org_id = $1 ORDER BY created_at DESC, id DESC`
+	rows, err := r.db.Query(ctx, query, orgID)
+	if err != nil {
+		return nil, database.PsqlErrorHandler(err)
+	}
+	defer rows.Close()
+
+	invitations := make([]Invitation, 0)
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, inv)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, database.PsqlErrorHandler(err)
+	}
+	return invitations, nil
+}
+
+// RevokeInvitation Отзывает неиспользованное приглашение организации
+func (r *InvitationsRepositoryImpl) RevokeInvitation(ctx context.Context, orgID int64, id int64) error {
+	query := `UPDATE invitations SET revoked_at = CURRENT_TIMESTAMP WHERE org_id = $1 AND id = $2 AND ` + pendingCondition
+	result, err := r.db.Exec(ctx, query, orgID, id)
+	if err != nil {
+		return database.PsqlErrorHandler(err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrInvitationNotFound
+	}
+	return nil
+}
+
+// GetPendingInvitation Приглашение по хешу токена, если его ещё можно принять
+func (r *InvitationsRepositoryImpl) GetPendingInvitation(ctx context.Context, tokenHash string) (Invitation, error) {
+	query := `SELECT ` + invitationColumns + ` FROM invitations WHERE token_hash = $1 AND ` + pendingCondition
+	return scanInvitation(r.db.QueryRow(ctx, query, tokenHash))
+}
+
+// AcceptInvitation Списывает приглашение и создаёт по нему пользователя с email из приглашения.
+// Пользователь вступает в организацию приглашения с ролью user и приглашёнными ролями.
+// Всё делается в одной транзакции: приглашение нельзя принять дважды, а при ошибке создания оно остаётся действующим
+func (r *InvitationsRepositoryImpl) AcceptInvitation(ctx context.Context, tokenHash string, userinfo *create_user.UserCreate) (int64, Invitation, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, Invitation{}, database.PsqlErrorHandler(err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `UPDATE invitations SET accepted_at = CURRENT_TIMESTAMP WHERE token_hash = $1 AND ` + pendingCondition +
+		` RETURNING ` + invitationColumns
+	inv, err := scanInvitation(tx.QueryRow(ctx, query, tokenHash))
+	if err != nil {
+		return 0, Invitation{}, err
+	}
+
+	userinfo.Email = inv.Email
+	userID, err := users_db.CreateUserTx(ctx, tx, userinfo, inv.OrgID, append([]string{users_db.RoleUser}, inv.Roles...))
+	if err != nil {
+		return 0, Invitation{}, err
+	}
+	if _, err = tx.Exec(ctx, `UPDATE invitations SET accepted_user_id = $1 WHERE id = $2`, userID, inv.ID); err != nil {
+		return 0, Invitation{}, database.PsqlErrorHandler(err)
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return 0, Invitation{}, database.PsqlErrorHandler(err)
+	}
+	return userID, inv, nil
+}
+
+// JoinInvitation Списывает приглашение и добавляет по нему уже зарегистрированного пользователя userID в организацию
+// с ролью user и приглашёнными ролями. Приглашение должно быть выписано на email пользователя, иначе ErrInvitationNotFound:
+// чужую ссылку нельзя использовать для вступления. Если пользователь уже участник - orgs_db.ErrAlreadyMember,
+// приглашение при этом остаётся действующим
+func (r *InvitationsRepositoryImpl) JoinInvitation(ctx context.Context, tokenHash string, userID int64) (Invitation, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return Invitation{}, database.PsqlErrorHandler(err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+UPDATE invitations SET accepted_at = CURRENT_TIMESTAMP, accepted_user_id = $2
+WHERE token_hash = $1 AND email = (SELECT lower(email) FROM users WHERE id = $2) AND ` + pendingCondition + `
+RETURNING ` + invitationColumns
+	inv, err := scanInvitation(tx.QueryRow(ctx, query, tokenHash, userID))
+	if err != nil {
+		return Invitation{}, err
+	}
+
+	_, err = tx.Exec(ctx, `INSERT INTO organization_members (org_id, user_id) VALUES ($1, $2)`, inv.OrgID, userID)
+	if err != nil {
+		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == database.PSQLUniqueError {
+			return Invitation{}, orgs_db.ErrAlreadyMember
+		}
+		return Invitation{}, database.PsqlErrorHandler(err)
+	}
+	query = `
+INSERT INTO user_roles (org_id, user_id, role_id)
+SELECT $1, $2, roles.id FROM roles WHERE roles.name = ANY($3) AND (roles.org_id IS NULL OR roles.org_id = $1)`
+	if _, err = tx.Exec(ctx, query, inv.OrgID, userID, append([]string{users_db.RoleUser}, inv.Roles...)); err != nil {
+		return Invitation{}, database.PsqlErrorHandler(err)
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return Invitation{}, database.PsqlErrorHandler(err)
+	}
+	return inv, nil
+}
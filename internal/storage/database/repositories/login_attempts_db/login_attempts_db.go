@@ -0,0 +1,145 @@
+package login_attempts_db
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
+	"time"
+)
+
+// Области, по которым считаются неудачные попытки входа
+const (
+	ScopeAccount = "account"
+	ScopeIP      = "ip"
+)
+
+// LoginAttempt Состояние неудачных попыток входа по одному ключу (email или IP)
+type LoginAttempt struct {
+	FailedCount  int
+	LastFailedAt time.Time
+	LockedUntil  *time.Time
+}
+
+// Reservation Результат ReserveAttempt
+type Reservation struct {
+	Reserved    bool // Попытка учтена. false - ключ уже заблокирован до LockedUntil, счётчик не менялся
+	FailedCount int  // Значение счётчика с учётом этой попытки
+	LockedUntil *time.Time
+}
+
+type LoginAttemptsRepository interface {
+	GetAttempt(ctx context.Context, scope string, key string) (LoginAttempt, error)
+	ReserveAttempt(ctx context.Context, scope string, key string, window time.Duration, lockFor func(count int) time.Duration) (Reservation, error)
+	ReleaseAttempt(ctx context.Context, scope string, key string) error
+	Reset(ctx context.Context, scope string, key string) error
+}
+
+type LoginAttemptsRepositoryImpl struct {
+	db  *pgxpool.Pool
+	log *slog.Logger
+}
+
+func NewLoginAttemptsRepository(db *pgxpool.Pool, log *slog.Logger) *LoginAttemptsRepositoryImpl {
+	return &LoginAttemptsRepositoryImpl{
+		db:  db,
+		log: log,
+	}
+}
+
+// GetAttempt Возвращает состояние попыток. Если неудачных попыток не было, возвращается пустая структура без ошибки
+func (r *LoginAttemptsRepositoryImpl) GetAttempt(ctx context.Context, scope string, key string) (LoginAttempt, error) {
+	query := `SELECT failed_count, last_failed_at, locked_until FROM login_attempts WHERE scope = $1 AND key = $2`
+
+	var attempt LoginAttempt
+	err := r.db.QueryRow(ctx, query, scope, key).Scan(&attempt.FailedCount, &attempt.LastFailedAt, &attempt.LockedUntil)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return LoginAttempt{}, nil
+	}
+	if err != nil {
+		return LoginAttempt{}, database.PsqlErrorHandler(err)
+	}
+	return attempt, nil
+}
+
+// ReserveAttempt Учитывает попытку входа до проверки пароля. Если ключ заблокирован, попытка не учитывается
+// и возвращается Reserved: false. Иначе счётчик увеличивается (после паузы длиннее window начинается заново)
+// и, если lockFor для нового значения больше нуля, ключ сразу блокируется на это время.
+// Всё делается под блокировкой строки, поэтому параллельные попытки получают разные значения счётчика
+// и не проходят мимо блокировки, выставленной соседней попыткой
+func (r *LoginAttemptsRepositoryImpl) ReserveAttempt(ctx context.Context, scope string, key string, window time.Duration, lockFor func(count int) time.Duration) (Reservation, error) {
+	const op = "internal/storage/database/repositories/login_attempts_db/ReserveAttempt"
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return Reservation{}, database.PsqlErrorHandler(err)
+	}
+	defer tx.Rollback(ctx)
+
+	now := time.Now()
+	query := `INSERT INTO login_attempts (scope, key, failed_count, last_failed_at) VALUES ($1, $2, 0, $3) ON CONFLICT (scope, key) DO NOTHING`
+	if _, err = tx.Exec(ctx, query, scope, key, now); err != nil {
+		r.log.Error("Error while reserving login attempt", slog.String("op", op), "err", err.Error())
+		return Reservation{}, database.PsqlErrorHandler(err)
+	}
+	var attempt LoginAttempt
+	query = `SELECT failed_count, last_failed_at, locked_until FROM login_attempts WHERE scope = $1 AND key = $2 FOR UPDATE`
+	err = tx.QueryRow(ctx, query, scope, key).Scan(&attempt.FailedCount, &attempt.LastFailedAt, &attempt.LockedUntil)
+	if err != nil {
+		r.log.Error("Error while reserving login attempt", slog.String("op", op), "err", err.Error())
+		return Reservation{}, database.PsqlErrorHandler(err)
+	}
+
+	reservation, locked := NextReservation(attempt, now, window, lockFor)
+	if !locked {
+		query = `UPDATE login_attempts SET failed_count = $3, last_failed_at = $4, locked_until = $5 WHERE scope = $1 AND key = $2`
+		if _, err = tx.Exec(ctx, query, scope, key, reservation.FailedCount, now, reservation.LockedUntil); err != nil {
+			r.log.Error("Error while reserving login attempt", slog.String("op", op), "err", err.Error())
+			return Reservation{}, database.PsqlErrorHandler(err)
+		}
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return Reservation{}, database.PsqlErrorHandler(err)
+	}
+	return reservation, nil
+}
+
+// NextReservation Результат ReserveAttempt для текущего состояния attempt. locked - ключ уже заблокирован и состояние не меняется.
+// Общая часть реализаций репозитория в разных хранилищах
+func NextReservation(attempt LoginAttempt, now time.Time, window time.Duration, lockFor func(count int) time.Duration) (Reservation, bool) {
+	if attempt.LockedUntil != nil && attempt.LockedUntil.After(now) {
+		return Reservation{FailedCount: attempt.FailedCount, LockedUntil: attempt.LockedUntil}, true
+	}
+	count := attempt.FailedCount + 1
+	if attempt.FailedCount == 0 || attempt.LastFailedAt.Before(now.Add(-window)) {
+		count = 1
+	}
+	reservation := Reservation{Reserved: true, FailedCount: count}
+	if lock := lockFor(count); lock > 0 {
+		lockedUntil := now.Add(lock)
+		reservation.LockedUntil = &lockedUntil
+	}
+	return reservation, false
+}
+
+// ReleaseAttempt Возвращает попытку, учтённую ReserveAttempt, если она оказалась успешной, а счётчик не сбрасывается (IP).
+// Блокировка, выставленная при резервировании, остаётся
+func (r *LoginAttemptsRepositoryImpl) ReleaseAttempt(ctx context.Context, scope string, key string) error {
+	query := `UPDATE login_attempts SET failed_count = GREATEST(failed_count - 1, 0) WHERE scope = $1 AND key = $2`
+	_, err := r.db.Exec(ctx, query, scope, key)
+	if err != nil {
+		return database.PsqlErrorHandler(err)
+	}
+	return nil
+}
+
+// Reset Сбрасывает счётчик и блокировку (успешный вход или разблокировка админом)
+func (r *LoginAttemptsRepositoryImpl) Reset(ctx context.Context, scope string, key string) error {
+	query := `DELETE FROM login_attempts WHERE scope = $1 AND key = $2`
+	_, err := r.db.Exec(ctx, query, scope, key)
+	if err != nil {
+		return database.PsqlErrorHandler(err)
+	}
+	return nil
+}
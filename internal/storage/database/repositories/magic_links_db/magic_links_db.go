@@ -0,0 +1,70 @@
+package magic_links_db
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
+	"time"
+)
+
+var ErrLinkNotFound = errors.New("magic link is invalid, expired or already used")
+
+type MagicLinksRepository interface {
+	CreateLink(ctx context.Context, userID int64, tokenHash string, expiresAt time.Time) error
+	CountLinksSince(ctx context.Context, userID int64, since time.Time) (int, error)
+	ConsumeLink(ctx context.Context, tokenHash string) (int64, error)
+}
+
+type MagicLinksRepositoryImpl struct {
+	db  *pgxpool.Pool
+	log *slog.Logger
+}
+
+func NewMagicLinksRepository(db *pgxpool.Pool, log *slog.Logger) *MagicLinksRepositoryImpl {
+	return &MagicLinksRepositoryImpl{
+		db:  db,
+		log: log,
+	}
+}
+
+func (r *MagicLinksRepositoryImpl) CreateLink(ctx context.Context, userID int64, tokenHash string, expiresAt time.Time) error {
+	query := `INSERT INTO magic_links (user_id, token_hash, expires_at) VALUES ($1, $2, $3)`
+	_, err := r.db.Exec(ctx, query, userID, tokenHash, expiresAt)
+	if err != nil {
+		return database.PsqlErrorHandler(err)
+	}
+	return nil
+}
+
+// CountLinksSince Количество ссылок, выданных пользователю после since. Нужен для ограничения частоты запросов
+func (r *MagicLinksRepositoryImpl) CountLinksSince(ctx context.Context, userID int64, since time.Time) (int, error) {
+	query := `SELECT count(*) FROM magic_links WHERE user_id = $1 AND created_at > $2`
+	var count int
+	err := r.db.QueryRow(ctx, query, userID, since).Scan(&count)
+	if err != nil {
+		return 0, database.PsqlErrorHandler(err)
+	}
+	return count, nil
+}
+
+// ConsumeLink Помечает ссылку использованной и возвращает id пользователя.
+// Проверка и пометка делаются одним запросом, поэтому ссылку нельзя использовать дважды даже параллельно
+func (r *MagicLinksRepositoryImpl) ConsumeLink(ctx context.Context, tokenHash string) (int64, error) {
+	query := `
+UPDATE magic_links SET used_at = CURRENT_TIMESTAMP
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+RETURNING user_id`
+
+	var userID int64
+	err := r.db.QueryRow(ctx, query, tokenHash).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrLinkNotFound
+	}
+	if err != nil {
+		return 0, database.PsqlErrorHandler(err)
+	}
+	return userID, nil
+}
@@ -0,0 +1,149 @@
+package orgs_db
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
+	"time"
+)
+
+var (
+	ErrOrgAlreadyExists = errors.New("organization with this slug already exists")
+	ErrAlreadyMember    = errors.New("user is already a member of the organization")
+	ErrNotMember        = errors.New("user is not a member of the organization")
+)
+
+// Organization Организация (тенант)
+type Organization struct {
+	ID        int64
+	Slug      string
+	Name      string
+	CreatedAt time.Time
+}
+
+type OrgsRepository interface {
+	CreateOrganization(ctx context.Context, slug string, name string, ownerID int64) (Organization, error)
+	ListUserOrganizations(ctx context.Context, userID int64) ([]Organization, error)
+	RemoveMember(ctx context.Context, orgID int64, userID int64) error
+}
+
+type OrgsRepositoryImpl struct {
+	db  *pgxpool.Pool
+	log *slog.Logger
+}
+
+func NewOrgsRepository(db *pgxpool.Pool, log *slog.Logger) *OrgsRepositoryImpl {
+	return &OrgsRepositoryImpl{
+		db:  db,
+		log: log,
+	}
+}
+
+const orgColumns = `organizations.id, organizations.slug, organizations.name, organizations.created_at`
+
+// CreateOrganization Создаёт организацию. Владелец становится её участником с ролями admin и user
+func (r *OrgsRepositoryImpl) CreateOrganization(ctx context.Context, slug string, name string, ownerID int64) (Organization, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return Organization{}, database.PsqlErrorHandler(err)
+	}
+	defer tx.Rollback(ctx)
+
+	var org Organization
+	query := `INSERT INTO organizations (slug, name) VALUES ($1, $2) RETURNING ` + orgColumns
+	err = tx.QueryRow(ctx, query, slug, name).Scan(&org.ID, &org.Slug, &org.Name, &org.CreatedAt)
+	if err != nil {
+		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == database.PSQLUniqueError {
+			return Organization{}, ErrOrgAlreadyExists
+		}
+		return Organization{}, database.PsqlErrorHandler(err)
+	}
+	if err = addMember(ctx, tx, org.ID, ownerID, users_db.RoleAdmin, users_db.RoleUser); err != nil {
+		return Organization{}, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return Organization{}, database.PsqlErrorHandler(err)
+	}
+	return org, nil
+}
+
+// ListUserOrganizations Организации пользователя в порядке вступления. Первая используется при входе без выбора организации
+func (r *OrgsRepositoryImpl) ListUserOrganizations(ctx context.Context, userID int64) ([]Organization, error) {
+	query := `
+SELECT ` + orgColumns + ` FROM organizations
+JOIN organization_members ON organization_members.org_id = organizations.id
+WHERE organization_members.user_id = $1
+ORDER BY organization_members.joined_at, organizations.id`
+
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, database.PsqlErrorHandler(err)
+	}
+	defer rows.Close()
+
+	orgs := make([]Organization, 0)
+	for rows.Next() {
+		var org Organization
+		if err = rows.Scan(&org.ID, &org.Slug, &org.Name, &org.CreatedAt); err != nil {
+			return nil, database.PsqlErrorHandler(err)
+		}
+		orgs = append(orgs, org)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, database.PsqlErrorHandler(err)
+	}
+	return orgs, nil
+}
+
+// RemoveMember Исключает пользователя из организации. Его роли и refresh токены в ней удаляются каскадом.
+// Последнего администратора организации исключить нельзя
+func (r *OrgsRepositoryImpl) RemoveMember(ctx context.Context, orgID int64, userID int64) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return database.PsqlErrorHandler(err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err = users_db.EnsureNotLastAdmin(ctx, tx, userID, &orgID); err != nil {
+		return err
+	}
+	result, err := tx.Exec(ctx, `DELETE FROM organization_members WHERE org_id = $1 AND user_id = $2`, orgID, userID)
+	if err != nil {
+		return database.PsqlErrorHandler(err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrNotMember
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return database.PsqlErrorHandler(err)
+	}
+	return nil
+}
+
+// addMember Добавляет участника и выдаёт ему встроенные роли roleNames в организации
+func addMember(ctx context.Context, tx pgx.Tx, orgID int64, userID int64, roleNames ...string) error {
+	_, err := tx.Exec(ctx, `INSERT INTO organization_members (org_id, user_id) VALUES ($1, $2)`, orgID, userID)
+	if err != nil {
+		if pgErr, ok := err.(*pgconn.PgError); ok {
+			switch pgErr.Code {
+			case database.PSQLUniqueError:
+				return ErrAlreadyMember
+			case database.PSQLForeignKeyError:
+				return users_db.ErrUserNotFound
+			}
+		}
+		return database.PsqlErrorHandler(err)
+	}
+	query := `
+INSERT INTO user_roles (org_id, user_id, role_id)
+SELECT $1, $2, roles.id FROM roles WHERE roles.name = ANY($3) AND roles.org_id IS NULL`
+	if _, err = tx.Exec(ctx, query, orgID, userID, roleNames); err != nil {
+		return database.PsqlErrorHandler(err)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package otp_db
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
+	"time"
+)
+
+// Назначения одноразовых кодов
+const (
+	PurposeLogin       = "login"
+	PurposeVerifyPhone = "verify_phone"
+)
+
+var ErrCodeNotFound = errors.New("one-time code not found")
+
+// OTPCode Одноразовый код. Сам код не хранится, только его хеш
+type OTPCode struct {
+	ID         int64
+	UserID     int64
+	Phone      string
+	CodeHash   string
+	Attempts   int
+	ExpiresAt  time.Time
+	ConsumedAt *time.Time
+	CreatedAt  time.Time
+}
+
+type OTPRepository interface {
+	CreateCode(ctx context.Context, code OTPCode, purpose string) error
+	GetLatestCode(ctx context.Context, purpose string, phone string) (OTPCode, error)
+	IncrementAttempts(ctx context.Context, id int64) (int, error)
+	ConsumeCode(ctx context.Context, id int64) error
+}
+
+type OTPRepositoryImpl struct {
+	db  *pgxpool.Pool
+	log *slog.Logger
+}
+
+func NewOTPRepository(db *pgxpool.Pool, log *slog.Logger) *OTPRepositoryImpl {
+	return &OTPRepositoryImpl{
+		db:  db,
+		log: log,
+	}
+}
+
+// CreateCode Сохраняет новый код. Все прежние неиспользованные коды на этот номер с тем же назначением перестают действовать
+func (r *OTPRepositoryImpl) CreateCode(ctx context.Context, code OTPCode, purpose string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return database.PsqlErrorHandler(err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `UPDATE otp_codes SET consumed_at = CURRENT_TIMESTAMP WHERE purpose = $1 AND phone = $2 AND consumed_at IS NULL`,
+		purpose, code.Phone)
+	if err != nil {
+		return database.PsqlErrorHandler(err)
+	}
+	_, err = tx.Exec(ctx, `INSERT INTO otp_codes (purpose, phone, user_id, code_hash, expires_at) VALUES ($1, $2, $3, $4, $5)`,
+		purpose, code.Phone, code.UserID, code.CodeHash, code.ExpiresAt)
+	if err != nil {
+		return database.PsqlErrorHandler(err)
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return database.PsqlErrorHandler(err)
+	}
+	return nil
+}
+
+// GetLatestCode Последний выданный код, в том числе уже использованный (нужен для паузы между повторными отправками)
+func (r *OTPRepositoryImpl) GetLatestCode(ctx context.Context, purpose string, phone string) (OTPCode, error) {
+	query := `
+SELECT id, user_id, phone, code_hash, attempts, expires_at, consumed_at, created_at
+FROM otp_codes
+WHERE purpose = $1 AND phone = $2
+ORDER BY created_at DESC, id DESC
+LIMIT 1`
+
+	var code OTPCode
+	err := r.db.QueryRow(ctx, query, purpose, phone).Scan(
+		&code.ID, &code.UserID, &code.Phone, &code.CodeHash, &code.Attempts, &code.ExpiresAt, &code.ConsumedAt, &code.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return OTPCode{}, ErrCodeNotFound
+	}
+	if err != nil {
+		return OTPCode{}, database.PsqlErrorHandler(err)
+	}
+	return code, nil
+}
+
+// IncrementAttempts Учитывает попытку ввода кода и возвращает новое количество попыток
+func (r *OTPRepositoryImpl) IncrementAttempts(ctx context.Context, id int64) (int, error) {
+	query := `UPDATE otp_codes SET attempts = attempts + 1 WHERE id = $1 RETURNING attempts`
+	var attempts int
+	err := r.db.QueryRow(ctx, query, id).Scan(&attempts)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrCodeNotFound
+	}
+	if err != nil {
+		return 0, database.PsqlErrorHandler(err)
+	}
+	return attempts, nil
+}
+
+// ConsumeCode Помечает код использованным. Если его уже использовали параллельно, вернёт ErrCodeNotFound
+func (r *OTPRepositoryImpl) ConsumeCode(ctx context.Context, id int64) error {
+	query := `UPDATE otp_codes SET consumed_at = CURRENT_TIMESTAMP WHERE id = $1 AND consumed_at IS NULL`
+	result, err := r.db.Exec(ctx, query, id)
+	if err != nil {
+		return database.PsqlErrorHandler(err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrCodeNotFound
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package policy_db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/policy"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
+)
+
+var ErrRuleNotFound = errors.New("policy rule not found")
+
+type PolicyRepository interface {
+	LoadRules(ctx context.Context) ([]policy.Rule, error)
+	UpsertRule(ctx context.Context, rule policy.Rule) error
+	DeleteRule(ctx context.Context, ruleID string) error
+}
+
+type PolicyRepositoryImpl struct {
+	db  *pgxpool.Pool
+	log *slog.Logger
+}
+
+func NewPolicyRepository(db *pgxpool.Pool, log *slog.Logger) *PolicyRepositoryImpl {
+	return &PolicyRepositoryImpl{
+		db:  db,
+		log: log,
+	}
+}
+
+// LoadRules Все включённые правила. Реализует policy.Store
+func (r *PolicyRepositoryImpl) LoadRules(ctx context.Context) ([]policy.Rule, error) {
+	query := `SELECT rule_id, description, effect, actions, resources, conditions FROM policy_rules WHERE enabled ORDER BY rule_id`
+	rows, err := r.db.Query(ctx, query)
+	if err != nil {
+		return nil, database.PsqlErrorHandler(err)
+	}
+	defer rows.Close()
+
+	var rules []policy.Rule
+	for rows.Next() {
+		var rule policy.Rule
+		var actions, resources, conditions []byte
+		if err = rows.Scan(&rule.ID, &rule.Description, &rule.Effect, &actions, &resources, &conditions); err != nil {
+			return nil, database.PsqlErrorHandler(err)
+		}
+		if err = json.Unmarshal(actions, &rule.Actions); err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(resources, &rule.Resources); err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(conditions, &rule.Conditions); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, database.PsqlErrorHandler(err)
+	}
+	return rules, nil
+}
+
+// UpsertRule Создаёт правило или заменяет существующее с тем же id
+func (r *PolicyRepositoryImpl) UpsertRule(ctx context.Context, rule policy.Rule) error {
+	actions, err := json.Marshal(rule.Actions)
+	if err != nil {
+		return err
+	}
+	resources, err := json.Marshal(rule.Resources)
+	if err != nil {
+		return err
+	}
+	conditions, err := json.Marshal(rule.Conditions)
+	if err != nil {
+		return err
+	}
+	query := `
+INSERT INTO policy_rules (rule_id, description, effect, actions, resources, conditions)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (rule_id) DO UPDATE SET
+    description = EXCLUDED.description,
+    effect      = EXCLUDED.effect,
+    actions     = EXCLUDED.actions,
+    resources   = EXCLUDED.resources,
+    conditions  = EXCLUDED.conditions`
+	_, err = r.db.Exec(ctx, query, rule.ID, rule.Description, rule.Effect, actions, resources, conditions)
+	if err != nil {
+		return database.PsqlErrorHandler(err)
+	}
+	return nil
+}
+
+func (r *PolicyRepositoryImpl) DeleteRule(ctx context.Context, ruleID string) error {
+	result, err := r.db.Exec(ctx, `DELETE FROM policy_rules WHERE rule_id = $1`, ruleID)
+	if err != nil {
+		return database.PsqlErrorHandler(err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrRuleNotFound
+	}
+	return nil
+}
@@ -0,0 +1,327 @@
+package privacy_db
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/audit_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/login_attempts_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+var ErrNoErasureRequest = errors.New("account erasure is not requested")
+
+// Значения обезличенного профиля. Email уникален, поэтому в него попадает id
+const (
+	ErasedFirstName   = "Deleted"
+	ErasedLastName    = "User"
+	ErasedEmailDomain = "erased.invalid"
+	ErasedReason      = "erased"
+)
+
+// Erasure Запрос на удаление персональных данных
+type Erasure struct {
+	RequestedAt *time.Time
+	DueAt       *time.Time // Когда данные будут обезличены. nil - запроса нет
+	ErasedAt    *time.Time
+}
+
+// Membership Участие пользователя в организации с ролями и группами
+type Membership struct {
+	OrgID    int64
+	OrgSlug  string
+	OrgName  string
+	JoinedAt time.Time
+	Roles    []string // Роли, выданные напрямую
+	Groups   []string
+}
+
+// Session Refresh токен пользователя. Сам токен в выгрузку не попадает
+type Session struct {
+	ID        int64
+	OrgID     int64
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// PersonalData Всё, что хранится о пользователе помимо профиля
+type PersonalData struct {
+	Erasure         Erasure
+	Memberships     []Membership
+	Sessions        []Session
+	PasswordChanges []time.Time // Только даты: хеши паролей не выгружаются
+	AuditEvents     []audit_db.Event
+}
+
+// PrivacyRepository Выгрузка и удаление персональных данных. Действует на аккаунт целиком, организация запроса не учитывается
+type PrivacyRepository interface {
+	ExportData(ctx context.Context, userID int64) (PersonalData, error)
+	RequestErasure(ctx context.Context, userID int64, dueAt time.Time) (Erasure, error)
+	CancelErasure(ctx context.Context, userID int64) error
+	DueErasures(ctx context.Context, now time.Time, limit int) ([]int64, error)
+	Anonymize(ctx context.Context, userID int64) error
+}
+
+type PrivacyRepositoryImpl struct {
+	db  *pgxpool.Pool
+	log *slog.Logger
+}
+
+func NewPrivacyRepository(db *pgxpool.Pool, log *slog.Logger) *PrivacyRepositoryImpl {
+	return &PrivacyRepositoryImpl{
+		db:  db,
+		log: log,
+	}
+}
+
+func (r *PrivacyRepositoryImpl) ExportData(ctx context.Context, userID int64) (PersonalData, error) {
+	var data PersonalData
+	err := r.db.QueryRow(ctx, `SELECT erasure_requested_at, erasure_due_at, erased_at FROM users WHERE id = $1`, userID).
+		Scan(&data.Erasure.RequestedAt, &data.Erasure.DueAt, &data.Erasure.ErasedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return PersonalData{}, users_db.ErrUserNotFound
+	}
+	if err != nil {
+		return PersonalData{}, database.PsqlErrorHandler(err)
+	}
+
+	if data.Memberships, err = r.memberships(ctx, userID); err != nil {
+		return PersonalData{}, err
+	}
+	if data.Sessions, err = r.sessions(ctx, userID); err != nil {
+		return PersonalData{}, err
+	}
+	if data.PasswordChanges, err = r.passwordChanges(ctx, userID); err != nil {
+		return PersonalData{}, err
+	}
+	if data.AuditEvents, err = r.auditEvents(ctx, userID); err != nil {
+		return PersonalData{}, err
+	}
+	return data, nil
+}
+
+func (r *PrivacyRepositoryImpl) memberships(ctx context.Context, userID int64) ([]Membership, error) {
+	query := `
+SELECT organizations.id, organizations.slug, organizations.name, organization_members.joined_at,
+    ARRAY(SELECT roles.name FROM user_roles JOIN roles ON roles.id = user_roles.role_id
+          WHERE user_roles.user_id = $1 AND user_roles.org_id = organizations.id ORDER BY roles.name),
+    ARRAY(SELECT groups.name FROM group_members JOIN groups ON groups.id = group_members.group_id
+          WHERE group_members.user_id = $1 AND group_members.org_id = organizations.id ORDER BY groups.name)
+FROM organization_members JOIN organizations ON organizations.id = organization_members.org_id
+WHERE organization_members.user_id = $1
+ORDER BY organization_members.joined_at, organizations.id`
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, database.PsqlErrorHandler(err)
+	}
+	defer rows.Close()
+
+	memberships := make([]Membership, 0)
+	for rows.Next() {
+		var membership Membership
+		if err = rows.Scan(&membership.OrgID, &membership.OrgSlug, &membership.OrgName, &membership.JoinedAt, &membership.Roles, &membership.Groups); err != nil {
+			return nil, database.PsqlErrorHandler(err)
+		}
+		memberships = append(memberships, membership)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, database.PsqlErrorHandler(err)
+	}
+	return memberships, nil
+}
+
+func (r *PrivacyRepositoryImpl) sessions(ctx context.Context, userID int64) ([]Session, error) {
+	rows, err := r.db.Query(ctx, `SELECT id, org_id, created_at, updated_at FROM tokens WHERE user_id = $1 ORDER BY created_at, id`, userID)
+	if err != nil {
+		return nil, database.PsqlErrorHandler(err)
+	}
+	defer rows.Close()
+
+	sessions := make([]Session, 0)
+	for rows.Next() {
+		var session Session
+		if err = rows.Scan(&session.ID, &session.OrgID, &session.CreatedAt, &session.UpdatedAt); err != nil {
+			return nil, database.PsqlErrorHandler(err)
+		}
+		sessions = append(sessions, session)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, database.PsqlErrorHandler(err)
+	}
+	return sessions, nil
+}
+
+func (r *PrivacyRepositoryImpl) passwordChanges(ctx context.Context, userID int64) ([]time.Time, error) {
+	rows, err := r.db.Query(ctx, `SELECT created_at FROM password_history WHERE user_id = $1 ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, database.PsqlErrorHandler(err)
+	}
+	defer rows.Close()
+
+	changes := make([]time.Time, 0)
+	for rows.Next() {
+		var changedAt time.Time
+		if err = rows.Scan(&changedAt); err != nil {
+			return nil, database.PsqlErrorHandler(err)
+		}
+		changes = append(changes, changedAt)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, database.PsqlErrorHandler(err)
+	}
+	return changes, nil
+}
+
+// auditEvents Записи журнала, где пользователь - исполнитель или цель
+func (r *PrivacyRepositoryImpl) auditEvents(ctx context.Context, userID int64) ([]audit_db.Event, error) {
+	query := `SELECT id, org_id, actor_id, action, target_user_id, reason, ip, created_at
+FROM audit_log WHERE actor_id = $1 OR target_user_id = $1
+ORDER BY created_at, id`
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, database.PsqlErrorHandler(err)
+	}
+	defer rows.Close()
+
+	events := make([]audit_db.Event, 0)
+	for rows.Next() {
+		var event audit_db.Event
+		if err = rows.Scan(&event.ID, &event.OrgID, &event.ActorID, &event.Action, &event.TargetUserID, &event.Reason, &event.IP, &event.CreatedAt); err != nil {
+			return nil, database.PsqlErrorHandler(err)
+		}
+		// IP администратора, выполнившего действие над пользователем, не относится к данным пользователя
+		if event.ActorID == nil || *event.ActorID != userID {
+			event.IP = ""
+		}
+		events = append(events, event)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, database.PsqlErrorHandler(err)
+	}
+	return events, nil
+}
+
+// RequestErasure Ставит удаление на dueAt. Повторный запрос срок не сдвигает.
+// Последний администратор организации запросить удаление не может
+func (r *PrivacyRepositoryImpl) RequestErasure(ctx context.Context, userID int64, dueAt time.Time) (Erasure, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return Erasure{}, database.PsqlErrorHandler(err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err = users_db.EnsureNotLastAdmin(ctx, tx, userID, nil); err != nil {
+		return Erasure{}, err
+	}
+	query := `
+UPDATE users SET erasure_requested_at = COALESCE(erasure_requested_at, CURRENT_TIMESTAMP), erasure_due_at = COALESCE(erasure_due_at, $2)
+WHERE id = $1 AND erased_at IS NULL
+RETURNING erasure_requested_at, erasure_due_at, erased_at`
+	var erasure Erasure
+	err = tx.QueryRow(ctx, query, userID, dueAt).Scan(&erasure.RequestedAt, &erasure.DueAt, &erasure.ErasedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Erasure{}, users_db.ErrUserNotFound
+	}
+	if err != nil {
+		return Erasure{}, database.PsqlErrorHandler(err)
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return Erasure{}, database.PsqlErrorHandler(err)
+	}
+	return erasure, nil
+}
+
+func (r *PrivacyRepositoryImpl) CancelErasure(ctx context.Context, userID int64) error {
+	query := `UPDATE users SET erasure_requested_at = NULL, erasure_due_at = NULL
+WHERE id = $1 AND erased_at IS NULL AND erasure_due_at IS NOT NULL`
+	result, err := r.db.Exec(ctx, query, userID)
+	if err != nil {
+		return database.PsqlErrorHandler(err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrNoErasureRequest
+	}
+	return nil
+}
+
+// DueErasures Пользователи, у которых истёк срок ожидания удаления
+func (r *PrivacyRepositoryImpl) DueErasures(ctx context.Context, now time.Time, limit int) ([]int64, error) {
+	query := `SELECT id FROM users WHERE erasure_due_at IS NOT NULL AND erasure_due_at <= $1 AND erased_at IS NULL
+ORDER BY erasure_due_at LIMIT $2`
+	rows, err := r.db.Query(ctx, query, now, limit)
+	if err != nil {
+		return nil, database.PsqlErrorHandler(err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			return nil, database.PsqlErrorHandler(err)
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, database.PsqlErrorHandler(err)
+	}
+	return ids, nil
+}
+
+// Anonymize Обезличивает пользователя. Строка users остаётся с тем же id, поэтому записи журнала продолжают на неё ссылаться.
+// Удаляются сессии, история паролей, одноразовые ссылки и коды, счётчики входов и приглашения на email,
+// а также участие в организациях вместе с ролями и группами. Аккаунт отключается
+func (r *PrivacyRepositoryImpl) Anonymize(ctx context.Context, userID int64) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return database.PsqlErrorHandler(err)
+	}
+	defer tx.Rollback(ctx)
+
+	var email string
+	err = tx.QueryRow(ctx, `SELECT email FROM users WHERE id = $1 AND erased_at IS NULL FOR UPDATE`, userID).Scan(&email)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return users_db.ErrUserNotFound
+	}
+	if err != nil {
+		return database.PsqlErrorHandler(err)
+	}
+	if err = users_db.EnsureNotLastAdmin(ctx, tx, userID, nil); err != nil {
+		return err
+	}
+
+	statements := []struct {
+		query string
+		args  []interface{}
+	}{
+		{`DELETE FROM tokens WHERE user_id = $1`, []interface{}{userID}},
+		{`DELETE FROM password_history WHERE user_id = $1`, []interface{}{userID}},
+		{`DELETE FROM magic_links WHERE user_id = $1`, []interface{}{userID}},
+		{`DELETE FROM otp_codes WHERE user_id = $1`, []interface{}{userID}},
+		{`DELETE FROM email_changes WHERE user_id = $1`, []interface{}{userID}},
+		{`DELETE FROM organization_members WHERE user_id = $1`, []interface{}{userID}},
+		{`DELETE FROM login_attempts WHERE scope = $1 AND key = $2`, []interface{}{login_attempts_db.ScopeAccount, strings.ToLower(email)}},
+		{`DELETE FROM invitations WHERE lower(email) = lower($1)`, []interface{}{email}},
+		// Записи журнала остаются, но IP, с которых пользователь что-то делал, стираются
+		{`UPDATE audit_log SET ip = '' WHERE actor_id = $1`, []interface{}{userID}},
+		{`UPDATE users SET first_name = $2, last_name = $3, email = 'erased-' || id || '@' || $4, password = '',
+    phone = NULL, phone_verified_at = NULL, metadata = DEFAULT,
+    status = 'deactivated', status_reason = $5, status_expires_at = NULL, status_changed_at = CURRENT_TIMESTAMP,
+    erasure_due_at = NULL, erased_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+WHERE id = $1`, []interface{}{userID, ErasedFirstName, ErasedLastName, ErasedEmailDomain, ErasedReason}},
+	}
+	for _, statement := range statements {
+		if _, err = tx.Exec(ctx, statement.query, statement.args...); err != nil {
+			return database.PsqlErrorHandler(err)
+		}
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return database.PsqlErrorHandler(err)
+	}
+	return nil
+}
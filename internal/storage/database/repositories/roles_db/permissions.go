@@ -0,0 +1,176 @@
+package roles_db
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/tenant"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrPermissionNotFound = errors.New("permission not found")
+	ErrAdminPermissions   = errors.New("permissions of the admin role cannot be revoked")
+)
+
+type Permission struct {
+	ID          int64
+	Name        string
+	Description string
+}
+
+// PermissionSource Откуда у пользователя право: из его роли (только Role), из роли группы (Role и GroupID)
+// или выдано группе напрямую (только GroupID)
+type PermissionSource struct {
+	Role      string
+	GroupID   *int64
+	GroupName string
+}
+
+// EffectivePermission Право пользователя со всеми источниками, из которых оно получено
+type EffectivePermission struct {
+	Name    string
+	Sources []PermissionSource
+}
+
+func (r *RolesRepositoryImpl) ListPermissions(ctx context.Context) ([]Permission, error) {
+	rows, err := r.db.Query(ctx, `SELECT id, name, description FROM permissions ORDER BY name`)
+	if err != nil {
+		return nil, database.PsqlErrorHandler(err)
+	}
+	defer rows.Close()
+
+	var permissions []Permission
+	for rows.Next() {
+		var permission Permission
+		if err = rows.Scan(&permission.ID, &permission.Name, &permission.Description); err != nil {
+			return nil, database.PsqlErrorHandler(err)
+		}
+		permissions = append(permissions, permission)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, database.PsqlErrorHandler(err)
+	}
+	return permissions, nil
+}
+
+// GrantPermission Добавляет право роли. Повторное добавление не ошибка
+func (r *RolesRepositoryImpl) GrantPermission(ctx context.Context, roleName string, permission string) error {
+	roleID, permissionID, err := r.rolePermissionIDs(ctx, roleName, permission)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO role_permissions (role_id, permission_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+	if _, err = r.db.Exec(ctx, query, roleID, permissionID); err != nil {
+		return database.PsqlErrorHandler(err)
+	}
+	return nil
+}
+
+// RevokePermission Убирает право у роли. У роли admin права не забираются, иначе можно потерять доступ к управлению ролями
+func (r *RolesRepositoryImpl) RevokePermission(ctx context.Context, roleName string, permission string) error {
+	if roleName == users_db.RoleAdmin {
+		return ErrAdminPermissions
+	}
+	roleID, permissionID, err := r.rolePermissionIDs(ctx, roleName, permission)
+	if err != nil {
+		return err
+	}
+	query := `DELETE FROM role_permissions WHERE role_id = $1 AND permission_id = $2`
+	if _, err = r.db.Exec(ctx, query, roleID, permissionID); err != nil {
+		return database.PsqlErrorHandler(err)
+	}
+	return nil
+}
+
+// rolePermissionIDs Находит роль и право. Права встроенных ролей действуют во всех организациях,
+// поэтому менять их можно только из организации по умолчанию
+func (r *RolesRepositoryImpl) rolePermissionIDs(ctx context.Context, roleName string, permission string) (int64, int64, error) {
+	role, err := r.findRole(ctx, r.db, roleName)
+	if err != nil {
+		return 0, 0, err
+	}
+	if orgID, ok := tenant.OrgIDFromContext(ctx); ok && role.OrgID == nil && orgID != tenant.DefaultOrgID {
+		return 0, 0, ErrSharedRole
+	}
+	var permissionID int64
+	err = r.db.QueryRow(ctx, `SELECT id FROM permissions WHERE name = $1`, permission).Scan(&permissionID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, 0, ErrPermissionNotFound
+	}
+	if err != nil {
+		return 0, 0, database.PsqlErrorHandler(err)
+	}
+	return role.ID, permissionID, nil
+}
+
+// EffectivePermissions Права пользователя в организации запроса с источниками: прямые роли, роли групп и права групп.
+// Возвращает users_db.ErrUserNotFound, если пользователь не состоит в организации
+func (r *RolesRepositoryImpl) EffectivePermissions(ctx context.Context, userID int64) ([]EffectivePermission, error) {
+	orgID := tenant.OrgIDOrDefault(ctx)
+	var member bool
+	query := `SELECT EXISTS (SELECT 1 FROM organization_members WHERE org_id = $1 AND user_id = $2)`
+	if err := r.db.QueryRow(ctx, query, orgID, userID).Scan(&member); err != nil {
+		return nil, database.PsqlErrorHandler(err)
+	}
+	if !member {
+		return nil, users_db.ErrUserNotFound
+	}
+
+	query = `
+SELECT permissions.name, roles.name, NULL::int, NULL::text
+FROM user_roles
+JOIN roles ON roles.id = user_roles.role_id
+JOIN role_permissions ON role_permissions.role_id = roles.id
+JOIN permissions ON permissions.id = role_permissions.permission_id
+WHERE user_roles.user_id = $1 AND user_roles.org_id = $2
+UNION ALL
+SELECT permissions.name, roles.name, groups.id, groups.name
+FROM group_members
+JOIN groups ON groups.id = group_members.group_id
+JOIN group_roles ON group_roles.group_id = groups.id
+JOIN roles ON roles.id = group_roles.role_id
+JOIN role_permissions ON role_permissions.role_id = roles.id
+JOIN permissions ON permissions.id = role_permissions.permission_id
+WHERE group_members.user_id = $1 AND group_members.org_id = $2
+UNION ALL
+SELECT permissions.name, NULL, groups.id, groups.name
+FROM group_members
+JOIN groups ON groups.id = group_members.group_id
+JOIN group_permissions ON group_permissions.group_id = groups.id
+JOIN permissions ON permissions.id = group_permissions.permission_id
+WHERE group_members.user_id = $1 AND group_members.org_id = $2
+ORDER BY 1, 3 NULLS FIRST, 2 NULLS FIRST`
+	rows, err := r.db.Query(ctx, query, userID, orgID)
+	if err != nil {
+		return nil, database.PsqlErrorHandler(err)
+	}
+	defer rows.Close()
+
+	permissions := make([]EffectivePermission, 0)
+	for rows.Next() {
+		var name string
+		var role, groupName *string
+		var source PermissionSource
+		if err = rows.Scan(&name, &role, &source.GroupID, &groupName); err != nil {
+			return nil, database.PsqlErrorHandler(err)
+		}
+		if role != nil {
+			source.Role = *role
+		}
+		if groupName != nil {
+			source.GroupName = *groupName
+		}
+		// Строки отсортированы по праву, источники одного права идут подряд
+		if len(permissions) == 0 || permissions[len(permissions)-1].Name != name {
+			permissions = append(permissions, EffectivePermission{Name: name})
+		}
+		last := &permissions[len(permissions)-1]
+		last.Sources = append(last.Sources, source)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, database.PsqlErrorHandler(err)
+	}
+	return permissions, nil
+}
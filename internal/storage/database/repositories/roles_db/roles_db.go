@@ -0,0 +1,178 @@
+package roles_db
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/tenant"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
+	"time"
+)
+
+var (
+	ErrRoleNotFound      = errors.New("role not found")
+	ErrRoleAlreadyExists = errors.New("role already exists")
+	ErrRoleNotGranted    = errors.New("user does not have this role")
+	ErrSharedRole        = errors.New("built-in roles are shared by all organizations and can only be changed from the default organization")
+)
+
+// Role Роль. Встроенные роли (OrgID == nil) общие для всех организаций, остальные видны только своей организации
+type Role struct {
+	ID          int64
+	OrgID       *int64
+	Name        string
+	Description string
+	Permissions []string
+	CreatedAt   time.Time
+}
+
+// roleColumns Колонки, которые читаются в Role функцией scanRole
+const roleColumns = `id, org_id, name, description, ARRAY(
+    SELECT permissions.name FROM role_permissions JOIN permissions ON permissions.id = role_permissions.permission_id
+    WHERE role_permissions.role_id = roles.id ORDER BY permissions.name), created_at`
+
+func scanRole(row pgx.Row) (Role, error) {
+	var role Role
+	err := row.Scan(&role.ID, &role.OrgID, &role.Name, &role.Description, &role.Permissions, &role.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Role{}, ErrRoleNotFound
+	}
+	if err != nil {
+		return Role{}, database.PsqlErrorHandler(err)
+	}
+	return role, nil
+}
+
+// RolesRepository Роли и права. Работает в рамках организации запроса (tenant.WithOrgID): видны встроенные роли
+// и роли этой организации, роли выдаются и забираются только в ней
+type RolesRepository interface {
+	ListRoles(ctx context.Context) ([]Role, error)
+	CreateRole(ctx context.Context, name string, description string) (Role, error)
+	GrantRole(ctx context.Context, userID int64, roleName string) error
+	RevokeRole(ctx context.Context, userID int64, roleName string) error
+	ListPermissions(ctx context.Context) ([]Permission, error)
+	GrantPermission(ctx context.Context, roleName string, permission string) error
+	RevokePermission(ctx context.Context, roleName string, permission string) error
+	EffectivePermissions(ctx context.Context, userID int64) ([]EffectivePermission, error)
+}
+
+type RolesRepositoryImpl struct {
+	db  *pgxpool.Pool
+	log *slog.Logger
+}
+
+func NewRolesRepository(db *pgxpool.Pool, log *slog.Logger) *RolesRepositoryImpl {
+	return &RolesRepositoryImpl{
+		db:  db,
+		log: log,
+	}
+}
+
+func (r *RolesRepositoryImpl) ListRoles(ctx context.Context) ([]Role, error) {
+	query := `SELECT ` + roleColumns + ` FROM roles WHERE org_id IS NULL OR org_id = $1 ORDER BY name`
+	rows, err := r.db.Query(ctx, query, tenant.OrgIDArg(ctx))
+	if err != nil {
+		return nil, database.PsqlErrorHandler(err)
+	}
+	defer rows.Close()
+
+	var roles []Role
+	for rows.Next() {
+		role, err := scanRole(rows)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, database.PsqlErrorHandler(err)
+	}
+	return roles, nil
+}
+
+// CreateRole Создаёт роль организации запроса. Имена встроенных ролей заняты во всех организациях
+func (r *RolesRepositoryImpl) CreateRole(ctx context.Context, name string, description string) (Role, error) {
+	query := `
+INSERT INTO roles (name, description, org_id)
+SELECT $1, $2, $3 WHERE NOT EXISTS (SELECT 1 FROM roles WHERE name = $1 AND org_id IS NULL)
+RETURNING ` + roleColumns
+	role, err := scanRole(r.db.QueryRow(ctx, query, name, description, tenant.OrgIDArg(ctx)))
+	if errors.Is(err, ErrRoleNotFound) {
+		return Role{}, ErrRoleAlreadyExists
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == database.PSQLUniqueError {
+		return Role{}, ErrRoleAlreadyExists
+	}
+	return role, err
+}
+
+// GrantRole Выдаёт роль участнику организации запроса. Повторная выдача не ошибка
+func (r *RolesRepositoryImpl) GrantRole(ctx context.Context, userID int64, roleName string) error {
+	role, err := r.findRole(ctx, r.db, roleName)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO user_roles (org_id, user_id, role_id) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`
+	_, err = r.db.Exec(ctx, query, tenant.OrgIDOrDefault(ctx), userID, role.ID)
+	if err != nil {
+		// Пользователь не состоит в организации
+		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == database.PSQLForeignKeyError {
+			return users_db.ErrUserNotFound
+		}
+		return database.PsqlErrorHandler(err)
+	}
+	return nil
+}
+
+// RevokeRole Забирает роль у пользователя в организации запроса. Последнего администратора организации лишить роли admin нельзя,
+// но можно забрать выданную напрямую роль, если пользователь остаётся администратором через группу
+func (r *RolesRepositoryImpl) RevokeRole(ctx context.Context, userID int64, roleName string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return database.PsqlErrorHandler(err)
+	}
+	defer tx.Rollback(ctx)
+
+	role, err := r.findRole(ctx, tx, roleName)
+	if err != nil {
+		return err
+	}
+	orgID := tenant.OrgIDOrDefault(ctx)
+	var hadAdmin bool
+	if roleName == users_db.RoleAdmin {
+		if hadAdmin, err = users_db.LockOrgAdmins(ctx, tx, orgID); err != nil {
+			return err
+		}
+	}
+	result, err := tx.Exec(ctx, `DELETE FROM user_roles WHERE org_id = $1 AND user_id = $2 AND role_id = $3`, orgID, userID, role.ID)
+	if err != nil {
+		return database.PsqlErrorHandler(err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrRoleNotGranted
+	}
+	if hadAdmin {
+		if err = users_db.EnsureOrgHasAdmin(ctx, tx, orgID); err != nil {
+			return err
+		}
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return database.PsqlErrorHandler(err)
+	}
+	return nil
+}
+
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// findRole Ищет роль среди встроенных и ролей организации запроса
+func (r *RolesRepositoryImpl) findRole(ctx context.Context, q querier, roleName string) (Role, error) {
+	query := `SELECT ` + roleColumns + ` FROM roles WHERE name = $1 AND (org_id IS NULL OR org_id = $2)`
+	return scanRole(q.QueryRow(ctx, query, roleName, tenant.OrgIDArg(ctx)))
+}
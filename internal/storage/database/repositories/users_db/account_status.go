@@ -0,0 +1,80 @@
+package users_db
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/tenant"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+// Статусы аккаунта
+const (
+	StatusActive      = "active"
+	StatusSuspended   = "suspended"   // Временно заблокирован администратором
+	StatusDeactivated = "deactivated" // Отключён насовсем, вернуть может только администратор
+)
+
+// StatusChange Новый статус аккаунта. ExpiresAt - когда статус перестаёт действовать:
+// блокировка снимается сама, а активный аккаунт истекает и становится deactivated. nil - бессрочно
+type StatusChange struct {
+	Status    string
+	Reason    string
+	ExpiresAt *time.Time
+}
+
+// StatusExpr Действующий статус пользователя из таблицы table с учётом status_expires_at.
+// Статус вычисляется при чтении, поэтому фоновая задача для снятия блокировок не нужна
+func StatusExpr(table string) string {
+	return `(CASE WHEN ` + table + `.status_expires_at IS NOT NULL AND ` + table + `.status_expires_at <= CURRENT_TIMESTAMP THEN
+    CASE ` + table + `.status WHEN 'suspended' THEN 'active' WHEN 'active' THEN 'deactivated' ELSE ` + table + `.status END
+    ELSE ` + table + `.status END)`
+}
+
+// GetUserStatus Действующий статус аккаунта. Статус общий для всех организаций, поэтому организация запроса не учитывается
+func (us *UserRepositoryImpl) GetUserStatus(ctx context.Context, id int64) (string, error) {
+	var status string
+	err := us.db.QueryRow(ctx, `SELECT `+StatusExpr("users")+` FROM users WHERE id = $1`, id).Scan(&status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrUserNotFound
+	}
+	if err != nil {
+		return "", database.PsqlErrorHandler(err)
+	}
+	return status, nil
+}
+
+// SetStatus Меняет статус аккаунта и возвращает пользователя после изменения.
+// При блокировке и отключении сразу удаляются все refresh токены пользователя, а последнего администратора
+// ни одной из организаций заблокировать нельзя
+func (us *UserRepositoryImpl) SetStatus(ctx context.Context, id int64, change StatusChange) (UserInfo, error) {
+	tx, err := us.db.Begin(ctx)
+	if err != nil {
+		return UserInfo{}, database.PsqlErrorHandler(err)
+	}
+	defer tx.Rollback(ctx)
+
+	if change.Status != StatusActive {
+		if err = EnsureNotLastAdmin(ctx, tx, id, nil); err != nil {
+			return UserInfo{}, err
+		}
+	}
+	query := `
+UPDATE users SET status = $2, status_reason = $3, status_expires_at = $4, status_changed_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND ` + MemberFilter("users.id", "$5") + `
+RETURNING ` + userColumns("$5")
+	user, err := scanUser(tx.QueryRow(ctx, query, id, change.Status, change.Reason, change.ExpiresAt, tenant.OrgIDArg(ctx)))
+	if err != nil {
+		return UserInfo{}, err
+	}
+	if change.Status != StatusActive {
+		if _, err = tx.Exec(ctx, `DELETE FROM tokens WHERE user_id = $1`, id); err != nil {
+			return UserInfo{}, database.PsqlErrorHandler(err)
+		}
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return UserInfo{}, database.PsqlErrorHandler(err)
+	}
+	return user, nil
+}
@@ -0,0 +1,162 @@
+package users_db
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+var ErrEmailChangeNotFound = errors.New("email change link is invalid, expired or already used")
+
+// EmailChange Заявка на смену email. Токены ссылок хранятся только хешами
+type EmailChange struct {
+	ID              int64
+	UserID          int64
+	OldEmail        string
+	NewEmail        string
+	ExpiresAt       time.Time // До какого момента можно подтвердить новый адрес
+	CancelExpiresAt time.Time // До какого момента владелец старого адреса может отменить смену
+	ConfirmedAt     *time.Time
+	CancelledAt     *time.Time
+	CreatedAt       time.Time
+}
+
+const emailChangeColumns = `id, user_id, old_email, new_email, expires_at, cancel_expires_at, confirmed_at, cancelled_at, created_at`
+
+// emailChangePending Заявка ещё ждёт подтверждения
+const emailChangePending = `confirmed_at IS NULL AND cancelled_at IS NULL AND expires_at > CURRENT_TIMESTAMP`
+
+func scanEmailChange(row pgx.Row) (EmailChange, error) {
+	var change EmailChange
+	err := row.Scan(&change.ID, &change.UserID, &change.OldEmail, &change.NewEmail, &change.ExpiresAt,
+		&change.CancelExpiresAt, &change.ConfirmedAt, &change.CancelledAt, &change.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return EmailChange{}, ErrEmailChangeNotFound
+	}
+	if err != nil {
+		return EmailChange{}, database.PsqlErrorHandler(err)
+	}
+	return change, nil
+}
+
+// CreateEmailChange Создаёт заявку на смену email пользователя change.UserID на change.NewEmail.
+// Старый адрес берётся из БД. Предыдущая неподтверждённая заявка пользователя отменяется.
+// Занятость нового адреса не проверяется, что б ответ не выдавал чужие адреса: уникальность проверяется при подтверждении
+func (us *UserRepositoryImpl) CreateEmailChange(ctx context.Context, change EmailChange, confirmTokenHash string, cancelTokenHash string) (EmailChange, error) {
+	tx, err := us.db.Begin(ctx)
+	if err != nil {
+		return EmailChange{}, database.PsqlErrorHandler(err)
+	}
+	defer tx.Rollback(ctx)
+
+	var oldEmail string
+	err = tx.QueryRow(ctx, `SELECT email FROM users WHERE id = $1 AND erased_at IS NULL FOR UPDATE`, change.UserID).Scan(&oldEmail)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return EmailChange{}, ErrUserNotFound
+	}
+	if err != nil {
+		return EmailChange{}, database.PsqlErrorHandler(err)
+	}
+
+	change.NewEmail = NormalizeEmail(change.NewEmail)
+
+	query := `UPDATE email_changes SET cancelled_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND ` + emailChangePending
+	if _, err = tx.Exec(ctx, query, change.UserID); err != nil {
+		return EmailChange{}, database.PsqlErrorHandler(err)
+	}
+
+	query = `
+INSERT INTO email_changes (user_id, old_email, new_email, confirm_token_hash, cancel_token_hash, expires_at, cancel_expires_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING ` + emailChangeColumns
+	created, err := scanEmailChange(tx.QueryRow(ctx, query,
+		change.UserID, oldEmail, change.NewEmail, confirmTokenHash, cancelTokenHash, change.ExpiresAt, change.CancelExpiresAt))
+	if err != nil {
+		return EmailChange{}, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return EmailChange{}, database.PsqlErrorHandler(err)
+	}
+	return created, nil
+}
+
+// ConfirmEmailChange Списывает ссылку подтверждения, меняет email и удаляет все refresh токены пользователя,
+// кроме keepRefreshToken (сессия, из которой подтвердили смену. Пустая строка - удаляются все).
+// Если адрес успели занять - ErrEmailAlreadyExists, если email пользователя успел измениться - ErrEmailChangeNotFound
+func (us *UserRepositoryImpl) ConfirmEmailChange(ctx context.Context, confirmTokenHash string, keepRefreshToken string) (EmailChange, error) {
+	tx, err := us.db.Begin(ctx)
+	if err != nil {
+		return EmailChange{}, database.PsqlErrorHandler(err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+UPDATE email_changes SET confirmed_at = CURRENT_TIMESTAMP
+WHERE confirm_token_hash = $1 AND ` + emailChangePending + `
+RETURNING ` + emailChangeColumns
+	change, err := scanEmailChange(tx.QueryRow(ctx, query, confirmTokenHash))
+	if err != nil {
+		return EmailChange{}, err
+	}
+
+	query = `UPDATE users SET email = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND email = $3 AND erased_at IS NULL`
+	result, err := tx.Exec(ctx, query, change.UserID, change.NewEmail, change.OldEmail)
+	if uniqueErr := uniqueViolationError(err); uniqueErr != nil {
+		return EmailChange{}, uniqueErr
+	}
+	if err != nil {
+		return EmailChange{}, database.PsqlErrorHandler(err)
+	}
+	if result.RowsAffected() == 0 {
+		return EmailChange{}, ErrEmailChangeNotFound
+	}
+
+	if _, err = tx.Exec(ctx, `DELETE FROM tokens WHERE user_id = $1 AND refresh_token <> $2`, change.UserID, keepRefreshToken); err != nil {
+		return EmailChange{}, database.PsqlErrorHandler(err)
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return EmailChange{}, database.PsqlErrorHandler(err)
+	}
+	return change, nil
+}
+
+// CancelEmailChange Отменяет смену по ссылке из письма на старый адрес. Уже подтверждённая смена откатывается:
+// email возвращается на старый, если с тех пор не менялся. В любом случае удаляются все refresh токены пользователя,
+// ведь отмена означает, что смену запросил не владелец аккаунта
+func (us *UserRepositoryImpl) CancelEmailChange(ctx context.Context, cancelTokenHash string) (EmailChange, error) {
+	tx, err := us.db.Begin(ctx)
+	if err != nil {
+		return EmailChange{}, database.PsqlErrorHandler(err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+UPDATE email_changes SET cancelled_at = CURRENT_TIMESTAMP
+WHERE cancel_token_hash = $1 AND cancelled_at IS NULL AND cancel_expires_at > CURRENT_TIMESTAMP
+RETURNING ` + emailChangeColumns
+	change, err := scanEmailChange(tx.QueryRow(ctx, query, cancelTokenHash))
+	if err != nil {
+		return EmailChange{}, err
+	}
+
+	if change.ConfirmedAt != nil {
+		query = `UPDATE users SET email = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND email = $3 AND erased_at IS NULL`
+		_, err = tx.Exec(ctx, query, change.UserID, change.OldEmail, change.NewEmail)
+		if uniqueErr := uniqueViolationError(err); uniqueErr != nil {
+			return EmailChange{}, uniqueErr
+		}
+		if err != nil {
+			return EmailChange{}, database.PsqlErrorHandler(err)
+		}
+	}
+
+	if _, err = tx.Exec(ctx, `DELETE FROM tokens WHERE user_id = $1`, change.UserID); err != nil {
+		return EmailChange{}, database.PsqlErrorHandler(err)
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return EmailChange{}, database.PsqlErrorHandler(err)
+	}
+	return change, nil
+}
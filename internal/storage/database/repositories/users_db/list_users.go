@@ -0,0 +1,145 @@
+package users_db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/tenant"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Поля, по которым можно сортировать список пользователей
+const (
+	SortByCreatedAt = "created_at"
+	SortByEmail     = "email"
+	SortByLastName  = "last_name"
+)
+
+var ErrInvalidSort = errors.New("unsupported sort field")
+
+// ListUsersCursor Позиция в списке: значение поля сортировки и id последнего выданного пользователя
+type ListUsersCursor struct {
+	Value string
+	ID    int64
+}
+
+// ListUsersFilter Параметры выборки списка пользователей. Пустые поля не фильтруют
+type ListUsersFilter struct {
+	Search      string // Подстрока имени, фамилии или email без учёта регистра
+	Role        string
+	Status      string
+	CreatedFrom *time.Time // Включительно
+	CreatedTo   *time.Time // Не включительно
+	Metadata    MetadataFilter
+	SortBy      string
+	Desc        bool
+	Limit       int
+	After       *ListUsersCursor // nil - с начала списка
+}
+
+// CursorFor Курсор, указывающий на пользователя при сортировке по sortBy
+func CursorFor(user UserInfo, sortBy string) ListUsersCursor {
+	cursor := ListUsersCursor{ID: user.ID}
+	switch sortBy {
+	case SortByEmail:
+		cursor.Value = user.Email
+	case SortByLastName:
+		cursor.Value = user.LastName
+	default:
+		cursor.Value = user.CreatedAt.Format(time.RFC3339Nano)
+	}
+	return cursor
+}
+
+// ListUsers Страница пользователей по фильтру. Пагинация по курсору (keyset): сортировка всегда дополняется id,
+// поэтому страницы не съезжают, когда между запросами добавляются или удаляются пользователи.
+// В список попадают только участники организации запроса, фильтр по роли смотрит на роли в ней
+func (us *UserRepositoryImpl) ListUsers(ctx context.Context, filter ListUsersFilter) ([]UserInfo, error) {
+	var sortColumn, cursorCast string
+	switch filter.SortBy {
+	case SortByCreatedAt, "":
+		sortColumn, cursorCast = "created_at", "::timestamptz"
+	case SortByEmail:
+		sortColumn = "email"
+	case SortByLastName:
+		sortColumn = "last_name"
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSort, filter.SortBy)
+	}
+	direction, comparison := "ASC", ">"
+	if filter.Desc {
+		direction, comparison = "DESC", "<"
+	}
+
+	var conditions []string
+	var args []interface{}
+	addArg := func(value interface{}) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+	orgArg := addArg(tenant.OrgIDArg(ctx))
+	conditions = append(conditions, MemberFilter("users.id", orgArg))
+
+	if filter.Search != "" {
+		pattern := addArg("%" + escapeLike(filter.Search) + "%")
+		conditions = append(conditions, fmt.Sprintf("(first_name ILIKE %[1]s OR last_name ILIKE %[1]s OR email ILIKE %[1]s)", pattern))
+	}
+	if filter.Role != "" {
+		// Роль может быть выдана и через группу
+		conditions = append(conditions, `EXISTS (
+    SELECT 1 FROM roles
+    WHERE roles.name = `+addArg(filter.Role)+` AND roles.id IN (`+EffectiveRoleIDsQuery("users.id", userOrgExpr(orgArg))+`))`)
+	}
+	if filter.Status != "" {
+		conditions = append(conditions, StatusExpr("users")+" = "+addArg(filter.Status))
+	}
+	if filter.CreatedFrom != nil {
+		conditions = append(conditions, "created_at >= "+addArg(*filter.CreatedFrom))
+	}
+	if filter.CreatedTo != nil {
+		conditions = append(conditions, "created_at < "+addArg(*filter.CreatedTo))
+	}
+	if len(filter.Metadata) > 0 {
+		document, err := metadataFilterArg(filter.Metadata)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, "metadata @> "+addArg(document)+"::jsonb")
+	}
+	if filter.After != nil {
+		conditions = append(conditions, fmt.Sprintf("(%s, id) %s (%s%s, %s)",
+			sortColumn, comparison, addArg(filter.After.Value), cursorCast, addArg(filter.After.ID)))
+	}
+
+	query := `SELECT ` + userColumns(orgArg) + ` FROM users WHERE ` + strings.Join(conditions, " AND ")
+	query += fmt.Sprintf(" ORDER BY %[1]s %[2]s, id %[2]s LIMIT %[3]s", sortColumn, direction, addArg(filter.Limit))
+
+	rows, err := us.db.Query(ctx, query, args...)
+	if err != nil {
+		dbErr := database.PsqlErrorHandler(err)
+		return nil, dbErr
+	}
+	defer rows.Close()
+
+	users := make([]UserInfo, 0, filter.Limit)
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	if err = rows.Err(); err != nil {
+		dbErr := database.PsqlErrorHandler(err)
+		return nil, dbErr
+	}
+	return users, nil
+}
+
+// escapeLike Экранирует спецсимволы LIKE, что б строка поиска искалась буквально
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
@@ -0,0 +1,118 @@
+package users_db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/tenant"
+	"slices"
+)
+
+// Секции дополнительных атрибутов пользователя
+const (
+	MetadataSectionUser  = "user"  // Меняет сам пользователь через PATCH /me
+	MetadataSectionAdmin = "admin" // Меняют только администраторы, пользователь видит их только на чтение
+)
+
+// Metadata Дополнительные атрибуты пользователя из колонки metadata. Содержимое проверяется JSON схемой в сервисе, БД следит
+// только за тем, что обе секции - объекты
+type Metadata struct {
+	User  map[string]interface{} `json:"user"`
+	Admin map[string]interface{} `json:"admin"`
+}
+
+// Section Секция по имени. nil для неизвестной секции
+func (m Metadata) Section(section string) map[string]interface{} {
+	switch section {
+	case MetadataSectionUser:
+		return m.User
+	case MetadataSectionAdmin:
+		return m.Admin
+	default:
+		return nil
+	}
+}
+
+// MetadataUpdate Новые секции атрибутов. Секция заменяется целиком, nil - не меняется
+type MetadataUpdate struct {
+	User  map[string]interface{}
+	Admin map[string]interface{}
+}
+
+// MetadataFilter Фильтр по атрибутам: секция -> атрибут -> значение. Сравнение через @>, поэтому
+// для массива достаточно, что б он содержал перечисленные элементы
+type MetadataFilter map[string]map[string]interface{}
+
+// SetMetadata Заменяет переданные секции атрибутов и возвращает пользователя после изменения
+func (us *UserRepositoryImpl) SetMetadata(ctx context.Context, id int64, update MetadataUpdate) (UserInfo, error) {
+	userSection, err := metadataSectionArg(update.User)
+	if err != nil {
+		return UserInfo{}, err
+	}
+	adminSection, err := metadataSectionArg(update.Admin)
+	if err != nil {
+		return UserInfo{}, err
+	}
+	query := `
+UPDATE users SET metadata = jsonb_build_object(
+    'user',  COALESCE($2::jsonb, metadata -> 'user'),
+    'admin', COALESCE($3::jsonb, metadata -> 'admin'))
+WHERE id = $1 AND ` + MemberFilter("users.id", "$4") + `
+RETURNING ` + userColumns("$4")
+	return scanUser(us.db.QueryRow(ctx, query, id, userSection, adminSection, tenant.OrgIDArg(ctx)))
+}
+
+// metadataSectionArg Секция для параметра ::jsonb. Для nil возвращает NULL, а не JSON null
+func metadataSectionArg(section map[string]interface{}) (*string, error) {
+	if section == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(section)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metadata: %w", err)
+	}
+	value := string(data)
+	return &value, nil
+}
+
+// metadataFilterArg Документ для сравнения metadata @> $n::jsonb
+func metadataFilterArg(filter MetadataFilter) (string, error) {
+	data, err := json.Marshal(filter)
+	if err != nil {
+		return "", fmt.Errorf("invalid metadata filter: %w", err)
+	}
+	return string(data), nil
+}
+
+// JSONContains Содержит ли документ value документ sub по правилам оператора jsonb @>: у объекта есть все ключи sub
+// с подходящими значениями, в массиве для каждого элемента sub есть подходящий элемент, скаляры равны.
+// Значения - результат json.Unmarshal в interface{}
+func JSONContains(value interface{}, sub interface{}) bool {
+	switch sub := sub.(type) {
+	case map[string]interface{}:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for key, subValue := range sub {
+			item, ok := object[key]
+			if !ok || !JSONContains(item, subValue) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		array, ok := value.([]interface{})
+		if !ok {
+			return false
+		}
+		for _, subItem := range sub {
+			if !slices.ContainsFunc(array, func(item interface{}) bool { return JSONContains(item, subItem) }) {
+				return false
+			}
+		}
+		return true
+	default:
+		return value == sub
+	}
+}
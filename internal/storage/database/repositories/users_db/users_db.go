@@ -3,23 +3,56 @@ package users_db
 import (
 	"context"
 	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/tenant"
 	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database"
 	"github.com/ShlykovPavel/auth-JWT-microservice/models/users/create_user"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"log/slog"
+	"strings"
+	"time"
 )
 
 var ErrEmailAlreadyExists = errors.New("Пользователь с email уже существует. ")
+var ErrUsernameAlreadyExists = errors.New("Имя пользователя уже занято ")
 var ErrUserNotFound = errors.New("Пользователь не найден ")
+var ErrPhoneAlreadyExists = errors.New("Номер телефона уже подтверждён другим пользователем ")
+var ErrUserModified = errors.New("Пользователь был изменён другим запросом ")
+var ErrLastAdmin = errors.New("Нельзя убрать последнего администратора ")
 
+// Встроенные роли. Роль user выдаётся при регистрации, admin даёт доступ к административным ручкам
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+// UserRepository Пользователи. Если запрос привязан к организации (tenant.WithOrgID), все методы видят
+// только её участников, а роли и права читаются в рамках этой организации. Всех пользователей видит только запрос,
+// явно отвязанный от организации (tenant.WithoutOrg), а запрос без организации не видит никого
 type UserRepository interface {
 	CreateUser(ctx context.Context, userinfo *create_user.UserCreate) (int64, error)
 	GetUser(ctx context.Context, userEmail string) (UserInfo, error)
+	GetUserByUsername(ctx context.Context, username string) (UserInfo, error)
 	CheckAdminInDB(ctx context.Context) (UserInfo, error)
-	AddFirstAdmin(ctx context.Context, passwordHash string) error
+	AddFirstAdmin(ctx context.Context, email string, passwordHash string) error
 	SetAdminRole(ctx context.Context, id int64) error
+	GetUserByID(ctx context.Context, id int64) (UserInfo, error)
+	UpdatePassword(ctx context.Context, id int64, passwordHash string) error
+	GetPasswordHistory(ctx context.Context, id int64, limit int) ([]string, error)
+	RehashPassword(ctx context.Context, id int64, oldPasswordHash string, newPasswordHash string) error
+	GetUserByPhone(ctx context.Context, phone string) (UserInfo, error)
+	SetPhone(ctx context.Context, id int64, phone string) error
+	MarkPhoneVerified(ctx context.Context, id int64, phone string) error
+	UpdateProfile(ctx context.Context, id int64, update ProfileUpdate, expectedUpdatedAt *time.Time) (UserInfo, error)
+	DeleteUser(ctx context.Context, id int64, expectedUpdatedAt *time.Time) error
+	ListUsers(ctx context.Context, filter ListUsersFilter) ([]UserInfo, error)
+	GetUserStatus(ctx context.Context, id int64) (string, error)
+	SetStatus(ctx context.Context, id int64, change StatusChange) (UserInfo, error)
+	SetMetadata(ctx context.Context, id int64, update MetadataUpdate) (UserInfo, error)
+	CreateEmailChange(ctx context.Context, change EmailChange, confirmTokenHash string, cancelTokenHash string) (EmailChange, error)
+	ConfirmEmailChange(ctx context.Context, confirmTokenHash string, keepRefreshToken string) (EmailChange, error)
+	CancelEmailChange(ctx context.Context, cancelTokenHash string) (EmailChange, error)
 }
 
 type UserRepositoryImpl struct {
@@ -29,12 +62,150 @@ type UserRepositoryImpl struct {
 
 // UserInfo Структура с информацие о пользователе
 type UserInfo struct {
-	ID           int64
-	FirstName    string
-	LastName     string
-	Email        string
-	PasswordHash string
-	Role         string
+	ID            int64
+	FirstName     string
+	LastName      string
+	Email         string
+	Username      string   // Пустая строка - имя пользователя не задано
+	PasswordHash  string   // Пустая строка - пароля нет: вход только по ссылке или коду
+	OrgID         int64    // Организация, в рамках которой прочитаны роли и права. 0 - пользователь не состоит ни в одной
+	Roles         []string // Роли в организации OrgID
+	Permissions   []string // Права всех ролей пользователя в организации OrgID
+	Phone         string   // Пустая строка - телефон не указан
+	PhoneVerified bool
+	Status        string // Действующий статус с учётом StatusExpiresAt
+	StatusReason  string
+	// StatusExpiresAt Когда статус перестаёт действовать. nil - бессрочно
+	StatusExpiresAt *time.Time
+	// PasswordResetRequired Пароль нужно задать при первом входе. Старый пароль при этом не спрашивается
+	PasswordResetRequired bool
+	Metadata              Metadata
+	CreatedAt             time.Time
+	UpdatedAt             time.Time
+}
+
+// ProfileUpdate Изменяемые пользователем поля профиля. nil - поле не меняется
+type ProfileUpdate struct {
+	FirstName    *string
+	LastName     *string
+	Username     *string                // Пустая строка убирает имя пользователя
+	UserMetadata map[string]interface{} // Новая секция user в Metadata целиком
+}
+
+// userColumns Колонки, которые читаются в UserInfo функцией scanUser. Порядок должен совпадать.
+// orgArg - параметр запроса с id организации из tenant.OrgIDArg
+func userColumns(orgArg string) string {
+	org := userOrgExpr(orgArg)
+	return `id, first_name, last_name, email, COALESCE(username, ''), password, ` + org + `, ` + RolesQuery("users.id", org) + `, ` + PermissionsQuery("users.id", org) +
+		`, COALESCE(phone, ''), phone_verified_at IS NOT NULL, ` + StatusExpr("users") + `, status_reason, status_expires_at, password_reset_required, metadata, created_at, updated_at`
+}
+
+// userOrgExpr Организация, в рамках которой читаются роли: из запроса, а без неё - та, в которую пользователь вступил первой
+func userOrgExpr(orgArg string) string {
+	return `COALESCE(` + orgArg + `::int, (
+    SELECT organization_members.org_id FROM organization_members WHERE organization_members.user_id = users.id
+    ORDER BY organization_members.joined_at, organization_members.org_id LIMIT 1), 0)`
+}
+
+// MemberFilter Условие "пользователь состоит в организации orgArg". orgArg - NULL только у запроса,
+// явно отвязанного от организации (tenant.WithoutOrg), тогда ничего не фильтрует
+func MemberFilter(userIDExpr string, orgArg string) string {
+	return `(` + orgArg + `::int IS NULL OR EXISTS (
+    SELECT 1 FROM organization_members
+    WHERE organization_members.user_id = ` + userIDExpr + ` AND organization_members.org_id = ` + orgArg + `))`
+}
+
+// EffectiveRoleIDsQuery Подзапрос с id ролей пользователя в организации: выданных напрямую и через группы
+func EffectiveRoleIDsQuery(userIDExpr string, orgIDExpr string) string {
+	return `SELECT user_roles.role_id FROM user_roles
+    WHERE user_roles.user_id = ` + userIDExpr + ` AND user_roles.org_id = ` + orgIDExpr + `
+    UNION
+    SELECT group_roles.role_id FROM group_members JOIN group_roles ON group_roles.group_id = group_members.group_id
+    WHERE group_members.user_id = ` + userIDExpr + ` AND group_members.org_id = ` + orgIDExpr
+}
+
+// RolesQuery Подзапрос, возвращающий имена ролей пользователя в организации массивом, включая роли его групп.
+// userIDExpr и orgIDExpr - выражения с id пользователя и организации
+func RolesQuery(userIDExpr string, orgIDExpr string) string {
+	return `ARRAY(
+    SELECT roles.name FROM roles WHERE roles.id IN (` + EffectiveRoleIDsQuery(userIDExpr, orgIDExpr) + `) ORDER BY roles.name)`
+}
+
+// PermissionsQuery Подзапрос, возвращающий массивом права всех ролей пользователя в организации и права, выданные его группам
+func PermissionsQuery(userIDExpr string, orgIDExpr string) string {
+	return `ARRAY(
+    SELECT permissions.name FROM permissions WHERE permissions.id IN (
+    SELECT role_permissions.permission_id FROM role_permissions
+    WHERE role_permissions.role_id IN (` + EffectiveRoleIDsQuery(userIDExpr, orgIDExpr) + `)
+    UNION
+    SELECT group_permissions.permission_id FROM group_members JOIN group_permissions ON group_permissions.group_id = group_members.group_id
+    WHERE group_members.user_id = ` + userIDExpr + ` AND group_members.org_id = ` + orgIDExpr + `) ORDER BY permissions.name)`
+}
+
+// HasRole Есть ли у пользователя роль
+func (u UserInfo) HasRole(role string) bool {
+	for _, r := range u.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func scanUser(row pgx.Row) (UserInfo, error) {
+	var user UserInfo
+	err := row.Scan(
+		&user.ID,
+		&user.FirstName,
+		&user.LastName,
+		&user.Email,
+		&user.Username,
+		&user.PasswordHash,
+		&user.OrgID,
+		&user.Roles,
+		&user.Permissions,
+		&user.Phone,
+		&user.PhoneVerified,
+		&user.Status,
+		&user.StatusReason,
+		&user.StatusExpiresAt,
+		&user.PasswordResetRequired,
+		&user.Metadata,
+		&user.CreatedAt,
+		&user.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return UserInfo{}, ErrUserNotFound
+	}
+	if uniqueErr := uniqueViolationError(err); uniqueErr != nil {
+		return UserInfo{}, uniqueErr
+	}
+	if err != nil {
+		dbErr := database.PsqlErrorHandler(err)
+		return UserInfo{}, dbErr
+	}
+	return user, nil
+}
+
+// NormalizeEmail Email в том виде, в каком он хранится и сравнивается: без пробелов по краям и в нижнем регистре
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// NormalizeUsername Имя пользователя хранится и сравнивается в нижнем регистре
+func NormalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// uniqueViolationError Ошибка нарушения уникальности email или имени пользователя. Для других ошибок nil
+func uniqueViolationError(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != database.PSQLUniqueError {
+		return nil
+	}
+	if pgErr.ConstraintName == "users_username_lower_key" {
+		return ErrUsernameAlreadyExists
+	}
+	return ErrEmailAlreadyExists
 }
 
 func NewUsersDB(dbPoll *pgxpool.Pool, log *slog.Logger) *UserRepositoryImpl {
@@ -49,19 +220,49 @@ func NewUsersDB(dbPoll *pgxpool.Pool, log *slog.Logger) *UserRepositoryImpl {
 // ctx - внешний контекст, что б вызывающая сторона могла контролировать запрос (например выставить таймаут)
 // userinfo - структуру UserInfo с необходимыми полями для добавления
 //
-// После запроса возвращается Id созданного пользователя
+// После запроса возвращается Id созданного пользователя.
+// Пользователь вступает в организацию запроса (без неё - в организацию по умолчанию) с ролью user
 func (us *UserRepositoryImpl) CreateUser(ctx context.Context, userinfo *create_user.UserCreate) (int64, error) {
+	return insertUser(ctx, us.db, userinfo, tenant.OrgIDOrDefault(ctx), []string{RoleUser})
+}
+
+// CreateUserTx Создаёт пользователя в транзакции tx и выдаёт ему роли roleNames в организации orgID.
+// Роли ищутся среди встроенных и ролей этой организации, несуществующие пропускаются
+func CreateUserTx(ctx context.Context, tx pgx.Tx, userinfo *create_user.UserCreate, orgID int64, roleNames []string) (int64, error) {
+	return insertUser(ctx, tx, userinfo, orgID, roleNames)
+}
+
+type queryRower interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func insertUser(ctx context.Context, q queryRower, userinfo *create_user.UserCreate, orgID int64, roleNames []string) (int64, error) {
+	// Хеш пароля сразу пишем в историю, что б политика паролей не дала вернуться к нему при смене
 	query := `
-INSERT INTO users (first_name, last_name, email, password, Role)
-VALUES ($1, $2, $3, $4, 'user')
-RETURNING id`
+WITH new_user AS (
+    INSERT INTO users (first_name, last_name, email, username, password)
+    VALUES ($1, $2, $3, NULLIF($7, ''), $4)
+    RETURNING id
+), history AS (
+    INSERT INTO password_history (user_id, password_hash)
+    SELECT id, $4 FROM new_user
+), membership AS (
+    INSERT INTO organization_members (org_id, user_id)
+    SELECT $5, id FROM new_user
+), granted_roles AS (
+    INSERT INTO user_roles (org_id, user_id, role_id)
+    SELECT $5, new_user.id, roles.id FROM new_user, roles
+    WHERE roles.name = ANY($6) AND (roles.org_id IS NULL OR roles.org_id = $5)
+)
+SELECT id FROM new_user`
 
 	var id int64
-	err := us.db.QueryRow(ctx, query, userinfo.FirstName, userinfo.LastName, userinfo.Email, userinfo.Password).Scan(&id)
+	err := q.QueryRow(ctx, query, userinfo.FirstName, userinfo.LastName, NormalizeEmail(userinfo.Email), userinfo.Password, orgID, roleNames,
+		NormalizeUsername(userinfo.Username)).Scan(&id)
 	if err != nil {
 		dbErr := database.PsqlErrorHandler(err)
-		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == database.PSQLUniqueError {
-			return 0, ErrEmailAlreadyExists
+		if uniqueErr := uniqueViolationError(err); uniqueErr != nil {
+			return 0, uniqueErr
 		}
 		return 0, dbErr
 	}
@@ -69,19 +270,37 @@ RETURNING id`
 	return id, nil
 }
 
+// GetUser Пользователь по email без учёта регистра
 func (us *UserRepositoryImpl) GetUser(ctx context.Context, userEmail string) (UserInfo, error) {
-	query := `SELECT id, first_name, last_name, email, password, role FROM users WHERE email = $1`
+	query := `SELECT ` + userColumns("$2") + ` FROM users WHERE lower(email) = $1 AND ` + MemberFilter("users.id", "$2")
+	return scanUser(us.db.QueryRow(ctx, query, NormalizeEmail(userEmail), tenant.OrgIDArg(ctx)))
+}
+
+// GetUserByUsername Пользователь по имени без учёта регистра
+func (us *UserRepositoryImpl) GetUserByUsername(ctx context.Context, username string) (UserInfo, error) {
+	query := `SELECT ` + userColumns("$2") + ` FROM users WHERE lower(username) = $1 AND ` + MemberFilter("users.id", "$2")
+	return scanUser(us.db.QueryRow(ctx, query, NormalizeUsername(username), tenant.OrgIDArg(ctx)))
+}
+
+// CheckAdminInDB Ищет администратора организации по умолчанию
+func (us *UserRepositoryImpl) CheckAdminInDB(ctx context.Context) (UserInfo, error) {
+	query := `
+SELECT id, first_name, last_name, email, password FROM users
+WHERE EXISTS (
+    SELECT 1 FROM user_roles JOIN roles ON roles.id = user_roles.role_id
+    WHERE user_roles.user_id = users.id AND user_roles.org_id = $1 AND roles.name = 'admin' AND roles.org_id IS NULL)
+LIMIT 1`
 
 	var user UserInfo
-	err := us.db.QueryRow(ctx, query, userEmail).Scan(
+	err := us.db.QueryRow(ctx, query, tenant.DefaultOrgID).Scan(
 		&user.ID,
 		&user.FirstName,
 		&user.LastName,
 		&user.Email,
 		&user.PasswordHash,
-		&user.Role)
+	)
 	if errors.Is(err, pgx.ErrNoRows) {
-		return UserInfo{}, ErrUserNotFound
+		return UserInfo{}, pgx.ErrNoRows
 	}
 	if err != nil {
 		dbErr := database.PsqlErrorHandler(err)
@@ -90,31 +309,73 @@ func (us *UserRepositoryImpl) GetUser(ctx context.Context, userEmail string) (Us
 	return user, nil
 }
 
-func (us *UserRepositoryImpl) CheckAdminInDB(ctx context.Context) (UserInfo, error) {
-	query := `SELECT id, first_name, last_name, email, password FROM users WHERE Role LIKE '%admin%'`
+// AddFirstAdmin Создаёт администратора организации по умолчанию с указанным email
+func (us *UserRepositoryImpl) AddFirstAdmin(ctx context.Context, email string, passwordHash string) error {
+	query := `
+WITH new_user AS (
+    INSERT INTO users (id, first_name, last_name, email, password) VALUES ($1, $2, $3, $4, $5)
+    RETURNING id
+), membership AS (
+    INSERT INTO organization_members (org_id, user_id)
+    SELECT $6, id FROM new_user
+)
+INSERT INTO user_roles (org_id, user_id, role_id)
+SELECT $6, new_user.id, roles.id FROM new_user, roles WHERE roles.name IN ('admin', 'user') AND roles.org_id IS NULL`
 
-	var user UserInfo
-	err := us.db.QueryRow(ctx, query).Scan(
-		&user.ID,
-		&user.FirstName,
-		&user.LastName,
-		&user.Email,
-		&user.PasswordHash,
-	)
+	_, err := us.db.Exec(ctx, query, 0, "Admin first name", "Admin last name", NormalizeEmail(email), passwordHash, tenant.DefaultOrgID)
+	if err != nil {
+		dbErr := database.PsqlErrorHandler(err)
+		return dbErr
+	}
+	return nil
+}
+
+// SetAdminRole Делает пользователя администратором организации запроса (без неё - организации по умолчанию)
+func (us *UserRepositoryImpl) SetAdminRole(ctx context.Context, id int64) error {
+	query := `
+INSERT INTO user_roles (org_id, user_id, role_id)
+SELECT organization_members.org_id, organization_members.user_id, roles.id FROM organization_members, roles
+WHERE organization_members.user_id = $1 AND organization_members.org_id = $2 AND roles.name = 'admin' AND roles.org_id IS NULL
+ON CONFLICT DO NOTHING
+RETURNING user_id`
+	var userID int64
+	err := us.db.QueryRow(ctx, query, id, tenant.OrgIDOrDefault(ctx)).Scan(&userID)
 	if errors.Is(err, pgx.ErrNoRows) {
-		return UserInfo{}, pgx.ErrNoRows
+		// Либо пользователя нет в организации, либо он уже админ
+		if _, err = us.GetUserByID(tenant.WithOrgID(ctx, tenant.OrgIDOrDefault(ctx)), id); err != nil {
+			return err
+		}
+		return nil
 	}
 	if err != nil {
 		dbErr := database.PsqlErrorHandler(err)
-		return UserInfo{}, dbErr
+		return dbErr
 	}
-	return user, nil
+	return nil
+}
+
+func (us *UserRepositoryImpl) GetUserByID(ctx context.Context, id int64) (UserInfo, error) {
+	query := `SELECT ` + userColumns("$2") + ` FROM users WHERE id = $1 AND ` + MemberFilter("users.id", "$2")
+	return scanUser(us.db.QueryRow(ctx, query, id, tenant.OrgIDArg(ctx)))
 }
 
-func (us *UserRepositoryImpl) AddFirstAdmin(ctx context.Context, passwordHash string) error {
-	query := `INSERT INTO users (id, first_name, last_name, email, password, Role) VALUES ($1, $2, $3, $4, $5, $6)`
+// UpdatePassword Обновляет хеш пароля пользователя, добавляет его в историю паролей и снимает требование задать пароль
+func (us *UserRepositoryImpl) UpdatePassword(ctx context.Context, id int64, passwordHash string) error {
+	query := `
+WITH updated AS (
+    UPDATE users SET password = $2, password_reset_required = false WHERE id = $1 AND ` + MemberFilter("users.id", "$3") + `
+    RETURNING id
+), history AS (
+    INSERT INTO password_history (user_id, password_hash)
+    SELECT id, $2 FROM updated
+)
+SELECT id FROM updated`
 
-	_, err := us.db.Exec(ctx, query, 0, "Admin first name", "Admin last name", "admin@admin.com", passwordHash, "admin")
+	var updatedID int64
+	err := us.db.QueryRow(ctx, query, id, passwordHash, tenant.OrgIDArg(ctx)).Scan(&updatedID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrUserNotFound
+	}
 	if err != nil {
 		dbErr := database.PsqlErrorHandler(err)
 		return dbErr
@@ -122,9 +383,37 @@ func (us *UserRepositoryImpl) AddFirstAdmin(ctx context.Context, passwordHash st
 	return nil
 }
 
-func (us *UserRepositoryImpl) SetAdminRole(ctx context.Context, id int64) error {
-	query := `UPDATE users SET Role = 'admin' WHERE id = $1`
-	result, err := us.db.Exec(ctx, query, id)
+// GetPasswordHistory Возвращает последние limit хешей паролей пользователя, начиная с самого свежего
+func (us *UserRepositoryImpl) GetPasswordHistory(ctx context.Context, id int64, limit int) ([]string, error) {
+	query := `SELECT password_hash FROM password_history WHERE user_id = $1 AND ` + MemberFilter("$1", "$3") + `
+ORDER BY created_at DESC, id DESC LIMIT $2`
+
+	rows, err := us.db.Query(ctx, query, id, limit, tenant.OrgIDArg(ctx))
+	if err != nil {
+		return nil, database.PsqlErrorHandler(err)
+	}
+	defer rows.Close()
+
+	var hashes []string
+	for rows.Next() {
+		var hash string
+		if err = rows.Scan(&hash); err != nil {
+			return nil, database.PsqlErrorHandler(err)
+		}
+		hashes = append(hashes, hash)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, database.PsqlErrorHandler(err)
+	}
+	return hashes, nil
+}
+
+// RehashPassword Заменяет хеш того же пароля на хеш нового алгоритма.
+// Обновление происходит только если хеш не поменялся с момента проверки пароля, что б не затереть параллельную смену пароля.
+// В историю паролей не пишется: пароль остался прежним
+func (us *UserRepositoryImpl) RehashPassword(ctx context.Context, id int64, oldPasswordHash string, newPasswordHash string) error {
+	query := `UPDATE users SET password = $3 WHERE id = $1 AND password = $2 AND ` + MemberFilter("users.id", "$4")
+	result, err := us.db.Exec(ctx, query, id, oldPasswordHash, newPasswordHash, tenant.OrgIDArg(ctx))
 	if err != nil {
 		dbErr := database.PsqlErrorHandler(err)
 		return dbErr
@@ -134,3 +423,244 @@ func (us *UserRepositoryImpl) SetAdminRole(ctx context.Context, id int64) error
 	}
 	return nil
 }
+
+// GetUserByPhone Ищет пользователя только по подтверждённому номеру телефона
+func (us *UserRepositoryImpl) GetUserByPhone(ctx context.Context, phone string) (UserInfo, error) {
+	query := `SELECT ` + userColumns("$2") + ` FROM users WHERE phone = $1 AND phone_verified_at IS NOT NULL AND ` + MemberFilter("users.id", "$2")
+	return scanUser(us.db.QueryRow(ctx, query, phone, tenant.OrgIDArg(ctx)))
+}
+
+// SetPhone Указывает новый, ещё не подтверждённый номер телефона
+func (us *UserRepositoryImpl) SetPhone(ctx context.Context, id int64, phone string) error {
+	query := `UPDATE users SET phone = $2, phone_verified_at = NULL WHERE id = $1 AND ` + MemberFilter("users.id", "$3")
+	result, err := us.db.Exec(ctx, query, id, phone, tenant.OrgIDArg(ctx))
+	if err != nil {
+		dbErr := database.PsqlErrorHandler(err)
+		return dbErr
+	}
+	if result.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// MarkPhoneVerified Подтверждает номер, если он всё ещё указан у пользователя
+func (us *UserRepositoryImpl) MarkPhoneVerified(ctx context.Context, id int64, phone string) error {
+	query := `UPDATE users SET phone_verified_at = CURRENT_TIMESTAMP WHERE id = $1 AND phone = $2 AND ` + MemberFilter("users.id", "$3")
+	result, err := us.db.Exec(ctx, query, id, phone, tenant.OrgIDArg(ctx))
+	if err != nil {
+		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == database.PSQLUniqueError {
+			return ErrPhoneAlreadyExists
+		}
+		dbErr := database.PsqlErrorHandler(err)
+		return dbErr
+	}
+	if result.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// UpdateProfile Частично обновляет профиль и возвращает пользователя после изменения.
+// Если передан expectedUpdatedAt, обновление выполняется только если профиль с тех пор не меняли, иначе ErrUserModified
+func (us *UserRepositoryImpl) UpdateProfile(ctx context.Context, id int64, update ProfileUpdate, expectedUpdatedAt *time.Time) (UserInfo, error) {
+	query := `
+UPDATE users SET
+    first_name = COALESCE($2, first_name),
+    last_name  = COALESCE($3, last_name),
+    username   = CASE WHEN $7::text IS NULL THEN username ELSE NULLIF($7, '') END,
+    metadata   = CASE WHEN $6::jsonb IS NULL THEN metadata ELSE jsonb_set(metadata, '{user}', $6::jsonb) END
+WHERE id = $1 AND ($4::timestamptz IS NULL OR updated_at = $4) AND ` + MemberFilter("users.id", "$5") + `
+RETURNING ` + userColumns("$5")
+
+	userMetadata, err := metadataSectionArg(update.UserMetadata)
+	if err != nil {
+		return UserInfo{}, err
+	}
+	var username *string
+	if update.Username != nil {
+		normalized := NormalizeUsername(*update.Username)
+		username = &normalized
+	}
+	user, err := scanUser(us.db.QueryRow(ctx, query, id, update.FirstName, update.LastName, expectedUpdatedAt, tenant.OrgIDArg(ctx), userMetadata, username))
+	if errors.Is(err, ErrUsernameAlreadyExists) {
+		return UserInfo{}, err
+	}
+	if errors.Is(err, ErrUserNotFound) {
+		return UserInfo{}, us.notFoundOrModified(ctx, id)
+	}
+	return user, err
+}
+
+// DeleteUser Удаляет пользователя из всех организаций. Refresh токены, история паролей и одноразовые коды удаляются каскадно внешними ключами.
+// Нельзя удалить последнего администратора ни одной из организаций. expectedUpdatedAt работает так же, как в UpdateProfile
+func (us *UserRepositoryImpl) DeleteUser(ctx context.Context, id int64, expectedUpdatedAt *time.Time) error {
+	tx, err := us.db.Begin(ctx)
+	if err != nil {
+		dbErr := database.PsqlErrorHandler(err)
+		return dbErr
+	}
+	defer tx.Rollback(ctx)
+
+	if err = EnsureNotLastAdmin(ctx, tx, id, nil); err != nil {
+		return err
+	}
+	query := `DELETE FROM users WHERE id = $1 AND ($2::timestamptz IS NULL OR updated_at = $2) AND ` + MemberFilter("users.id", "$3")
+	result, err := tx.Exec(ctx, query, id, expectedUpdatedAt, tenant.OrgIDArg(ctx))
+	if err != nil {
+		dbErr := database.PsqlErrorHandler(err)
+		return dbErr
+	}
+	if result.RowsAffected() == 0 {
+		return us.notFoundOrModified(ctx, id)
+	}
+	if err = tx.Commit(ctx); err != nil {
+		dbErr := database.PsqlErrorHandler(err)
+		return dbErr
+	}
+	return nil
+}
+
+// EnsureNotLastAdmin Возвращает ErrLastAdmin, если userID - единственный администратор организации orgID,
+// а при orgID == nil - хотя бы одной из организаций, в которых он состоит. Администратором считается и тот,
+// кто получил роль admin через группу. Вызывается до изменения, после которого пользователь перестаёт быть администратором
+func EnsureNotLastAdmin(ctx context.Context, tx pgx.Tx, userID int64, orgID *int64) error {
+	adminRoleID, err := adminRole(ctx, tx)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var orgIDs []int64
+	if orgID != nil {
+		orgIDs = []int64{*orgID}
+	} else if orgIDs, err = memberOrgs(ctx, tx, userID); err != nil {
+		return err
+	}
+	if err = lockAdmins(ctx, tx, adminRoleID, orgIDs); err != nil {
+		return err
+	}
+
+	// Отдельным запросом после блокировки: в READ COMMITTED он видит изменения транзакций, которые держали блокировку до нас
+	query := `
+SELECT EXISTS (
+    SELECT 1 FROM organization_members member
+    WHERE member.user_id = $1 AND member.org_id = ANY($2) AND $3 IN (` + EffectiveRoleIDsQuery("member.user_id", "member.org_id") + `)
+      AND NOT EXISTS (
+        SELECT 1 FROM organization_members other
+        WHERE other.org_id = member.org_id AND other.user_id <> $1 AND $3 IN (` + EffectiveRoleIDsQuery("other.user_id", "other.org_id") + `)))`
+	var lastAdmin bool
+	if err = tx.QueryRow(ctx, query, userID, orgIDs, adminRoleID).Scan(&lastAdmin); err != nil {
+		return database.PsqlErrorHandler(err)
+	}
+	if lastAdmin {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+// LockOrgAdmins Блокирует до конца транзакции выдачи роли admin в организации и возвращает, есть ли в ней администратор.
+// Вызывается до изменения, которое может лишить роли admin не пользователя целиком, а только одну из её выдач
+// (роль напрямую, группа, участие в группе). После изменения - EnsureOrgHasAdmin, если администратор был
+func LockOrgAdmins(ctx context.Context, tx pgx.Tx, orgID int64) (bool, error) {
+	adminRoleID, err := adminRole(ctx, tx)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err = lockAdmins(ctx, tx, adminRoleID, []int64{orgID}); err != nil {
+		return false, err
+	}
+	return hasAdmin(ctx, tx, adminRoleID, orgID)
+}
+
+// EnsureOrgHasAdmin Возвращает ErrLastAdmin, если в организации не осталось администратора. Только после LockOrgAdmins
+func EnsureOrgHasAdmin(ctx context.Context, tx pgx.Tx, orgID int64) error {
+	adminRoleID, err := adminRole(ctx, tx)
+	if err != nil {
+		return err
+	}
+	exists, err := hasAdmin(ctx, tx, adminRoleID, orgID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+// adminRole id встроенной роли admin. Если её нет - pgx.ErrNoRows
+func adminRole(ctx context.Context, tx pgx.Tx) (int64, error) {
+	var id int64
+	err := tx.QueryRow(ctx, `SELECT id FROM roles WHERE name = $1 AND org_id IS NULL`, RoleAdmin).Scan(&id)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return 0, database.PsqlErrorHandler(err)
+	}
+	return id, err
+}
+
+// memberOrgs Организации, в которых состоит пользователь
+func memberOrgs(ctx context.Context, tx pgx.Tx, userID int64) ([]int64, error) {
+	rows, err := tx.Query(ctx, `SELECT org_id FROM organization_members WHERE user_id = $1 ORDER BY org_id`, userID)
+	if err != nil {
+		return nil, database.PsqlErrorHandler(err)
+	}
+	orgIDs, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return nil, database.PsqlErrorHandler(err)
+	}
+	return orgIDs, nil
+}
+
+// lockAdmins Блокирует выдачи роли admin в организациях: напрямую (user_roles) и через группы (group_roles и участие
+// в таких группах). Их берут все, кто может лишить организацию администратора, поэтому две транзакции не уберут
+// двух последних администраторов одновременно. Строки блокируются в одном порядке, что б не было взаимоблокировок
+func lockAdmins(ctx context.Context, tx pgx.Tx, adminRoleID int64, orgIDs []int64) error {
+	queries := []string{`
+SELECT 1 FROM user_roles
+WHERE role_id = $1 AND org_id = ANY($2)
+ORDER BY org_id, user_id
+FOR UPDATE`, `
+SELECT 1 FROM group_roles JOIN group_members ON group_members.group_id = group_roles.group_id
+WHERE group_roles.role_id = $1 AND group_members.org_id = ANY($2)
+ORDER BY group_members.group_id, group_members.user_id
+FOR UPDATE`}
+	for _, query := range queries {
+		if _, err := tx.Exec(ctx, query, adminRoleID, orgIDs); err != nil {
+			return database.PsqlErrorHandler(err)
+		}
+	}
+	return nil
+}
+
+// hasAdmin Есть ли в организации администратор, напрямую или через группу
+func hasAdmin(ctx context.Context, tx pgx.Tx, adminRoleID int64, orgID int64) (bool, error) {
+	query := `
+SELECT EXISTS (
+    SELECT 1 FROM organization_members member
+    WHERE member.org_id = $1 AND $2 IN (` + EffectiveRoleIDsQuery("member.user_id", "member.org_id") + `))`
+	var exists bool
+	if err := tx.QueryRow(ctx, query, orgID, adminRoleID).Scan(&exists); err != nil {
+		return false, database.PsqlErrorHandler(err)
+	}
+	return exists, nil
+}
+
+// notFoundOrModified Разбирается, почему условный запрос не затронул строку: пользователя нет или его уже изменили
+func (us *UserRepositoryImpl) notFoundOrModified(ctx context.Context, id int64) error {
+	var exists bool
+	query := `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1 AND ` + MemberFilter("users.id", "$2") + `)`
+	err := us.db.QueryRow(ctx, query, id, tenant.OrgIDArg(ctx)).Scan(&exists)
+	if err != nil {
+		dbErr := database.PsqlErrorHandler(err)
+		return dbErr
+	}
+	if exists {
+		return ErrUserModified
+	}
+	return ErrUserNotFound
+}
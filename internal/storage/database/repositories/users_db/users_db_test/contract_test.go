@@ -0,0 +1,48 @@
+package users_db_test
+
+import (
+	"context"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/migration"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/migrator"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/auth_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/login_attempts_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/storagetest"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
+	"os"
+	"testing"
+)
+
+// TestContract Проверки storagetest на настоящем Postgres. Нужна отдельная БД в TEST_DATABASE_URL:
+// тест применяет к ней миграции и очищает таблицу пользователей перед каждой проверкой
+func TestContract(t *testing.T) {
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, databaseURL)
+	if err != nil {
+		t.Fatal("Failed to connect to database. Error: ", err)
+	}
+	defer pool.Close()
+	m, err := migrator.New(pool, migration.FS, slog.Default())
+	if err != nil {
+		t.Fatal("Failed to load migrations. Error: ", err)
+	}
+	if err = m.Up(ctx); err != nil {
+		t.Fatal("Failed to apply migrations. Error: ", err)
+	}
+
+	storagetest.RunContract(t, func(t *testing.T) storagetest.Backend {
+		if _, err := pool.Exec(ctx, `TRUNCATE users, login_attempts CASCADE`); err != nil {
+			t.Fatal("Failed to clean users. Error: ", err)
+		}
+		return storagetest.Backend{
+			Users:         users_db.NewUsersDB(pool, slog.Default()),
+			Tokens:        auth_db.NewTokensRepositoryImpl(pool, slog.Default()),
+			LoginAttempts: login_attempts_db.NewLoginAttemptsRepository(pool, slog.Default()),
+		}
+	})
+}
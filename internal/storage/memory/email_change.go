@@ -0,0 +1,116 @@
+package memory
+
+import (
+	"context"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"time"
+)
+
+// pending Заявка ещё ждёт подтверждения
+func (c *emailChange) pending(at time.Time) bool {
+	return c.ConfirmedAt == nil && c.CancelledAt == nil && c.ExpiresAt.After(at)
+}
+
+// CreateEmailChange Создаёт заявку на смену email, отменяя предыдущую неподтверждённую заявку пользователя.
+// Занятость нового адреса проверяется только при подтверждении
+func (r *UserRepository) CreateEmailChange(_ context.Context, change users_db.EmailChange, confirmTokenHash string, cancelTokenHash string) (users_db.EmailChange, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	u, ok := r.store.users[change.UserID]
+	if !ok {
+		return users_db.EmailChange{}, users_db.ErrUserNotFound
+	}
+	change.NewEmail = users_db.NormalizeEmail(change.NewEmail)
+
+	at := now()
+	for _, existing := range r.store.emailChanges {
+		if existing.UserID == change.UserID && existing.pending(at) {
+			cancelledAt := at
+			existing.CancelledAt = &cancelledAt
+		}
+	}
+	r.store.lastChangeID++
+	created := &emailChange{
+		EmailChange: users_db.EmailChange{
+			ID:              r.store.lastChangeID,
+			UserID:          change.UserID,
+			OldEmail:        u.email,
+			NewEmail:        change.NewEmail,
+			ExpiresAt:       change.ExpiresAt,
+			CancelExpiresAt: change.CancelExpiresAt,
+			CreatedAt:       at,
+		},
+		confirmTokenHash: confirmTokenHash,
+		cancelTokenHash:  cancelTokenHash,
+	}
+	r.store.emailChanges = append(r.store.emailChanges, created)
+	return created.EmailChange, nil
+}
+
+// ConfirmEmailChange Списывает ссылку подтверждения, меняет email и удаляет все refresh токены пользователя, кроме keepRefreshToken.
+// Если адрес успели занять - ErrEmailAlreadyExists, если email пользователя успел измениться - ErrEmailChangeNotFound.
+// При ошибке ссылка не списывается
+func (r *UserRepository) ConfirmEmailChange(_ context.Context, confirmTokenHash string, keepRefreshToken string) (users_db.EmailChange, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	at := now()
+	var change *emailChange
+	for _, candidate := range r.store.emailChanges {
+		if candidate.confirmTokenHash == confirmTokenHash && candidate.pending(at) {
+			change = candidate
+			break
+		}
+	}
+	if change == nil {
+		return users_db.EmailChange{}, users_db.ErrEmailChangeNotFound
+	}
+	u, ok := r.store.users[change.UserID]
+	if !ok || u.email != change.OldEmail {
+		return users_db.EmailChange{}, users_db.ErrEmailChangeNotFound
+	}
+	if other := r.store.userByEmail(change.NewEmail); other != nil && other.id != u.id {
+		return users_db.EmailChange{}, users_db.ErrEmailAlreadyExists
+	}
+
+	change.ConfirmedAt = &at
+	u.email = change.NewEmail
+	u.updatedAt = at
+	r.store.deleteTokens(u.id, keepRefreshToken)
+	return change.EmailChange, nil
+}
+
+// CancelEmailChange Отменяет смену по ссылке из письма на старый адрес. Уже подтверждённая смена откатывается,
+// если email с тех пор не менялся. Все refresh токены пользователя удаляются
+func (r *UserRepository) CancelEmailChange(_ context.Context, cancelTokenHash string) (users_db.EmailChange, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	at := now()
+	var change *emailChange
+	for _, candidate := range r.store.emailChanges {
+		if candidate.cancelTokenHash == cancelTokenHash && candidate.CancelledAt == nil && candidate.CancelExpiresAt.After(at) {
+			change = candidate
+			break
+		}
+	}
+	if change == nil {
+		return users_db.EmailChange{}, users_db.ErrEmailChangeNotFound
+	}
+	u, ok := r.store.users[change.UserID]
+	revert := ok && change.ConfirmedAt != nil && u.email == change.NewEmail
+	if revert {
+		if other := r.store.userByEmail(change.OldEmail); other != nil && other.id != u.id {
+			return users_db.EmailChange{}, users_db.ErrEmailAlreadyExists
+		}
+	}
+
+	change.CancelledAt = &at
+	if revert {
+		u.email = change.OldEmail
+		u.updatedAt = at
+	}
+	r.store.deleteTokens(change.UserID, "")
+	return change.EmailChange, nil
+}
@@ -0,0 +1,119 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ListUsers Страница пользователей по фильтру с той же сортировкой и курсорами, что и в Postgres:
+// сортировка дополняется id, курсор указывает на последнего выданного пользователя
+func (r *UserRepository) ListUsers(ctx context.Context, filter users_db.ListUsersFilter) ([]users_db.UserInfo, error) {
+	switch filter.SortBy {
+	case users_db.SortByCreatedAt, "", users_db.SortByEmail, users_db.SortByLastName:
+	default:
+		return nil, fmt.Errorf("%w: %s", users_db.ErrInvalidSort, filter.SortBy)
+	}
+	var metadataFilter interface{}
+	if len(filter.Metadata) > 0 {
+		data, err := json.Marshal(filter.Metadata)
+		if err != nil {
+			return nil, fmt.Errorf("invalid metadata filter: %w", err)
+		}
+		if err = json.Unmarshal(data, &metadataFilter); err != nil {
+			return nil, fmt.Errorf("invalid metadata filter: %w", err)
+		}
+	}
+	var afterCreatedAt time.Time
+	if filter.After != nil && (filter.SortBy == users_db.SortByCreatedAt || filter.SortBy == "") {
+		var err error
+		if afterCreatedAt, err = time.Parse(time.RFC3339Nano, filter.After.Value); err != nil {
+			return nil, pgError(database.PSQLInvalidDatetimeError, "")
+		}
+	}
+	// compareKey Сравнивает значение поля сортировки пользователя со значением курсора или другого пользователя
+	compareKey := func(u *user, value string, createdAt time.Time) int {
+		switch filter.SortBy {
+		case users_db.SortByEmail:
+			return strings.Compare(u.email, value)
+		case users_db.SortByLastName:
+			return strings.Compare(u.lastName, value)
+		default:
+			return u.createdAt.Compare(createdAt)
+		}
+	}
+	sortKey := func(u *user) string {
+		if filter.SortBy == users_db.SortByEmail {
+			return u.email
+		}
+		return u.lastName
+	}
+
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	at := now()
+	search := strings.ToLower(filter.Search)
+	var matched []*user
+	for _, u := range r.store.users {
+		if !u.visible(ctx) {
+			continue
+		}
+		if search != "" && !strings.Contains(strings.ToLower(u.firstName), search) &&
+			!strings.Contains(strings.ToLower(u.lastName), search) && !strings.Contains(strings.ToLower(u.email), search) {
+			continue
+		}
+		if filter.Role != "" && !containsString(u.roles[u.viewOrg(ctx)], filter.Role) {
+			continue
+		}
+		if filter.Status != "" && u.effectiveStatus(at) != filter.Status {
+			continue
+		}
+		if filter.CreatedFrom != nil && u.createdAt.Before(*filter.CreatedFrom) {
+			continue
+		}
+		if filter.CreatedTo != nil && !u.createdAt.Before(*filter.CreatedTo) {
+			continue
+		}
+		if metadataFilter != nil && !users_db.JSONContains(metadataDocument(u.metadata), metadataFilter) {
+			continue
+		}
+		if filter.After != nil {
+			c := cmp.Or(compareKey(u, filter.After.Value, afterCreatedAt), cmp.Compare(u.id, filter.After.ID))
+			if (!filter.Desc && c <= 0) || (filter.Desc && c >= 0) {
+				continue
+			}
+		}
+		matched = append(matched, u)
+	}
+
+	slices.SortFunc(matched, func(a, b *user) int {
+		c := cmp.Or(compareKey(a, sortKey(b), b.createdAt), cmp.Compare(a.id, b.id))
+		if filter.Desc {
+			return -c
+		}
+		return c
+	})
+	if len(matched) > filter.Limit {
+		matched = matched[:max(filter.Limit, 0)]
+	}
+	users := make([]users_db.UserInfo, 0, len(matched))
+	for _, u := range matched {
+		users = append(users, u.info(ctx))
+	}
+	return users, nil
+}
+
+// metadataDocument Атрибуты пользователя в виде документа jsonb
+func metadataDocument(metadata users_db.Metadata) interface{} {
+	return map[string]interface{}{
+		users_db.MetadataSectionUser:  map[string]interface{}(metadata.User),
+		users_db.MetadataSectionAdmin: map[string]interface{}(metadata.Admin),
+	}
+}
@@ -0,0 +1,79 @@
+package memory
+
+import (
+	"context"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/login_attempts_db"
+	"time"
+)
+
+// attemptKey Ключ счётчика неудачных попыток, как первичный ключ (scope, key) в login_attempts
+type attemptKey struct {
+	scope string
+	key   string
+}
+
+// LoginAttemptsRepository Реализация login_attempts_db.LoginAttemptsRepository в памяти
+type LoginAttemptsRepository struct {
+	store *Store
+}
+
+func NewLoginAttemptsRepository(store *Store) *LoginAttemptsRepository {
+	return &LoginAttemptsRepository{store: store}
+}
+
+// GetAttempt Возвращает состояние попыток. Если неудачных попыток не было, возвращается пустая структура без ошибки
+func (r *LoginAttemptsRepository) GetAttempt(_ context.Context, scope string, key string) (login_attempts_db.LoginAttempt, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	attempt, ok := r.store.loginAttempts[attemptKey{scope: scope, key: key}]
+	if !ok {
+		return login_attempts_db.LoginAttempt{}, nil
+	}
+	result := *attempt
+	if attempt.LockedUntil != nil {
+		lockedUntil := *attempt.LockedUntil
+		result.LockedUntil = &lockedUntil
+	}
+	return result, nil
+}
+
+// ReserveAttempt Учитывает попытку входа до проверки пароля, как login_attempts_db.ReserveAttempt
+func (r *LoginAttemptsRepository) ReserveAttempt(_ context.Context, scope string, key string, window time.Duration, lockFor func(count int) time.Duration) (login_attempts_db.Reservation, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	reservedAt := now()
+	attempt, ok := r.store.loginAttempts[attemptKey{scope: scope, key: key}]
+	if !ok {
+		attempt = &login_attempts_db.LoginAttempt{}
+		r.store.loginAttempts[attemptKey{scope: scope, key: key}] = attempt
+	}
+	reservation, locked := login_attempts_db.NextReservation(*attempt, reservedAt, window, lockFor)
+	if !locked {
+		attempt.FailedCount = reservation.FailedCount
+		attempt.LastFailedAt = reservedAt
+		attempt.LockedUntil = reservation.LockedUntil
+	}
+	return reservation, nil
+}
+
+// ReleaseAttempt Возвращает попытку, учтённую ReserveAttempt, как login_attempts_db.ReleaseAttempt
+func (r *LoginAttemptsRepository) ReleaseAttempt(_ context.Context, scope string, key string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if attempt, ok := r.store.loginAttempts[attemptKey{scope: scope, key: key}]; ok && attempt.FailedCount > 0 {
+		attempt.FailedCount--
+	}
+	return nil
+}
+
+// Reset Сбрасывает счётчик и блокировку (успешный вход или разблокировка админом)
+func (r *LoginAttemptsRepository) Reset(_ context.Context, scope string, key string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	delete(r.store.loginAttempts, attemptKey{scope: scope, key: key})
+	return nil
+}
@@ -0,0 +1,18 @@
+package memory_test
+
+import (
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/memory"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/storagetest"
+	"testing"
+)
+
+func TestContract(t *testing.T) {
+	storagetest.RunContract(t, func(t *testing.T) storagetest.Backend {
+		store := memory.NewStore()
+		return storagetest.Backend{
+			Users:         memory.NewUserRepository(store),
+			Tokens:        memory.NewTokensRepository(store),
+			LoginAttempts: memory.NewLoginAttemptsRepository(store),
+		}
+	})
+}
@@ -0,0 +1,284 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/permissions"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/tenant"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/login_attempts_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"github.com/jackc/pgx/v5/pgconn"
+	"sort"
+	"sync"
+	"time"
+)
+
+// rolePermissions Права встроенных ролей, как их выдают миграции: администратору все, пользователю никаких
+var rolePermissions = map[string][]string{
+	users_db.RoleAdmin: {
+		permissions.UsersRead, permissions.UsersWrite, permissions.RolesRead, permissions.RolesWrite,
+		permissions.SessionsRevoke, permissions.AuthzCheck, permissions.PoliciesWrite, permissions.OrgsWrite,
+		permissions.UsersImpersonate,
+	},
+	users_db.RoleUser: {},
+}
+
+// Store Пользователи, refresh токены, заявки на смену email и счётчики неудачных попыток входа в памяти процесса.
+// Общий для UserRepository, TokensRepository и LoginAttemptsRepository, что б удаление пользователя и блокировка удаляли его токены, как внешние ключи в Postgres.
+// Каждый метод репозиториев выполняется целиком под одной блокировкой, поэтому атомарен, как транзакция
+type Store struct {
+	mu            sync.RWMutex
+	users         map[int64]*user
+	tokens        map[string]*token // По refresh токену
+	emailChanges  []*emailChange
+	loginAttempts map[attemptKey]*login_attempts_db.LoginAttempt
+	lastUserID    int64
+	lastChangeID  int64
+}
+
+type user struct {
+	id                    int64
+	firstName             string
+	lastName              string
+	email                 string
+	username              string
+	password              string
+	phone                 string
+	phoneVerified         bool
+	status                string
+	statusReason          string
+	statusExpiresAt       *time.Time
+	passwordResetRequired bool
+	metadata              users_db.Metadata
+	orgs                  []int64            // Организации в порядке вступления
+	roles                 map[int64][]string // Роли в каждой организации
+	passwordHistory       []string           // От старых хешей к новым
+	createdAt             time.Time
+	updatedAt             time.Time
+}
+
+type token struct {
+	userID int64
+	orgID  int64
+}
+
+type emailChange struct {
+	users_db.EmailChange
+	confirmTokenHash string
+	cancelTokenHash  string
+}
+
+// NewStore Пустое хранилище. Данные живут, пока живёт процесс
+func NewStore() *Store {
+	return &Store{
+		users:         make(map[int64]*user),
+		tokens:        make(map[string]*token),
+		loginAttempts: make(map[attemptKey]*login_attempts_db.LoginAttempt),
+	}
+}
+
+// now Текущее время с точностью Postgres, что б updated_at, переданный клиенту, совпадал при сравнении
+func now() time.Time {
+	return time.Now().Truncate(time.Microsecond)
+}
+
+// pgError Ошибка, которую вернул бы Postgres при нарушении ограничения, после database.PsqlErrorHandler.
+// Вызывающий код видит тот же текст и тот же *pgconn.PgError с кодом и именем ограничения
+func pgError(code string, constraint string) error {
+	return database.PsqlErrorHandler(&pgconn.PgError{
+		Severity:       "ERROR",
+		Code:           code,
+		Message:        fmt.Sprintf("constraint %q is violated", constraint),
+		ConstraintName: constraint,
+	})
+}
+
+// memberOf Состоит ли пользователь в организации orgID
+func (u *user) memberOf(orgID int64) bool {
+	for _, org := range u.orgs {
+		if org == orgID {
+			return true
+		}
+	}
+	return false
+}
+
+// visible Пользователь виден в запросе: запрос явно отвязан от организации или пользователь в ней состоит
+func (u *user) visible(ctx context.Context) bool {
+	orgID := tenant.OrgIDArg(ctx)
+	return orgID == nil || u.memberOf(*orgID)
+}
+
+// grantRole Выдаёт роль в организации, если её ещё нет
+func (u *user) grantRole(orgID int64, role string) {
+	for _, r := range u.roles[orgID] {
+		if r == role {
+			return
+		}
+	}
+	u.roles[orgID] = append(u.roles[orgID], role)
+}
+
+// effectiveStatus Действующий статус с учётом statusExpiresAt, как users_db.StatusExpr
+func (u *user) effectiveStatus(at time.Time) string {
+	if u.statusExpiresAt == nil || u.statusExpiresAt.After(at) {
+		return u.status
+	}
+	switch u.status {
+	case users_db.StatusSuspended:
+		return users_db.StatusActive
+	case users_db.StatusActive:
+		return users_db.StatusDeactivated
+	default:
+		return u.status
+	}
+}
+
+// viewOrg Организация, в рамках которой читаются роли: из запроса, а у отвязанного от организации - та, в которую пользователь вступил первой
+func (u *user) viewOrg(ctx context.Context) int64 {
+	if orgID := tenant.OrgIDArg(ctx); orgID != nil {
+		return *orgID
+	}
+	if len(u.orgs) > 0 {
+		return u.orgs[0]
+	}
+	return 0
+}
+
+// rolesAndPermissions Имена ролей и права пользователя в организации, отсортированные по имени
+func (u *user) rolesAndPermissions(orgID int64) ([]string, []string) {
+	roles := append([]string{}, u.roles[orgID]...)
+	sort.Strings(roles)
+	granted := make(map[string]struct{})
+	for _, role := range roles {
+		for _, permission := range rolePermissions[role] {
+			granted[permission] = struct{}{}
+		}
+	}
+	perms := make([]string, 0, len(granted))
+	for permission := range granted {
+		perms = append(perms, permission)
+	}
+	sort.Strings(perms)
+	return roles, perms
+}
+
+// info Пользователь в том виде, в каком его возвращает users_db
+func (u *user) info(ctx context.Context) users_db.UserInfo {
+	orgID := u.viewOrg(ctx)
+	roles, perms := u.rolesAndPermissions(orgID)
+	var statusExpiresAt *time.Time
+	if u.statusExpiresAt != nil {
+		expiresAt := *u.statusExpiresAt
+		statusExpiresAt = &expiresAt
+	}
+	return users_db.UserInfo{
+		ID:                    u.id,
+		FirstName:             u.firstName,
+		LastName:              u.lastName,
+		Email:                 u.email,
+		Username:              u.username,
+		PasswordHash:          u.password,
+		OrgID:                 orgID,
+		Roles:                 roles,
+		Permissions:           perms,
+		Phone:                 u.phone,
+		PhoneVerified:         u.phoneVerified,
+		Status:                u.effectiveStatus(now()),
+		StatusReason:          u.statusReason,
+		StatusExpiresAt:       statusExpiresAt,
+		PasswordResetRequired: u.passwordResetRequired,
+		Metadata:              copyMetadata(u.metadata),
+		CreatedAt:             u.createdAt,
+		UpdatedAt:             u.updatedAt,
+	}
+}
+
+// userByEmail Пользователь с email без учёта регистра среди всех организаций
+func (s *Store) userByEmail(email string) *user {
+	email = users_db.NormalizeEmail(email)
+	for _, u := range s.users {
+		if users_db.NormalizeEmail(u.email) == email {
+			return u
+		}
+	}
+	return nil
+}
+
+// userByUsername Пользователь с именем без учёта регистра среди всех организаций
+func (s *Store) userByUsername(username string) *user {
+	username = users_db.NormalizeUsername(username)
+	if username == "" {
+		return nil
+	}
+	for _, u := range s.users {
+		if users_db.NormalizeUsername(u.username) == username {
+			return u
+		}
+	}
+	return nil
+}
+
+// deleteTokens Удаляет refresh токены пользователя, кроме keep
+func (s *Store) deleteTokens(userID int64, keep string) {
+	for refreshToken, t := range s.tokens {
+		if t.userID == userID && refreshToken != keep {
+			delete(s.tokens, refreshToken)
+		}
+	}
+}
+
+// lastAdmin Пользователь - единственный администратор хотя бы одной из организаций, как users_db.EnsureNotLastAdmin
+func (s *Store) lastAdmin(u *user) bool {
+	for orgID, roles := range u.roles {
+		if !containsString(roles, users_db.RoleAdmin) {
+			continue
+		}
+		other := false
+		for _, candidate := range s.users {
+			if candidate.id != u.id && containsString(candidate.roles[orgID], users_db.RoleAdmin) {
+				other = true
+				break
+			}
+		}
+		if !other {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// copySection Глубокая копия секции атрибутов через JSON: хранилище не делит вложенные map с вызывающим кодом,
+// а числа читаются как float64, как из jsonb
+func copySection(section map[string]interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(section)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metadata: %w", err)
+	}
+	var copied map[string]interface{}
+	if err = json.Unmarshal(data, &copied); err != nil {
+		return nil, fmt.Errorf("invalid metadata: %w", err)
+	}
+	if copied == nil {
+		copied = make(map[string]interface{})
+	}
+	return copied, nil
+}
+
+// copyMetadata Копия атрибутов, которые уже лежат в хранилище и поэтому всегда сериализуются
+func copyMetadata(metadata users_db.Metadata) users_db.Metadata {
+	userSection, _ := copySection(metadata.User)
+	adminSection, _ := copySection(metadata.Admin)
+	return users_db.Metadata{User: userSection, Admin: adminSection}
+}
@@ -0,0 +1,86 @@
+package memory
+
+import (
+	"context"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/tenant"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/auth_db"
+	"github.com/jackc/pgx/v5"
+)
+
+// TokensRepository Реализация auth_db.TokensRepository в памяти. Ненайденный токен - pgx.ErrNoRows, как в Postgres
+type TokensRepository struct {
+	store *Store
+}
+
+func NewTokensRepository(store *Store) *TokensRepository {
+	return &TokensRepository{store: store}
+}
+
+// visible Токен виден в запросе: запрос явно отвязан от организации или токен выдан в ней
+func (t *token) visible(ctx context.Context) bool {
+	orgID := tenant.OrgIDArg(ctx)
+	return orgID == nil || t.orgID == *orgID
+}
+
+// DbPutTokens Сохраняет refresh токен. Пользователь должен состоять в организации, как требует внешний ключ на членство
+func (r *TokensRepository) DbPutTokens(_ context.Context, userId int64, orgID int64, refreshToken string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if u, ok := r.store.users[userId]; !ok || !u.memberOf(orgID) {
+		return pgError(database.PSQLForeignKeyError, "fk_tokens_membership")
+	}
+	if _, ok := r.store.tokens[refreshToken]; ok {
+		return pgError(database.PSQLUniqueError, "tokens_refresh_token_key")
+	}
+	r.store.tokens[refreshToken] = &token{userID: userId, orgID: orgID}
+	return nil
+}
+
+func (r *TokensRepository) DbGetTokens(ctx context.Context, refreshToken string) (auth_db.JWTTokenData, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	t, ok := r.store.tokens[refreshToken]
+	if !ok || !t.visible(ctx) {
+		return auth_db.JWTTokenData{}, pgx.ErrNoRows
+	}
+	u := r.store.users[t.userID]
+	roles, perms := u.rolesAndPermissions(t.orgID)
+	return auth_db.JWTTokenData{
+		UserId:          t.userID,
+		OrgID:           t.orgID,
+		UserRoles:       roles,
+		UserPermissions: perms,
+		UserStatus:      u.effectiveStatus(now()),
+		UserMetadata:    copyMetadata(u.metadata),
+	}, nil
+}
+
+// DbUpdateTokens Заменяет refresh токен пользователя. Если старого токена нет, ничего не делает
+func (r *TokensRepository) DbUpdateTokens(ctx context.Context, userId int64, refreshToken string, oldRefreshToken string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	t, ok := r.store.tokens[oldRefreshToken]
+	if !ok || t.userID != userId || !t.visible(ctx) {
+		return nil
+	}
+	if _, exists := r.store.tokens[refreshToken]; exists && refreshToken != oldRefreshToken {
+		return pgError(database.PSQLUniqueError, "tokens_refresh_token_key")
+	}
+	delete(r.store.tokens, oldRefreshToken)
+	r.store.tokens[refreshToken] = t
+	return nil
+}
+
+func (r *TokensRepository) DbDeleteToken(ctx context.Context, refreshToken string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if t, ok := r.store.tokens[refreshToken]; ok && t.visible(ctx) {
+		delete(r.store.tokens, refreshToken)
+	}
+	return nil
+}
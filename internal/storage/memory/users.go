@@ -0,0 +1,398 @@
+package memory
+
+import (
+	"context"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/tenant"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/models/users/create_user"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+// UserRepository Реализация users_db.UserRepository в памяти с теми же ошибками, что и у Postgres
+type UserRepository struct {
+	store *Store
+}
+
+func NewUserRepository(store *Store) *UserRepository {
+	return &UserRepository{store: store}
+}
+
+// CreateUser Создаёт пользователя в организации запроса (без неё - в организации по умолчанию) с ролью user
+func (r *UserRepository) CreateUser(ctx context.Context, userinfo *create_user.UserCreate) (int64, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if r.store.userByEmail(userinfo.Email) != nil {
+		return 0, users_db.ErrEmailAlreadyExists
+	}
+	if r.store.userByUsername(userinfo.Username) != nil {
+		return 0, users_db.ErrUsernameAlreadyExists
+	}
+	r.store.lastUserID++
+	orgID := tenant.OrgIDOrDefault(ctx)
+	createdAt := now()
+	u := &user{
+		id:              r.store.lastUserID,
+		firstName:       userinfo.FirstName,
+		lastName:        userinfo.LastName,
+		email:           users_db.NormalizeEmail(userinfo.Email),
+		username:        users_db.NormalizeUsername(userinfo.Username),
+		password:        userinfo.Password,
+		status:          users_db.StatusActive,
+		metadata:        users_db.Metadata{User: map[string]interface{}{}, Admin: map[string]interface{}{}},
+		orgs:            []int64{orgID},
+		roles:           map[int64][]string{orgID: {users_db.RoleUser}},
+		passwordHistory: []string{userinfo.Password},
+		createdAt:       createdAt,
+		updatedAt:       createdAt,
+	}
+	r.store.users[u.id] = u
+	return u.id, nil
+}
+
+// GetUser Пользователь по email без учёта регистра
+func (r *UserRepository) GetUser(ctx context.Context, userEmail string) (users_db.UserInfo, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	u := r.store.userByEmail(userEmail)
+	if u == nil || !u.visible(ctx) {
+		return users_db.UserInfo{}, users_db.ErrUserNotFound
+	}
+	return u.info(ctx), nil
+}
+
+// GetUserByUsername Пользователь по имени без учёта регистра
+func (r *UserRepository) GetUserByUsername(ctx context.Context, username string) (users_db.UserInfo, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	u := r.store.userByUsername(username)
+	if u == nil || !u.visible(ctx) {
+		return users_db.UserInfo{}, users_db.ErrUserNotFound
+	}
+	return u.info(ctx), nil
+}
+
+// CheckAdminInDB Ищет администратора организации по умолчанию. Если его нет - pgx.ErrNoRows
+func (r *UserRepository) CheckAdminInDB(_ context.Context) (users_db.UserInfo, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var admin *user
+	for _, u := range r.store.users {
+		if containsString(u.roles[tenant.DefaultOrgID], users_db.RoleAdmin) && (admin == nil || u.id < admin.id) {
+			admin = u
+		}
+	}
+	if admin == nil {
+		return users_db.UserInfo{}, pgx.ErrNoRows
+	}
+	return users_db.UserInfo{
+		ID:           admin.id,
+		FirstName:    admin.firstName,
+		LastName:     admin.lastName,
+		Email:        admin.email,
+		PasswordHash: admin.password,
+	}, nil
+}
+
+// AddFirstAdmin Создаёт администратора организации по умолчанию с теми же данными, что и Postgres реализация
+func (r *UserRepository) AddFirstAdmin(_ context.Context, email string, passwordHash string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	const adminID = 0
+	adminEmail := users_db.NormalizeEmail(email)
+	if _, ok := r.store.users[adminID]; ok {
+		return pgError(database.PSQLUniqueError, "users_pkey")
+	}
+	if r.store.userByEmail(adminEmail) != nil {
+		return pgError(database.PSQLUniqueError, "users_email_lower_key")
+	}
+	createdAt := now()
+	r.store.users[adminID] = &user{
+		id:        adminID,
+		firstName: "Admin first name",
+		lastName:  "Admin last name",
+		email:     adminEmail,
+		password:  passwordHash,
+		status:    users_db.StatusActive,
+		metadata:  users_db.Metadata{User: map[string]interface{}{}, Admin: map[string]interface{}{}},
+		orgs:      []int64{tenant.DefaultOrgID},
+		roles:     map[int64][]string{tenant.DefaultOrgID: {users_db.RoleAdmin, users_db.RoleUser}},
+		createdAt: createdAt,
+		updatedAt: createdAt,
+	}
+	return nil
+}
+
+// SetAdminRole Делает пользователя администратором организации запроса (без неё - организации по умолчанию)
+func (r *UserRepository) SetAdminRole(ctx context.Context, id int64) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	orgID := tenant.OrgIDOrDefault(ctx)
+	u, ok := r.store.users[id]
+	if !ok || !u.memberOf(orgID) {
+		return users_db.ErrUserNotFound
+	}
+	u.grantRole(orgID, users_db.RoleAdmin)
+	return nil
+}
+
+func (r *UserRepository) GetUserByID(ctx context.Context, id int64) (users_db.UserInfo, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	u, ok := r.store.visibleUser(ctx, id)
+	if !ok {
+		return users_db.UserInfo{}, users_db.ErrUserNotFound
+	}
+	return u.info(ctx), nil
+}
+
+// UpdatePassword Обновляет хеш пароля, добавляет его в историю паролей и снимает требование задать пароль
+func (r *UserRepository) UpdatePassword(ctx context.Context, id int64, passwordHash string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	u, ok := r.store.visibleUser(ctx, id)
+	if !ok {
+		return users_db.ErrUserNotFound
+	}
+	u.password = passwordHash
+	u.passwordResetRequired = false
+	u.passwordHistory = append(u.passwordHistory, passwordHash)
+	u.updatedAt = now()
+	return nil
+}
+
+// GetPasswordHistory Последние limit хешей паролей пользователя, начиная с самого свежего
+func (r *UserRepository) GetPasswordHistory(ctx context.Context, id int64, limit int) ([]string, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	u, ok := r.store.visibleUser(ctx, id)
+	if !ok {
+		return nil, nil
+	}
+	var hashes []string
+	for i := len(u.passwordHistory) - 1; i >= 0 && len(hashes) < limit; i-- {
+		hashes = append(hashes, u.passwordHistory[i])
+	}
+	return hashes, nil
+}
+
+// RehashPassword Заменяет хеш, только если он не поменялся с момента проверки пароля. В историю паролей не пишется
+func (r *UserRepository) RehashPassword(ctx context.Context, id int64, oldPasswordHash string, newPasswordHash string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	u, ok := r.store.visibleUser(ctx, id)
+	if !ok || u.password != oldPasswordHash {
+		return users_db.ErrUserNotFound
+	}
+	u.password = newPasswordHash
+	u.updatedAt = now()
+	return nil
+}
+
+// GetUserByPhone Ищет пользователя только по подтверждённому номеру телефона
+func (r *UserRepository) GetUserByPhone(ctx context.Context, phone string) (users_db.UserInfo, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, u := range r.store.users {
+		if u.phone == phone && u.phoneVerified && u.visible(ctx) {
+			return u.info(ctx), nil
+		}
+	}
+	return users_db.UserInfo{}, users_db.ErrUserNotFound
+}
+
+// SetPhone Указывает новый, ещё не подтверждённый номер телефона
+func (r *UserRepository) SetPhone(ctx context.Context, id int64, phone string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	u, ok := r.store.visibleUser(ctx, id)
+	if !ok {
+		return users_db.ErrUserNotFound
+	}
+	u.phone = phone
+	u.phoneVerified = false
+	u.updatedAt = now()
+	return nil
+}
+
+// MarkPhoneVerified Подтверждает номер, если он всё ещё указан у пользователя. Подтверждённый номер уникален
+func (r *UserRepository) MarkPhoneVerified(ctx context.Context, id int64, phone string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	u, ok := r.store.visibleUser(ctx, id)
+	if !ok || u.phone != phone {
+		return users_db.ErrUserNotFound
+	}
+	for _, other := range r.store.users {
+		if other.id != id && other.phoneVerified && other.phone == phone {
+			return users_db.ErrPhoneAlreadyExists
+		}
+	}
+	u.phoneVerified = true
+	u.updatedAt = now()
+	return nil
+}
+
+// UpdateProfile Частично обновляет профиль. Если передан expectedUpdatedAt и профиль с тех пор меняли - ErrUserModified
+func (r *UserRepository) UpdateProfile(ctx context.Context, id int64, update users_db.ProfileUpdate, expectedUpdatedAt *time.Time) (users_db.UserInfo, error) {
+	var userMetadata map[string]interface{}
+	if update.UserMetadata != nil {
+		var err error
+		if userMetadata, err = copySection(update.UserMetadata); err != nil {
+			return users_db.UserInfo{}, err
+		}
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	u, ok := r.store.visibleUser(ctx, id)
+	if !ok {
+		return users_db.UserInfo{}, users_db.ErrUserNotFound
+	}
+	if expectedUpdatedAt != nil && !u.updatedAt.Equal(*expectedUpdatedAt) {
+		return users_db.UserInfo{}, users_db.ErrUserModified
+	}
+	if update.Username != nil {
+		if other := r.store.userByUsername(*update.Username); other != nil && other.id != id {
+			return users_db.UserInfo{}, users_db.ErrUsernameAlreadyExists
+		}
+	}
+
+	if update.FirstName != nil {
+		u.firstName = *update.FirstName
+	}
+	if update.LastName != nil {
+		u.lastName = *update.LastName
+	}
+	if update.Username != nil {
+		u.username = users_db.NormalizeUsername(*update.Username)
+	}
+	if userMetadata != nil {
+		u.metadata.User = userMetadata
+	}
+	u.updatedAt = now()
+	return u.info(ctx), nil
+}
+
+// DeleteUser Удаляет пользователя вместе с его токенами, историей паролей и заявками на смену email.
+// Последнего администратора ни одной из организаций удалить нельзя
+func (r *UserRepository) DeleteUser(ctx context.Context, id int64, expectedUpdatedAt *time.Time) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	u, ok := r.store.users[id]
+	if ok && r.store.lastAdmin(u) {
+		return users_db.ErrLastAdmin
+	}
+	if !ok || !u.visible(ctx) {
+		return users_db.ErrUserNotFound
+	}
+	if expectedUpdatedAt != nil && !u.updatedAt.Equal(*expectedUpdatedAt) {
+		return users_db.ErrUserModified
+	}
+	delete(r.store.users, id)
+	r.store.deleteTokens(id, "")
+	changes := r.store.emailChanges[:0]
+	for _, change := range r.store.emailChanges {
+		if change.UserID != id {
+			changes = append(changes, change)
+		}
+	}
+	r.store.emailChanges = changes
+	return nil
+}
+
+// GetUserStatus Действующий статус аккаунта. Организация запроса не учитывается
+func (r *UserRepository) GetUserStatus(_ context.Context, id int64) (string, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	u, ok := r.store.users[id]
+	if !ok {
+		return "", users_db.ErrUserNotFound
+	}
+	return u.effectiveStatus(now()), nil
+}
+
+// SetStatus Меняет статус аккаунта. При блокировке и отключении удаляются все refresh токены пользователя,
+// а последнего администратора ни одной из организаций заблокировать нельзя
+func (r *UserRepository) SetStatus(ctx context.Context, id int64, change users_db.StatusChange) (users_db.UserInfo, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	u, ok := r.store.users[id]
+	if ok && change.Status != users_db.StatusActive && r.store.lastAdmin(u) {
+		return users_db.UserInfo{}, users_db.ErrLastAdmin
+	}
+	if !ok || !u.visible(ctx) {
+		return users_db.UserInfo{}, users_db.ErrUserNotFound
+	}
+	u.status = change.Status
+	u.statusReason = change.Reason
+	u.statusExpiresAt = nil
+	if change.ExpiresAt != nil {
+		expiresAt := *change.ExpiresAt
+		u.statusExpiresAt = &expiresAt
+	}
+	u.updatedAt = now()
+	if change.Status != users_db.StatusActive {
+		r.store.deleteTokens(id, "")
+	}
+	return u.info(ctx), nil
+}
+
+// SetMetadata Заменяет переданные секции атрибутов
+func (r *UserRepository) SetMetadata(ctx context.Context, id int64, update users_db.MetadataUpdate) (users_db.UserInfo, error) {
+	var userSection, adminSection map[string]interface{}
+	var err error
+	if update.User != nil {
+		if userSection, err = copySection(update.User); err != nil {
+			return users_db.UserInfo{}, err
+		}
+	}
+	if update.Admin != nil {
+		if adminSection, err = copySection(update.Admin); err != nil {
+			return users_db.UserInfo{}, err
+		}
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	u, ok := r.store.visibleUser(ctx, id)
+	if !ok {
+		return users_db.UserInfo{}, users_db.ErrUserNotFound
+	}
+	if userSection != nil {
+		u.metadata.User = userSection
+	}
+	if adminSection != nil {
+		u.metadata.Admin = adminSection
+	}
+	u.updatedAt = now()
+	return u.info(ctx), nil
+}
+
+// visibleUser Пользователь по id, если он виден в запросе
+func (s *Store) visibleUser(ctx context.Context, id int64) (*user, bool) {
+	u, ok := s.users[id]
+	if !ok || !u.visible(ctx) {
+		return nil, false
+	}
+	return u, true
+}
@@ -0,0 +1,186 @@
+// Package sqlite Хранилище пользователей и refresh токенов в файле SQLite для развёртывания на одном узле без Postgres.
+// Драйвер на чистом Go (без cgo). Репозитории реализуют те же интерфейсы и возвращают те же ошибки, что и Postgres
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	sqlitedriver "github.com/glebarez/go-sqlite"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+)
+
+// timeLayout Формат времени в колонках TEXT: UTC с микросекундами, как хранит Postgres. Строки такого вида сортируются по времени
+const timeLayout = "2006-01-02T15:04:05.000000Z"
+
+func init() {
+	// lower() в SQLite меняет регистр только у латиницы, а поиск в списке пользователей должен находить и кириллицу, как ILIKE
+	sqlitedriver.MustRegisterDeterministicScalarFunction("casefold", 1, func(_ *sqlitedriver.FunctionContext, args []driver.Value) (driver.Value, error) {
+		switch value := args[0].(type) {
+		case string:
+			return strings.ToLower(value), nil
+		case nil:
+			return nil, nil
+		default:
+			return nil, fmt.Errorf("casefold: unexpected argument %T", value)
+		}
+	})
+	// jsonb_contains(document, filter) Аналог оператора jsonb @> для фильтра по атрибутам
+	sqlitedriver.MustRegisterDeterministicScalarFunction("jsonb_contains", 2, func(_ *sqlitedriver.FunctionContext, args []driver.Value) (driver.Value, error) {
+		var document, filter interface{}
+		for i, dest := range []*interface{}{&document, &filter} {
+			text, ok := args[i].(string)
+			if !ok {
+				return nil, fmt.Errorf("jsonb_contains: unexpected argument %T", args[i])
+			}
+			if err := json.Unmarshal([]byte(text), dest); err != nil {
+				return nil, fmt.Errorf("jsonb_contains: %w", err)
+			}
+		}
+		return users_db.JSONContains(document, filter), nil
+	})
+}
+
+// Open Открывает файл БД (создаёт, если его нет) с включёнными внешними ключами. Миграции применяет Migrate.
+// SQLite пишет из одного соединения за раз, поэтому пул ограничен одним соединением: запросы выполняются по очереди,
+// а параллельные транзакции не получают SQLITE_BUSY
+func Open(ctx context.Context, path string, log *slog.Logger) (*sql.DB, error) {
+	const op = "internal/storage/sqlite/Open"
+	log = log.With(slog.String("op", op), slog.String("path", path))
+
+	dsn := "file:" + path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite failed: %w", err)
+	}
+	db.SetMaxOpenConns(1)
+	if err = db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("ping failed: %w", SqliteErrorHandler(err))
+	}
+	log.Info("Successfully opened sqlite database")
+	return db, nil
+}
+
+// querier Общие методы *sql.DB и *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// inTx Выполняет fn в транзакции. Если fn вернула ошибку, транзакция откатывается, а ошибка возвращается как есть.
+// Внутри fn можно обращаться только к tx: второго соединения в пуле нет
+func inTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return SqliteErrorHandler(err)
+	}
+	defer tx.Rollback()
+
+	if err = fn(tx); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return SqliteErrorHandler(err)
+	}
+	return nil
+}
+
+// now Текущее время с точностью Postgres, что б updated_at, переданный клиенту, совпадал при сравнении
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// formatTime Время в виде для колонки TEXT
+func formatTime(t time.Time) string {
+	return t.UTC().Truncate(time.Microsecond).Format(timeLayout)
+}
+
+// timeArg Параметр запроса со временем. nil - NULL
+func timeArg(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return formatTime(*t)
+}
+
+// timeValue Читает колонку TEXT со временем в *time.Time
+type timeValue struct {
+	dest *time.Time
+}
+
+func (v timeValue) Scan(src interface{}) error {
+	text, ok := src.(string)
+	if !ok {
+		return fmt.Errorf("unexpected time value %T", src)
+	}
+	parsed, err := time.Parse(timeLayout, text)
+	if err != nil {
+		return fmt.Errorf("invalid time value %q: %w", text, err)
+	}
+	*v.dest = parsed
+	return nil
+}
+
+// nullTimeValue Читает колонку TEXT со временем, которая может быть NULL, в **time.Time
+type nullTimeValue struct {
+	dest **time.Time
+}
+
+func (v nullTimeValue) Scan(src interface{}) error {
+	if src == nil {
+		*v.dest = nil
+		return nil
+	}
+	var t time.Time
+	if err := (timeValue{dest: &t}).Scan(src); err != nil {
+		return err
+	}
+	*v.dest = &t
+	return nil
+}
+
+// stringsValue Читает массив строк из json_group_array. Порядок агрегации в SQLite не гарантирован, поэтому массив сортируется,
+// как ORDER BY в подзапросах Postgres
+type stringsValue struct {
+	dest *[]string
+}
+
+func (v stringsValue) Scan(src interface{}) error {
+	text, ok := src.(string)
+	if !ok {
+		return fmt.Errorf("unexpected array value %T", src)
+	}
+	values := make([]string, 0)
+	if err := json.Unmarshal([]byte(text), &values); err != nil {
+		return fmt.Errorf("invalid array value %q: %w", text, err)
+	}
+	slices.Sort(values)
+	*v.dest = values
+	return nil
+}
+
+// metadataValue Читает колонку metadata в users_db.Metadata
+type metadataValue struct {
+	dest *users_db.Metadata
+}
+
+func (v metadataValue) Scan(src interface{}) error {
+	text, ok := src.(string)
+	if !ok {
+		return fmt.Errorf("unexpected metadata value %T", src)
+	}
+	var metadata users_db.Metadata
+	if err := json.Unmarshal([]byte(text), &metadata); err != nil {
+		return fmt.Errorf("invalid metadata: %w", err)
+	}
+	*v.dest = metadata
+	return nil
+}
@@ -0,0 +1,104 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	sqlitedriver "github.com/glebarez/go-sqlite"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	sqlite3 "modernc.org/sqlite/lib"
+	"strings"
+)
+
+// lengthConstraintSuffix Окончание имени CHECK ограничения на длину колонки. Его нарушение - аналог переполнения VARCHAR(n)
+const lengthConstraintSuffix = "_length"
+
+// SqliteErrorHandler Приводит ошибку SQLite к той, что вернул бы database.PsqlErrorHandler для такой же ошибки Postgres:
+// нарушение ограничения становится *pgconn.PgError с кодом Postgres и именем ограничения, а sql.ErrNoRows - pgx.ErrNoRows.
+// Поэтому обработчики и сервисы разбирают ошибки обоих хранилищ одним кодом.
+// Имя уникального ограничения SQLite называет только для индексов по выражению, для колонок оно собирается
+// как в Postgres по умолчанию: <table>_<column>_key и <table>_pkey. Имя нарушенного внешнего ключа SQLite не сообщает
+func SqliteErrorHandler(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return pgx.ErrNoRows
+	}
+	var sqliteErr *sqlitedriver.Error
+	if !errors.As(err, &sqliteErr) {
+		return err
+	}
+
+	pgErr := &pgconn.PgError{Severity: "ERROR", Message: sqliteErr.Error()}
+	detail := constraintDetail(sqliteErr.Error())
+	switch sqliteErr.Code() {
+	case sqlite3.SQLITE_CONSTRAINT_UNIQUE:
+		pgErr.Code = database.PSQLUniqueError
+		pgErr.TableName, pgErr.ConstraintName = uniqueConstraintName(detail, "_key")
+	case sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+		pgErr.Code = database.PSQLUniqueError
+		pgErr.TableName, _ = uniqueConstraintName(detail, "")
+		pgErr.ConstraintName = pgErr.TableName + "_pkey"
+	case sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY:
+		pgErr.Code = database.PSQLForeignKeyError
+	case sqlite3.SQLITE_CONSTRAINT_NOTNULL:
+		pgErr.Code = database.PSQLNotNullError
+		pgErr.TableName, pgErr.ColumnName, _ = strings.Cut(detail, ".")
+	case sqlite3.SQLITE_CONSTRAINT_CHECK:
+		pgErr.Code, pgErr.ConstraintName = database.PSQLCheckError, detail
+		if strings.HasSuffix(detail, lengthConstraintSuffix) {
+			pgErr.Code = database.PSQLStringDataRightTruncationError
+		}
+	case sqlite3.SQLITE_TOOBIG:
+		pgErr.Code = database.PSQLStringDataRightTruncationError
+	case sqlite3.SQLITE_ERROR:
+		if !strings.Contains(sqliteErr.Error(), "syntax error") {
+			return fmt.Errorf("ошибка SQLite (%d): %w", sqliteErr.Code(), err)
+		}
+		pgErr.Code = database.PSQLSyntaxError
+	default:
+		return fmt.Errorf("ошибка SQLite (%d): %w", sqliteErr.Code(), err)
+	}
+	return database.PsqlErrorHandler(pgErr)
+}
+
+// constraintDetail Что нарушено по тексту ошибки: "index 'name'", "table.column, table.column" или имя CHECK ограничения.
+// Текст драйвера: "constraint failed: UNIQUE constraint failed: users.id (1555)"
+func constraintDetail(message string) string {
+	const marker = "constraint failed: "
+	if i := strings.LastIndex(message, marker); i >= 0 {
+		message = message[i+len(marker):]
+	}
+	if i := strings.LastIndex(message, " ("); i >= 0 && strings.HasSuffix(message, ")") {
+		message = message[:i]
+	}
+	return strings.TrimSpace(message)
+}
+
+// uniqueConstraintName Таблица и имя уникального ограничения из constraintDetail. Для индекса таблица неизвестна
+func uniqueConstraintName(detail string, suffix string) (string, string) {
+	if name, ok := strings.CutPrefix(detail, "index '"); ok {
+		return "", strings.TrimSuffix(name, "'")
+	}
+	var table string
+	var columns []string
+	for _, column := range strings.Split(detail, ",") {
+		var name string
+		table, name, _ = strings.Cut(strings.TrimSpace(column), ".")
+		columns = append(columns, name)
+	}
+	return table, table + "_" + strings.Join(columns, "_") + suffix
+}
+
+// uniqueViolationError Ошибка нарушения уникальности email или имени пользователя, как в users_db. Для других ошибок nil
+func uniqueViolationError(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != database.PSQLUniqueError {
+		return nil
+	}
+	if pgErr.ConstraintName == "users_username_lower_key" {
+		return users_db.ErrUsernameAlreadyExists
+	}
+	return users_db.ErrEmailAlreadyExists
+}
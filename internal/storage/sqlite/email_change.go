@@ -0,0 +1,150 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+)
+
+const emailChangeColumns = `id, user_id, old_email, new_email, expires_at, cancel_expires_at, confirmed_at, cancelled_at, created_at`
+
+// emailChangePending Заявка ещё ждёт подтверждения
+const emailChangePending = `confirmed_at IS NULL AND cancelled_at IS NULL AND expires_at > :now`
+
+func scanEmailChange(row rowScanner) (users_db.EmailChange, error) {
+	var change users_db.EmailChange
+	err := row.Scan(&change.ID, &change.UserID, &change.OldEmail, &change.NewEmail,
+		timeValue{dest: &change.ExpiresAt}, timeValue{dest: &change.CancelExpiresAt},
+		nullTimeValue{dest: &change.ConfirmedAt}, nullTimeValue{dest: &change.CancelledAt}, timeValue{dest: &change.CreatedAt})
+	if errors.Is(err, sql.ErrNoRows) {
+		return users_db.EmailChange{}, users_db.ErrEmailChangeNotFound
+	}
+	if err != nil {
+		return users_db.EmailChange{}, SqliteErrorHandler(err)
+	}
+	return change, nil
+}
+
+// CreateEmailChange Создаёт заявку на смену email, как users_db.CreateEmailChange.
+// Предыдущая неподтверждённая заявка пользователя отменяется
+func (us *UserRepository) CreateEmailChange(ctx context.Context, change users_db.EmailChange, confirmTokenHash string, cancelTokenHash string) (users_db.EmailChange, error) {
+	var created users_db.EmailChange
+	err := inTx(ctx, us.db, func(tx *sql.Tx) error {
+		var oldEmail string
+		err := tx.QueryRowContext(ctx, `SELECT email FROM users WHERE id = :id`, sql.Named("id", change.UserID)).Scan(&oldEmail)
+		if errors.Is(err, sql.ErrNoRows) {
+			return users_db.ErrUserNotFound
+		}
+		if err != nil {
+			return SqliteErrorHandler(err)
+		}
+
+		change.NewEmail = users_db.NormalizeEmail(change.NewEmail)
+		createdAt := sql.Named("now", formatTime(now()))
+		query := `UPDATE email_changes SET cancelled_at = :now WHERE user_id = :user_id AND ` + emailChangePending
+		if _, err = tx.ExecContext(ctx, query, sql.Named("user_id", change.UserID), createdAt); err != nil {
+			return SqliteErrorHandler(err)
+		}
+
+		query = `
+INSERT INTO email_changes (user_id, old_email, new_email, confirm_token_hash, cancel_token_hash, expires_at, cancel_expires_at, created_at)
+VALUES (:user_id, :old_email, :new_email, :confirm_token_hash, :cancel_token_hash, :expires_at, :cancel_expires_at, :now)
+RETURNING ` + emailChangeColumns
+		created, err = scanEmailChange(tx.QueryRowContext(ctx, query,
+			sql.Named("user_id", change.UserID),
+			sql.Named("old_email", oldEmail),
+			sql.Named("new_email", change.NewEmail),
+			sql.Named("confirm_token_hash", confirmTokenHash),
+			sql.Named("cancel_token_hash", cancelTokenHash),
+			sql.Named("expires_at", formatTime(change.ExpiresAt)),
+			sql.Named("cancel_expires_at", formatTime(change.CancelExpiresAt)),
+			createdAt))
+		return err
+	})
+	if err != nil {
+		return users_db.EmailChange{}, err
+	}
+	return created, nil
+}
+
+// ConfirmEmailChange Списывает ссылку подтверждения, меняет email и удаляет все refresh токены пользователя,
+// кроме keepRefreshToken, как users_db.ConfirmEmailChange
+func (us *UserRepository) ConfirmEmailChange(ctx context.Context, confirmTokenHash string, keepRefreshToken string) (users_db.EmailChange, error) {
+	var change users_db.EmailChange
+	err := inTx(ctx, us.db, func(tx *sql.Tx) error {
+		confirmedAt := sql.Named("now", formatTime(now()))
+		query := `
+UPDATE email_changes SET confirmed_at = :now
+WHERE confirm_token_hash = :hash AND ` + emailChangePending + `
+RETURNING ` + emailChangeColumns
+		var err error
+		change, err = scanEmailChange(tx.QueryRowContext(ctx, query, sql.Named("hash", confirmTokenHash), confirmedAt))
+		if err != nil {
+			return err
+		}
+
+		err = replaceEmail(ctx, tx, change.UserID, change.OldEmail, change.NewEmail)
+		if errors.Is(err, users_db.ErrUserNotFound) {
+			return users_db.ErrEmailChangeNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		query = `DELETE FROM tokens WHERE user_id = :user_id AND refresh_token <> :keep`
+		if _, err = tx.ExecContext(ctx, query, sql.Named("user_id", change.UserID), sql.Named("keep", keepRefreshToken)); err != nil {
+			return SqliteErrorHandler(err)
+		}
+		return nil
+	})
+	if err != nil {
+		return users_db.EmailChange{}, err
+	}
+	return change, nil
+}
+
+// CancelEmailChange Отменяет смену по ссылке из письма на старый адрес, как users_db.CancelEmailChange.
+// Уже подтверждённая смена откатывается, все refresh токены пользователя удаляются
+func (us *UserRepository) CancelEmailChange(ctx context.Context, cancelTokenHash string) (users_db.EmailChange, error) {
+	var change users_db.EmailChange
+	err := inTx(ctx, us.db, func(tx *sql.Tx) error {
+		cancelledAt := sql.Named("now", formatTime(now()))
+		query := `
+UPDATE email_changes SET cancelled_at = :now
+WHERE cancel_token_hash = :hash AND cancelled_at IS NULL AND cancel_expires_at > :now
+RETURNING ` + emailChangeColumns
+		var err error
+		change, err = scanEmailChange(tx.QueryRowContext(ctx, query, sql.Named("hash", cancelTokenHash), cancelledAt))
+		if err != nil {
+			return err
+		}
+
+		if change.ConfirmedAt != nil {
+			// Если email с тех пор снова меняли, возвращать нечего
+			err = replaceEmail(ctx, tx, change.UserID, change.NewEmail, change.OldEmail)
+			if err != nil && !errors.Is(err, users_db.ErrUserNotFound) {
+				return err
+			}
+		}
+
+		if _, err = tx.ExecContext(ctx, `DELETE FROM tokens WHERE user_id = :user_id`, sql.Named("user_id", change.UserID)); err != nil {
+			return SqliteErrorHandler(err)
+		}
+		return nil
+	})
+	if err != nil {
+		return users_db.EmailChange{}, err
+	}
+	return change, nil
+}
+
+// replaceEmail Меняет email пользователя с from на to. Если email уже не from - ErrUserNotFound
+func replaceEmail(ctx context.Context, tx *sql.Tx, userID int64, from string, to string) error {
+	query := `UPDATE users SET email = :to, updated_at = :now WHERE id = :id AND email = :from`
+	err := execUser(ctx, tx, query, sql.Named("id", userID), sql.Named("from", from), sql.Named("to", to), sql.Named("now", formatTime(now())))
+	if uniqueErr := uniqueViolationError(err); uniqueErr != nil {
+		return uniqueErr
+	}
+	return err
+}
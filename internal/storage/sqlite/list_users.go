@@ -0,0 +1,106 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"github.com/jackc/pgx/v5/pgconn"
+	"strings"
+	"time"
+)
+
+// ListUsers Страница пользователей по фильтру с пагинацией по курсору, как users_db.ListUsers.
+// Поиск по подстроке буквальный и без учёта регистра (casefold), фильтр по атрибутам - аналог jsonb @> (jsonb_contains)
+func (us *UserRepository) ListUsers(ctx context.Context, filter users_db.ListUsersFilter) ([]users_db.UserInfo, error) {
+	var sortColumn string
+	switch filter.SortBy {
+	case users_db.SortByCreatedAt, "":
+		sortColumn = "created_at"
+	case users_db.SortByEmail:
+		sortColumn = "email"
+	case users_db.SortByLastName:
+		sortColumn = "last_name"
+	default:
+		return nil, fmt.Errorf("%w: %s", users_db.ErrInvalidSort, filter.SortBy)
+	}
+	direction, comparison := "ASC", ">"
+	if filter.Desc {
+		direction, comparison = "DESC", "<"
+	}
+
+	conditions := []string{memberFilter("users.id")}
+	var args []any
+	if filter.Search != "" {
+		args = append(args, sql.Named("search", strings.ToLower(filter.Search)))
+		conditions = append(conditions, `(instr(casefold(first_name), :search) > 0 OR instr(casefold(last_name), :search) > 0 OR instr(casefold(email), :search) > 0)`)
+	}
+	if filter.Role != "" {
+		args = append(args, sql.Named("role", filter.Role))
+		conditions = append(conditions, `EXISTS (
+    SELECT 1 FROM user_roles JOIN roles ON roles.id = user_roles.role_id
+    WHERE user_roles.user_id = users.id AND user_roles.org_id = `+userOrgExpr+` AND roles.name = :role)`)
+	}
+	if filter.Status != "" {
+		args = append(args, sql.Named("status", filter.Status))
+		conditions = append(conditions, statusExpr+` = :status`)
+	}
+	if filter.CreatedFrom != nil {
+		args = append(args, sql.Named("created_from", formatTime(*filter.CreatedFrom)))
+		conditions = append(conditions, `created_at >= :created_from`)
+	}
+	if filter.CreatedTo != nil {
+		args = append(args, sql.Named("created_to", formatTime(*filter.CreatedTo)))
+		conditions = append(conditions, `created_at < :created_to`)
+	}
+	if len(filter.Metadata) > 0 {
+		document, err := json.Marshal(filter.Metadata)
+		if err != nil {
+			return nil, fmt.Errorf("invalid metadata filter: %w", err)
+		}
+		args = append(args, sql.Named("metadata", string(document)))
+		conditions = append(conditions, `jsonb_contains(metadata, :metadata)`)
+	}
+	if filter.After != nil {
+		value := filter.After.Value
+		if sortColumn == "created_at" {
+			createdAt, err := time.Parse(time.RFC3339Nano, value)
+			if err != nil {
+				// Та же ошибка, что вернул бы Postgres на приведении курсора к timestamptz
+				return nil, database.PsqlErrorHandler(&pgconn.PgError{
+					Severity: "ERROR",
+					Code:     database.PSQLInvalidDatetimeError,
+					Message:  fmt.Sprintf("invalid input syntax for type timestamp with time zone: %q", value),
+				})
+			}
+			value = formatTime(createdAt)
+		}
+		args = append(args, sql.Named("after_value", value), sql.Named("after_id", filter.After.ID))
+		conditions = append(conditions, fmt.Sprintf("(%s, id) %s (:after_value, :after_id)", sortColumn, comparison))
+	}
+	args = append(args, sql.Named("limit", filter.Limit))
+
+	query := `SELECT ` + userColumns + ` FROM users WHERE ` + strings.Join(conditions, " AND ")
+	query += fmt.Sprintf(" ORDER BY %[1]s %[2]s, id %[2]s LIMIT :limit", sortColumn, direction)
+
+	rows, err := us.db.QueryContext(ctx, query, userArgs(ctx, args...)...)
+	if err != nil {
+		return nil, SqliteErrorHandler(err)
+	}
+	defer rows.Close()
+
+	users := make([]users_db.UserInfo, 0, filter.Limit)
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, SqliteErrorHandler(err)
+	}
+	return users, nil
+}
@@ -0,0 +1,101 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/login_attempts_db"
+	"log/slog"
+	"time"
+)
+
+// LoginAttemptsRepository Реализация login_attempts_db.LoginAttemptsRepository на SQLite
+type LoginAttemptsRepository struct {
+	db  *sql.DB
+	log *slog.Logger
+}
+
+func NewLoginAttemptsRepository(db *sql.DB, log *slog.Logger) *LoginAttemptsRepository {
+	return &LoginAttemptsRepository{
+		db:  db,
+		log: log,
+	}
+}
+
+// GetAttempt Возвращает состояние попыток. Если неудачных попыток не было, возвращается пустая структура без ошибки
+func (r *LoginAttemptsRepository) GetAttempt(ctx context.Context, scope string, key string) (login_attempts_db.LoginAttempt, error) {
+	query := `SELECT failed_count, last_failed_at, locked_until FROM login_attempts WHERE scope = :scope AND key = :key`
+
+	var attempt login_attempts_db.LoginAttempt
+	err := r.db.QueryRowContext(ctx, query, sql.Named("scope", scope), sql.Named("key", key)).Scan(
+		&attempt.FailedCount, timeValue{dest: &attempt.LastFailedAt}, nullTimeValue{dest: &attempt.LockedUntil})
+	if errors.Is(err, sql.ErrNoRows) {
+		return login_attempts_db.LoginAttempt{}, nil
+	}
+	if err != nil {
+		return login_attempts_db.LoginAttempt{}, SqliteErrorHandler(err)
+	}
+	return attempt, nil
+}
+
+// ReserveAttempt Учитывает попытку входа до проверки пароля, как login_attempts_db.ReserveAttempt.
+// Транзакции SQLite идут по одной, поэтому параллельные попытки не проходят мимо блокировки
+func (r *LoginAttemptsRepository) ReserveAttempt(ctx context.Context, scope string, key string, window time.Duration, lockFor func(count int) time.Duration) (login_attempts_db.Reservation, error) {
+	const op = "internal/storage/sqlite/login_attempts.go/ReserveAttempt"
+	var reservation login_attempts_db.Reservation
+	err := inTx(ctx, r.db, func(tx *sql.Tx) error {
+		reservedAt := now()
+		var attempt login_attempts_db.LoginAttempt
+		query := `SELECT failed_count, last_failed_at, locked_until FROM login_attempts WHERE scope = :scope AND key = :key`
+		err := tx.QueryRowContext(ctx, query, sql.Named("scope", scope), sql.Named("key", key)).Scan(
+			&attempt.FailedCount, timeValue{dest: &attempt.LastFailedAt}, nullTimeValue{dest: &attempt.LockedUntil})
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return SqliteErrorHandler(err)
+		}
+
+		var locked bool
+		reservation, locked = login_attempts_db.NextReservation(attempt, reservedAt, window, lockFor)
+		if locked {
+			return nil
+		}
+		query = `
+INSERT INTO login_attempts (scope, key, failed_count, last_failed_at, locked_until)
+VALUES (:scope, :key, :failed_count, :now, :locked_until)
+ON CONFLICT (scope, key) DO UPDATE SET
+    failed_count   = excluded.failed_count,
+    last_failed_at = excluded.last_failed_at,
+    locked_until   = excluded.locked_until`
+		_, err = tx.ExecContext(ctx, query, sql.Named("scope", scope), sql.Named("key", key),
+			sql.Named("failed_count", reservation.FailedCount), sql.Named("now", formatTime(reservedAt)),
+			sql.Named("locked_until", timeArg(reservation.LockedUntil)))
+		if err != nil {
+			return SqliteErrorHandler(err)
+		}
+		return nil
+	})
+	if err != nil {
+		r.log.Error("Error while reserving login attempt", slog.String("op", op), "err", err.Error())
+		return login_attempts_db.Reservation{}, err
+	}
+	return reservation, nil
+}
+
+// ReleaseAttempt Возвращает попытку, учтённую ReserveAttempt, как login_attempts_db.ReleaseAttempt
+func (r *LoginAttemptsRepository) ReleaseAttempt(ctx context.Context, scope string, key string) error {
+	query := `UPDATE login_attempts SET failed_count = max(failed_count - 1, 0) WHERE scope = :scope AND key = :key`
+	_, err := r.db.ExecContext(ctx, query, sql.Named("scope", scope), sql.Named("key", key))
+	if err != nil {
+		return SqliteErrorHandler(err)
+	}
+	return nil
+}
+
+// Reset Сбрасывает счётчик и блокировку (успешный вход или разблокировка админом)
+func (r *LoginAttemptsRepository) Reset(ctx context.Context, scope string, key string) error {
+	query := `DELETE FROM login_attempts WHERE scope = :scope AND key = :key`
+	_, err := r.db.ExecContext(ctx, query, sql.Named("scope", scope), sql.Named("key", key))
+	if err != nil {
+		return SqliteErrorHandler(err)
+	}
+	return nil
+}
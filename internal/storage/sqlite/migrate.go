@@ -0,0 +1,66 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/migrator"
+	"io/fs"
+	"log/slog"
+)
+
+// versionTable Таблица с версией схемы в том же формате, что у migrator для Postgres: одна строка (version, dirty)
+const versionTable = "schema_migrations"
+
+// Migrate Применяет ещё не применённые миграции из fsys (формат имён как у migrator.Load).
+// Каждая миграция выполняется в своей транзакции вместе с записью версии. Блокировка между процессами не нужна:
+// с файлом БД работает один экземпляр сервиса
+func Migrate(ctx context.Context, db *sql.DB, fsys fs.FS, log *slog.Logger) error {
+	log = log.With(slog.String("op", "internal/storage/sqlite/Migrate"))
+	migrations, err := migrator.Load(fsys)
+	if err != nil {
+		return err
+	}
+	if _, err = db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+versionTable+` (version INTEGER NOT NULL PRIMARY KEY, dirty INTEGER NOT NULL)`); err != nil {
+		return SqliteErrorHandler(err)
+	}
+
+	var version int64
+	var dirty bool
+	err = db.QueryRowContext(ctx, `SELECT version, dirty FROM `+versionTable+` LIMIT 1`).Scan(&version, &dirty)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return SqliteErrorHandler(err)
+	}
+	if dirty {
+		return fmt.Errorf("%w (version %d)", migrator.ErrDirty, version)
+	}
+
+	applied := 0
+	for _, migration := range migrations {
+		if int64(migration.Version) <= version {
+			continue
+		}
+		err = inTx(ctx, db, func(tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, migration.Up); err != nil {
+				return SqliteErrorHandler(err)
+			}
+			if _, err := tx.ExecContext(ctx, `DELETE FROM `+versionTable); err != nil {
+				return SqliteErrorHandler(err)
+			}
+			if _, err := tx.ExecContext(ctx, `INSERT INTO `+versionTable+` (version, dirty) VALUES ($1, false)`, int64(migration.Version)); err != nil {
+				return SqliteErrorHandler(err)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("migration %s failed: %w", migration, err)
+		}
+		log.Info("Migration applied", slog.String("migration", migration.String()))
+		applied++
+	}
+	if applied == 0 {
+		log.Info("Database schema is up to date", slog.Int64("version", version))
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS email_changes;
+DROP TABLE IF EXISTS tokens;
+DROP TABLE IF EXISTS user_roles;
+DROP TABLE IF EXISTS organization_members;
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS permissions;
+DROP TABLE IF EXISTS roles;
+DROP TABLE IF EXISTS password_history;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,144 @@
+-- Время хранится текстом в UTC с микросекундами (2006-01-02T15:04:05.000000Z), поэтому сравнивается и сортируется как строка.
+-- Значения времени передаёт сервис: CURRENT_TIMESTAMP в SQLite с точностью до секунды.
+-- Длины колонок проверяются ограничениями *_length, что б слишком длинные данные отклонялись, как в VARCHAR(n) Postgres
+CREATE TABLE IF NOT EXISTS users
+(
+    id                      INTEGER PRIMARY KEY AUTOINCREMENT,
+    first_name              TEXT    NOT NULL CONSTRAINT users_first_name_length CHECK (length(first_name) <= 64),
+    last_name               TEXT    NOT NULL CONSTRAINT users_last_name_length CHECK (length(last_name) <= 64),
+    email                   TEXT    NOT NULL CONSTRAINT users_email_length CHECK (length(email) <= 256),
+    username                TEXT CONSTRAINT users_username_length CHECK (length(username) <= 32),
+    password                TEXT    NOT NULL CONSTRAINT users_password_length CHECK (length(password) <= 128),
+    phone                   TEXT CONSTRAINT users_phone_length CHECK (length(phone) <= 32),
+    phone_verified_at       TEXT,
+    status                  TEXT    NOT NULL DEFAULT 'active'
+        CONSTRAINT chk_users_status CHECK (status IN ('active', 'suspended', 'deactivated')),
+    status_reason           TEXT    NOT NULL DEFAULT '' CONSTRAINT users_status_reason_length CHECK (length(status_reason) <= 512),
+    status_expires_at       TEXT,
+    status_changed_at       TEXT,
+    password_reset_required INTEGER NOT NULL DEFAULT 0,
+    metadata                TEXT    NOT NULL DEFAULT '{"user": {}, "admin": {}}'
+        CONSTRAINT users_metadata_sections_check CHECK (
+            json_type(metadata, '$.user') = 'object' AND json_type(metadata, '$.admin') = 'object'),
+    created_at              TEXT    NOT NULL,
+    updated_at              TEXT    NOT NULL
+);
+
+-- Email и имя пользователя сервис записывает уже в нижнем регистре, индексы по lower() называются как в Postgres,
+-- что б нарушение уникальности приходило с тем же именем ограничения
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_lower_key ON users (lower(email));
+CREATE UNIQUE INDEX IF NOT EXISTS users_username_lower_key ON users (lower(username)) WHERE username IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_verified_phone ON users (phone) WHERE phone_verified_at IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_users_created_at_id ON users (created_at, id);
+CREATE INDEX IF NOT EXISTS idx_users_email_id ON users (email, id);
+CREATE INDEX IF NOT EXISTS idx_users_last_name_id ON users (last_name, id);
+
+CREATE TABLE IF NOT EXISTS password_history
+(
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id       INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    password_hash TEXT    NOT NULL CONSTRAINT password_history_password_hash_length CHECK (length(password_hash) <= 256),
+    created_at    TEXT    NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_password_history_user_id_created_at ON password_history (user_id, created_at DESC);
+
+-- Только встроенные роли с теми же правами, что выдают миграции Postgres: своих ролей и групп в этом хранилище нет
+CREATE TABLE IF NOT EXISTS roles
+(
+    id   INTEGER PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE
+);
+
+INSERT INTO roles (id, name)
+VALUES (1, 'admin'),
+       (2, 'user')
+ON CONFLICT DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS permissions
+(
+    id   INTEGER PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE
+);
+
+INSERT INTO permissions (name)
+VALUES ('users:read'),
+       ('users:write'),
+       ('roles:read'),
+       ('roles:write'),
+       ('sessions:revoke'),
+       ('authz:check'),
+       ('policies:write'),
+       ('orgs:write'),
+       ('users:impersonate')
+ON CONFLICT DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS role_permissions
+(
+    role_id       INTEGER NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    permission_id INTEGER NOT NULL REFERENCES permissions (id) ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles,
+     permissions
+WHERE roles.name = 'admin'
+ON CONFLICT DO NOTHING;
+
+-- Таблицы организаций нет: пользователь вступает в организацию запроса (без неё - в организацию по умолчанию),
+-- а членство нужно, что б роли и refresh токены выдавались в рамках организации, как в Postgres
+CREATE TABLE IF NOT EXISTS organization_members
+(
+    org_id    INTEGER NOT NULL,
+    user_id   INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    joined_at TEXT    NOT NULL,
+    PRIMARY KEY (org_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_organization_members_user_id ON organization_members (user_id);
+
+CREATE TABLE IF NOT EXISTS user_roles
+(
+    org_id  INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    role_id INTEGER NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    PRIMARY KEY (org_id, user_id, role_id),
+    CONSTRAINT fk_user_roles_membership FOREIGN KEY (org_id, user_id)
+        REFERENCES organization_members (org_id, user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_roles_user_id ON user_roles (user_id);
+
+CREATE TABLE IF NOT EXISTS tokens
+(
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id       INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    org_id        INTEGER NOT NULL,
+    refresh_token TEXT    NOT NULL UNIQUE CONSTRAINT tokens_refresh_token_length CHECK (length(refresh_token) <= 128),
+    created_at    TEXT    NOT NULL,
+    updated_at    TEXT    NOT NULL,
+    CONSTRAINT fk_tokens_membership FOREIGN KEY (org_id, user_id)
+        REFERENCES organization_members (org_id, user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_tokens_user_id ON tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS email_changes
+(
+    id                 INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id            INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    old_email          TEXT    NOT NULL,
+    new_email          TEXT    NOT NULL,
+    confirm_token_hash TEXT    NOT NULL UNIQUE,
+    cancel_token_hash  TEXT    NOT NULL UNIQUE,
+    expires_at         TEXT    NOT NULL,
+    cancel_expires_at  TEXT    NOT NULL,
+    confirmed_at       TEXT,
+    cancelled_at       TEXT,
+    created_at         TEXT    NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_changes_user_id ON email_changes (user_id);
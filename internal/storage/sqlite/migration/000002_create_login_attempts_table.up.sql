@@ -0,0 +1,10 @@
+-- Счётчики неудачных попыток входа, как в Postgres. Время - текст в UTC, как в 000001
+CREATE TABLE IF NOT EXISTS login_attempts
+(
+    scope          TEXT    NOT NULL CONSTRAINT login_attempts_scope_length CHECK (length(scope) <= 16),
+    key            TEXT    NOT NULL CONSTRAINT login_attempts_key_length CHECK (length(key) <= 256),
+    failed_count   INTEGER NOT NULL DEFAULT 0,
+    last_failed_at TEXT    NOT NULL,
+    locked_until   TEXT,
+    PRIMARY KEY (scope, key)
+);
@@ -0,0 +1,9 @@
+package migration
+
+import "embed"
+
+// FS SQL миграции схемы SQLite, встроенные в бинарник. Отдельный набор от Postgres: здесь только таблицы,
+// которые нужны репозиториям пользователей, refresh токенов и неудачных попыток входа. Формат имён тот же: NNNNNN_<name>.up.sql и NNNNNN_<name>.down.sql
+//
+//go:embed *.sql
+var FS embed.FS
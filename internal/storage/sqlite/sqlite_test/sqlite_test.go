@@ -0,0 +1,35 @@
+package sqlite_test
+
+import (
+	"context"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/sqlite"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/sqlite/migration"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/storagetest"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+)
+
+func TestContract(t *testing.T) {
+	storagetest.RunContract(t, func(t *testing.T) storagetest.Backend {
+		log := slog.New(slog.NewTextHandler(io.Discard, nil))
+		db, err := sqlite.Open(context.Background(), filepath.Join(t.TempDir(), "auth.db"), log)
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		if err = sqlite.Migrate(context.Background(), db, migration.FS, log); err != nil {
+			t.Fatalf("migrate: %v", err)
+		}
+		// Повторный запуск ничего не применяет
+		if err = sqlite.Migrate(context.Background(), db, migration.FS, log); err != nil {
+			t.Fatalf("migrate again: %v", err)
+		}
+		return storagetest.Backend{
+			Users:         sqlite.NewUserRepository(db, log),
+			Tokens:        sqlite.NewTokensRepository(db, log),
+			LoginAttempts: sqlite.NewLoginAttemptsRepository(db, log),
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/tenant"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/auth_db"
+	"log/slog"
+	"strconv"
+)
+
+// TokensRepository Реализация auth_db.TokensRepository на SQLite. Ненайденный токен - pgx.ErrNoRows, как в Postgres
+type TokensRepository struct {
+	db  *sql.DB
+	log *slog.Logger
+}
+
+func NewTokensRepository(db *sql.DB, log *slog.Logger) *TokensRepository {
+	return &TokensRepository{
+		db:  db,
+		log: log,
+	}
+}
+
+// DbPutTokens Сохраняет refresh токен. Пользователь должен состоять в организации orgID (внешний ключ на членство)
+func (r *TokensRepository) DbPutTokens(ctx context.Context, userId int64, orgID int64, refreshToken string) error {
+	const op = "internal/storage/sqlite/tokens.go/DbPutTokens"
+	log := r.log.With(
+		slog.String("operation", op),
+		slog.String("User_id", strconv.FormatInt(userId, 10)),
+		slog.Int64("org_id", orgID))
+
+	query := `INSERT INTO tokens (user_id, org_id, refresh_token, created_at, updated_at) VALUES (:user_id, :org_id, :refresh_token, :now, :now)`
+	_, err := r.db.ExecContext(ctx, query, sql.Named("user_id", userId), sql.Named("org_id", orgID),
+		sql.Named("refresh_token", refreshToken), sql.Named("now", formatTime(now())))
+	if err != nil {
+		log.Error("Error while put tokens in db", "err", err.Error())
+		return SqliteErrorHandler(err)
+	}
+	return nil
+}
+
+func (r *TokensRepository) DbGetTokens(ctx context.Context, refreshToken string) (auth_db.JWTTokenData, error) {
+	const op = "internal/storage/sqlite/tokens.go/DbGetTokens"
+	log := r.log.With(slog.String("operation", op))
+
+	query := `SELECT tokens.user_id, tokens.org_id, ` + rolesQuery("tokens.user_id", "tokens.org_id") + `, ` + permissionsQuery("tokens.user_id", "tokens.org_id") + `,
+` + statusExpr + `, users.metadata
+FROM tokens JOIN users ON users.id = tokens.user_id
+WHERE refresh_token = :refresh_token AND (:org IS NULL OR tokens.org_id = :org)`
+	var tokenData auth_db.JWTTokenData
+	err := r.db.QueryRowContext(ctx, query, userArgs(ctx, sql.Named("refresh_token", refreshToken))...).Scan(
+		&tokenData.UserId,
+		&tokenData.OrgID,
+		stringsValue{dest: &tokenData.UserRoles},
+		stringsValue{dest: &tokenData.UserPermissions},
+		&tokenData.UserStatus,
+		metadataValue{dest: &tokenData.UserMetadata})
+	if err != nil {
+		log.Error("Error while get tokens", "err", err.Error())
+		return auth_db.JWTTokenData{}, SqliteErrorHandler(err)
+	}
+	return tokenData, nil
+}
+
+// DbUpdateTokens Заменяет refresh токен пользователя. Если старого токена нет, ничего не делает
+func (r *TokensRepository) DbUpdateTokens(ctx context.Context, userId int64, refreshToken string, oldRefreshToken string) error {
+	const op = "internal/storage/sqlite/tokens.go/DbUpdateTokens"
+	log := r.log.With(slog.String("operation", op))
+
+	query := `UPDATE tokens SET refresh_token = :refresh_token, updated_at = :now
+WHERE user_id = :user_id AND refresh_token = :old_refresh_token AND (:org IS NULL OR org_id = :org)`
+	_, err := r.db.ExecContext(ctx, query, userArgs(ctx, sql.Named("refresh_token", refreshToken),
+		sql.Named("user_id", userId), sql.Named("old_refresh_token", oldRefreshToken))...)
+	if err != nil {
+		log.Error("Error while update tokens", "err", err.Error())
+		return SqliteErrorHandler(err)
+	}
+	return nil
+}
+
+func (r *TokensRepository) DbDeleteToken(ctx context.Context, refreshToken string) error {
+	const op = "internal/storage/sqlite/tokens.go/DbDeleteToken"
+	log := r.log.With(slog.String("operation", op))
+
+	query := `DELETE FROM tokens WHERE refresh_token = :refresh_token AND (:org IS NULL OR org_id = :org)`
+	_, err := r.db.ExecContext(ctx, query, sql.Named("refresh_token", refreshToken), sql.Named("org", tenant.OrgIDArg(ctx)))
+	if err != nil {
+		log.Error("Error while delete token", "err", err.Error())
+		return SqliteErrorHandler(err)
+	}
+	return nil
+}
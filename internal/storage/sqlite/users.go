@@ -0,0 +1,518 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/tenant"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/models/users/create_user"
+	"log/slog"
+	"time"
+)
+
+// UserRepository Реализация users_db.UserRepository на SQLite с теми же ошибками, что и у Postgres.
+// Организация запроса и текущее время передаются во все запросы параметрами :org и :now (см. userArgs)
+type UserRepository struct {
+	db  *sql.DB
+	log *slog.Logger
+}
+
+func NewUserRepository(db *sql.DB, log *slog.Logger) *UserRepository {
+	return &UserRepository{
+		db:  db,
+		log: log,
+	}
+}
+
+// userOrgExpr Организация, в рамках которой читаются роли: из запроса, а без неё - та, в которую пользователь вступил первой
+const userOrgExpr = `COALESCE(:org, (
+    SELECT organization_members.org_id FROM organization_members WHERE organization_members.user_id = users.id
+    ORDER BY organization_members.joined_at, organization_members.org_id LIMIT 1), 0)`
+
+// statusExpr Действующий статус пользователя с учётом status_expires_at, как users_db.StatusExpr
+const statusExpr = `(CASE WHEN users.status_expires_at IS NOT NULL AND users.status_expires_at <= :now THEN
+    CASE users.status WHEN 'suspended' THEN 'active' WHEN 'active' THEN 'deactivated' ELSE users.status END
+    ELSE users.status END)`
+
+// userColumns Колонки, которые читаются в UserInfo функцией scanUser. Порядок должен совпадать
+var userColumns = `id, first_name, last_name, email, COALESCE(username, ''), password, ` + userOrgExpr + `, ` +
+	rolesQuery("users.id", userOrgExpr) + `, ` + permissionsQuery("users.id", userOrgExpr) +
+	`, COALESCE(phone, ''), phone_verified_at IS NOT NULL, ` + statusExpr + `, status_reason, status_expires_at, password_reset_required, metadata, created_at, updated_at`
+
+// memberFilter Условие "пользователь состоит в организации запроса". Запрос, явно отвязанный от организации, не фильтрует
+func memberFilter(userIDExpr string) string {
+	return `(:org IS NULL OR EXISTS (
+    SELECT 1 FROM organization_members
+    WHERE organization_members.user_id = ` + userIDExpr + ` AND organization_members.org_id = :org))`
+}
+
+// rolesQuery Подзапрос с JSON массивом имён ролей пользователя в организации
+func rolesQuery(userIDExpr string, orgIDExpr string) string {
+	return `(
+    SELECT json_group_array(roles.name) FROM user_roles JOIN roles ON roles.id = user_roles.role_id
+    WHERE user_roles.user_id = ` + userIDExpr + ` AND user_roles.org_id = ` + orgIDExpr + `)`
+}
+
+// permissionsQuery Подзапрос с JSON массивом прав всех ролей пользователя в организации
+func permissionsQuery(userIDExpr string, orgIDExpr string) string {
+	return `(
+    SELECT json_group_array(DISTINCT permissions.name) FROM user_roles
+    JOIN role_permissions ON role_permissions.role_id = user_roles.role_id
+    JOIN permissions ON permissions.id = role_permissions.permission_id
+    WHERE user_roles.user_id = ` + userIDExpr + ` AND user_roles.org_id = ` + orgIDExpr + `)`
+}
+
+// userArgs Параметры запроса и общие для всех запросов пользователей :org (tenant.OrgIDArg) и :now
+func userArgs(ctx context.Context, args ...any) []any {
+	return append(args, sql.Named("org", tenant.OrgIDArg(ctx)), sql.Named("now", formatTime(now())))
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanUser(row rowScanner) (users_db.UserInfo, error) {
+	var user users_db.UserInfo
+	err := row.Scan(
+		&user.ID,
+		&user.FirstName,
+		&user.LastName,
+		&user.Email,
+		&user.Username,
+		&user.PasswordHash,
+		&user.OrgID,
+		stringsValue{dest: &user.Roles},
+		stringsValue{dest: &user.Permissions},
+		&user.Phone,
+		&user.PhoneVerified,
+		&user.Status,
+		&user.StatusReason,
+		nullTimeValue{dest: &user.StatusExpiresAt},
+		&user.PasswordResetRequired,
+		metadataValue{dest: &user.Metadata},
+		timeValue{dest: &user.CreatedAt},
+		timeValue{dest: &user.UpdatedAt})
+	if errors.Is(err, sql.ErrNoRows) {
+		return users_db.UserInfo{}, users_db.ErrUserNotFound
+	}
+	if err != nil {
+		return users_db.UserInfo{}, SqliteErrorHandler(err)
+	}
+	return user, nil
+}
+
+// getUser Пользователь по условию where, если он виден в организации запроса
+func getUser(ctx context.Context, q querier, where string, args ...any) (users_db.UserInfo, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE ` + where + ` AND ` + memberFilter("users.id")
+	return scanUser(q.QueryRowContext(ctx, query, userArgs(ctx, args...)...))
+}
+
+// CreateUser Создаёт пользователя в организации запроса (без неё - в организации по умолчанию) с ролью user
+func (us *UserRepository) CreateUser(ctx context.Context, userinfo *create_user.UserCreate) (int64, error) {
+	var id int64
+	err := inTx(ctx, us.db, func(tx *sql.Tx) error {
+		var err error
+		id, err = insertUser(ctx, tx, userinfo, tenant.OrgIDOrDefault(ctx), []string{users_db.RoleUser})
+		return err
+	})
+	return id, err
+}
+
+// insertUser Добавляет пользователя, его первый пароль в историю, членство в организации orgID и роли roleNames в ней
+func insertUser(ctx context.Context, tx *sql.Tx, userinfo *create_user.UserCreate, orgID int64, roleNames []string) (int64, error) {
+	createdAt := formatTime(now())
+	var id int64
+	err := tx.QueryRowContext(ctx, `
+INSERT INTO users (first_name, last_name, email, username, password, created_at, updated_at)
+VALUES (:first_name, :last_name, :email, NULLIF(:username, ''), :password, :now, :now)
+RETURNING id`,
+		sql.Named("first_name", userinfo.FirstName),
+		sql.Named("last_name", userinfo.LastName),
+		sql.Named("email", users_db.NormalizeEmail(userinfo.Email)),
+		sql.Named("username", users_db.NormalizeUsername(userinfo.Username)),
+		sql.Named("password", userinfo.Password),
+		sql.Named("now", createdAt)).Scan(&id)
+	if err != nil {
+		dbErr := SqliteErrorHandler(err)
+		if uniqueErr := uniqueViolationError(dbErr); uniqueErr != nil {
+			return 0, uniqueErr
+		}
+		return 0, dbErr
+	}
+
+	roles, err := json.Marshal(roleNames)
+	if err != nil {
+		return 0, err
+	}
+	args := []any{sql.Named("id", id), sql.Named("org", orgID), sql.Named("now", createdAt), sql.Named("roles", string(roles)),
+		sql.Named("password", userinfo.Password)}
+	// Хеш пароля сразу пишем в историю, что б политика паролей не дала вернуться к нему при смене
+	for _, query := range []string{
+		`INSERT INTO password_history (user_id, password_hash, created_at) VALUES (:id, :password, :now)`,
+		`INSERT INTO organization_members (org_id, user_id, joined_at) VALUES (:org, :id, :now)`,
+		`INSERT INTO user_roles (org_id, user_id, role_id)
+SELECT :org, :id, roles.id FROM roles WHERE roles.name IN (SELECT value FROM json_each(:roles))`,
+	} {
+		if _, err = tx.ExecContext(ctx, query, args...); err != nil {
+			return 0, SqliteErrorHandler(err)
+		}
+	}
+	return id, nil
+}
+
+// GetUser Пользователь по email без учёта регистра. Email хранится в нижнем регистре
+func (us *UserRepository) GetUser(ctx context.Context, userEmail string) (users_db.UserInfo, error) {
+	return getUser(ctx, us.db, `email = :email`, sql.Named("email", users_db.NormalizeEmail(userEmail)))
+}
+
+// GetUserByUsername Пользователь по имени без учёта регистра. Имя хранится в нижнем регистре
+func (us *UserRepository) GetUserByUsername(ctx context.Context, username string) (users_db.UserInfo, error) {
+	return getUser(ctx, us.db, `username = :username`, sql.Named("username", users_db.NormalizeUsername(username)))
+}
+
+// CheckAdminInDB Ищет администратора организации по умолчанию. Если его нет - pgx.ErrNoRows, как в Postgres
+func (us *UserRepository) CheckAdminInDB(ctx context.Context) (users_db.UserInfo, error) {
+	query := `
+SELECT id, first_name, last_name, email, password FROM users
+WHERE EXISTS (
+    SELECT 1 FROM user_roles JOIN roles ON roles.id = user_roles.role_id
+    WHERE user_roles.user_id = users.id AND user_roles.org_id = :org AND roles.name = 'admin')
+ORDER BY id
+LIMIT 1`
+
+	var user users_db.UserInfo
+	err := us.db.QueryRowContext(ctx, query, sql.Named("org", tenant.DefaultOrgID)).Scan(
+		&user.ID,
+		&user.FirstName,
+		&user.LastName,
+		&user.Email,
+		&user.PasswordHash,
+	)
+	if err != nil {
+		return users_db.UserInfo{}, SqliteErrorHandler(err)
+	}
+	return user, nil
+}
+
+// AddFirstAdmin Создаёт администратора организации по умолчанию с теми же данными, что и Postgres реализация
+func (us *UserRepository) AddFirstAdmin(ctx context.Context, email string, passwordHash string) error {
+	return inTx(ctx, us.db, func(tx *sql.Tx) error {
+		args := []any{sql.Named("id", 0), sql.Named("org", tenant.DefaultOrgID), sql.Named("now", formatTime(now())),
+			sql.Named("email", users_db.NormalizeEmail(email)), sql.Named("password", passwordHash)}
+		for _, query := range []string{
+			`INSERT INTO users (id, first_name, last_name, email, password, created_at, updated_at)
+VALUES (:id, 'Admin first name', 'Admin last name', :email, :password, :now, :now)`,
+			`INSERT INTO organization_members (org_id, user_id, joined_at) VALUES (:org, :id, :now)`,
+			`INSERT INTO user_roles (org_id, user_id, role_id) SELECT :org, :id, roles.id FROM roles WHERE roles.name IN ('admin', 'user')`,
+		} {
+			if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+				return SqliteErrorHandler(err)
+			}
+		}
+		return nil
+	})
+}
+
+// SetAdminRole Делает пользователя администратором организации запроса (без неё - организации по умолчанию)
+func (us *UserRepository) SetAdminRole(ctx context.Context, id int64) error {
+	query := `
+INSERT INTO user_roles (org_id, user_id, role_id)
+SELECT organization_members.org_id, organization_members.user_id, roles.id FROM organization_members, roles
+WHERE organization_members.user_id = :id AND organization_members.org_id = :org AND roles.name = 'admin'
+ON CONFLICT DO NOTHING`
+	orgID := tenant.OrgIDOrDefault(ctx)
+	result, err := us.db.ExecContext(ctx, query, sql.Named("id", id), sql.Named("org", orgID))
+	if err != nil {
+		return SqliteErrorHandler(err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		// Либо пользователя нет в организации, либо он уже админ
+		if _, err = us.GetUserByID(tenant.WithOrgID(ctx, orgID), id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (us *UserRepository) GetUserByID(ctx context.Context, id int64) (users_db.UserInfo, error) {
+	return getUser(ctx, us.db, `id = :id`, sql.Named("id", id))
+}
+
+// UpdatePassword Обновляет хеш пароля пользователя, добавляет его в историю паролей и снимает требование задать пароль
+func (us *UserRepository) UpdatePassword(ctx context.Context, id int64, passwordHash string) error {
+	return inTx(ctx, us.db, func(tx *sql.Tx) error {
+		args := userArgs(ctx, sql.Named("id", id), sql.Named("password", passwordHash))
+		query := `UPDATE users SET password = :password, password_reset_required = false, updated_at = :now
+WHERE id = :id AND ` + memberFilter("users.id")
+		if err := execUser(ctx, tx, query, args...); err != nil {
+			return err
+		}
+		query = `INSERT INTO password_history (user_id, password_hash, created_at) VALUES (:id, :password, :now)`
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return SqliteErrorHandler(err)
+		}
+		return nil
+	})
+}
+
+// GetPasswordHistory Возвращает последние limit хешей паролей пользователя, начиная с самого свежего
+func (us *UserRepository) GetPasswordHistory(ctx context.Context, id int64, limit int) ([]string, error) {
+	query := `SELECT password_hash FROM password_history WHERE user_id = :id AND ` + memberFilter(":id") + `
+ORDER BY created_at DESC, id DESC LIMIT :limit`
+
+	rows, err := us.db.QueryContext(ctx, query, userArgs(ctx, sql.Named("id", id), sql.Named("limit", limit))...)
+	if err != nil {
+		return nil, SqliteErrorHandler(err)
+	}
+	defer rows.Close()
+
+	var hashes []string
+	for rows.Next() {
+		var hash string
+		if err = rows.Scan(&hash); err != nil {
+			return nil, SqliteErrorHandler(err)
+		}
+		hashes = append(hashes, hash)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, SqliteErrorHandler(err)
+	}
+	return hashes, nil
+}
+
+// RehashPassword Заменяет хеш, только если он не поменялся с момента проверки пароля. В историю паролей не пишется
+func (us *UserRepository) RehashPassword(ctx context.Context, id int64, oldPasswordHash string, newPasswordHash string) error {
+	query := `UPDATE users SET password = :new_password, updated_at = :now
+WHERE id = :id AND password = :old_password AND ` + memberFilter("users.id")
+	return execUser(ctx, us.db, query, userArgs(ctx, sql.Named("id", id),
+		sql.Named("old_password", oldPasswordHash), sql.Named("new_password", newPasswordHash))...)
+}
+
+// GetUserByPhone Ищет пользователя только по подтверждённому номеру телефона
+func (us *UserRepository) GetUserByPhone(ctx context.Context, phone string) (users_db.UserInfo, error) {
+	return getUser(ctx, us.db, `phone = :phone AND phone_verified_at IS NOT NULL`, sql.Named("phone", phone))
+}
+
+// SetPhone Указывает новый, ещё не подтверждённый номер телефона
+func (us *UserRepository) SetPhone(ctx context.Context, id int64, phone string) error {
+	query := `UPDATE users SET phone = :phone, phone_verified_at = NULL, updated_at = :now WHERE id = :id AND ` + memberFilter("users.id")
+	return execUser(ctx, us.db, query, userArgs(ctx, sql.Named("id", id), sql.Named("phone", phone))...)
+}
+
+// MarkPhoneVerified Подтверждает номер, если он всё ещё указан у пользователя. Подтверждённый номер уникален
+func (us *UserRepository) MarkPhoneVerified(ctx context.Context, id int64, phone string) error {
+	query := `UPDATE users SET phone_verified_at = :now, updated_at = :now WHERE id = :id AND phone = :phone AND ` + memberFilter("users.id")
+	err := execUser(ctx, us.db, query, userArgs(ctx, sql.Named("id", id), sql.Named("phone", phone))...)
+	if uniqueViolationError(err) != nil {
+		return users_db.ErrPhoneAlreadyExists
+	}
+	return err
+}
+
+// UpdateProfile Частично обновляет профиль и возвращает пользователя после изменения.
+// Если передан expectedUpdatedAt, обновление выполняется только если профиль с тех пор не меняли, иначе ErrUserModified
+func (us *UserRepository) UpdateProfile(ctx context.Context, id int64, update users_db.ProfileUpdate, expectedUpdatedAt *time.Time) (users_db.UserInfo, error) {
+	userMetadata, err := metadataSectionArg(update.UserMetadata)
+	if err != nil {
+		return users_db.UserInfo{}, err
+	}
+	var username *string
+	if update.Username != nil {
+		normalized := users_db.NormalizeUsername(*update.Username)
+		username = &normalized
+	}
+
+	var user users_db.UserInfo
+	err = inTx(ctx, us.db, func(tx *sql.Tx) error {
+		query := `
+UPDATE users SET
+    first_name = COALESCE(:first_name, first_name),
+    last_name  = COALESCE(:last_name, last_name),
+    username   = CASE WHEN :username IS NULL THEN username ELSE NULLIF(:username, '') END,
+    metadata   = CASE WHEN :user_metadata IS NULL THEN metadata ELSE json_set(metadata, '$.user', json(:user_metadata)) END,
+    updated_at = :now
+WHERE id = :id AND (:expected_updated_at IS NULL OR updated_at = :expected_updated_at) AND ` + memberFilter("users.id")
+		result, err := tx.ExecContext(ctx, query, userArgs(ctx, sql.Named("id", id),
+			sql.Named("first_name", update.FirstName),
+			sql.Named("last_name", update.LastName),
+			sql.Named("username", username),
+			sql.Named("user_metadata", userMetadata),
+			sql.Named("expected_updated_at", timeArg(expectedUpdatedAt)))...)
+		if err != nil {
+			dbErr := SqliteErrorHandler(err)
+			if uniqueErr := uniqueViolationError(dbErr); uniqueErr != nil {
+				return uniqueErr
+			}
+			return dbErr
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			return notFoundOrModified(ctx, tx, id)
+		}
+		user, err = getUser(ctx, tx, `id = :id`, sql.Named("id", id))
+		return err
+	})
+	if err != nil {
+		return users_db.UserInfo{}, err
+	}
+	return user, nil
+}
+
+// DeleteUser Удаляет пользователя из всех организаций. Refresh токены, история паролей и заявки на смену email удаляются
+// каскадно внешними ключами. Нельзя удалить последнего администратора ни одной из организаций.
+// expectedUpdatedAt работает так же, как в UpdateProfile
+func (us *UserRepository) DeleteUser(ctx context.Context, id int64, expectedUpdatedAt *time.Time) error {
+	return inTx(ctx, us.db, func(tx *sql.Tx) error {
+		if err := ensureNotLastAdmin(ctx, tx, id); err != nil {
+			return err
+		}
+		query := `DELETE FROM users WHERE id = :id AND (:expected_updated_at IS NULL OR updated_at = :expected_updated_at) AND ` + memberFilter("users.id")
+		result, err := tx.ExecContext(ctx, query, userArgs(ctx, sql.Named("id", id), sql.Named("expected_updated_at", timeArg(expectedUpdatedAt)))...)
+		if err != nil {
+			return SqliteErrorHandler(err)
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			return notFoundOrModified(ctx, tx, id)
+		}
+		return nil
+	})
+}
+
+// ensureNotLastAdmin Возвращает ErrLastAdmin, если userID - единственный администратор хотя бы одной из организаций,
+// в которых он администратор. Транзакции в SQLite выполняются по очереди, поэтому строку блокировать не нужно
+func ensureNotLastAdmin(ctx context.Context, tx *sql.Tx, userID int64) error {
+	query := `
+SELECT EXISTS (
+    SELECT 1 FROM user_roles JOIN roles ON roles.id = user_roles.role_id
+    WHERE roles.name = 'admin' AND user_roles.user_id = :id
+      AND NOT EXISTS (
+        SELECT 1 FROM user_roles other
+        WHERE other.role_id = user_roles.role_id AND other.org_id = user_roles.org_id AND other.user_id <> :id))`
+
+	var lastAdmin bool
+	if err := tx.QueryRowContext(ctx, query, sql.Named("id", userID)).Scan(&lastAdmin); err != nil {
+		return SqliteErrorHandler(err)
+	}
+	if lastAdmin {
+		return users_db.ErrLastAdmin
+	}
+	return nil
+}
+
+// GetUserStatus Действующий статус аккаунта. Статус общий для всех организаций, поэтому организация запроса не учитывается
+func (us *UserRepository) GetUserStatus(ctx context.Context, id int64) (string, error) {
+	var status string
+	err := us.db.QueryRowContext(ctx, `SELECT `+statusExpr+` FROM users WHERE id = :id`, sql.Named("id", id), sql.Named("now", formatTime(now()))).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", users_db.ErrUserNotFound
+	}
+	if err != nil {
+		return "", SqliteErrorHandler(err)
+	}
+	return status, nil
+}
+
+// SetStatus Меняет статус аккаунта и возвращает пользователя после изменения.
+// При блокировке и отключении сразу удаляются все refresh токены пользователя, а последнего администратора
+// ни одной из организаций заблокировать нельзя
+func (us *UserRepository) SetStatus(ctx context.Context, id int64, change users_db.StatusChange) (users_db.UserInfo, error) {
+	var user users_db.UserInfo
+	err := inTx(ctx, us.db, func(tx *sql.Tx) error {
+		if change.Status != users_db.StatusActive {
+			if err := ensureNotLastAdmin(ctx, tx, id); err != nil {
+				return err
+			}
+		}
+		query := `
+UPDATE users SET status = :status, status_reason = :reason, status_expires_at = :expires_at, status_changed_at = :now, updated_at = :now
+WHERE id = :id AND ` + memberFilter("users.id")
+		err := execUser(ctx, tx, query, userArgs(ctx, sql.Named("id", id), sql.Named("status", change.Status),
+			sql.Named("reason", change.Reason), sql.Named("expires_at", timeArg(change.ExpiresAt)))...)
+		if err != nil {
+			return err
+		}
+		if change.Status != users_db.StatusActive {
+			if _, err = tx.ExecContext(ctx, `DELETE FROM tokens WHERE user_id = :id`, sql.Named("id", id)); err != nil {
+				return SqliteErrorHandler(err)
+			}
+		}
+		user, err = getUser(ctx, tx, `id = :id`, sql.Named("id", id))
+		return err
+	})
+	if err != nil {
+		return users_db.UserInfo{}, err
+	}
+	return user, nil
+}
+
+// SetMetadata Заменяет переданные секции атрибутов и возвращает пользователя после изменения
+func (us *UserRepository) SetMetadata(ctx context.Context, id int64, update users_db.MetadataUpdate) (users_db.UserInfo, error) {
+	userSection, err := metadataSectionArg(update.User)
+	if err != nil {
+		return users_db.UserInfo{}, err
+	}
+	adminSection, err := metadataSectionArg(update.Admin)
+	if err != nil {
+		return users_db.UserInfo{}, err
+	}
+
+	var user users_db.UserInfo
+	err = inTx(ctx, us.db, func(tx *sql.Tx) error {
+		query := `
+UPDATE users SET metadata = json_set(metadata,
+    '$.user',  json(COALESCE(:user_section, json_extract(metadata, '$.user'))),
+    '$.admin', json(COALESCE(:admin_section, json_extract(metadata, '$.admin')))),
+    updated_at = :now
+WHERE id = :id AND ` + memberFilter("users.id")
+		err := execUser(ctx, tx, query, userArgs(ctx, sql.Named("id", id),
+			sql.Named("user_section", userSection), sql.Named("admin_section", adminSection))...)
+		if err != nil {
+			return err
+		}
+		user, err = getUser(ctx, tx, `id = :id`, sql.Named("id", id))
+		return err
+	})
+	if err != nil {
+		return users_db.UserInfo{}, err
+	}
+	return user, nil
+}
+
+// metadataSectionArg Секция атрибутов JSON строкой. Для nil возвращает NULL, а не JSON null
+func metadataSectionArg(section map[string]interface{}) (interface{}, error) {
+	if section == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(section)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metadata: %w", err)
+	}
+	return string(data), nil
+}
+
+// execUser Выполняет изменение одного пользователя. Если строка не затронута - ErrUserNotFound
+func execUser(ctx context.Context, q querier, query string, args ...any) error {
+	result, err := q.ExecContext(ctx, query, args...)
+	if err != nil {
+		return SqliteErrorHandler(err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return users_db.ErrUserNotFound
+	}
+	return nil
+}
+
+// notFoundOrModified Разбирается, почему условный запрос не затронул строку: пользователя нет или его уже изменили
+func notFoundOrModified(ctx context.Context, q querier, id int64) error {
+	var exists bool
+	query := `SELECT EXISTS (SELECT 1 FROM users WHERE id = :id AND ` + memberFilter("users.id") + `)`
+	if err := q.QueryRowContext(ctx, query, userArgs(ctx, sql.Named("id", id))...).Scan(&exists); err != nil {
+		return SqliteErrorHandler(err)
+	}
+	if exists {
+		return users_db.ErrUserModified
+	}
+	return users_db.ErrUserNotFound
+}
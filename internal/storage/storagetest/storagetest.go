@@ -0,0 +1,747 @@
+// Package storagetest Общий набор проверок для реализаций репозиториев пользователей, refresh токенов
+// и счётчиков неудачных попыток входа.
+// Каждое хранилище запускает его из своих тестов, что б все реализации вели себя одинаково
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/permissions"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/tenant"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/auth_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/login_attempts_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/storage/database/repositories/users_db"
+	"github.com/ShlykovPavel/auth-JWT-microservice/models/users/create_user"
+	"github.com/jackc/pgx/v5"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Backend Репозитории одного хранилища
+type Backend struct {
+	Users         users_db.UserRepository
+	Tokens        auth_db.TokensRepository
+	LoginAttempts login_attempts_db.LoginAttemptsRepository
+}
+
+// RunContract Запускает проверки. newBackend вызывается для каждой проверки и должен возвращать пустое хранилище
+func RunContract(t *testing.T, newBackend func(t *testing.T) Backend) {
+	for _, tt := range []struct {
+		Name string
+		Test func(t *testing.T, b Backend)
+	}{
+		{Name: "users", Test: testUsers},
+		{Name: "first admin", Test: testFirstAdmin},
+		{Name: "passwords", Test: testPasswords},
+		{Name: "profile", Test: testProfile},
+		{Name: "phone", Test: testPhone},
+		{Name: "status", Test: testStatus},
+		{Name: "tokens", Test: testTokens},
+		{Name: "list users", Test: testListUsers},
+		{Name: "email change", Test: testEmailChange},
+		{Name: "concurrent registration", Test: testConcurrentRegistration},
+		{Name: "login attempts", Test: testLoginAttempts},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			tt.Test(t, newBackend(t))
+		})
+	}
+}
+
+func createUser(t *testing.T, b Backend, email string, username string) int64 {
+	t.Helper()
+	id, err := b.Users.CreateUser(context.Background(), &create_user.UserCreate{
+		FirstName: "First",
+		LastName:  "Last",
+		Email:     email,
+		Username:  username,
+		Password:  "hash-" + email,
+	})
+	if err != nil {
+		t.Fatalf("CreateUser(%s) is failed. Error: %v", email, err)
+	}
+	return id
+}
+
+// createAdmin Создаёт первого администратора и возвращает его id
+func createAdmin(t *testing.T, b Backend) int64 {
+	t.Helper()
+	if err := b.Users.AddFirstAdmin(context.Background(), "Admin@Example.com", "admin-hash"); err != nil {
+		t.Fatal("AddFirstAdmin is failed. Error: ", err)
+	}
+	admin, err := b.Users.CheckAdminInDB(context.Background())
+	if err != nil {
+		t.Fatal("CheckAdminInDB is failed. Error: ", err)
+	}
+	return admin.ID
+}
+
+func testUsers(t *testing.T, b Backend) {
+	ctx := tenant.WithoutOrg(context.Background())
+	id := createUser(t, b, " Alice@Example.com ", "Alice")
+
+	user, err := b.Users.GetUser(ctx, "ALICE@example.com")
+	if err != nil {
+		t.Fatal("GetUser is failed. Error: ", err)
+	}
+	if user.ID != id || user.Email != "alice@example.com" || user.Username != "alice" || user.PasswordHash != "hash- Alice@Example.com " {
+		t.Errorf("Unexpected user %+v", user)
+	}
+	if user.OrgID != tenant.DefaultOrgID || !slices.Equal(user.Roles, []string{users_db.RoleUser}) || len(user.Permissions) != 0 {
+		t.Errorf("Expected role user in the default organization, got org %d, roles %v, permissions %v", user.OrgID, user.Roles, user.Permissions)
+	}
+	if user.Status != users_db.StatusActive || user.Metadata.User == nil || user.Metadata.Admin == nil || user.CreatedAt.IsZero() {
+		t.Errorf("Unexpected defaults %+v", user)
+	}
+	if byName, err := b.Users.GetUserByUsername(ctx, "ALICE"); err != nil || byName.ID != id {
+		t.Errorf("Expected user %d by username, got %+v, %v", id, byName, err)
+	}
+
+	for _, tt := range []struct {
+		TestName    string
+		Email       string
+		Username    string
+		ExpectedErr error
+	}{
+		{TestName: "email in another case", Email: "alice@EXAMPLE.com", ExpectedErr: users_db.ErrEmailAlreadyExists},
+		{TestName: "username in another case", Email: "bob@example.com", Username: "ALICE", ExpectedErr: users_db.ErrUsernameAlreadyExists},
+	} {
+		_, err = b.Users.CreateUser(ctx, &create_user.UserCreate{Email: tt.Email, Username: tt.Username, Password: "hash"})
+		if !errors.Is(err, tt.ExpectedErr) {
+			t.Errorf("%s: expected %v, got %v", tt.TestName, tt.ExpectedErr, err)
+		}
+	}
+	// Пользователи без имени не конфликтуют друг с другом
+	createUser(t, b, "bob@example.com", "")
+	createUser(t, b, "carol@example.com", "")
+
+	for _, tt := range []struct {
+		TestName string
+		Get      func() (users_db.UserInfo, error)
+	}{
+		{TestName: "unknown email", Get: func() (users_db.UserInfo, error) { return b.Users.GetUser(ctx, "nobody@example.com") }},
+		{TestName: "unknown username", Get: func() (users_db.UserInfo, error) { return b.Users.GetUserByUsername(ctx, "nobody") }},
+		{TestName: "unknown id", Get: func() (users_db.UserInfo, error) { return b.Users.GetUserByID(ctx, id+100) }},
+		{TestName: "another organization", Get: func() (users_db.UserInfo, error) { return b.Users.GetUserByID(tenant.WithOrgID(ctx, 999), id) }},
+		{TestName: "no organization", Get: func() (users_db.UserInfo, error) { return b.Users.GetUserByID(context.Background(), id) }},
+	} {
+		if _, err = tt.Get(); !errors.Is(err, users_db.ErrUserNotFound) {
+			t.Errorf("%s: expected ErrUserNotFound, got %v", tt.TestName, err)
+		}
+	}
+}
+
+func testFirstAdmin(t *testing.T, b Backend) {
+	ctx := tenant.WithoutOrg(context.Background())
+	if _, err := b.Users.CheckAdminInDB(ctx); !errors.Is(err, pgx.ErrNoRows) {
+		t.Fatalf("Expected pgx.ErrNoRows without admin, got %v", err)
+	}
+	adminID := createAdmin(t, b)
+	admin, err := b.Users.GetUserByID(ctx, adminID)
+	if err != nil {
+		t.Fatal("GetUserByID is failed. Error: ", err)
+	}
+	if admin.Email != "admin@example.com" || !admin.HasRole(users_db.RoleAdmin) || !slices.Contains(admin.Permissions, permissions.UsersWrite) {
+		t.Errorf("Unexpected admin %+v", admin)
+	}
+	if err = b.Users.AddFirstAdmin(ctx, "root@example.com", "admin-hash"); err == nil {
+		t.Error("Expected error for second first admin")
+	}
+
+	id := createUser(t, b, "alice@example.com", "")
+	for i := 0; i < 2; i++ {
+		if err = b.Users.SetAdminRole(ctx, id); err != nil {
+			t.Fatal("SetAdminRole is failed. Error: ", err)
+		}
+	}
+	user, err := b.Users.GetUserByID(ctx, id)
+	if err != nil {
+		t.Fatal("GetUserByID is failed. Error: ", err)
+	}
+	if !slices.Equal(user.Roles, []string{users_db.RoleAdmin, users_db.RoleUser}) || !slices.Contains(user.Permissions, permissions.UsersRead) {
+		t.Errorf("Expected admin and user roles, got %v, permissions %v", user.Roles, user.Permissions)
+	}
+	if err = b.Users.SetAdminRole(ctx, id+100); !errors.Is(err, users_db.ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound for unknown user, got %v", err)
+	}
+}
+
+func testPasswords(t *testing.T, b Backend) {
+	ctx := tenant.WithoutOrg(context.Background())
+	id := createUser(t, b, "alice@example.com", "")
+	for _, hash := range []string{"hash-2", "hash-3"} {
+		if err := b.Users.UpdatePassword(ctx, id, hash); err != nil {
+			t.Fatal("UpdatePassword is failed. Error: ", err)
+		}
+	}
+	history, err := b.Users.GetPasswordHistory(ctx, id, 2)
+	if err != nil {
+		t.Fatal("GetPasswordHistory is failed. Error: ", err)
+	}
+	if !slices.Equal(history, []string{"hash-3", "hash-2"}) {
+		t.Errorf("Expected newest hashes first, got %v", history)
+	}
+	if err = b.Users.UpdatePassword(ctx, id+100, "hash"); !errors.Is(err, users_db.ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound for unknown user, got %v", err)
+	}
+
+	// Перехеширование не затирает пароль, сменённый после проверки
+	if err = b.Users.RehashPassword(ctx, id, "hash-2", "rehashed"); !errors.Is(err, users_db.ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound for stale hash, got %v", err)
+	}
+	if err = b.Users.RehashPassword(ctx, id, "hash-3", "rehashed"); err != nil {
+		t.Fatal("RehashPassword is failed. Error: ", err)
+	}
+	user, err := b.Users.GetUserByID(ctx, id)
+	if err != nil || user.PasswordHash != "rehashed" {
+		t.Errorf("Expected rehashed password, got %q, %v", user.PasswordHash, err)
+	}
+	if history, _ = b.Users.GetPasswordHistory(ctx, id, 10); len(history) != 3 {
+		t.Errorf("Expected rehash to skip the history, got %v", history)
+	}
+}
+
+func testProfile(t *testing.T, b Backend) {
+	ctx := tenant.WithoutOrg(context.Background())
+	id := createUser(t, b, "alice@example.com", "alice")
+	createUser(t, b, "bob@example.com", "bob")
+	user, err := b.Users.GetUserByID(ctx, id)
+	if err != nil {
+		t.Fatal("GetUserByID is failed. Error: ", err)
+	}
+
+	// Версия профиля - updated_at, поэтому изменение должно попасть в другую микросекунду
+	time.Sleep(time.Millisecond)
+	firstName, username := "Alicia", "Ally"
+	updated, err := b.Users.UpdateProfile(ctx, id, users_db.ProfileUpdate{
+		FirstName:    &firstName,
+		Username:     &username,
+		UserMetadata: map[string]interface{}{"theme": "dark"},
+	}, &user.UpdatedAt)
+	if err != nil {
+		t.Fatal("UpdateProfile is failed. Error: ", err)
+	}
+	if updated.FirstName != "Alicia" || updated.LastName != "Last" || updated.Username != "ally" || updated.Metadata.User["theme"] != "dark" {
+		t.Errorf("Unexpected profile %+v", updated)
+	}
+
+	taken := "BOB"
+	for _, tt := range []struct {
+		TestName    string
+		ID          int64
+		Update      users_db.ProfileUpdate
+		Expected    *time.Time
+		ExpectedErr error
+	}{
+		{TestName: "stale version", ID: id, Expected: &user.UpdatedAt, ExpectedErr: users_db.ErrUserModified},
+		{TestName: "taken username", ID: id, Update: users_db.ProfileUpdate{Username: &taken}, ExpectedErr: users_db.ErrUsernameAlreadyExists},
+		{TestName: "unknown user", ID: id + 100, ExpectedErr: users_db.ErrUserNotFound},
+	} {
+		if _, err = b.Users.UpdateProfile(ctx, tt.ID, tt.Update, tt.Expected); !errors.Is(err, tt.ExpectedErr) {
+			t.Errorf("%s: expected %v, got %v", tt.TestName, tt.ExpectedErr, err)
+		}
+	}
+
+	empty := ""
+	if updated, err = b.Users.UpdateProfile(ctx, id, users_db.ProfileUpdate{Username: &empty}, nil); err != nil || updated.Username != "" {
+		t.Errorf("Expected username to be removed, got %q, %v", updated.Username, err)
+	}
+	updated, err = b.Users.SetMetadata(ctx, id, users_db.MetadataUpdate{Admin: map[string]interface{}{"level": 3}})
+	if err != nil {
+		t.Fatal("SetMetadata is failed. Error: ", err)
+	}
+	if updated.Metadata.Admin["level"] != float64(3) || updated.Metadata.User["theme"] != "dark" {
+		t.Errorf("Expected admin section replaced and user section kept, got %+v", updated.Metadata)
+	}
+	if _, err = b.Users.SetMetadata(ctx, id+100, users_db.MetadataUpdate{}); !errors.Is(err, users_db.ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound for unknown user, got %v", err)
+	}
+
+	if err = b.Users.DeleteUser(ctx, id, &user.UpdatedAt); !errors.Is(err, users_db.ErrUserModified) {
+		t.Errorf("Expected ErrUserModified for stale delete, got %v", err)
+	}
+	if err = b.Users.DeleteUser(ctx, id, nil); err != nil {
+		t.Fatal("DeleteUser is failed. Error: ", err)
+	}
+	if err = b.Users.DeleteUser(ctx, id, nil); !errors.Is(err, users_db.ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound for deleted user, got %v", err)
+	}
+	if _, err = b.Users.GetUser(ctx, "alice@example.com"); !errors.Is(err, users_db.ErrUserNotFound) {
+		t.Errorf("Expected deleted user to be gone, got %v", err)
+	}
+}
+
+func testPhone(t *testing.T, b Backend) {
+	ctx := tenant.WithoutOrg(context.Background())
+	alice := createUser(t, b, "alice@example.com", "")
+	bob := createUser(t, b, "bob@example.com", "")
+	const phone = "+79990000000"
+
+	if err := b.Users.SetPhone(ctx, alice, phone); err != nil {
+		t.Fatal("SetPhone is failed. Error: ", err)
+	}
+	if _, err := b.Users.GetUserByPhone(ctx, phone); !errors.Is(err, users_db.ErrUserNotFound) {
+		t.Errorf("Expected unverified phone to be ignored, got %v", err)
+	}
+	if err := b.Users.MarkPhoneVerified(ctx, alice, "+70000000000"); !errors.Is(err, users_db.ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound for another phone, got %v", err)
+	}
+	if err := b.Users.MarkPhoneVerified(ctx, alice, phone); err != nil {
+		t.Fatal("MarkPhoneVerified is failed. Error: ", err)
+	}
+	user, err := b.Users.GetUserByPhone(ctx, phone)
+	if err != nil || user.ID != alice || !user.PhoneVerified {
+		t.Errorf("Expected user %d by verified phone, got %+v, %v", alice, user, err)
+	}
+
+	if err = b.Users.SetPhone(ctx, bob, phone); err != nil {
+		t.Fatal("SetPhone is failed. Error: ", err)
+	}
+	if err = b.Users.MarkPhoneVerified(ctx, bob, phone); !errors.Is(err, users_db.ErrPhoneAlreadyExists) {
+		t.Errorf("Expected ErrPhoneAlreadyExists, got %v", err)
+	}
+}
+
+func testStatus(t *testing.T, b Backend) {
+	ctx := tenant.WithoutOrg(context.Background())
+	adminID := createAdmin(t, b)
+	id := createUser(t, b, "alice@example.com", "")
+	if err := b.Tokens.DbPutTokens(ctx, id, tenant.DefaultOrgID, "alice-token"); err != nil {
+		t.Fatal("DbPutTokens is failed. Error: ", err)
+	}
+
+	user, err := b.Users.SetStatus(ctx, id, users_db.StatusChange{Status: users_db.StatusSuspended, Reason: "spam"})
+	if err != nil {
+		t.Fatal("SetStatus is failed. Error: ", err)
+	}
+	if user.Status != users_db.StatusSuspended || user.StatusReason != "spam" {
+		t.Errorf("Expected suspended user, got %+v", user)
+	}
+	if _, err = b.Tokens.DbGetTokens(ctx, "alice-token"); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("Expected suspension to delete refresh tokens, got %v", err)
+	}
+
+	// Истёкшая блокировка снимается сама, истёкший активный статус отключает аккаунт
+	expired := time.Now().Add(-time.Minute)
+	for _, tt := range []struct {
+		Status   string
+		Expected string
+	}{
+		{Status: users_db.StatusSuspended, Expected: users_db.StatusActive},
+		{Status: users_db.StatusActive, Expected: users_db.StatusDeactivated},
+	} {
+		if _, err = b.Users.SetStatus(ctx, id, users_db.StatusChange{Status: tt.Status, ExpiresAt: &expired}); err != nil {
+			t.Fatal("SetStatus is failed. Error: ", err)
+		}
+		status, err := b.Users.GetUserStatus(ctx, id)
+		if err != nil || status != tt.Expected {
+			t.Errorf("Expected expired %s to read as %s, got %s, %v", tt.Status, tt.Expected, status, err)
+		}
+	}
+
+	for _, tt := range []struct {
+		TestName string
+		Run      func() error
+	}{
+		{TestName: "suspend", Run: func() error {
+			_, err := b.Users.SetStatus(ctx, adminID, users_db.StatusChange{Status: users_db.StatusSuspended})
+			return err
+		}},
+		{TestName: "delete", Run: func() error { return b.Users.DeleteUser(ctx, adminID, nil) }},
+	} {
+		if err = tt.Run(); !errors.Is(err, users_db.ErrLastAdmin) {
+			t.Errorf("%s last admin: expected ErrLastAdmin, got %v", tt.TestName, err)
+		}
+	}
+	if _, err = b.Users.GetUserStatus(ctx, id+100); !errors.Is(err, users_db.ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound for unknown user, got %v", err)
+	}
+	if _, err = b.Users.SetStatus(ctx, id+100, users_db.StatusChange{Status: users_db.StatusActive}); !errors.Is(err, users_db.ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound for unknown user, got %v", err)
+	}
+}
+
+func testTokens(t *testing.T, b Backend) {
+	ctx := tenant.WithoutOrg(context.Background())
+	id := createUser(t, b, "alice@example.com", "")
+	if _, err := b.Users.SetMetadata(ctx, id, users_db.MetadataUpdate{Admin: map[string]interface{}{"team": "core"}}); err != nil {
+		t.Fatal("SetMetadata is failed. Error: ", err)
+	}
+
+	if err := b.Tokens.DbPutTokens(ctx, id, tenant.DefaultOrgID, "token-1"); err != nil {
+		t.Fatal("DbPutTokens is failed. Error: ", err)
+	}
+	for _, tt := range []struct {
+		TestName string
+		UserID   int64
+		OrgID    int64
+		Token    string
+	}{
+		{TestName: "duplicate token", UserID: id, OrgID: tenant.DefaultOrgID, Token: "token-1"},
+		{TestName: "unknown user", UserID: id + 100, OrgID: tenant.DefaultOrgID, Token: "token-2"},
+		{TestName: "not a member", UserID: id, OrgID: 999, Token: "token-3"},
+	} {
+		if err := b.Tokens.DbPutTokens(ctx, tt.UserID, tt.OrgID, tt.Token); err == nil {
+			t.Errorf("%s: expected error", tt.TestName)
+		}
+	}
+
+	data, err := b.Tokens.DbGetTokens(ctx, "token-1")
+	if err != nil {
+		t.Fatal("DbGetTokens is failed. Error: ", err)
+	}
+	if data.UserId != id || data.OrgID != tenant.DefaultOrgID || !slices.Equal(data.UserRoles, []string{users_db.RoleUser}) ||
+		data.UserStatus != users_db.StatusActive || data.UserMetadata.Admin["team"] != "core" {
+		t.Errorf("Unexpected token data %+v", data)
+	}
+	if _, err = b.Tokens.DbGetTokens(tenant.WithOrgID(ctx, 999), "token-1"); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("Expected token of another organization to be hidden, got %v", err)
+	}
+	// Запрос без организации не видит ничего, пока не отвязан явно (tenant.WithoutOrg)
+	if _, err = b.Tokens.DbGetTokens(context.Background(), "token-1"); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("Expected token to be hidden from a request without organization, got %v", err)
+	}
+
+	if err = b.Tokens.DbUpdateTokens(ctx, id, "token-2", "token-1"); err != nil {
+		t.Fatal("DbUpdateTokens is failed. Error: ", err)
+	}
+	if _, err = b.Tokens.DbGetTokens(ctx, "token-1"); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("Expected old token to be replaced, got %v", err)
+	}
+	if err = b.Tokens.DbUpdateTokens(ctx, id+100, "token-3", "token-2"); err != nil {
+		t.Errorf("Expected update of another user's token to be ignored, got %v", err)
+	}
+	if data, err = b.Tokens.DbGetTokens(ctx, "token-2"); err != nil || data.UserId != id {
+		t.Errorf("Expected new token to belong to user %d, got %+v, %v", id, data, err)
+	}
+
+	if err = b.Tokens.DbDeleteToken(ctx, "token-2"); err != nil {
+		t.Fatal("DbDeleteToken is failed. Error: ", err)
+	}
+	if _, err = b.Tokens.DbGetTokens(ctx, "token-2"); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("Expected deleted token to be gone, got %v", err)
+	}
+	if err = b.Tokens.DbDeleteToken(ctx, "token-2"); err != nil {
+		t.Errorf("Expected repeated delete to succeed, got %v", err)
+	}
+
+	// Удаление пользователя удаляет его токены
+	if err = b.Tokens.DbPutTokens(ctx, id, tenant.DefaultOrgID, "token-4"); err != nil {
+		t.Fatal("DbPutTokens is failed. Error: ", err)
+	}
+	if err = b.Users.DeleteUser(ctx, id, nil); err != nil {
+		t.Fatal("DeleteUser is failed. Error: ", err)
+	}
+	if _, err = b.Tokens.DbGetTokens(ctx, "token-4"); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("Expected tokens of deleted user to be gone, got %v", err)
+	}
+}
+
+func testListUsers(t *testing.T, b Backend) {
+	ctx := tenant.WithoutOrg(context.Background())
+	ids := make(map[string]int64)
+	for _, email := range []string{"carol@example.com", "alice@example.com", "dave@example.com", "bob@example.com"} {
+		ids[email] = createUser(t, b, email, "")
+	}
+	if err := b.Users.SetAdminRole(ctx, ids["dave@example.com"]); err != nil {
+		t.Fatal("SetAdminRole is failed. Error: ", err)
+	}
+	if _, err := b.Users.SetStatus(ctx, ids["bob@example.com"], users_db.StatusChange{Status: users_db.StatusSuspended}); err != nil {
+		t.Fatal("SetStatus is failed. Error: ", err)
+	}
+	if _, err := b.Users.SetMetadata(ctx, ids["carol@example.com"], users_db.MetadataUpdate{
+		User: map[string]interface{}{"tags": []interface{}{"a", "b"}, "team": "core"},
+	}); err != nil {
+		t.Fatal("SetMetadata is failed. Error: ", err)
+	}
+
+	emails := func(users []users_db.UserInfo) []string {
+		result := make([]string, 0, len(users))
+		for _, user := range users {
+			result = append(result, user.Email)
+		}
+		return result
+	}
+	otherOrg := tenant.WithOrgID(ctx, 999)
+	for _, tt := range []struct {
+		TestName string
+		Ctx      context.Context
+		Filter   users_db.ListUsersFilter
+		Expected []string
+	}{
+		{TestName: "by creation", Filter: users_db.ListUsersFilter{}, Expected: []string{"carol@example.com", "alice@example.com", "dave@example.com", "bob@example.com"}},
+		{TestName: "by email desc", Filter: users_db.ListUsersFilter{SortBy: users_db.SortByEmail, Desc: true}, Expected: []string{"dave@example.com", "carol@example.com", "bob@example.com", "alice@example.com"}},
+		{TestName: "search", Filter: users_db.ListUsersFilter{Search: "AL", SortBy: users_db.SortByEmail}, Expected: []string{"alice@example.com"}},
+		{TestName: "literal search", Filter: users_db.ListUsersFilter{Search: "_"}, Expected: []string{}},
+		{TestName: "role", Filter: users_db.ListUsersFilter{Role: users_db.RoleAdmin}, Expected: []string{"dave@example.com"}},
+		{TestName: "status", Filter: users_db.ListUsersFilter{Status: users_db.StatusSuspended}, Expected: []string{"bob@example.com"}},
+		{TestName: "metadata", Filter: users_db.ListUsersFilter{Metadata: users_db.MetadataFilter{"user": {"tags": []interface{}{"b"}}}}, Expected: []string{"carol@example.com"}},
+		{TestName: "metadata mismatch", Filter: users_db.ListUsersFilter{Metadata: users_db.MetadataFilter{"user": {"team": "ops"}}}, Expected: []string{}},
+		{TestName: "another organization", Ctx: otherOrg, Filter: users_db.ListUsersFilter{}, Expected: []string{}},
+	} {
+		listCtx := ctx
+		if tt.Ctx != nil {
+			listCtx = tt.Ctx
+		}
+		filter := tt.Filter
+		filter.Limit = 10
+		users, err := b.Users.ListUsers(listCtx, filter)
+		if err != nil {
+			t.Fatalf("%s: ListUsers is failed. Error: %v", tt.TestName, err)
+		}
+		if got := emails(users); !slices.Equal(got, tt.Expected) {
+			t.Errorf("%s: expected %v, got %v", tt.TestName, tt.Expected, got)
+		}
+	}
+
+	// Страницы по курсору идут без пропусков и повторов
+	for _, tt := range []struct {
+		SortBy   string
+		Expected []string
+	}{
+		{SortBy: users_db.SortByEmail, Expected: []string{"alice@example.com", "bob@example.com", "carol@example.com", "dave@example.com"}},
+		{SortBy: users_db.SortByCreatedAt, Expected: []string{"carol@example.com", "alice@example.com", "dave@example.com", "bob@example.com"}},
+	} {
+		filter := users_db.ListUsersFilter{SortBy: tt.SortBy, Limit: 3}
+		first, err := b.Users.ListUsers(ctx, filter)
+		if err != nil || len(first) != 3 {
+			t.Fatalf("Expected first page of 3 users by %s, got %v, %v", tt.SortBy, emails(first), err)
+		}
+		cursor := users_db.CursorFor(first[len(first)-1], tt.SortBy)
+		filter.After = &cursor
+		second, err := b.Users.ListUsers(ctx, filter)
+		if err != nil {
+			t.Fatal("ListUsers is failed. Error: ", err)
+		}
+		if got := append(emails(first), emails(second)...); !slices.Equal(got, tt.Expected) {
+			t.Errorf("Expected pages by %s to be %v, got %v", tt.SortBy, tt.Expected, got)
+		}
+	}
+	if _, err := b.Users.ListUsers(ctx, users_db.ListUsersFilter{SortBy: "password", Limit: 10}); !errors.Is(err, users_db.ErrInvalidSort) {
+		t.Errorf("Expected ErrInvalidSort, got %v", err)
+	}
+}
+
+func testEmailChange(t *testing.T, b Backend) {
+	ctx := tenant.WithoutOrg(context.Background())
+	id := createUser(t, b, "alice@example.com", "")
+	createUser(t, b, "bob@example.com", "")
+	for _, refreshToken := range []string{"current", "other"} {
+		if err := b.Tokens.DbPutTokens(ctx, id, tenant.DefaultOrgID, refreshToken); err != nil {
+			t.Fatal("DbPutTokens is failed. Error: ", err)
+		}
+	}
+	request := users_db.EmailChange{
+		UserID:          id,
+		NewEmail:        "New@Example.com",
+		ExpiresAt:       time.Now().Add(time.Hour),
+		CancelExpiresAt: time.Now().Add(24 * time.Hour),
+	}
+
+	// Занятый адрес не выдаётся при запросе, смена отклоняется при подтверждении
+	taken := request
+	taken.NewEmail = "BOB@example.com"
+	if _, err := b.Users.CreateEmailChange(ctx, taken, "taken-confirm", "taken-cancel"); err != nil {
+		t.Fatal("CreateEmailChange is failed. Error: ", err)
+	}
+	if _, err := b.Users.ConfirmEmailChange(ctx, "taken-confirm", ""); !errors.Is(err, users_db.ErrEmailAlreadyExists) {
+		t.Errorf("Expected ErrEmailAlreadyExists for taken email, got %v", err)
+	}
+	unknown := request
+	unknown.UserID = id + 100
+	if _, err := b.Users.CreateEmailChange(ctx, unknown, "unknown-confirm", "unknown-cancel"); !errors.Is(err, users_db.ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound for unknown user, got %v", err)
+	}
+
+	// Новая заявка отменяет предыдущую
+	if _, err := b.Users.CreateEmailChange(ctx, request, "old-confirm", "old-cancel"); err != nil {
+		t.Fatal("CreateEmailChange is failed. Error: ", err)
+	}
+	change, err := b.Users.CreateEmailChange(ctx, request, "confirm", "cancel")
+	if err != nil {
+		t.Fatal("CreateEmailChange is failed. Error: ", err)
+	}
+	if change.OldEmail != "alice@example.com" || change.NewEmail != "new@example.com" || change.UserID != id {
+		t.Errorf("Unexpected email change %+v", change)
+	}
+	if _, err = b.Users.ConfirmEmailChange(ctx, "old-confirm", ""); !errors.Is(err, users_db.ErrEmailChangeNotFound) {
+		t.Errorf("Expected replaced request to be cancelled, got %v", err)
+	}
+
+	if change, err = b.Users.ConfirmEmailChange(ctx, "confirm", "current"); err != nil {
+		t.Fatal("ConfirmEmailChange is failed. Error: ", err)
+	}
+	if change.ConfirmedAt == nil {
+		t.Errorf("Expected confirmed change, got %+v", change)
+	}
+	if _, err = b.Users.GetUser(ctx, "new@example.com"); err != nil {
+		t.Errorf("Expected user by new email, got %v", err)
+	}
+	if _, err = b.Tokens.DbGetTokens(ctx, "current"); err != nil {
+		t.Errorf("Expected current session to stay, got %v", err)
+	}
+	if _, err = b.Tokens.DbGetTokens(ctx, "other"); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("Expected other sessions to be revoked, got %v", err)
+	}
+	if _, err = b.Users.ConfirmEmailChange(ctx, "confirm", ""); !errors.Is(err, users_db.ErrEmailChangeNotFound) {
+		t.Errorf("Expected confirmation link to be single use, got %v", err)
+	}
+
+	// Отмена со старого адреса возвращает его и завершает все сессии
+	if change, err = b.Users.CancelEmailChange(ctx, "cancel"); err != nil {
+		t.Fatal("CancelEmailChange is failed. Error: ", err)
+	}
+	if change.CancelledAt == nil {
+		t.Errorf("Expected cancelled change, got %+v", change)
+	}
+	if user, err := b.Users.GetUserByID(ctx, id); err != nil || user.Email != "alice@example.com" {
+		t.Errorf("Expected old email after cancellation, got %q, %v", user.Email, err)
+	}
+	if _, err = b.Tokens.DbGetTokens(ctx, "current"); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("Expected all sessions to be revoked, got %v", err)
+	}
+	if _, err = b.Users.CancelEmailChange(ctx, "cancel"); !errors.Is(err, users_db.ErrEmailChangeNotFound) {
+		t.Errorf("Expected cancel link to be single use, got %v", err)
+	}
+}
+
+// Параллельные регистрации с одним email: успешна ровно одна, остальные получают ErrEmailAlreadyExists
+func testConcurrentRegistration(t *testing.T, b Backend) {
+	const attempts = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, attempts)
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := b.Users.CreateUser(context.Background(), &create_user.UserCreate{Email: "Race@Example.com", Password: "hash"})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	created := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			created++
+		case !errors.Is(err, users_db.ErrEmailAlreadyExists):
+			t.Errorf("Expected ErrEmailAlreadyExists, got %v", err)
+		}
+	}
+	if created != 1 {
+		t.Errorf("Expected exactly one registration, got %d", created)
+	}
+}
+
+func testLoginAttempts(t *testing.T, b Backend) {
+	ctx := context.Background()
+	attempt, err := b.LoginAttempts.GetAttempt(ctx, login_attempts_db.ScopeAccount, "alice@example.com")
+	if err != nil {
+		t.Fatal("GetAttempt is failed. Error: ", err)
+	}
+	if attempt.FailedCount != 0 || attempt.LockedUntil != nil {
+		t.Errorf("Expected no attempts, got %+v", attempt)
+	}
+
+	// Третья попытка блокирует ключ на час
+	lockFor := func(count int) time.Duration {
+		if count >= 3 {
+			return time.Hour
+		}
+		return 0
+	}
+	for expected := 1; expected <= 3; expected++ {
+		reservation, err := b.LoginAttempts.ReserveAttempt(ctx, login_attempts_db.ScopeAccount, "alice@example.com", time.Hour, lockFor)
+		if err != nil {
+			t.Fatal("ReserveAttempt is failed. Error: ", err)
+		}
+		if !reservation.Reserved || reservation.FailedCount != expected {
+			t.Errorf("Expected reserved attempt %d, got %+v", expected, reservation)
+		}
+		if (reservation.LockedUntil != nil) != (expected == 3) {
+			t.Errorf("Expected lock only on third attempt, got %+v", reservation)
+		}
+	}
+	reservation, err := b.LoginAttempts.ReserveAttempt(ctx, login_attempts_db.ScopeAccount, "alice@example.com", time.Hour, lockFor)
+	if err != nil {
+		t.Fatal("ReserveAttempt is failed. Error: ", err)
+	}
+	if reservation.Reserved || reservation.FailedCount != 3 || reservation.LockedUntil == nil {
+		t.Errorf("Expected locked key to reject attempt without counting it, got %+v", reservation)
+	}
+	attempt, err = b.LoginAttempts.GetAttempt(ctx, login_attempts_db.ScopeAccount, "alice@example.com")
+	if err != nil {
+		t.Fatal("GetAttempt is failed. Error: ", err)
+	}
+	if attempt.FailedCount != 3 || attempt.LockedUntil == nil || attempt.LockedUntil.Before(time.Now().Add(59*time.Minute)) {
+		t.Errorf("Expected 3 attempts locked for an hour, got %+v", attempt)
+	}
+
+	// Счётчики разных областей не пересекаются, возвращённая попытка не считается
+	noLock := func(int) time.Duration { return 0 }
+	for i := 0; i < 2; i++ {
+		if _, err = b.LoginAttempts.ReserveAttempt(ctx, login_attempts_db.ScopeIP, "alice@example.com", time.Hour, noLock); err != nil {
+			t.Fatal("ReserveAttempt is failed. Error: ", err)
+		}
+	}
+	if err = b.LoginAttempts.ReleaseAttempt(ctx, login_attempts_db.ScopeIP, "alice@example.com"); err != nil {
+		t.Fatal("ReleaseAttempt is failed. Error: ", err)
+	}
+	attempt, err = b.LoginAttempts.GetAttempt(ctx, login_attempts_db.ScopeIP, "alice@example.com")
+	if err != nil {
+		t.Fatal("GetAttempt is failed. Error: ", err)
+	}
+	if attempt.FailedCount != 1 || attempt.LockedUntil != nil {
+		t.Errorf("Expected one attempt for ip scope, got %+v", attempt)
+	}
+
+	// Попытки старше окна не считаются
+	time.Sleep(10 * time.Millisecond)
+	reservation, err = b.LoginAttempts.ReserveAttempt(ctx, login_attempts_db.ScopeIP, "alice@example.com", time.Millisecond, noLock)
+	if err != nil {
+		t.Fatal("ReserveAttempt is failed. Error: ", err)
+	}
+	if reservation.FailedCount != 1 {
+		t.Errorf("Expected counter to restart after window, got %+v", reservation)
+	}
+
+	if err = b.LoginAttempts.Reset(ctx, login_attempts_db.ScopeAccount, "alice@example.com"); err != nil {
+		t.Fatal("Reset is failed. Error: ", err)
+	}
+	attempt, err = b.LoginAttempts.GetAttempt(ctx, login_attempts_db.ScopeAccount, "alice@example.com")
+	if err != nil {
+		t.Fatal("GetAttempt is failed. Error: ", err)
+	}
+	if attempt.FailedCount != 0 || attempt.LockedUntil != nil {
+		t.Errorf("Expected reset attempts, got %+v", attempt)
+	}
+
+	// Параллельные попытки получают разные значения счётчика, после блокировки не проходит ни одна
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	reserved := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reservation, err := b.LoginAttempts.ReserveAttempt(ctx, login_attempts_db.ScopeAccount, "bob@example.com", time.Hour, lockFor)
+			if err != nil {
+				t.Error("ReserveAttempt is failed. Error: ", err)
+				return
+			}
+			if reservation.Reserved {
+				mu.Lock()
+				reserved++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if reserved != 3 {
+		t.Errorf("Expected exactly 3 concurrent attempts before lock, got %d", reserved)
+	}
+}
@@ -11,6 +11,8 @@ type Metrics struct {
 	PgxPoolMaxConns     prometheus.Gauge
 	PgxPoolUsedConns    prometheus.Gauge
 	PgxPoolIdleConns    prometheus.Gauge
+	LoginAttemptsTotal  *prometheus.CounterVec
+	LoginLockoutsTotal  *prometheus.CounterVec
 }
 
 // NewMetrics Создаёт экземпляры метрик из структуры
@@ -48,6 +50,20 @@ func NewMetrics() *Metrics {
 				Help: "Currently idle connections in the pool",
 			},
 		),
+		LoginAttemptsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "login_attempts_total",
+				Help: "Total number of login attempts by result",
+			},
+			[]string{"result"},
+		),
+		LoginLockoutsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "login_lockouts_total",
+				Help: "Total number of temporary login lockouts by scope (account or ip)",
+			},
+			[]string{"scope"},
+		),
 	}
 }
 
@@ -60,6 +76,8 @@ func InitMetrics() *Metrics {
 		metrics.PgxPoolMaxConns,
 		metrics.PgxPoolUsedConns,
 		metrics.PgxPoolIdleConns,
+		metrics.LoginAttemptsTotal,
+		metrics.LoginLockoutsTotal,
 	)
 	return metrics
 
@@ -0,0 +1,14 @@
+package audit
+
+import "time"
+
+type EventResponse struct {
+	ID           int64                  `json:"id"`
+	ActorID      *int64                 `json:"actor_id,omitempty"`
+	Action       string                 `json:"action"`
+	TargetUserID *int64                 `json:"target_user_id,omitempty"`
+	Reason       string                 `json:"reason,omitempty"`
+	IP           string                 `json:"ip,omitempty"`
+	Details      map[string]interface{} `json:"details,omitempty"`
+	CreatedAt    time.Time              `json:"created_at"`
+}
@@ -0,0 +1,32 @@
+package authz
+
+import "github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/policy"
+
+// CheckSubject Субъект проверки. Если указан user_id, атрибуты пользователя (роли, права, статус, email...) берутся из БД
+// и важнее переданных. Без субъекта проверяется сам вызывающий по своему токену
+type CheckSubject struct {
+	UserID     *int64                 `json:"user_id"`
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+type CheckResource struct {
+	Type       string                 `json:"type" validate:"required"`
+	ID         string                 `json:"id"`
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+// CheckRequest "Может ли субъект выполнить действие над ресурсом"
+type CheckRequest struct {
+	Subject  *CheckSubject          `json:"subject"`
+	Action   string                 `json:"action" validate:"required"`
+	Resource CheckResource          `json:"resource"`
+	Context  map[string]interface{} `json:"context"`
+	Explain  bool                   `json:"explain"` // Вернуть разбор всех правил
+}
+
+type CheckResponse struct {
+	Allowed     bool                    `json:"allowed"`
+	Decision    string                  `json:"decision"`
+	RuleID      string                  `json:"rule_id,omitempty"`
+	Evaluations []policy.RuleEvaluation `json:"evaluations,omitempty"`
+}
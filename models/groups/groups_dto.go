@@ -0,0 +1,35 @@
+package groups
+
+import "time"
+
+type GroupResponse struct {
+	ID           int64     `json:"id"`
+	Name         string    `json:"name"`
+	Description  string    `json:"description"`
+	Roles        []string  `json:"roles"`
+	Permissions  []string  `json:"permissions"` // Права, выданные группе напрямую
+	MembersCount int       `json:"members_count"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type CreateGroupRequest struct {
+	Name        string `json:"name" validate:"required,min=2,max=64"`
+	Description string `json:"description" validate:"max=256"`
+}
+
+type UpdateGroupRequest struct {
+	Name        *string `json:"name" validate:"omitempty,min=2,max=64"`
+	Description *string `json:"description" validate:"omitempty,max=256"`
+}
+
+type AddGroupMemberRequest struct {
+	UserID int64 `json:"user_id" validate:"required"`
+}
+
+type GroupMemberResponse struct {
+	UserID    int64     `json:"user_id"`
+	Email     string    `json:"email"`
+	FirstName string    `json:"first_name"`
+	LastName  string    `json:"last_name"`
+	AddedAt   time.Time `json:"added_at"`
+}
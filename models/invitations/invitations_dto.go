@@ -0,0 +1,31 @@
+package invitations
+
+import "time"
+
+type CreateInvitationRequest struct {
+	Email     string     `json:"email" validate:"required,email"`
+	Roles     []string   `json:"roles" validate:"max=20,dive,required"` // Роли сверх user. Выдача ролей требует права roles:write
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`                  // Пусто - срок действия из INVITATION_TTL
+}
+
+type InvitationResponse struct {
+	ID         int64      `json:"id"`
+	Email      string     `json:"email"`
+	Roles      []string   `json:"roles"`
+	InvitedBy  *int64     `json:"invited_by,omitempty"`
+	Status     string     `json:"status"` // pending, accepted, revoked или expired
+	ExpiresAt  time.Time  `json:"expires_at"`
+	AcceptedAt *time.Time `json:"accepted_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type AcceptInvitationRequest struct {
+	Token     string `json:"token" validate:"required,min=3"`
+	FirstName string `json:"first_name" validate:"max=64"`
+	LastName  string `json:"last_name" validate:"max=64"`
+	Password  string `json:"password" validate:"required"`
+}
+
+type JoinInvitationRequest struct {
+	Token string `json:"token" validate:"required,min=3"`
+}
@@ -0,0 +1,21 @@
+package orgs
+
+import "time"
+
+type OrganizationResponse struct {
+	ID        int64     `json:"id"`
+	Slug      string    `json:"slug"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	Current   bool      `json:"current"` // Организация, в которую выдан текущий токен
+}
+
+type CreateOrganizationRequest struct {
+	Slug    string `json:"slug" validate:"required,min=2,max=64"`
+	Name    string `json:"name" validate:"required,max=128"`
+	OwnerID int64  `json:"owner_id" validate:"required"` // Пользователь, который станет администратором организации
+}
+
+type SwitchOrganizationRequest struct {
+	OrgID int64 `json:"org_id" validate:"required"`
+}
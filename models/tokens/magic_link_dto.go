@@ -0,0 +1,9 @@
+package tokens
+
+type MagicLinkRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type MagicLinkConsumeRequest struct {
+	Token string `json:"token" validate:"required,min=3"`
+}
@@ -0,0 +1,11 @@
+package tokens
+
+// OTPRequest Запрос кода для входа. Номер в формате E.164, например +79991234567
+type OTPRequest struct {
+	Phone string `json:"phone" validate:"required,e164"`
+}
+
+type OTPVerifyRequest struct {
+	Phone string `json:"phone" validate:"required,e164"`
+	Code  string `json:"code" validate:"required,numeric,len=6"`
+}
@@ -3,4 +3,6 @@ package tokens
 type RefreshTokensDto struct {
 	AccessToken  string `json:"access_token" validate:"required,min=3"`
 	RefreshToken string `json:"refresh_token" validate:"required,min=3"`
+	// PasswordResetRequired Пароля у пользователя нет (импорт без паролей): его нужно задать через PUT /user/password
+	PasswordResetRequired bool `json:"password_reset_required,omitempty"`
 }
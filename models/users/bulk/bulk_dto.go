@@ -0,0 +1,18 @@
+package bulk
+
+// ImportReportResponse Итог импорта. При dry_run imported - сколько строк загрузилось бы
+type ImportReportResponse struct {
+	DryRun          bool                     `json:"dry_run"`
+	Total           int                      `json:"total"`
+	Imported        int                      `json:"imported"`
+	Failed          int                      `json:"failed"`
+	Errors          []ImportRowErrorResponse `json:"errors"`
+	ErrorsTruncated bool                     `json:"errors_truncated,omitempty"`
+}
+
+// ImportRowErrorResponse Ошибка в строке файла. line - номер строки, считая заголовок CSV
+type ImportRowErrorResponse struct {
+	Line  int    `json:"line"`
+	Email string `json:"email,omitempty"`
+	Error string `json:"error"`
+}
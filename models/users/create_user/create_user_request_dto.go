@@ -4,5 +4,6 @@ type UserCreate struct {
 	FirstName string `json:"first_name"`
 	LastName  string `json:"last_name"`
 	Email     string `json:"email" validate:"required,email"`
-	Password  string `json:"password"  validate:"required,min=3,max=64"`
+	Username  string `json:"username,omitempty" validate:"omitempty,username"` // Необязательное имя для входа вместо email
+	Password  string `json:"password"  validate:"required"`
 }
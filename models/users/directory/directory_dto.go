@@ -0,0 +1,39 @@
+package directory
+
+import "time"
+
+// UserResponse Пользователь в административном справочнике
+type UserResponse struct {
+	ID              int64      `json:"id"`
+	FirstName       string     `json:"first_name"`
+	LastName        string     `json:"last_name"`
+	Email           string     `json:"email"`
+	Username        string     `json:"username,omitempty"`
+	Roles           []string   `json:"roles"`
+	Status          string     `json:"status"`
+	StatusReason    string     `json:"status_reason,omitempty"`
+	StatusExpiresAt *time.Time `json:"status_expires_at,omitempty"`
+	Phone           string     `json:"phone,omitempty"`
+	PhoneVerified   bool       `json:"phone_verified"`
+	Metadata        Metadata   `json:"metadata"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// Metadata Дополнительные атрибуты пользователя по секциям
+type Metadata struct {
+	User  map[string]interface{} `json:"user"`
+	Admin map[string]interface{} `json:"admin"`
+}
+
+// SetMetadataRequest Новые секции атрибутов. Переданная секция заменяется целиком, не переданная не меняется
+type SetMetadataRequest struct {
+	User  map[string]interface{} `json:"user"`
+	Admin map[string]interface{} `json:"admin"`
+}
+
+// ListUsersResponse Страница списка пользователей. NextCursor пустой на последней странице
+type ListUsersResponse struct {
+	Users      []UserResponse `json:"users"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
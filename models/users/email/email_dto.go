@@ -0,0 +1,18 @@
+package email
+
+// ChangeEmailRequest Новый адрес и текущий пароль для подтверждения, что смену запросил владелец аккаунта
+type ChangeEmailRequest struct {
+	NewEmail string `json:"new_email" validate:"required,email,max=256"`
+	Password string `json:"password" validate:"required"`
+}
+
+// ConfirmEmailChangeRequest Токен из ссылки в письме на новый адрес. RefreshToken - сессия, которую не нужно завершать
+type ConfirmEmailChangeRequest struct {
+	Token        string `json:"token" validate:"required,min=3"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+// CancelEmailChangeRequest Токен из ссылки в письме на старый адрес
+type CancelEmailChangeRequest struct {
+	Token string `json:"token" validate:"required,min=3"`
+}
@@ -1,6 +1,17 @@
 package get_user
 
+// AuthUser Вход по email или по имени пользователя: нужно одно из двух
 type AuthUser struct {
-	Email    string `json:"email" validate:"required,email"`
+	Email    string `json:"email,omitempty" validate:"required_without=Username,omitempty,email"`
+	Username string `json:"username,omitempty" validate:"required_without=Email,omitempty,username"`
 	Password string `json:"password" validate:"required,min=3,max=64"`
+	OrgID    *int64 `json:"org_id,omitempty"` // Организация для входа. Не указана - первая организация пользователя
+}
+
+// Login Идентификатор, по которому выполняется вход
+func (u AuthUser) Login() string {
+	if u.Email != "" {
+		return u.Email
+	}
+	return u.Username
 }
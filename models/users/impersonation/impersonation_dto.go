@@ -0,0 +1,14 @@
+package impersonation
+
+import "time"
+
+type ImpersonateRequest struct {
+	Reason string `json:"reason" validate:"required,max=512"` // Зачем нужен вход: попадает в журнал
+}
+
+// ImpersonationResponse Access токен пользователя. Refresh токена нет: по истечении нужно запросить новый
+type ImpersonationResponse struct {
+	AccessToken string    `json:"access_token"`
+	UserID      int64     `json:"user_id"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
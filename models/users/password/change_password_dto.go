@@ -0,0 +1,7 @@
+package password
+
+// ChangePasswordRequest Старый пароль не нужен, если пароль требуется задать при первом входе (пользователь из импорта)
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password" validate:"required"`
+}
@@ -0,0 +1,12 @@
+package password
+
+import (
+	resp "github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/api/response"
+	"github.com/ShlykovPavel/auth-JWT-microservice/internal/lib/password_policy"
+)
+
+// PasswordPolicyErrorResponse Ответ с перечнем нарушенных правил политики паролей
+type PasswordPolicyErrorResponse struct {
+	resp.Response
+	Violations []password_policy.Violation `json:"violations"`
+}
@@ -0,0 +1,10 @@
+package phone
+
+// SetPhoneRequest Новый номер телефона в формате E.164, например +79991234567
+type SetPhoneRequest struct {
+	Phone string `json:"phone" validate:"required,e164"`
+}
+
+type VerifyPhoneRequest struct {
+	Code string `json:"code" validate:"required,numeric,len=6"`
+}
@@ -0,0 +1,61 @@
+package privacy
+
+import (
+	"github.com/ShlykovPavel/auth-JWT-microservice/models/audit"
+	"time"
+)
+
+// ExportResponse Все персональные данные пользователя
+type ExportResponse struct {
+	ExportedAt      time.Time             `json:"exported_at"`
+	Profile         ExportProfile         `json:"profile"`
+	Erasure         *ErasureResponse      `json:"erasure,omitempty"`
+	Organizations   []ExportMembership    `json:"organizations"`
+	Sessions        []ExportSession       `json:"sessions"`
+	PasswordChanges []time.Time           `json:"password_changes"`
+	AuditEvents     []audit.EventResponse `json:"audit_events"`
+}
+
+type ExportProfile struct {
+	ID              int64      `json:"id"`
+	FirstName       string     `json:"first_name"`
+	LastName        string     `json:"last_name"`
+	Email           string     `json:"email"`
+	Username        string     `json:"username,omitempty"`
+	Phone           string     `json:"phone,omitempty"`
+	PhoneVerified   bool       `json:"phone_verified"`
+	Status          string     `json:"status"`
+	StatusReason    string     `json:"status_reason,omitempty"`
+	StatusExpiresAt *time.Time `json:"status_expires_at,omitempty"`
+	// Metadata Дополнительные атрибуты пользователя по секциям user и admin
+	Metadata  map[string]map[string]interface{} `json:"metadata"`
+	CreatedAt time.Time                         `json:"created_at"`
+	UpdatedAt time.Time                         `json:"updated_at"`
+}
+
+type ExportMembership struct {
+	OrgID    int64     `json:"org_id"`
+	OrgSlug  string    `json:"org_slug"`
+	OrgName  string    `json:"org_name"`
+	JoinedAt time.Time `json:"joined_at"`
+	Roles    []string  `json:"roles"`
+	Groups   []string  `json:"groups"`
+}
+
+// ExportSession Refresh токен без самого значения токена
+type ExportSession struct {
+	ID        int64     `json:"id"`
+	OrgID     int64     `json:"org_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ErasureResponse Запрос на удаление данных. До due_at его можно отменить
+type ErasureResponse struct {
+	RequestedAt *time.Time `json:"requested_at,omitempty"`
+	DueAt       *time.Time `json:"due_at,omitempty"`
+}
+
+type EraseUserRequest struct {
+	Reason string `json:"reason" validate:"required,max=512"`
+}
@@ -0,0 +1,44 @@
+package profile
+
+import "time"
+
+// ProfileResponse Профиль текущего пользователя
+type ProfileResponse struct {
+	ID            int64    `json:"id"`
+	FirstName     string   `json:"first_name"`
+	LastName      string   `json:"last_name"`
+	Email         string   `json:"email"`
+	Username      string   `json:"username,omitempty"`
+	OrgID         int64    `json:"org_id"`
+	Roles         []string `json:"roles"` // Роли в организации org_id
+	Phone         string   `json:"phone,omitempty"`
+	PhoneVerified bool     `json:"phone_verified"`
+	// PasswordResetRequired Пароль нужно задать через PUT /user/password, старый пароль не спрашивается
+	PasswordResetRequired bool `json:"password_reset_required"`
+	// Metadata Дополнительные атрибуты. Секцию admin пользователь видит, но изменить не может
+	Metadata  MetadataResponse `json:"metadata"`
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+// MetadataResponse Дополнительные атрибуты пользователя по секциям
+type MetadataResponse struct {
+	User  map[string]interface{} `json:"user"`
+	Admin map[string]interface{} `json:"admin"`
+}
+
+// UpdateProfileRequest Частичное обновление профиля. Не переданные поля не меняются.
+// UpdatedAt - значение из последнего GET, альтернатива заголовку If-Match
+type UpdateProfileRequest struct {
+	FirstName *string                `json:"first_name" validate:"omitempty,min=1,max=64"`
+	LastName  *string                `json:"last_name" validate:"omitempty,min=1,max=64"`
+	Username  *string                `json:"username" validate:"omitempty,username"` // Пустая строка убирает имя пользователя
+	Metadata  *UpdateMetadataRequest `json:"metadata"`
+	UpdatedAt *time.Time             `json:"updated_at"`
+}
+
+// UpdateMetadataRequest Новая секция user целиком. Секцию admin меняют только администраторы
+type UpdateMetadataRequest struct {
+	User  map[string]interface{} `json:"user"`
+	Admin map[string]interface{} `json:"admin" swaggerignore:"true"`
+}
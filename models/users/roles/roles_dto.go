@@ -0,0 +1,43 @@
+package roles
+
+import "time"
+
+type RoleResponse struct {
+	ID          int64     `json:"id"`
+	OrgID       *int64    `json:"org_id,omitempty"` // Пусто - встроенная роль, общая для всех организаций
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type CreateRoleRequest struct {
+	Name        string `json:"name" validate:"required,min=2,max=64"`
+	Description string `json:"description" validate:"max=256"`
+}
+
+type GrantRoleRequest struct {
+	Role string `json:"role" validate:"required"`
+}
+
+type PermissionResponse struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type GrantPermissionRequest struct {
+	Permission string `json:"permission" validate:"required"`
+}
+
+// PermissionSourceResponse Источник права: роль пользователя, роль группы или право, выданное группе напрямую
+type PermissionSourceResponse struct {
+	Type      string `json:"type"` // role, group_role или group
+	Role      string `json:"role,omitempty"`
+	GroupID   *int64 `json:"group_id,omitempty"`
+	GroupName string `json:"group_name,omitempty"`
+}
+
+type EffectivePermissionResponse struct {
+	Permission string                     `json:"permission"`
+	Sources    []PermissionSourceResponse `json:"sources"`
+}
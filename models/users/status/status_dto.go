@@ -0,0 +1,18 @@
+package status
+
+import "time"
+
+// SuspendUserRequest Блокировка аккаунта. Без expires_at блокировка бессрочная
+type SuspendUserRequest struct {
+	Reason    string     `json:"reason" validate:"required,max=512"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type DeactivateUserRequest struct {
+	Reason string `json:"reason" validate:"max=512"`
+}
+
+// ReactivateUserRequest Возврат аккаунта в работу. expires_at - до какого момента аккаунт активен, потом он отключится сам
+type ReactivateUserRequest struct {
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}